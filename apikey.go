@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// environment variable holding the IBM Cloud API key, as used by the ibmcloud CLI
+const apiKeyEnv = "IBMCLOUD_API_KEY"
+
+// values of --auth
+const (
+	authAPIKey         = "api-key"
+	authTrustedProfile = "trusted-profile"
+	authTokenFile      = "token-file"
+)
+
+// Resolves the API key from, in order, --api-key-stdin, the deprecated --api-key flag, IBMCLOUD_API_KEY, the
+// config profile and the OS keyring. --auth-command replaces all of them, so only the explicit sources conflict with it.
+// --auth trusted-profile and --auth token-file need no key at all.
+func (o *globalOptions) resolveAPIKey(stdin io.Reader) error {
+	if o.crTokenFile != "" && o.auth != authTrustedProfile {
+		return fmt.Errorf("--cr-token-file requires --auth %s", authTrustedProfile)
+	}
+	if o.tokenFile != "" && o.auth != authTokenFile {
+		return fmt.Errorf("--token-file requires --auth %s", authTokenFile)
+	}
+	switch o.auth {
+	case authAPIKey, "":
+	case authTrustedProfile, authTokenFile:
+		if o.apiKey != "" || o.apiKeyStdin || o.authCommand != "" {
+			return fmt.Errorf("--auth %s cannot be used with --api-key, --api-key-stdin or --auth-command", o.auth)
+		}
+		if o.auth == authTokenFile && o.tokenFile == "" {
+			return fmt.Errorf("--auth %s requires --token-file", authTokenFile)
+		}
+		if o.auth == authTrustedProfile && !o.profile.IsSet() {
+			return fmt.Errorf("--auth %s requires --profile-id (or --trusted-profile-name and --trusted-profile-account)", authTrustedProfile)
+		}
+		return nil
+	default:
+		return fmt.Errorf("--auth %q: must be %s, %s or %s", o.auth, authAPIKey, authTrustedProfile, authTokenFile)
+	}
+	if o.apiKeyStdin {
+		if o.apiKey != "" {
+			return errors.New("--api-key and --api-key-stdin cannot be used together")
+		}
+		key, err := readAPIKey(stdin)
+		if err != nil {
+			return err
+		}
+		o.apiKey = key
+	} else if o.apiKey != "" {
+		logger.Warn(fmt.Sprintf("--api-key is deprecated because it exposes the key in shell history and process listings; set %s or use --api-key-stdin", apiKeyEnv))
+	}
+	if o.authCommand != "" {
+		if o.apiKey != "" {
+			return errors.New("--auth-command cannot be used with --api-key or --api-key-stdin")
+		}
+		return nil
+	}
+	if o.apiKey == "" {
+		o.apiKey = strings.TrimSpace(os.Getenv(apiKeyEnv))
+	}
+	if o.apiKey == "" && o.fileProfile != nil {
+		profile := o.fileProfile
+		o.apiKey, o.authCommand = profile.APIKey, profile.AuthCommand
+		if profile.APIKeyEnv != "" {
+			if o.apiKey = strings.TrimSpace(os.Getenv(profile.APIKeyEnv)); o.apiKey == "" {
+				return fmt.Errorf("profile %s: %s is not set", o.fileProfileName, profile.APIKeyEnv)
+			}
+		}
+	}
+	if o.apiKey == "" && o.authCommand == "" {
+		o.apiKey = lookupKeyringAPIKey(o.keyringAccount())
+	}
+	if o.apiKey == "" && o.authCommand == "" {
+		if o.apiKeySecretCRN != "" {
+			return fmt.Errorf("--apikey-secret-crn needs an identity to read the secret as: use --auth %s, --auth-command, or a separate key in %s", authTrustedProfile, apiKeyEnv)
+		}
+		return fmt.Errorf("an API key is required: set %s, pipe it to --api-key-stdin, store it with `auth login`, or use --auth-command", apiKeyEnv)
+	}
+	addSecret(o.apiKey)
+	return nil
+}
+
+// Reads the API key from the first line of r.
+func readAPIKey(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("reading API key from stdin: %w", err)
+	}
+	key := strings.TrimSpace(line)
+	if key == "" {
+		return "", errors.New("--api-key-stdin: no API key on stdin")
+	}
+	return key, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+func authCommands() []command {
+	return []command{
+		{name: "login", summary: "store an API key in the OS keyring for later commands", run: runAuthLoginCommand, flags: func(name string) *flag.FlagSet {
+			fs, _ := authLoginFlags(name)
+			return fs
+		}},
+		{name: "logout", summary: "delete the API key stored by auth login", run: runAuthLogoutCommand, flags: func(name string) *flag.FlagSet {
+			fs, _ := authLogoutFlags(name)
+			return fs
+		}},
+	}
+}
+
+// flags of `auth login`
+type authLoginOptions struct {
+	profile     string
+	verify      bool
+	iamEndpoint string
+	private     bool
+	transport   schematics.TransportOptions
+}
+
+// Builds the flag set for `auth login`.
+func authLoginFlags(name string) (*flag.FlagSet, *authLoginOptions) {
+	fs := newFlagSet(name, name+" [flags] < api-key", "Reads an IBM Cloud API key from stdin, prompting for it on a terminal, checks it with IAM and stores it "+
+		"in the OS keyring: the macOS Keychain, the Windows Credential Manager or the Secret Service (secret-tool). Later commands use it "+
+		"when no other API key or auth method is given.")
+	opts := &authLoginOptions{}
+	fs.StringVar(&opts.profile, "profile", "", "store the key for this config profile, used when the profile is selected, instead of as the default")
+	fs.BoolVar(&opts.verify, "verify", true, "exchange the key for an IAM token before storing it")
+	fs.StringVar(&opts.iamEndpoint, "iam-endpoint", "", "IAM base URL to verify the key against, e.g. https://iam.cloud.ibm.com")
+	fs.BoolVar(&opts.private, "private", false, "verify the key against the private IAM endpoint")
+	fs.StringVar(&opts.transport.CACertFile, "ca-cert", "", "PEM `file` of CA certificates to trust besides the system ones")
+	fs.BoolVar(&opts.transport.InsecureSkipVerify, "insecure-skip-verify", false, "do not verify TLS certificates (unsafe; prefer --ca-cert)")
+	return fs, opts
+}
+
+// `auth login`: stores an API key in the keyring.
+func runAuthLoginCommand(name string, args []string) {
+	fs, opts := authLoginFlags(name)
+	if rest := parseFlagsArgs(fs, args); len(rest) > 0 {
+		usageError(fs, fmt.Errorf("unexpected argument %q", rest[0]))
+	}
+	apiKey, err := promptAPIKey()
+	if err != nil {
+		fatalCode(exitInvalidInput, err)
+	}
+	addSecret(apiKey)
+	if opts.verify {
+		client := schematics.NewClient(schematics.WithUserAgent(userAgent()))
+		client.Logger = logger
+		if client.HTTPClient, err = schematics.NewHTTPClient(opts.transport); err != nil {
+			fatalCode(exitInvalidInput, err)
+		}
+		if opts.private {
+			client.IAMEndpoint = schematics.DefaultPrivateIAMEndpoint
+		}
+		if opts.iamEndpoint != "" {
+			client.IAMEndpoint = opts.iamEndpoint
+		}
+		if err := client.Authenticate(context.Background(), apiKey); err != nil {
+			fatalCode(exitAuthFailed, err)
+		}
+	}
+	account := opts.profile
+	if account == "" {
+		account = keyringDefaultAccount
+	}
+	if err := keyringSet(account, apiKey); err != nil {
+		fatal(fmt.Errorf("storing API key in the keyring: %w", err))
+	}
+	logger.Info("stored API key in the OS keyring", "entry", account)
+}
+
+// Reads the API key from stdin, prompting without echo when stdin is a terminal.
+func promptAPIKey() (string, error) {
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "IBM Cloud API key: ")
+		// best effort: without stty the key is echoed
+		noEcho := exec.Command("stty", "-echo")
+		noEcho.Stdin = os.Stdin
+		if noEcho.Run() == nil {
+			defer func() {
+				stty := exec.Command("stty", "echo")
+				stty.Stdin = os.Stdin
+				stty.Run()
+				fmt.Fprintln(os.Stderr)
+			}()
+		}
+	}
+	return readAPIKey(os.Stdin)
+}
+
+// Builds the flag set for `auth logout`.
+func authLogoutFlags(name string) (*flag.FlagSet, *string) {
+	fs := newFlagSet(name, name+" [flags]", "Deletes the API key that auth login stored in the OS keyring.")
+	profile := fs.String("profile", "", "delete the key stored for this config profile instead of the default one")
+	return fs, profile
+}
+
+// `auth logout`: deletes the stored API key.
+func runAuthLogoutCommand(name string, args []string) {
+	fs, profile := authLogoutFlags(name)
+	if rest := parseFlagsArgs(fs, args); len(rest) > 0 {
+		usageError(fs, fmt.Errorf("unexpected argument %q", rest[0]))
+	}
+	account := *profile
+	if account == "" {
+		account = keyringDefaultAccount
+	}
+	if err := keyringDelete(account); err != nil {
+		if errors.Is(err, errKeyringNotFound) {
+			logger.Info("no API key stored in the keyring", "entry", account)
+			return
+		}
+		fatal(fmt.Errorf("deleting API key from the keyring: %w", err))
+	}
+	logger.Info("deleted API key from the OS keyring", "entry", account)
+}
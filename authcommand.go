@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// Authenticates with an external credential helper, similar to kubectl exec credential plugins. The helper
+// runs again whenever the token needs renewing and there is no refresh token.
+type commandAuthenticator struct {
+	command string
+}
+
+// Runs the credential helper. The command line is split on whitespace and executed without a shell.
+// The helper must exit 0 and print either a bare access token or a JSON object on stdout:
+//
+//	{"access_token": "<token>", "refresh_token": "<optional>", "expiration": <optional unix seconds>}
+//
+// Anything written to stderr is included in the error when the helper fails.
+func (a commandAuthenticator) Token(ctx context.Context, client *schematics.Client) (schematics.Token, error) {
+	fields := strings.Fields(a.command)
+	if len(fields) == 0 {
+		return schematics.Token{}, fmt.Errorf("auth command is empty")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return schematics.Token{}, fmt.Errorf("auth command %q failed: %w", fields[0], err)
+		}
+		return schematics.Token{}, fmt.Errorf("auth command %q failed: %w: %s", fields[0], err, msg)
+	}
+
+	token, err := schematics.ParseToken(stdout.String())
+	if err != nil {
+		return token, fmt.Errorf("auth command %q output: %w", fields[0], err)
+	}
+	return token, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// values of --backend
+const (
+	backendHTTP = "http" // the client's own requests
+	backendSDK  = "sdk"  // the IBM Cloud Schematics Go SDK, in binaries built with -tags schematicssdk
+)
+
+// the --backend default; builds with the SDK default to it
+var defaultBackend = backendHTTP
+
+// builds the SDK backend for a logged-in client; nil unless the binary was built with -tags schematicssdk
+var newSDKBackend func(client *schematics.Client, o *globalOptions) (schematics.Backend, error)
+
+// Checks --backend.
+func validateBackend(backend string) error {
+	switch backend {
+	case backendHTTP:
+		return nil
+	case backendSDK:
+		if newSDKBackend == nil {
+			return fmt.Errorf("--backend %s: this binary was built without the Schematics Go SDK; rebuild it with -tags schematicssdk", backend)
+		}
+		return nil
+	}
+	return fmt.Errorf("--backend %q: must be %s or %s", backend, backendHTTP, backendSDK)
+}
+
+// Sends the client's workspace and job calls through the backend --backend selects.
+func (o *globalOptions) configureBackend(client *schematics.Client) {
+	if o.backend != backendSDK {
+		return
+	}
+	backend, err := newSDKBackend(client, o)
+	if err != nil {
+		fatalCode(exitInvalidInput, err)
+	}
+	client.Backend = backend
+	logger.Debug("sending workspace and job calls through the Schematics Go SDK")
+}
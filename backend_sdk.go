@@ -0,0 +1,26 @@
+//go:build schematicssdk
+
+package main
+
+import (
+	"github.com/IBM/go-sdk-core/v5/core"
+
+	"schematics-apply-destroy/pkg/schematics"
+	"schematics-apply-destroy/pkg/schematics/sdkbackend"
+)
+
+func init() {
+	defaultBackend = backendSDK
+	newSDKBackend = func(client *schematics.Client, o *globalOptions) (schematics.Backend, error) {
+		// a plain API key login lets the SDK's IAM authenticator manage the token; every other way of logging in
+		// keeps signing with the client's token
+		var authenticator core.Authenticator
+		if auth, ok := o.authenticator().(schematics.APIKeyAuthenticator); ok && o.apiKeySecretCRN == "" && !o.profile.IsSet() {
+			var err error
+			if authenticator, err = sdkbackend.NewIAMAuthenticator(client, auth.APIKey); err != nil {
+				return nil, err
+			}
+		}
+		return sdkbackend.New(client, authenticator)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// placeholder written to cassettes in place of credentials
+const redacted = "REDACTED"
+
+// request headers whose values are never written to a cassette
+var sensitiveHeaders = []string{"Authorization", "Refresh_token"}
+
+// form fields and JSON keys whose values are never written to a cassette
+var sensitiveFields = []string{"apikey", "access_token", "refresh_token", "api_key", "payload"}
+
+// One recorded request/response pair, stored as <dir>/NNNN.json.
+type interaction struct {
+	Request struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header"`
+		Body   string      `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		StatusCode int         `json:"status_code"`
+		Status     string      `json:"status"`
+		Header     http.Header `json:"header"`
+		Body       string      `json:"body,omitempty"`
+	} `json:"response"`
+}
+
+// http.RoundTripper that forwards to next and saves every interaction, with credentials redacted, to dir.
+type recordingTransport struct {
+	next http.RoundTripper
+	dir  string
+
+	mu    sync.Mutex
+	count int
+}
+
+// Returns a transport that records to dir, creating it if needed.
+func newRecordingTransport(dir string, next http.RoundTripper) (*recordingTransport, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating cassette directory: %w", err)
+	}
+	return &recordingTransport{next: next, dir: dir}, nil
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	var i interaction
+	i.Request.Method = req.Method
+	i.Request.URL = req.URL.String()
+	i.Request.Header = redactHeader(req.Header)
+	i.Request.Body = redactBody(reqBody)
+	i.Response.StatusCode = resp.StatusCode
+	i.Response.Status = resp.Status
+	i.Response.Header = redactHeader(resp.Header)
+	i.Response.Body = redactBody(respBody)
+
+	data, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.count++
+	name := filepath.Join(t.dir, fmt.Sprintf("%04d.json", t.count))
+	t.mu.Unlock()
+	if err := ioutil.WriteFile(name, data, 0600); err != nil {
+		return nil, fmt.Errorf("writing cassette: %w", err)
+	}
+	return resp, nil
+}
+
+// http.RoundTripper that answers requests from a recorded cassette directory, in recorded order, without any network access.
+type replayingTransport struct {
+	mu           sync.Mutex
+	interactions []interaction
+	next         int
+}
+
+// Loads every interaction in dir, ordered by file name.
+func newReplayingTransport(dir string) (*replayingTransport, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no cassettes found in %s", dir)
+	}
+	sort.Strings(names)
+
+	t := &replayingTransport{}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("reading cassette: %w", err)
+		}
+		var i interaction
+		if err := json.Unmarshal(data, &i); err != nil {
+			return nil, fmt.Errorf("parsing cassette %s: %w", name, err)
+		}
+		t.interactions = append(t.interactions, i)
+	}
+	return t, nil
+}
+
+func (t *replayingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.next >= len(t.interactions) {
+		return nil, fmt.Errorf("replay: no recorded interaction left for %s %s", req.Method, req.URL)
+	}
+	i := t.interactions[t.next]
+	if i.Request.Method != req.Method || i.Request.URL != req.URL.String() {
+		return nil, fmt.Errorf("replay: expected %s %s but got %s %s", i.Request.Method, i.Request.URL, req.Method, req.URL)
+	}
+	t.next++
+
+	return &http.Response{
+		StatusCode:    i.Response.StatusCode,
+		Status:        i.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        i.Response.Header,
+		Body:          ioutil.NopCloser(strings.NewReader(i.Response.Body)),
+		ContentLength: int64(len(i.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Returns a copy of header with credential headers replaced by a placeholder and secrets masked in the others.
+func redactHeader(header http.Header) http.Header {
+	clean := header.Clone()
+	for name, values := range clean {
+		for i, value := range values {
+			values[i] = redactString(value)
+		}
+		clean[name] = values
+	}
+	for _, name := range sensitiveHeaders {
+		if clean.Get(name) != "" {
+			clean.Set(name, redacted)
+		}
+	}
+	return clean
+}
+
+// Replaces credential values, and the values of secure variables, in a JSON or form-encoded body, then masks the
+// secrets and --redact-pattern matches redactString knows of in whatever is left.
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var value interface{}
+	if json.Unmarshal(body, &value) == nil {
+		if redactJSON(value) {
+			if data, err := json.Marshal(value); err == nil {
+				body = data
+			}
+		}
+		return redactString(string(body))
+	}
+
+	if form, err := url.ParseQuery(string(body)); err == nil {
+		changed := false
+		for _, key := range sensitiveFields {
+			if form.Get(key) != "" {
+				form.Set(key, redacted)
+				changed = true
+			}
+		}
+		if changed {
+			return redactString(form.Encode())
+		}
+	}
+	return redactString(string(body))
+}
+
+// Replaces credential fields and the values of secure variables at any depth of a decoded JSON value, such as the
+// variablestore of each template_data entry of a workspace. Reports whether anything was replaced.
+func redactJSON(value interface{}) bool {
+	changed := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sensitiveFields {
+			if _, ok := v[key]; ok {
+				v[key] = redacted
+				changed = true
+			}
+		}
+		// values of secure workspace variables
+		if store, ok := v["variablestore"].([]interface{}); ok {
+			for _, entry := range store {
+				if variable, ok := entry.(map[string]interface{}); ok && variable["secure"] == true {
+					variable["value"] = redacted
+					changed = true
+				}
+			}
+		}
+		for _, child := range v {
+			if redactJSON(child) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if redactJSON(child) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// Installs the recording or replaying transport on httpClient for --record and --replay.
+func configureCassettes(httpClient *http.Client, recordDir string, replayDir string) error {
+	switch {
+	case recordDir != "" && replayDir != "":
+		return fmt.Errorf("--record and --replay cannot be used together")
+	case recordDir != "":
+		next := httpClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		t, err := newRecordingTransport(recordDir, next)
+		if err != nil {
+			return err
+		}
+		httpClient.Transport = t
+	case replayDir != "":
+		t, err := newReplayingTransport(replayDir)
+		if err != nil {
+			return err
+		}
+		httpClient.Transport = t
+	}
+	return nil
+}
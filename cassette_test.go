@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"schematics-apply-destroy/pkg/schematics/schematicstest"
+)
+
+func TestRedactBody(t *testing.T) {
+	resetSecrets(t)
+	addSensitiveValue("s3cret-value")
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"top-level credential", `{"apikey":"k","name":"x"}`, `{"apikey":"REDACTED","name":"x"}`},
+		{"top-level secure variable", `{"variablestore":[{"name":"pw","value":"v","secure":true},{"name":"n","value":"1"}]}`,
+			`{"variablestore":[{"name":"pw","secure":true,"value":"REDACTED"},{"name":"n","value":"1"}]}`},
+		{"secure variable of a template", `{"name":"ws","template_data":[{"folder":".","variablestore":[{"name":"pw","value":"v","secure":true}]}]}`,
+			`{"name":"ws","template_data":[{"folder":".","variablestore":[{"name":"pw","secure":true,"value":"REDACTED"}]}]}`},
+		{"nested credential", `{"outer":[{"refresh_token":"r"}]}`, `{"outer":[{"refresh_token":"REDACTED"}]}`},
+		{"unchanged JSON keeps its layout", `{ "status": "ok" }`, `{ "status": "ok" }`},
+		{"sensitive value", `{"msg":"got s3cret-value back"}`, `{"msg":"got REDACTED back"}`},
+		{"form", "grant_type=apikey&apikey=k", "apikey=REDACTED&grant_type=apikey"},
+		{"text", "plain s3cret-value", "plain REDACTED"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := redactBody([]byte(test.body)); got != test.want {
+				t.Errorf("redactBody(%s)\n got  %s\n want %s", test.body, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRecordingRedactsSecrets(t *testing.T) {
+	resetSecrets(t)
+	discardLogs(t)
+	addSensitiveValue("s3cret-value")
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	dir := t.TempDir()
+	transport, err := newRecordingTransport(dir, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/workspaces", strings.NewReader(
+		`{"name":"ws","template_data":[{"variablestore":[{"name":"pw","value":"hunter2","secure":true}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Note", "s3cret-value")
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, "0001.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter2") || strings.Contains(string(data), "s3cret-value") {
+		t.Errorf("cassette holds a secret:\n%s", data)
+	}
+	var i interaction
+	if err := json.Unmarshal(data, &i); err != nil {
+		t.Fatal(err)
+	}
+	if i.Request.Header.Get("X-Note") != redacted {
+		t.Errorf("X-Note header = %q, want %s", i.Request.Header.Get("X-Note"), redacted)
+	}
+}
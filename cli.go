@@ -0,0 +1,498 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// settings shared by every command that talks to IBM Cloud
+type globalOptions struct {
+	apiKey             string
+	apiKeyStdin        bool
+	authCommand        string
+	auth               string // --auth: authAPIKey or authTrustedProfile
+	crTokenFile        string
+	tokenFile          string
+	apiKeySecretCRN    string
+	secretsEndpoint    string
+	workspaceID        string
+	workspaceIDs       workspaceIDList // every --workspace-id, for commands that accept several
+	multiWorkspace     bool            // set by commands that run against each of several workspaces
+	workspaceCRN       string
+	workspaceNames     workspaceIDList // --workspace-name, resolved to workspaceIDs by connect
+	workspaceTags      workspaceIDList // --workspace-tag, likewise
+	resourceGroup      string          // limits --workspace-name and --workspace-tag to one resource group
+	slackWebhook       string          // --slack-webhook of the action commands, or slack_webhook from the profile
+	profile            schematics.TrustedProfile
+	region             string
+	iamEndpoint        string
+	schematicsEndpoint string
+	private            bool
+	caCert             string
+	insecureSkipVerify bool
+	useCLIConfig       bool
+	record             string
+	replay             string
+	maxRuntime         time.Duration
+	timeout            time.Duration // per HTTP request
+	dnsRetries         int
+	rateLimit          float64 // requests per second
+	retry              schematics.RetryPolicy
+	tokenCache         bool
+	otlpEndpoint       string
+	backend            string // --backend: backendHTTP or backendSDK
+	correlationID      string // sent with every request of the run and logged with every line
+	commandName        string // names the run's root span
+
+	profileIDAlias  string         // --profile-id, merged into profile.ID by validate
+	profileName     string         // --profile
+	fileProfile     *runnerProfile // the loaded profile, if any
+	fileProfileName string
+}
+
+// Registers the shared flags on fs. withWorkspace adds --workspace-id and --crn for commands that act on one workspace.
+func (o *globalOptions) register(fs *flag.FlagSet, withWorkspace bool) {
+	o.commandName = fs.Name()
+	fs.StringVar(&o.apiKey, "api-key", "", "IBM Cloud API key (deprecated: visible in shell history and process listings; use "+apiKeyEnv+" or --api-key-stdin)")
+	fs.BoolVar(&o.apiKeyStdin, "api-key-stdin", false, "read the IBM Cloud API key from the first line of stdin")
+	fs.StringVar(&o.apiKeySecretCRN, "apikey-secret-crn", "", "CRN of a Secrets Manager secret (IAM credentials or arbitrary) holding the API key, read at run time as the identity the other auth flags select")
+	fs.StringVar(&o.secretsEndpoint, "secrets-manager-endpoint", "", "Secrets Manager instance URL, overriding the one derived from --apikey-secret-crn")
+	fs.StringVar(&o.authCommand, "auth-command", "", "external command that prints an IAM access token (or a JSON token object) on stdout; replaces the API key")
+	fs.StringVar(&o.auth, "auth", authAPIKey, "how to authenticate: "+authAPIKey+" (the API key or --auth-command), "+authTrustedProfile+
+		" (this pod's or VPC instance's compute resource identity exchanged for the trusted profile given by --profile-id; no API key) or "+
+		authTokenFile+" (the token in --token-file, re-read whenever it needs renewing)")
+	fs.StringVar(&o.tokenFile, "token-file", "", "file holding an IAM access token, or a JSON object with access_token, for --auth "+authTokenFile)
+	fs.StringVar(&o.profileIDAlias, "profile-id", "", "trusted profile `id` for --auth "+authTrustedProfile+"; an alias of --trusted-profile-id")
+	fs.StringVar(&o.crTokenFile, "cr-token-file", "", "compute resource token file for --auth "+authTrustedProfile+"; defaults to "+strings.Join(schematics.DefaultCRTokenFiles, " or ")+
+		", then the VPC instance metadata service")
+	if withWorkspace {
+		fs.Var(&o.workspaceIDs, "workspace-id", "Schematics workspace `id`")
+		fs.StringVar(&o.workspaceCRN, "crn", "", "Schematics workspace CRN; sets the region and replaces --workspace-id")
+		fs.Var(&o.workspaceNames, "workspace-name", "exact `name` of the Schematics workspace, looked up in the region; replaces --workspace-id")
+		if o.multiWorkspace {
+			fs.Var(&o.workspaceTags, "workspace-tag", "run against every workspace in the region carrying this `tag`, e.g. env:ephemeral; may be repeated to require several")
+		}
+		fs.StringVar(&o.resourceGroup, "resource-group", "", "resource group `id` that --workspace-name and --workspace-tag look in, leaving other groups' workspaces alone")
+	}
+	fs.StringVar(&o.profile.ID, "trusted-profile-id", "", "exchange the initial token for one acting as this trusted profile")
+	fs.StringVar(&o.profile.Name, "trusted-profile-name", "", "like --trusted-profile-id but by name; requires --trusted-profile-account")
+	fs.StringVar(&o.profile.Account, "trusted-profile-account", "", "account that owns the trusted profile")
+	fs.StringVar(&o.profileName, "profile", "", "named profile from ~/.schematics-runner.yaml (or "+runnerConfigEnv+") supplying defaults for the other flags; "+profileEnv+" also selects one")
+	fs.StringVar(&o.region, "region", "", "IBM Cloud region whose Schematics endpoint to use ("+strings.Join(schematics.Regions(), ", ")+"); defaults to "+regionEnv)
+	fs.StringVar(&o.iamEndpoint, "iam-endpoint", "", "IAM base URL, e.g. https://iam.cloud.ibm.com")
+	fs.BoolVar(&o.private, "private", false, "use the private IAM and Schematics endpoints, for hosts on the IBM Cloud private network without public egress")
+	fs.StringVar(&o.schematicsEndpoint, "schematics-endpoint", "", "Schematics base URL, overriding the region's, e.g. https://us.schematics.cloud.ibm.com")
+	fs.StringVar(&o.caCert, "ca-cert", "", "PEM `file` of CA certificates to trust besides the system ones, e.g. a TLS-intercepting proxy's; HTTPS_PROXY and NO_PROXY are honoured")
+	fs.BoolVar(&o.insecureSkipVerify, "insecure-skip-verify", false, "do not verify TLS certificates (unsafe; prefer --ca-cert)")
+	fs.StringVar(&o.otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP collector base `URL`, e.g. http://localhost:4318, to send a trace of the run's IAM and Schematics calls and job waits to; "+
+		"defaults to "+otlpTracesEndpointEnv+" or "+otlpEndpointEnv)
+	fs.BoolVar(&o.useCLIConfig, "ibmcloud-config", true, "read default region and IAM endpoint from the IBM Cloud CLI config (~/.bluemix/config.json) when present")
+	fs.StringVar(&o.record, "record", "", "save every HTTP interaction, with credentials redacted, as cassettes in this directory")
+	fs.StringVar(&o.replay, "replay", "", "answer HTTP requests from cassettes previously saved with --record instead of the network")
+	fs.DurationVar(&o.timeout, "timeout", time.Minute, "give up on a single HTTP request after this long; 0 disables the limit")
+	fs.DurationVar(&o.maxRuntime, "max-runtime", 0, "give up once the whole run has taken this long; "+deadlineEnv+" or "+deadlineSecondsEnv+" in the environment also set a deadline and the earlier one wins")
+	fs.Float64Var(&o.rateLimit, "rate-limit", 0, "send at most this many requests per second to IAM and Schematics, across every workspace of a batch; 0 disables the limit")
+	fs.IntVar(&o.dnsRetries, "dns-retries", 3, "extra attempts when a host name cannot be resolved")
+	fs.StringVar(&o.correlationID, "correlation-id", "", "`id` sent as "+schematics.CorrelationIDHeader+" on every IAM and Schematics request of the run and logged with every line; defaults to "+
+		correlationIDEnv+", else a random one")
+	fs.StringVar(&o.backend, "backend", defaultBackend, "how workspace and job calls are sent: "+backendHTTP+" (built-in requests) or "+backendSDK+
+		" (the IBM Cloud Schematics Go SDK, in binaries built with -tags schematicssdk)")
+	fs.BoolVar(&o.tokenCache, "token-cache", false, "reuse IAM tokens across runs until shortly before they expire, cached with mode 0600 in the user cache directory")
+	defaults := schematics.DefaultRetryPolicy()
+	fs.IntVar(&o.retry.MaxAttempts, "retry-attempts", defaults.MaxAttempts, "attempts per request, including the first, when IAM or Schematics answers 429 or 5xx; 1 disables retries")
+	fs.DurationVar(&o.retry.InitialBackoff, "retry-backoff", defaults.InitialBackoff, "delay before the first retry, doubled for each further one; a Retry-After header takes precedence")
+	fs.DurationVar(&o.retry.MaxBackoff, "retry-max-backoff", defaults.MaxBackoff, "upper bound on the delay between retries")
+	fs.Float64Var(&o.retry.Jitter, "retry-jitter", defaults.Jitter, "fraction (0-1) of each retry delay that is randomised")
+	fs.BoolVar(&verbose, "verbose", false, "log every request and response, raw errors and extra diagnostics")
+	fs.BoolVar(&quiet, "quiet", false, "log nothing but errors; text output prints just each job's activity id")
+	fs.BoolVar(&compactErrors, "compact-errors", false, "print errors on a single line")
+	fs.Var(&redactPatterns, "redact-pattern", "regular expression whose matches are masked in all output; may be repeated")
+}
+
+// Checks the flags, fills in the config profile and resolves the API key and --crn into a workspace id and region.
+// needWorkspace is set for commands that act on a single workspace.
+func (o *globalOptions) validate(needWorkspace bool) error {
+	if verbose && quiet {
+		return errors.New("--verbose and --quiet cannot be used together")
+	}
+	if len(o.workspaceIDs) > 1 && !o.multiWorkspace {
+		return errors.New("--workspace-id: this command acts on a single workspace")
+	}
+	if len(o.workspaceNames) > 1 && !o.multiWorkspace {
+		return errors.New("--workspace-name: this command acts on a single workspace")
+	}
+	if len(o.workspaceNames) > 0 && (o.workspaceID != "" || len(o.workspaceIDs) > 0 || o.workspaceCRN != "") {
+		return errors.New("--workspace-name cannot be used with a workspace id or --crn")
+	}
+	if len(o.workspaceTags) > 0 && (o.workspaceID != "" || len(o.workspaceIDs) > 0 || o.workspaceCRN != "" || len(o.workspaceNames) > 0) {
+		return errors.New("--workspace-tag cannot be used with a workspace id, --workspace-name or --crn")
+	}
+	if o.workspaceID == "" && len(o.workspaceIDs) > 0 {
+		o.workspaceID = o.workspaceIDs[0]
+	}
+	if o.profileIDAlias != "" {
+		if o.profile.ID != "" && o.profile.ID != o.profileIDAlias {
+			return fmt.Errorf("--profile-id %s and --trusted-profile-id %s name different trusted profiles; give one of them", o.profileIDAlias, o.profile.ID)
+		}
+		o.profile.ID = o.profileIDAlias
+	}
+	if o.rateLimit < 0 {
+		return errors.New("--rate-limit must not be negative")
+	}
+	if o.timeout < 0 {
+		return errors.New("--timeout must not be negative")
+	}
+	if o.retry.Jitter < 0 || o.retry.Jitter > 1 {
+		return errors.New("--retry-jitter must be between 0 and 1")
+	}
+	if err := validateBackend(o.backend); err != nil {
+		return err
+	}
+	// a --crn carries its own region
+	if o.region == "" && o.workspaceCRN == "" {
+		o.region = os.Getenv(regionEnv)
+	}
+	if err := o.applyProfile(); err != nil {
+		return err
+	}
+	if err := o.resolveAPIKey(os.Stdin); err != nil {
+		return err
+	}
+	if err := o.profile.Validate(); err != nil {
+		return err
+	}
+	if o.apiKeySecretCRN != "" {
+		if _, err := schematics.ParseSecretCRN(o.apiKeySecretCRN); err != nil {
+			return fmt.Errorf("--apikey-secret-crn: %w", err)
+		}
+	} else if o.secretsEndpoint != "" {
+		return errors.New("--secrets-manager-endpoint requires --apikey-secret-crn")
+	}
+	if o.workspaceCRN != "" {
+		if o.workspaceID != "" {
+			return errors.New("--workspace-id and --crn cannot be used together")
+		}
+		crnRegion, workspaceID, err := schematics.ParseWorkspaceCRN(o.workspaceCRN)
+		if err != nil {
+			return err
+		}
+		if o.region != "" && o.region != crnRegion {
+			return fmt.Errorf("--region %s conflicts with region %s from --crn", o.region, crnRegion)
+		}
+		o.region = crnRegion
+		o.workspaceID = workspaceID
+	}
+	if o.resourceGroup != "" && len(o.workspaceNames) == 0 && len(o.workspaceTags) == 0 {
+		return errors.New("--resource-group only applies to --workspace-name and --workspace-tag")
+	}
+	if needWorkspace && o.workspaceID == "" && len(o.workspaceNames) == 0 && len(o.workspaceTags) == 0 {
+		return errors.New("--workspace-id (or --crn or --workspace-name) is required")
+	}
+	if len(o.workspaceIDs) == 0 && o.workspaceID != "" {
+		o.workspaceIDs = workspaceIDList{o.workspaceID}
+	}
+	return nil
+}
+
+// Builds an authenticated client and the context the run executes under. Any failure is fatal.
+func (o *globalOptions) connect() (context.Context, *schematics.Client) {
+	o.startOperation()
+	client := schematics.NewClient(schematics.WithUserAgent(userAgent()))
+	client.DNSRetries = o.dnsRetries
+	client.Retry = o.retry
+	if o.rateLimit > 0 {
+		client.RateLimit = schematics.NewRateLimiter(o.rateLimit, 0)
+	}
+	client.Logger = logger
+	if err := configureEndpoints(client, o.useCLIConfig, o.private, o.region, o.iamEndpoint, o.schematicsEndpoint); err != nil {
+		fatalCode(exitInvalidInput, err)
+	}
+	httpClient, err := schematics.NewHTTPClient(schematics.TransportOptions{CACertFile: o.caCert, InsecureSkipVerify: o.insecureSkipVerify})
+	if err != nil {
+		fatalCode(exitInvalidInput, err)
+	}
+	if o.insecureSkipVerify {
+		logger.Warn("--insecure-skip-verify: TLS certificates are not verified, so credentials can be intercepted; prefer --ca-cert")
+	}
+	httpClient.Timeout = o.timeout
+	if url := otlpTracesURL(o.otlpEndpoint); url != "" {
+		exportClient, _ := schematics.NewHTTPClient(schematics.TransportOptions{CACertFile: o.caCert, InsecureSkipVerify: o.insecureSkipVerify})
+		exportClient.Timeout = 10 * time.Second
+		tracer = newOTLPTracer(url, exportClient)
+		httpClient.Transport = tracingTransport{base: httpClient.Transport}
+	}
+	client.HTTPClient = httpClient
+	if err := configureCassettes(client.HTTPClient, o.record, o.replay); err != nil {
+		fatalCode(exitInvalidInput, err)
+	}
+	ctx, cancel, err := configureDeadline(o.maxRuntime)
+	if err != nil {
+		fatalCode(exitInvalidInput, err)
+	}
+	atExit(cancel)
+	ctx = handleSignals(ctx)
+	ctx = schematics.WithCorrelationID(ctx, o.correlationID)
+	ctx, root := startSpan(ctx, programName()+" "+o.commandName, "correlation_id", o.correlationID)
+	atExit(func() { root.finish(nil) })
+
+	if !o.useCachedToken(client) {
+		authCtx, span := startSpan(ctx, "authenticate", "auth", o.auth)
+		if err := client.Login(authCtx, o.authenticator()); err != nil {
+			span.finish(err)
+			fatalCode(exitAuthFailed, err)
+		}
+		if o.apiKeySecretCRN != "" {
+			o.loginWithSecretAPIKey(authCtx, client)
+		}
+		o.assumeProfile(authCtx, client)
+		span.finish(nil)
+		o.storeCachedToken(client)
+	}
+	addTokenSecrets(client.Token())
+	client.OnNewToken = addTokenSecrets
+	o.configureBackend(client)
+	if len(o.workspaceNames) > 0 {
+		o.resolveWorkspaceNames(ctx, client)
+	}
+	if len(o.workspaceTags) > 0 {
+		o.resolveWorkspaceTags(ctx, client)
+	}
+	return ctx, client
+}
+
+// Replaces --workspace-name with the ids of the workspaces so named. A name matching no workspace is fatal, and so
+// is one matching several unless stdin is a terminal, where the user picks one from a numbered list.
+func (o *globalOptions) resolveWorkspaceNames(ctx context.Context, client *schematics.Client) {
+	for _, name := range o.workspaceNames {
+		ws, err := client.FindWorkspace(ctx, name, o.resourceGroup)
+		var ambiguous *schematics.AmbiguousWorkspaceError
+		if errors.As(err, &ambiguous) && isTerminal(os.Stdin) {
+			ws, err = chooseWorkspace(os.Stdin, os.Stderr, ambiguous)
+		}
+		if err != nil {
+			if errors.Is(err, schematics.ErrWorkspaceNotFound) || errors.Is(err, schematics.ErrAmbiguousWorkspace) {
+				fatalCode(exitInvalidInput, err)
+			}
+			fatal(err)
+		}
+		logger.Debug("resolved workspace name", "name", name, "id", ws.ID)
+		o.workspaceIDs = append(o.workspaceIDs, ws.ID)
+	}
+	o.workspaceID = o.workspaceIDs[0]
+}
+
+// Replaces --workspace-tag with the ids of the workspaces carrying every tag. When there are none there is nothing
+// to do, so the run exits successfully.
+func (o *globalOptions) resolveWorkspaceTags(ctx context.Context, client *schematics.Client) {
+	workspaces, err := client.FindWorkspacesByTag(ctx, o.resourceGroup, o.workspaceTags...)
+	if err != nil {
+		fatal(err)
+	}
+	if len(workspaces) == 0 {
+		logger.Info("no workspace carries the tags; nothing to do", "tags", o.workspaceTags.String())
+		exit(exitOK)
+	}
+	for _, ws := range workspaces {
+		logger.Info("selected workspace by tag", "name", ws.Name, "id", ws.ID)
+		o.workspaceIDs = append(o.workspaceIDs, ws.ID)
+	}
+	o.workspaceID = o.workspaceIDs[0]
+}
+
+// The authenticator --auth and the credential flags select.
+func (o *globalOptions) authenticator() schematics.Authenticator {
+	switch {
+	case o.auth == authTrustedProfile:
+		return schematics.TrustedProfileAuthenticator{ComputeResource: schematics.ComputeResource{TokenFile: o.crTokenFile}, Profile: o.profile}
+	case o.auth == authTokenFile:
+		return schematics.TokenFileAuthenticator{Path: o.tokenFile}
+	case o.authCommand != "":
+		return commandAuthenticator{command: o.authCommand}
+	}
+	return schematics.APIKeyAuthenticator{APIKey: o.apiKey}
+}
+
+// Reads the API key from the --apikey-secret-crn secret as the identity the client is logged in as, then logs
+// the client in with that key instead.
+func (o *globalOptions) loginWithSecretAPIKey(ctx context.Context, client *schematics.Client) {
+	crn, err := schematics.ParseSecretCRN(o.apiKeySecretCRN)
+	if err != nil {
+		fatalCode(exitInvalidInput, err)
+	}
+	endpoint := o.secretsEndpoint
+	if endpoint == "" {
+		endpoint = crn.Endpoint(o.private)
+	}
+	apiKey, err := client.GetSecretAPIKey(ctx, endpoint, crn.SecretID)
+	if err != nil {
+		fatalCode(exitAuthFailed, err)
+	}
+	addSecret(apiKey)
+	if err := client.Authenticate(ctx, apiKey); err != nil {
+		fatalCode(exitAuthFailed, err)
+	}
+	logger.Info("authenticated with the API key from Secrets Manager", "secret", crn.SecretID)
+}
+
+// Exchanges the client's token for the trusted profile's when one was requested on top of another identity.
+func (o *globalOptions) assumeProfile(ctx context.Context, client *schematics.Client) {
+	if !o.profile.IsSet() || o.auth == authTrustedProfile {
+		return
+	}
+	if err := client.AssumeTrustedProfile(ctx, o.profile); err != nil {
+		fatalCode(exitAuthFailed, err)
+	}
+}
+
+// flag.Value collecting every use of a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// flag.Value for a count that is only checked when the flag is given, so that 0 is a limit like any other
+type optionalCount struct {
+	count **int
+}
+
+func (c optionalCount) String() string {
+	if c.count == nil || *c.count == nil {
+		return ""
+	}
+	return strconv.Itoa(**c.count)
+}
+
+func (c optionalCount) Set(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%q: expected a count of 0 or more", value)
+	}
+	*c.count = &n
+	return nil
+}
+
+// flag.Value for an amount such as a cost that, like optionalCount, is only checked when the flag is given
+type optionalAmount struct {
+	amount **float64
+}
+
+func (a optionalAmount) String() string {
+	if a.amount == nil || *a.amount == nil {
+		return ""
+	}
+	return strconv.FormatFloat(**a.amount, 'f', -1, 64)
+}
+
+func (a optionalAmount) Set(value string) error {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 || math.IsNaN(n) || math.IsInf(n, 0) {
+		return fmt.Errorf("%q: expected an amount of 0 or more", value)
+	}
+	*a.amount = &n
+	return nil
+}
+
+// flag.Value collecting workspace ids from repeated flags and comma-separated lists, without duplicates
+type workspaceIDList []string
+
+func (l *workspaceIDList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *workspaceIDList) Set(value string) error {
+	for _, id := range strings.Split(value, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			return errors.New("empty workspace id")
+		}
+		duplicate := false
+		for _, seen := range *l {
+			duplicate = duplicate || seen == id
+		}
+		if !duplicate {
+			*l = append(*l, id)
+		}
+	}
+	return nil
+}
+
+// Creates the flag set for a command. Usage prints synopsis and description before the flags.
+func newFlagSet(name string, synopsis string, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: %s %s\n\n%s\n\nflags:\n", programName(), synopsis, description)
+		fs.PrintDefaults()
+		printExitCodes(out)
+	}
+	return fs
+}
+
+// Parses args into fs, exiting 0 for -h and exitInvalidInput with usage for bad flags or stray arguments.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	if rest := parseFlagsArgs(fs, args); len(rest) > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected argument %q\n", rest[0])
+		fs.Usage()
+		exit(exitInvalidInput)
+	}
+}
+
+// Like parseFlags, but returns the positional arguments instead of rejecting them.
+// Flags may follow positional arguments; everything after "--" is positional.
+func parseFlagsArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				exit(exitOK)
+			}
+			exit(exitInvalidInput)
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	applyLogLevel()
+	return positional
+}
+
+// Reports a flag validation error with the command's usage and exits exitInvalidInput.
+func usageError(fs *flag.FlagSet, err error) {
+	fmt.Fprintln(fs.Output(), formatError(err))
+	fs.Usage()
+	exit(exitInvalidInput)
+}
+
+// Name the binary was invoked as, for usage messages.
+func programName() string {
+	if len(os.Args) > 0 && os.Args[0] != "" {
+		name := os.Args[0]
+		if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+			name = name[i+1:]
+		}
+		return name
+	}
+	return "schematics-apply-destroy"
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"schematics-apply-destroy/pkg/schematics"
+	"schematics-apply-destroy/pkg/schematics/schematicstest"
+)
+
+func TestProfileIDAlias(t *testing.T) {
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+
+	code, stderr := runMain(t, srv, "job", "status", ws.ID, "--profile-id", "Profile-1", "--trusted-profile-id", "Profile-2")
+	if code != exitInvalidInput || !strings.Contains(stderr, "--profile-id Profile-1 and --trusted-profile-id Profile-2 name different trusted profiles") {
+		t.Errorf("different ids exited %d: %s", code, stderr)
+	}
+	// the alias may repeat the same id
+	if _, stderr := runMain(t, srv, "job", "status", ws.ID, "--profile-id", "Profile-1", "--trusted-profile-id", "Profile-1"); strings.Contains(stderr, "different trusted profiles") {
+		t.Errorf("the same id was refused: %s", stderr)
+	}
+}
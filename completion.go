@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// the shells `completion` writes scripts for
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// first argument the completion scripts call the binary back with, followed by the words typed so far
+const completeArg = "__complete"
+
+// One workspace remembered for completion.
+type cachedWorkspace struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Path of the workspaces `workspace list` last saw, which completion offers without calling IBM Cloud.
+func workspaceCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "schematics-apply-destroy", "workspaces.json"), nil
+}
+
+// Reads the cached workspaces, keyed by the Schematics endpoint they were listed from. A missing file is an empty cache.
+func loadWorkspaceCache(path string) (map[string][]cachedWorkspace, error) {
+	cache := map[string][]cachedWorkspace{}
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return cache, nil
+}
+
+// Replaces the cached workspaces of endpoint with workspaces. Failures are only logged with --verbose: the cache
+// is a convenience and must never fail a listing.
+func cacheWorkspaces(endpoint string, workspaces []schematics.Workspace) {
+	path, err := workspaceCachePath()
+	if err != nil {
+		logger.Debug("not caching workspaces for completion: " + err.Error())
+		return
+	}
+	cache, err := loadWorkspaceCache(path)
+	if err != nil {
+		cache = map[string][]cachedWorkspace{}
+	}
+	entries := make([]cachedWorkspace, len(workspaces))
+	for i, ws := range workspaces {
+		entries[i] = cachedWorkspace{ID: ws.ID, Name: ws.Name}
+	}
+	cache[endpoint] = entries
+	if err := saveWorkspaceCache(path, cache); err != nil {
+		logger.Debug("not caching workspaces for completion: " + err.Error())
+	}
+}
+
+// Writes the workspace cache with mode 0600. The file is replaced atomically.
+func saveWorkspaceCache(path string, cache map[string][]cachedWorkspace) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".workspaces-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// The cached workspace ids, or with names their names, of every endpoint, sorted and without duplicates.
+func cachedWorkspaceWords(names bool) []string {
+	path, err := workspaceCachePath()
+	if err != nil {
+		return nil
+	}
+	cache, err := loadWorkspaceCache(path)
+	if err != nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var words []string
+	for _, entries := range cache {
+		for _, ws := range entries {
+			word := ws.ID
+			if names {
+				word = ws.Name
+			}
+			if word != "" && !seen[word] {
+				seen[word] = true
+				words = append(words, word)
+			}
+		}
+	}
+	sort.Strings(words)
+	return words
+}
+
+// Builds the flag set for `completion`.
+func completionFlags() *flag.FlagSet {
+	return newFlagSet("completion", "completion bash|zsh|fish|powershell", "Prints a shell completion script. It completes commands and flags, "+
+		"and workspace ids and names from the workspaces the last `workspace list` printed, without calling IBM Cloud. For example:\n\n"+
+		"  bash:        source <("+programName()+" completion bash)\n"+
+		"  zsh:         source <("+programName()+" completion zsh)\n"+
+		"  fish:        "+programName()+" completion fish | source\n"+
+		"  powershell:  "+programName()+" completion powershell | Out-String | Invoke-Expression")
+}
+
+// `completion <shell>`: prints the script. The scripts call back `completion __complete <words...>` for candidates.
+func runCompletionCommand(_ string, args []string) {
+	if len(args) > 0 && args[0] == completeArg {
+		for _, word := range completeWords(args[1:]) {
+			fmt.Println(word)
+		}
+		exit(exitOK)
+	}
+	fs := completionFlags()
+	rest := parseFlagsArgs(fs, args)
+	if len(rest) != 1 {
+		usageError(fs, fmt.Errorf("expected one shell: %s", strings.Join(completionShells, ", ")))
+	}
+	if err := writeCompletionScript(os.Stdout, rest[0], programName()); err != nil {
+		usageError(fs, err)
+	}
+	exit(exitOK)
+}
+
+// Writes the completion script for shell, completing the command prog.
+func writeCompletionScript(out io.Writer, shell string, prog string) error {
+	fn := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(prog)
+	var script string
+	switch shell {
+	case "bash":
+		script = `# bash completion for PROG
+FN() {
+    local IFS=$'\n'
+    COMPREPLY=($(compgen -W "$(PROG completion __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)" -- "${COMP_WORDS[COMP_CWORD]}"))
+}
+complete -o default -F FN PROG
+`
+	case "zsh":
+		script = `#compdef PROG
+# zsh completion for PROG
+FN() {
+    local -a candidates
+    candidates=("${(@f)$(PROG completion __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    compadd -a candidates
+}
+if [ "$funcstack[1]" = "FN" ]; then
+    FN "$@"
+else
+    compdef FN PROG
+fi
+`
+	case "fish":
+		script = `# fish completion for PROG
+complete -c PROG -f -a '(PROG completion __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)'
+`
+	case "powershell":
+		script = `# PowerShell completion for PROG
+Register-ArgumentCompleter -Native -CommandName 'PROG' -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -eq '') {
+        # before 7.3, PowerShell drops empty arguments to native commands unless quoted like this
+        if ($PSVersionTable.PSVersion -lt [version]'7.3') { $words += '""' } else { $words += '' }
+    }
+    & 'PROG' completion __complete @words 2>$null | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`
+	default:
+		return fmt.Errorf("unknown shell %q: must be one of %s", shell, strings.Join(completionShells, ", "))
+	}
+	_, err := io.WriteString(out, strings.NewReplacer("PROG", prog, "FN", fn).Replace(script))
+	return err
+}
+
+// The candidates for the last of words, the one being typed, given the words before it: command and subcommand
+// names, flags, shells for `completion`, and cached workspace ids and names for --workspace-id, --workspace-name
+// and a command's positional workspace id.
+func completeWords(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current, before := words[len(words)-1], words[:len(words)-1]
+
+	cmds, path := commands, []string{}
+	var cmd command
+	i := 0
+	for ; i < len(before); i++ {
+		found, ok := findCommand(cmds, before[i])
+		if !ok && len(path) == 0 && strings.Contains(before[i], ",") {
+			// a chained action list such as apply,destroy takes the action flags
+			found, ok = command{name: before[i], flags: actionFlagSet}, true
+		}
+		if !ok {
+			return nil
+		}
+		cmd, path = found, append(path, found.name)
+		if found.subcommands == nil {
+			i++
+			break
+		}
+		cmds = found.subcommands
+	}
+	if len(path) == 0 || cmd.subcommands != nil {
+		return matching(commandNames(cmds), current)
+	}
+	if cmd.name == "completion" {
+		return matching(completionShells, current)
+	}
+	if cmd.name == "help" {
+		return matching(commandNames(commands), current)
+	}
+	if cmd.flags == nil {
+		return nil
+	}
+	fs := cmd.flags(cmd.name)
+
+	// the flag before current takes it as its value unless it's a boolean one
+	positional := 0
+	for j := i; j < len(before); j++ {
+		word := before[j]
+		if !strings.HasPrefix(word, "-") || word == "-" {
+			positional++
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(word, "-"), "=")
+		f := fs.Lookup(name)
+		if f == nil || hasValue || isBoolFlag(f) {
+			continue
+		}
+		if j == len(before)-1 {
+			switch name {
+			case "workspace-id":
+				return matching(cachedWorkspaceWords(false), current)
+			case "workspace-name":
+				return matching(cachedWorkspaceWords(true), current)
+			}
+			return nil
+		}
+		j++ // skip the value
+	}
+	if strings.HasPrefix(current, "-") {
+		var flags []string
+		fs.VisitAll(func(f *flag.Flag) {
+			flags = append(flags, "--"+f.Name)
+		})
+		return matching(flags, current)
+	}
+	if positional == 0 && fs.Lookup("workspace-id") != nil && takesWorkspaceArg(path) {
+		return matching(cachedWorkspaceWords(false), current)
+	}
+	return nil
+}
+
+// Reports whether the command at path takes a workspace id as its first argument. The actions and `vars` only
+// take --workspace-id.
+func takesWorkspaceArg(path []string) bool {
+	return !supportedActions[path[0]] && !strings.Contains(path[0], ",") && path[0] != "vars"
+}
+
+// Reports whether f is set without a value, like --wait.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// The names of cmds, in order.
+func commandNames(cmds []command) []string {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.name
+	}
+	return names
+}
+
+// The candidates that start with prefix.
+func matching(candidates []string, prefix string) []string {
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
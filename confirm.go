@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// Asks question on stderr and reads a yes/no answer from stdin. Anything but "y" or "yes" declines.
+// Without a terminal on stdin nobody can answer, so it fails and tells the caller which flag skips the prompt.
+func confirm(question string, skipFlag string) (bool, error) {
+	if err := requireTerminal(question, skipFlag); err != nil {
+		return false, err
+	}
+	return readConfirmation(os.Stdin, os.Stderr, question)
+}
+
+// Like confirm, but the answer must be expected, typically the name of what is about to be destroyed,
+// so a reflexive "y" is not enough.
+func confirmTyped(question string, expected string, skipFlag string) (bool, error) {
+	if err := requireTerminal(question, skipFlag); err != nil {
+		return false, err
+	}
+	return readTypedConfirmation(os.Stdin, os.Stderr, question, expected)
+}
+
+func requireTerminal(question string, skipFlag string) error {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("%s: stdin is not a terminal; pass %s to confirm", question, skipFlag)
+	}
+	return nil
+}
+
+// Prompts on out and reads the answer from in.
+func readConfirmation(in io.Reader, out io.Writer, question string) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// Prompts on out for expected and reports whether in answered with exactly that.
+func readTypedConfirmation(in io.Reader, out io.Writer, question string, expected string) (bool, error) {
+	fmt.Fprintf(out, "%s\nType %q to confirm: ", question, expected)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	return strings.TrimSpace(answer) == expected, nil
+}
+
+// Lists the workspaces sharing a name on out, numbered with their id, region and status, and reads the number of
+// the one to use from in. A wrong answer is asked again; no answer fails with the original error.
+func chooseWorkspace(in io.Reader, out io.Writer, ambiguous *schematics.AmbiguousWorkspaceError) (schematics.Workspace, error) {
+	fmt.Fprintf(out, "Several workspaces are named %q:\n", ambiguous.Name)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tID\tREGION\tSTATUS")
+	for i, ws := range ambiguous.Matches {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, ws.ID, orDash(ws.Location), orDash(ws.Status))
+	}
+	w.Flush()
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "Number of the workspace to use (1-%d): ", len(ambiguous.Matches))
+		answer, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return schematics.Workspace{}, err
+		}
+		answer = strings.TrimSpace(answer)
+		if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= len(ambiguous.Matches) {
+			return ambiguous.Matches[n-1], nil
+		}
+		if err != nil {
+			fmt.Fprintln(out)
+			return schematics.Workspace{}, ambiguous
+		}
+		if answer != "" {
+			fmt.Fprintf(out, "no workspace %q\n", answer)
+		}
+	}
+}
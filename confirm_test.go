@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+func TestChooseWorkspace(t *testing.T) {
+	ambiguous := &schematics.AmbiguousWorkspaceError{Name: "demo", Matches: []schematics.Workspace{
+		{ID: "us-south.workspace.demo.1", Name: "demo", Location: "us-south", Status: "ACTIVE"},
+		{ID: "eu-de.workspace.demo.2", Name: "demo", Location: "eu-de", Status: "FAILED"},
+	}}
+	tests := []struct {
+		name   string
+		answer string
+		want   string // the id chosen, or "" for the error
+	}{
+		{"first", "1\n", "us-south.workspace.demo.1"},
+		{"second without a newline", "2", "eu-de.workspace.demo.2"},
+		{"asked again", "3\n\nx\n 2 \n", "eu-de.workspace.demo.2"},
+		{"no answer", "", ""},
+		{"no valid answer", "0\n9", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			ws, err := chooseWorkspace(strings.NewReader(test.answer), &out, ambiguous)
+			if test.want == "" {
+				if !errors.Is(err, schematics.ErrAmbiguousWorkspace) {
+					t.Errorf("error = %v, want the ambiguous name", err)
+				}
+				return
+			}
+			if err != nil || ws.ID != test.want {
+				t.Errorf("chose %q, %v; want %q", ws.ID, err, test.want)
+			}
+			for _, line := range []string{`Several workspaces are named "demo":`, "1  us-south.workspace.demo.1  us-south  ACTIVE", "2  eu-de.workspace.demo.2     eu-de     FAILED"} {
+				if !strings.Contains(out.String(), line) {
+					t.Errorf("output lacks %q:\n%s", line, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// environment variable an orchestrator can hand its own correlation id down in
+const correlationIDEnv = "SCHEMATICS_CORRELATION_ID"
+
+// the longest correlation id taken from --correlation-id, the environment or an API request
+const maxCorrelationIDLength = 128
+
+// the run's correlation id once startOperation picked it
+var runCorrelationID string
+
+// Picks the run's correlation id, from --correlation-id, $SCHEMATICS_CORRELATION_ID or at random, and adds it to
+// every line logger prints from here on. Later calls keep the first id.
+func (o *globalOptions) startOperation() {
+	if runCorrelationID != "" {
+		o.correlationID = runCorrelationID
+		return
+	}
+	if o.correlationID == "" {
+		o.correlationID = os.Getenv(correlationIDEnv)
+	}
+	if !validCorrelationID(o.correlationID) {
+		if o.correlationID != "" {
+			logger.Warn("ignoring the correlation id: it must be 1 to 128 printable ASCII characters without spaces")
+		}
+		o.correlationID = schematics.NewCorrelationID()
+	}
+	runCorrelationID = o.correlationID
+	logger = logger.With("correlation_id", o.correlationID)
+}
+
+// Reports whether id can be sent as a header value and logged on one line.
+func validCorrelationID(id string) bool {
+	if id == "" || len(id) > maxCorrelationIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
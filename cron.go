@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A parsed five-field cron expression: minute, hour, day of month, month and day of week.
+type cronSchedule struct {
+	minute, hour, dom, month, dow []bool
+	// whether the day-of-month and day-of-week fields were restricted; when both are, a day matching either runs,
+	// as in cron(8)
+	domSet, dowSet bool
+}
+
+// the allowed range of each field, in order
+var cronFields = []struct {
+	name     string
+	min, max int
+	names    []string // names for min, min+1, ...
+}{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is Sunday too
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// shorthands for common schedules
+var cronAliases = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parses a cron expression such as "0 8 * * mon-fri" or "*/15 9-17 * * 1-5". Each field is *, a number or name,
+// a range a-b, any of those followed by /step, or a comma-separated list of them. The @daily family of aliases is
+// accepted too.
+func parseCron(expr string) (*cronSchedule, error) {
+	expanded := strings.TrimSpace(expr)
+	if alias, ok := cronAliases[strings.ToLower(expanded)]; ok {
+		expanded = alias
+	}
+	fields := strings.Fields(expanded)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q: expected 5 fields (minute hour day-of-month month day-of-week), got %d", expr, len(fields))
+	}
+	sets := make([][]bool, len(fields))
+	for i, field := range fields {
+		set, err := parseCronField(field, i)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %s: %w", expr, cronFields[i].name, err)
+		}
+		sets[i] = set
+	}
+	// Sunday may be given as 0 or 7
+	sets[4][0] = sets[4][0] || sets[4][7]
+	return &cronSchedule{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domSet: fields[2] != "*", dowSet: fields[4] != "*",
+	}, nil
+}
+
+// Parses field number i into the set of values it matches, indexed by value.
+func parseCronField(field string, i int) ([]bool, error) {
+	spec := cronFields[i]
+	set := make([]bool, spec.max+1)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+		low, high := spec.min, spec.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = cronValue(a, i); err != nil {
+				return nil, err
+			}
+			if high, err = cronValue(b, i); err != nil {
+				return nil, err
+			}
+			if low > high {
+				return nil, fmt.Errorf("range %q runs backwards", rangePart)
+			}
+		default:
+			v, err := cronValue(rangePart, i)
+			if err != nil {
+				return nil, err
+			}
+			low = v
+			if !hasStep {
+				high = v
+			}
+		}
+		for v := low; v <= high; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// A single number or name in field number i.
+func cronValue(s string, i int) (int, error) {
+	spec := cronFields[i]
+	for n, name := range spec.names {
+		if strings.EqualFold(s, name) {
+			return spec.min + n, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < spec.min || v > spec.max {
+		return 0, fmt.Errorf("%d is outside %d-%d", v, spec.min, spec.max)
+	}
+	return v, nil
+}
+
+// Reports whether the schedule runs on t's day.
+func (c *cronSchedule) matchesDay(t time.Time) bool {
+	dom, dow := c.dom[t.Day()], c.dow[int(t.Weekday())]
+	if c.domSet && c.dowSet {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// The first minute after t that the schedule runs at, in t's location, or the zero time if it never runs within
+// the next five years, e.g. for 30 February. Times are wall-clock times: one the clock skips when daylight saving
+// time starts never comes, and one it repeats when daylight saving time ends comes once.
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = cronTime(t, t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !c.month[int(t.Month())]:
+			t = cronTime(t, t.Year(), t.Month()+1, 1, 0, 0)
+		case !c.matchesDay(t):
+			t = cronTime(t, t.Year(), t.Month(), t.Day()+1, 0, 0)
+		case !c.hour[t.Hour()]:
+			t = cronTime(t, t.Year(), t.Month(), t.Day(), t.Hour()+1, 0)
+		case !c.minute[t.Minute()]:
+			// by the wall clock, so the hour repeated at the end of daylight saving time isn't run through again
+			t = cronTime(t, t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// The wall-clock time in after's location that comes after it. time.Date places a time in the gap daylight saving
+// time skips before the gap, and a repeated time at its first occurrence; either may be no later than after, which
+// would keep next where it was, so such a time is moved on by the size of the change.
+func cronTime(after time.Time, year int, month time.Month, day int, hour int, minute int) time.Time {
+	t := time.Date(year, month, day, hour, minute, 0, 0, after.Location())
+	if t.After(after) {
+		return t
+	}
+	_, offset := t.Zone()
+	_, later := t.Add(3 * time.Hour).Zone()
+	shift := time.Duration(later-offset) * time.Second
+	if shift < 0 {
+		shift = -shift
+	}
+	return t.Add(shift)
+}
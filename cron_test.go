@@ -0,0 +1,197 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// The values set in a parsed field, e.g. [0 15 30 45].
+func cronValues(set []bool) []int {
+	var values []int
+	for v, ok := range set {
+		if ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func TestParseCronFields(t *testing.T) {
+	tests := []struct {
+		field string
+		i     int
+		want  []int
+	}{
+		{"*", 1, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23}},
+		{"5", 0, []int{5}},
+		{"*/15", 0, []int{0, 15, 30, 45}},
+		{"5/20", 0, []int{5, 25, 45}},
+		{"9-17", 1, []int{9, 10, 11, 12, 13, 14, 15, 16, 17}},
+		{"9-17/4", 1, []int{9, 13, 17}},
+		{"1,15,31", 2, []int{1, 15, 31}},
+		{"1-3,10-11", 2, []int{1, 2, 3, 10, 11}},
+		{"*/5", 2, []int{1, 6, 11, 16, 21, 26, 31}},
+		{"jan,Mar,DEC", 3, []int{1, 3, 12}},
+		{"jun-aug", 3, []int{6, 7, 8}},
+		{"mon-fri", 4, []int{1, 2, 3, 4, 5}},
+		{"sat-sun", 4, nil},
+		{"fri-7", 4, []int{5, 6, 7}},
+	}
+	for _, test := range tests {
+		set, err := parseCronField(test.field, test.i)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("%s %q parsed as %v, want an error", cronFields[test.i].name, test.field, cronValues(set))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %q: %v", cronFields[test.i].name, test.field, err)
+			continue
+		}
+		if got := cronValues(set); !equalInts(got, test.want) {
+			t.Errorf("%s %q = %v, want %v", cronFields[test.i].name, test.field, got, test.want)
+		}
+	}
+}
+
+func equalInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseCron(t *testing.T) {
+	schedule, err := parseCron("@weekly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(cronValues(schedule.dow), []int{0}) || schedule.domSet || !schedule.dowSet {
+		t.Errorf("@weekly: dow %v, domSet %v, dowSet %v", cronValues(schedule.dow), schedule.domSet, schedule.dowSet)
+	}
+	// 7 is Sunday as well
+	if schedule, err = parseCron("0 0 * * 7"); err != nil || !schedule.dow[0] {
+		t.Errorf("day of week 7: %v, %v", schedule, err)
+	}
+
+	errors := []struct {
+		expr string
+		want string
+	}{
+		{"", "expected 5 fields"},
+		{"* * * *", "expected 5 fields"},
+		{"* * * * * *", "expected 5 fields"},
+		{"@reboot", "expected 5 fields"},
+		{"60 * * * *", "minute: 60 is outside 0-59"},
+		{"* 24 * * *", "hour: 24 is outside 0-23"},
+		{"* * 0 * *", "day of month: 0 is outside 1-31"},
+		{"* * * 13 *", "month: 13 is outside 1-12"},
+		{"* * * * 8", "day of week: 8 is outside 0-7"},
+		{"*/0 * * * *", `minute: invalid step "0"`},
+		{"*/x * * * *", `minute: invalid step "x"`},
+		{"* 17-9 * * *", `hour: range "17-9" runs backwards`},
+		{"* * * foo *", `month: invalid value "foo"`},
+		{"* * * * mon-", `day of week: invalid value ""`},
+		{"1,,2 * * * *", `minute: invalid value ""`},
+	}
+	for _, test := range errors {
+		if _, err := parseCron(test.expr); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("parseCron(%q) error = %v, want %q", test.expr, err, test.want)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(loc *time.Location, value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	tests := []struct {
+		name string
+		expr string
+		loc  *time.Location
+		from string
+		want []string
+	}{
+		{"next minute", "* * * * *", time.UTC, "2024-03-01 10:00", []string{"2024-03-01 10:01", "2024-03-01 10:02"}},
+		{"seconds dropped", "*/15 * * * *", time.UTC, "2024-03-01 10:14", []string{"2024-03-01 10:15", "2024-03-01 10:30"}},
+		{"weekdays", "0 8 * * mon-fri", time.UTC, "2024-03-01 09:00", []string{"2024-03-04 08:00", "2024-03-05 08:00"}},
+		{"end of month", "30 23 31 * *", time.UTC, "2024-01-31 23:30", []string{"2024-03-31 23:30", "2024-05-31 23:30"}},
+		{"leap day", "0 0 29 2 *", time.UTC, "2024-03-01 00:00", []string{"2028-02-29 00:00"}},
+		{"new year", "0 0 1 1 *", time.UTC, "2024-12-31 23:59", []string{"2025-01-01 00:00", "2026-01-01 00:00"}},
+		{"first of month", "@monthly", time.UTC, "2024-01-31 12:00", []string{"2024-02-01 00:00", "2024-03-01 00:00"}},
+		// with both day fields set a day matching either runs: the 13th, and every Friday
+		{"day of month or week", "0 12 13 * fri", time.UTC, "2024-09-10 00:00", []string{"2024-09-13 12:00", "2024-09-20 12:00", "2024-09-27 12:00", "2024-10-04 12:00", "2024-10-11 12:00", "2024-10-13 12:00"}},
+		// a step on the day of month restricts it, so the OR applies
+		{"stepped day or week", "0 0 */10 * mon", time.UTC, "2024-04-01 00:00", []string{"2024-04-08 00:00", "2024-04-11 00:00", "2024-04-15 00:00"}},
+		// day of week restricted alone: both must match
+		{"day of week only", "0 0 * 2 sun", time.UTC, "2024-01-01 00:00", []string{"2024-02-04 00:00", "2024-02-11 00:00"}},
+		{"local time", "0 9 * * *", newYork, "2024-07-01 09:00", []string{"2024-07-02 09:00"}},
+		// 2:30 doesn't exist on 10 March 2024 in New York
+		{"skipped by DST", "30 2 * * *", newYork, "2024-03-09 03:00", []string{"2024-03-11 02:30"}},
+		{"hourly across DST start", "0 * * * *", newYork, "2024-03-10 00:30", []string{"2024-03-10 01:00", "2024-03-10 03:00", "2024-03-10 04:00"}},
+		// 1:30 happens twice on 3 November 2024 in New York
+		{"repeated by DST", "30 1 * * *", newYork, "2024-11-03 00:00", []string{"2024-11-03 01:30", "2024-11-04 01:30"}},
+		{"daily across DST end", "0 9 * * *", newYork, "2024-11-02 12:00", []string{"2024-11-03 09:00", "2024-11-04 09:00"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := parseCron(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := at(test.loc, test.from).Add(59 * time.Second)
+			for _, want := range test.want {
+				next := schedule.next(from)
+				if got := next.Format("2006-01-02 15:04"); got != want {
+					t.Fatalf("next after %s = %s, want %s", from.Format("2006-01-02 15:04 MST"), next.Format("2006-01-02 15:04 MST"), want)
+				}
+				from = next
+			}
+		})
+	}
+
+	never, err := parseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := never.next(at(time.UTC, "2024-01-01 00:00")); !next.IsZero() {
+		t.Errorf("30 February runs at %s, want never", next)
+	}
+}
+
+func TestCronNextRepeatedHourRunsOnce(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule, err := parseCron("*/20 1 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2024, 11, 3, 0, 59, 0, 0, newYork)
+	var got []string
+	for i := 0; i < 4; i++ {
+		from = schedule.next(from)
+		got = append(got, from.Format("01-02 15:04 MST"))
+	}
+	want := []string{"11-03 01:00 EDT", "11-03 01:20 EDT", "11-03 01:40 EDT", "11-04 01:00 EST"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("runs = %v, want %v", got, want)
+	}
+}
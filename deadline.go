@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// environment variables an orchestrator can set to hand down its deadline
+const (
+	deadlineEnv        = "SCHEMATICS_DEADLINE"         // absolute, RFC 3339, e.g. 2024-01-02T15:04:05Z
+	deadlineSecondsEnv = "SCHEMATICS_DEADLINE_SECONDS" // remaining budget in seconds from process start
+)
+
+// Reads the orchestrator deadline from the environment. ok is false when neither variable is set.
+// SCHEMATICS_DEADLINE takes precedence over SCHEMATICS_DEADLINE_SECONDS when both are present.
+func deadlineFromEnv(now time.Time) (deadline time.Time, ok bool, err error) {
+	if value := os.Getenv(deadlineEnv); value != "" {
+		deadline, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("%s must be an RFC 3339 timestamp: %w", deadlineEnv, err)
+		}
+		return deadline, true, nil
+	}
+	if value := os.Getenv(deadlineSecondsEnv); value != "" {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("%s must be a number of seconds: %w", deadlineSecondsEnv, err)
+		}
+		return now.Add(time.Duration(seconds * float64(time.Second))), true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+// Returns the context every request and wait runs under, with its deadline taken from the environment and --max-runtime.
+// When both are given the earlier one wins, so the tool never outlives either its own budget or the orchestrator's.
+// With neither, the run has no deadline. The returned cancel func releases the context's resources.
+func configureDeadline(maxRuntime time.Duration) (context.Context, context.CancelFunc, error) {
+	now := time.Now()
+	deadline, ok, err := deadlineFromEnv(now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if maxRuntime > 0 && (!ok || now.Add(maxRuntime).Before(deadline)) {
+		deadline, ok = now.Add(maxRuntime), true
+	}
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		return ctx, cancel, nil
+	}
+	if !deadline.After(now) {
+		return nil, nil, fmt.Errorf("deadline %s has already passed", deadline.Format(time.RFC3339))
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	return ctx, cancel, nil
+}
+
+// Waits for d, returning early with the context error if ctx ends first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// the report `drift` prints
+type driftReport struct {
+	WorkspaceID     string                      `json:"workspace_id"`
+	RefreshActivity string                      `json:"refresh_activity_id"`
+	PlanActivity    string                      `json:"plan_activity_id"`
+	Drifted         bool                        `json:"drifted"`
+	Resources       []schematics.ResourceChange `json:"resources"`
+	// what an apply would now change, drift included
+	Plan *schematics.PlanSummary `json:"plan"`
+}
+
+// flags of `drift`
+type driftOptions struct {
+	output       string
+	pollInterval time.Duration
+	jobTimeout   time.Duration
+}
+
+// Builds the flag set for `drift`.
+func driftFlags(name string) (*flag.FlagSet, *globalOptions, *driftOptions) {
+	fs := newFlagSet(name, name+" <workspace-id> [flags]", "Runs a refresh and then a plan against a Schematics workspace, waits for both, and reports the resources "+
+		"that changed outside of Terraform. The id may also be given with --workspace-id or --crn. Exits "+fmt.Sprint(exitChangesPending)+" when anything drifted.")
+	global := &globalOptions{}
+	global.register(fs, true)
+	opts := &driftOptions{}
+	fs.StringVar(&opts.output, "output", outputText, "output format: text, or json for a report object")
+	fs.DurationVar(&opts.pollInterval, "poll-interval", 10*time.Second, "how often to check the job status")
+	fs.DurationVar(&opts.jobTimeout, "job-timeout", 0, "stop waiting for the refresh or the plan after this long and fail; 0 waits as long as --max-runtime allows")
+	return fs, global, opts
+}
+
+// `drift <id>`: refreshes, plans and reports drifted resources.
+func runDriftCommand(name string, args []string) {
+	fs, global, opts := driftFlags(name)
+	switch rest := parseFlagsArgs(fs, args); len(rest) {
+	case 0:
+	case 1:
+		global.workspaceID = rest[0]
+	default:
+		usageError(fs, fmt.Errorf("unexpected argument %q", rest[1]))
+	}
+	if opts.output != outputText && opts.output != outputJSON {
+		usageError(fs, fmt.Errorf("--output %q: must be %s or %s", opts.output, outputText, outputJSON))
+	}
+	if err := global.validate(true); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	results := runSteps(ctx, client, []string{"refresh", "plan"}, global.workspaceID, stepOptions{
+		Wait:                true,
+		PollInterval:        opts.pollInterval,
+		JobTimeout:          opts.jobTimeout,
+		WaitForReadyTimeout: 30 * time.Minute,
+	})
+	if len(results) < 2 || results[0].failed() || results[1].failed() {
+		exit(exitCodeFor(results))
+	}
+	plan := results[1].Plan
+	if plan == nil {
+		logger.Error("cannot tell what drifted: no plan summary", "activity", results[1].ActivityID)
+		exit(exitFailed)
+	}
+	report := driftReport{
+		WorkspaceID:     global.workspaceID,
+		RefreshActivity: results[0].ActivityID,
+		PlanActivity:    results[1].ActivityID,
+		Drifted:         len(plan.Drift) > 0,
+		Resources:       plan.Drift,
+		Plan:            plan,
+	}
+	if report.Resources == nil {
+		report.Resources = []schematics.ResourceChange{}
+	}
+	if err := writeDriftReport(redactingWriter{os.Stdout}, opts.output, report); err != nil {
+		fatal(err)
+	}
+	if report.Drifted {
+		exit(exitChangesPending)
+	}
+}
+
+// Writes report as text or JSON.
+func writeDriftReport(out io.Writer, output string, report driftReport) error {
+	if output == outputJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	if !report.Drifted {
+		_, err := fmt.Fprintf(out, "%s: no drift\n", report.WorkspaceID)
+		return err
+	}
+	fmt.Fprintf(out, "%s: %d resources drifted\n", report.WorkspaceID, len(report.Resources))
+	for _, change := range report.Resources {
+		state := "changed"
+		if change.Action == "delete" {
+			state = "deleted"
+		}
+		if _, err := fmt.Fprintf(out, "  %s %s\n", change.Address, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// struct for holding the fields we use from the IBM Cloud CLI's ~/.bluemix/config.json
+type ibmcloudConfig struct {
+	Region      string `json:"Region"`
+	IAMEndpoint string `json:"IAMEndpoint"`
+}
+
+// Path of the IBM Cloud CLI config, honouring IBMCLOUD_HOME like the CLI itself does.
+func ibmcloudConfigPath() (string, error) {
+	home := os.Getenv("IBMCLOUD_HOME")
+	if home == "" {
+		var err error
+		if home, err = os.UserHomeDir(); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(home, ".bluemix", "config.json"), nil
+}
+
+// Reads the IBM Cloud CLI config. A missing file is not an error and yields an empty config.
+func loadIbmcloudConfig() (ibmcloudConfig, error) {
+	var config ibmcloudConfig
+	path, err := ibmcloudConfigPath()
+	if err != nil {
+		return config, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("reading IBM Cloud CLI config: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("parsing IBM Cloud CLI config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// environment variable selecting the Schematics region when --region is not given
+const regionEnv = "SCHEMATICS_REGION"
+
+// Sets the client's IAM and Schematics endpoints, in increasing order of precedence, from the IBM Cloud CLI config
+// (when useCLIConfig is set), then from the region, and finally from the --iam-endpoint and --schematics-endpoint flags.
+// With private set the region's private endpoints and private IAM are used instead of the public ones.
+// A CLI-targeted region without a Schematics endpoint keeps the global endpoint rather than failing.
+func configureEndpoints(client *schematics.Client, useCLIConfig bool, private bool, region string, iamOverride string, schematicsOverride string) error {
+	// region whose endpoint is in use; empty for the global one
+	endpointRegion := ""
+	if useCLIConfig {
+		config, err := loadIbmcloudConfig()
+		if err != nil {
+			return err
+		}
+		if config.IAMEndpoint != "" && !private {
+			client.IAMEndpoint = config.IAMEndpoint
+		}
+		if endpoint, err := schematics.RegionEndpoint(config.Region); err == nil {
+			client.SchematicsEndpoint = endpoint
+			endpointRegion = config.Region
+		} else if config.Region != "" {
+			logger.Debug(fmt.Sprintf("IBM Cloud CLI region %s has no Schematics endpoint, using %s", config.Region, client.SchematicsEndpoint))
+		}
+	}
+	if region != "" {
+		endpoint, err := schematics.RegionEndpoint(region)
+		if err != nil {
+			return err
+		}
+		client.SchematicsEndpoint = endpoint
+		endpointRegion = region
+	}
+	if private {
+		endpoint, err := schematics.PrivateRegionEndpoint(endpointRegion)
+		if err != nil {
+			return err
+		}
+		client.SchematicsEndpoint = endpoint
+		client.IAMEndpoint = schematics.DefaultPrivateIAMEndpoint
+	}
+	if iamOverride != "" {
+		client.IAMEndpoint = iamOverride
+	}
+	if schematicsOverride != "" {
+		client.SchematicsEndpoint = schematicsOverride
+	}
+	client.IAMEndpoint = strings.TrimSuffix(client.IAMEndpoint, "/")
+	client.SchematicsEndpoint = strings.TrimSuffix(client.SchematicsEndpoint, "/")
+	return nil
+}
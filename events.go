@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// job lifecycle events published to Event Notifications, as the suffix of the event type
+const (
+	eventSubmitted = "submitted"
+	eventStarted   = "started"
+	eventCompleted = "completed"
+	eventFailed    = "failed"
+)
+
+// prefix of the type of every event published; rules match e.g. com.ibm.cloud.schematics.job.failed
+const eventTypePrefix = "com.ibm.cloud.schematics.job."
+
+// Publishes the lifecycle of each job to an Event Notifications instance, whose rules route the events on.
+type eventPublisher struct {
+	instance schematics.EventNotificationsCRN
+	endpoint string
+	sourceID string
+}
+
+// Checks --event-notifications-crn and --event-notifications-source.
+func newEventPublisher(crn string, sourceID string, private bool) (*eventPublisher, error) {
+	instance, err := schematics.ParseEventNotificationsCRN(crn)
+	if err != nil {
+		return nil, fmt.Errorf("--event-notifications-crn: %w", err)
+	}
+	if sourceID == "" {
+		return nil, errors.New("--event-notifications-source is required with --event-notifications-crn: the id of an API source in the instance")
+	}
+	return &eventPublisher{instance: instance, endpoint: instance.Endpoint(private), sourceID: sourceID}, nil
+}
+
+// Publishes event for the job behind result. Failures are logged and never fail the run.
+func (p *eventPublisher) publish(ctx context.Context, client *schematics.Client, event string, result runResult) {
+	severity := "INFO"
+	if event == eventFailed {
+		severity = "HIGH"
+	}
+	text := fmt.Sprintf("Schematics %s of workspace %s %s", result.Action, result.WorkspaceID, event)
+	long := text
+	if result.ActivityID != "" {
+		long += " (activity " + result.ActivityID + ")"
+	}
+	if result.Error != "" {
+		long += ": " + redactString(result.Error)
+	}
+	n := schematics.Notification{
+		ID:        randomHex(16),
+		Source:    consoleURL(result.WorkspaceID),
+		SourceID:  p.sourceID,
+		Type:      eventTypePrefix + event,
+		Time:      time.Now().UTC(),
+		Severity:  severity,
+		Subject:   result.WorkspaceID,
+		ShortText: text,
+		LongText:  long,
+		Data: map[string]interface{}{
+			"workspace_id":     result.WorkspaceID,
+			"action":           result.Action,
+			"activity_id":      result.ActivityID,
+			"status":           stepStatus(result),
+			"duration_seconds": result.Duration.Seconds(),
+		},
+	}
+	if err := client.SendNotification(ctx, p.endpoint, p.instance.InstanceID, n); err != nil {
+		logger.Warn("publishing to Event Notifications failed", "event", event, "error", formatError(err))
+		return
+	}
+	logger.Debug("published to Event Notifications", "event", event, "workspace", result.WorkspaceID)
+}
+
+// The event a finished step ends its job's lifecycle with, or "" while the job is still running without --wait.
+func finalEvent(result runResult) string {
+	switch {
+	case result.Skipped:
+		return ""
+	case result.failed():
+		return eventFailed
+	case result.JobStatus == "COMPLETED":
+		return eventCompleted
+	}
+	return ""
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// exit codes, documented in --help so scripts can branch on the outcome
+const (
+	exitOK           = 0 // every action was submitted (and, with --wait, completed)
+	exitFailed       = 1 // a job or request failed
+	exitAuthFailed   = 2 // IAM rejected the credentials, or Schematics answered 401
+	exitInvalidInput = 3 // bad flags, arguments or configuration
+	// exitNetworkUnreachable (4) is defined in neterror.go
+	exitChangesPending = 5 // --dry-run found changes that an apply would make, drift found drifted resources, or a plan is outside --max-destroy or --expect-changes
+	// exitInterrupted (130) is defined in signals.go
+)
+
+// Prints the exit code table shown at the end of every usage message.
+func printExitCodes(out io.Writer) {
+	fmt.Fprintf(out, "\nexit status:\n")
+	fmt.Fprintf(out, "  %d  success\n", exitOK)
+	fmt.Fprintf(out, "  %d  job failure\n", exitFailed)
+	fmt.Fprintf(out, "  %d  authentication failure\n", exitAuthFailed)
+	fmt.Fprintf(out, "  %d  invalid input\n", exitInvalidInput)
+	fmt.Fprintf(out, "  %d  IBM Cloud unreachable\n", exitNetworkUnreachable)
+	fmt.Fprintf(out, "  %d  --dry-run found changes, drift found drifted resources, or a plan is outside --max-destroy or --expect-changes\n", exitChangesPending)
+	fmt.Fprintf(out, "  %d  interrupted by SIGINT or SIGTERM\n", exitInterrupted)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strings"
+)
+
+// set by --compact-errors; collapses printed errors onto a single line
+var compactErrors bool
+
+// Returns the message for err, joined onto one line with ": " when --compact-errors is set.
+func formatError(err error) string {
+	msg := err.Error()
+	if !compactErrors {
+		return msg
+	}
+	var segments []string
+	for _, line := range strings.Split(msg, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			segments = append(segments, line)
+		}
+	}
+	return strings.Join(segments, ": ")
+}
+
+// Prints err and exits with exitFailed. With --compact-errors the full multi-line error is still logged under --verbose.
+// Errors from requests that never reached their host get the network hint and exitNetworkUnreachable instead.
+func fatal(err error) {
+	fatalCode(exitFailed, err)
+}
+
+// Like fatal, but exits with code, e.g. exitAuthFailed for a rejected API key.
+func fatalCode(code int, err error) {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && isNetworkUnreachable(err) {
+		exitUnreachable(urlErr.URL, err)
+	}
+	if compactErrors {
+		logger.Debug(err.Error())
+	}
+	logger.Error(formatError(err))
+	exit(code)
+}
+
+// handlers run before the process exits, on both the normal and the fatal path
+var exitHandlers []func()
+
+// guards against running the exit handlers twice when a handler itself fails
+var exiting bool
+
+// Registers f to run before the process exits, e.g. to flush a report with whatever was collected so far.
+// Handlers run in reverse order of registration.
+func atExit(f func()) {
+	exitHandlers = append(exitHandlers, f)
+}
+
+// Runs the exit handlers and exits with code, or exitInterrupted after a signal. Use this instead of os.Exit so
+// partial output is never lost.
+func exit(code int) {
+	if interrupted.Load() {
+		code = exitInterrupted
+	}
+	if !exiting {
+		exiting = true
+		for i := len(exitHandlers) - 1; i >= 0; i-- {
+			exitHandlers[i]()
+		}
+	}
+	os.Exit(code)
+}
+
+// Deferred at the top of main: turns an unexpected panic into a logged fatal error so the exit handlers still run.
+// The stack trace is only printed under --verbose.
+func recoverFatal() {
+	if r := recover(); r != nil {
+		logger.Error(fmt.Sprintf("unexpected error: %v", r))
+		logger.Debug(string(debug.Stack()))
+		exit(exitFailed)
+	}
+}
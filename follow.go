@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// Tails the Terraform output of a running activity. Schematics only serves whole logs, so every poll
+// re-fetches them and prints the lines past the ones already printed.
+type logFollower struct {
+	client      *schematics.Client
+	workspaceID string
+	activityID  string
+	out         io.Writer
+
+	// number of complete lines already written to out
+	printed int
+	// the logs as last fetched
+	logs string
+}
+
+// Fetches the logs and prints any new complete lines. A trailing partial line is held back until final is set,
+// when the activity has finished and nothing more will be appended.
+// Logs are often not available for the first seconds of a run, so fetch errors are only logged with --verbose.
+func (f *logFollower) poll(ctx context.Context, final bool) {
+	logs, err := f.client.GetActivityLogs(ctx, f.workspaceID, f.activityID)
+	if err != nil {
+		logger.Debug(formatError(err))
+		return
+	}
+	if logs == "" {
+		return
+	}
+	f.logs = logs
+
+	lines := strings.Split(logs, "\n")
+	// the last element is whatever follows the final newline: empty, or a line still being written
+	pending := lines[len(lines)-1]
+	lines = lines[:len(lines)-1]
+	if final && pending != "" {
+		lines = append(lines, pending)
+	}
+	if len(lines) <= f.printed {
+		return
+	}
+	for _, line := range lines[f.printed:] {
+		fmt.Fprintln(f.out, line)
+	}
+	f.printed = len(lines)
+}
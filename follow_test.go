@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"schematics-apply-destroy/pkg/schematics"
+	"schematics-apply-destroy/pkg/schematics/schematicstest"
+)
+
+func TestLogFollower(t *testing.T) {
+	discardLogs(t)
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+	srv.SetJobOptions(schematicstest.JobOptions{Polls: 100, Logs: "Plan: 1 to add\nCreating...\nstill writ"})
+	client := srv.Client()
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, schematicstest.APIKey); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Apply(ctx, ws.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	follower := &logFollower{client: client, workspaceID: ws.ID, activityID: resp.ActivityID, out: &out}
+
+	// logs that are not there yet are retried on the next poll
+	srv.FailNext(404)
+	follower.poll(ctx, false)
+	if out.Len() != 0 {
+		t.Fatalf("printed %q while the logs were unavailable", out.String())
+	}
+
+	// a partial last line waits for the job to end, and lines are printed once
+	follower.poll(ctx, false)
+	follower.poll(ctx, false)
+	if want := "Plan: 1 to add\nCreating...\n"; out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+	follower.poll(ctx, true)
+	if want := "Plan: 1 to add\nCreating...\nstill writ\n"; out.String() != want {
+		t.Errorf("printed %q after the job ended, want %q", out.String(), want)
+	}
+}
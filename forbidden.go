@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+)
+
+// The least IAM service access role Schematics requires for each workspace action: Writer may plan and refresh,
+// only Manager may change resources, and reading a workspace, as the pre-flight checks do, takes Reader.
+var requiredSchematicsRole = map[string]string{
+	"read":    "Reader",
+	"plan":    "Writer",
+	"refresh": "Writer",
+	"apply":   "Manager",
+	"destroy": "Manager",
+}
+
+// Builds an actionable message for a 403 from Schematics, naming the IAM role the action most likely lacks.
+func forbiddenMessage(action string, schematicsWorkspaceID string, transactionID string) string {
+	role, ok := requiredSchematicsRole[action]
+	if !ok {
+		role = "Manager"
+	}
+	msg := fmt.Sprintf("permission denied: the API key's identity needs the Schematics %s service access role to %s workspace %s (and Viewer on its resource group)", role, action, schematicsWorkspaceID)
+	if transactionID != "" {
+		msg += "; transaction id " + transactionID
+	}
+	return msg
+}
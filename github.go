@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// file GitHub Actions reads a step's outputs from
+const githubOutputEnv = "GITHUB_OUTPUT"
+
+// step outputs --github-output always writes; Terraform outputs with these names are left out
+var githubReservedOutputs = []string{"activity_id", "status", "ok"}
+
+// Sets up --github-output: the job logs are folded into a group per job, and when the run ends the failed steps
+// become ::error annotations and the results are appended to $GITHUB_OUTPUT.
+func configureGitHubOutput(ctx context.Context, client *schematics.Client, path string, results *[]runResult, workspaceIDs []string, opts *stepOptions) {
+	opts.LogGroups = true
+	atExit(func() {
+		writeGitHubAnnotations(os.Stdout, *results)
+		if err := writeGitHubOutputs(ctx, client, path, *results, workspaceIDs); err != nil {
+			logger.Error(formatError(err))
+		}
+	})
+}
+
+// Prints an ::error annotation for each failed step.
+func writeGitHubAnnotations(w io.Writer, results []runResult) {
+	for _, result := range results {
+		if !result.failed() {
+			continue
+		}
+		message := result.Error
+		if message == "" {
+			message = "finished with status " + stepStatus(result)
+		}
+		message = result.WorkspaceID + ": " + message
+		fmt.Fprintf(w, "::error title=%s failed::%s\n", githubEscape(result.Action), githubEscape(redactString(message)))
+	}
+}
+
+// Appends activity_id and status of the last step, ok for the whole run and, after a successful run against a
+// single workspace that wasn't destroyed, the workspace's Terraform outputs to the file at path. Sensitive outputs
+// are masked in the job log first.
+func writeGitHubOutputs(ctx context.Context, client *schematics.Client, path string, results []runResult, workspaceIDs []string) error {
+	var b strings.Builder
+	ok := len(results) > 0
+	for _, result := range results {
+		ok = ok && !result.failed()
+	}
+	if len(results) > 0 {
+		last := results[len(results)-1]
+		writeGitHubOutput(&b, "activity_id", last.ActivityID)
+		writeGitHubOutput(&b, "status", stepStatus(last))
+	}
+	writeGitHubOutput(&b, "ok", strconv.FormatBool(ok))
+	if ok && len(workspaceIDs) == 1 && results[len(results)-1].Action != "destroy" {
+		outputs, err := client.GetOutputs(ctx, workspaceIDs[0])
+		if err != nil {
+			logger.Warn("not writing the Terraform outputs to "+githubOutputEnv, "error", formatError(err))
+		}
+		for _, output := range outputs {
+			if slices.Contains(githubReservedOutputs, output.Name) {
+				logger.Warn(fmt.Sprintf("not writing Terraform output %s to %s; the name is taken", output.Name, githubOutputEnv))
+				continue
+			}
+			value := outputString(output.Value)
+			if output.Sensitive {
+				for _, line := range strings.Split(value, "\n") {
+					if line != "" {
+						fmt.Fprintln(os.Stdout, "::add-mask::"+githubEscape(line))
+					}
+				}
+			}
+			writeGitHubOutput(&b, output.Name, value)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("writing step outputs: %w", err)
+	}
+	if _, err := io.WriteString(f, b.String()); err != nil {
+		f.Close()
+		return fmt.Errorf("writing step outputs: %w", err)
+	}
+	return f.Close()
+}
+
+// Writes name=value, or for values spanning lines the name<<DELIMITER form with a random delimiter.
+func writeGitHubOutput(b *strings.Builder, name string, value string) {
+	if !strings.ContainsAny(value, "\r\n") {
+		fmt.Fprintf(b, "%s=%s\n", name, value)
+		return
+	}
+	delimiter := "EOF_" + randomHex(16)
+	fmt.Fprintf(b, "%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter)
+}
+
+// Escapes s for the message of a workflow command, which must stay on one line.
+func githubEscape(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
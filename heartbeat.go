@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// The JSON body POSTed to --heartbeat-url while a job is waited on.
+type heartbeatPayload struct {
+	WorkspaceID string `json:"workspace_id"`
+	Action      string `json:"action"`
+	ActivityID  string `json:"activity_id"`
+	// the job status last seen, e.g. INPROGRESS
+	Status         string    `json:"status"`
+	ElapsedSeconds float64   `json:"elapsed_seconds"`
+	SentAt         time.Time `json:"sent_at"`
+}
+
+// POSTs a heartbeatPayload for each job --wait follows, at most once per interval, so a dead man's switch
+// monitor learns the run is still progressing.
+type heartbeat struct {
+	client   *http.Client // the Schematics client's, assigned after connecting
+	url      string
+	host     string // what the logs name, as webhookHost explains
+	interval time.Duration
+
+	// how long each activity had been waited on at its last heartbeat; parallel workspaces poll concurrently
+	mu   sync.Mutex
+	sent map[string]time.Duration
+}
+
+// Checks --heartbeat-url and --heartbeat-interval.
+func newHeartbeat(rawURL string, interval time.Duration) (*heartbeat, error) {
+	host, ok := webhookHost(rawURL, true)
+	if !ok {
+		return nil, fmt.Errorf("--heartbeat-url %q: must be an http or https URL", rawURL)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("--heartbeat-interval %s: must be positive", interval)
+	}
+	return &heartbeat{url: rawURL, host: host, interval: interval, sent: map[string]time.Duration{}}, nil
+}
+
+// Called at every status check of a job that has been waited on for elapsed, with its status in result.JobStatus.
+// Sends a heartbeat at the first check and then once interval has passed since the last one, until the job ends.
+// Failures are only logged and never fail the run.
+func (h *heartbeat) poll(ctx context.Context, result runResult, elapsed time.Duration) {
+	if schematics.IsTerminalStatus(result.JobStatus) {
+		return
+	}
+	h.mu.Lock()
+	last, beaten := h.sent[result.ActivityID]
+	due := !beaten || elapsed-last >= h.interval
+	if due {
+		h.sent[result.ActivityID] = elapsed
+	}
+	h.mu.Unlock()
+	if !due {
+		return
+	}
+	payload := heartbeatPayload{
+		WorkspaceID:    result.WorkspaceID,
+		Action:         result.Action,
+		ActivityID:     result.ActivityID,
+		Status:         result.JobStatus,
+		ElapsedSeconds: elapsed.Seconds(),
+		SentAt:         time.Now().UTC(),
+	}
+	// a slow monitor must not hold up the job's status checks
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := h.post(ctx, payload); err != nil {
+		logger.Warn("heartbeat failed", "host", h.host, "error", formatError(err))
+	}
+}
+
+func (h *heartbeat) post(ctx context.Context, payload heartbeatPayload) error {
+	resp, _, err := postJSON(ctx, h.client, h.url, payload, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("heartbeat endpoint answered " + resp.Status)
+	}
+	logger.Debug("sent heartbeat", "host", h.host, "action", payload.Action, "workspace", payload.WorkspaceID)
+	return nil
+}
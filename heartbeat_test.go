@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics/schematicstest"
+)
+
+func TestHeartbeat(t *testing.T) {
+	var mu sync.Mutex
+	var beats []heartbeatPayload
+	monitor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload heartbeatPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("heartbeat body: %v", err)
+		}
+		mu.Lock()
+		beats = append(beats, payload)
+		mu.Unlock()
+	}))
+	defer monitor.Close()
+
+	client, result := fakeApply(t, schematicstest.JobOptions{Polls: 5})
+	beat, err := newHeartbeat(monitor.URL, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	beat.client = monitor.Client()
+	ctx := context.Background()
+	// status checks every 30s: INPROGRESS at 0s, 30s, 60s, 90s and 120s, then COMPLETED at 150s
+	waitForJob(ctx, client, &result, stepOptions{
+		PollInterval: 30 * time.Second,
+		Clock:        schematicstest.NewClock(time.Now()),
+		OnPoll:       func(result runResult, elapsed time.Duration) { beat.poll(ctx, result, elapsed) },
+	})
+	if result.JobStatus != "COMPLETED" {
+		t.Fatalf("job status = %q, want COMPLETED", result.JobStatus)
+	}
+	var elapsed []float64
+	for _, b := range beats {
+		if b.WorkspaceID != result.WorkspaceID || b.Action != "apply" || b.ActivityID != result.ActivityID || b.Status != "INPROGRESS" {
+			t.Errorf("heartbeat = %+v, want the running apply %s", b, result.ActivityID)
+		}
+		elapsed = append(elapsed, b.ElapsedSeconds)
+	}
+	if want := []float64{0, 60, 120}; !reflect.DeepEqual(elapsed, want) {
+		t.Errorf("heartbeats at %v seconds, want %v", elapsed, want)
+	}
+}
+
+func TestHeartbeatFailureIsOnlyLogged(t *testing.T) {
+	discardLogs(t)
+	monitor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer monitor.Close()
+	beat, err := newHeartbeat(monitor.URL, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	beat.client = monitor.Client()
+	// logs a warning and returns
+	beat.poll(context.Background(), runResult{Action: "apply", ActivityID: "act-1", JobStatus: "INPROGRESS"}, 0)
+	if err := beat.post(context.Background(), heartbeatPayload{}); err == nil || err.Error() != "heartbeat endpoint answered 503 Service Unavailable" {
+		t.Errorf("post error = %v, want the 503", err)
+	}
+}
+
+func TestNewHeartbeat(t *testing.T) {
+	for _, test := range []struct {
+		url      string
+		interval time.Duration
+		ok       bool
+	}{
+		{"https://hc-ping.example/abc", time.Minute, true},
+		{"ftp://example", time.Minute, false},
+		{"example.com/ping", time.Minute, false},
+		{"https://hc-ping.example/abc", 0, false},
+	} {
+		if _, err := newHeartbeat(test.url, test.interval); (err == nil) != test.ok {
+			t.Errorf("newHeartbeat(%q, %s) error = %v, want ok %v", test.url, test.interval, err, test.ok)
+		}
+	}
+}
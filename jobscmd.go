@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// the commands under `jobs`
+func jobsCommands() []command {
+	return []command{
+		{name: "list", summary: "list the workspace's recent activities with their type, status, times and who triggered them", run: runJobsListCommand, flags: func(name string) *flag.FlagSet {
+			fs, _, _ := jobsListFlags(name)
+			return fs
+		}},
+		{name: "status", summary: "print the state of an activity, by default the running or latest one, and with --watch follow it until it finishes", run: runJobStatusCommand, flags: func(name string) *flag.FlagSet {
+			fs, _, _ := jobStatusFlags(name)
+			return fs
+		}},
+		{name: "plan", summary: "print the resource changes of a finished plan as JSON in a stable schema, for policy checks", run: runJobPlanCommand, flags: func(name string) *flag.FlagSet {
+			fs, _, _ := jobPlanFlags(name)
+			return fs
+		}},
+		{name: "cancel", summary: "stop a running activity, e.g. a hung apply", run: runJobCancelCommand, flags: func(name string) *flag.FlagSet {
+			fs, _, _ := jobCancelFlags(name)
+			return fs
+		}},
+	}
+}
+
+// flags of `jobs list`
+type jobsListOptions struct {
+	limit  int
+	output string
+}
+
+// Builds the flag set for `jobs list`.
+func jobsListFlags(name string) (*flag.FlagSet, *globalOptions, *jobsListOptions) {
+	fs := newFlagSet(name, name+" <workspace-id> [flags]", "Lists a Schematics workspace's activities, most recent first. The id may also be given with --workspace-id or --crn.")
+	global := &globalOptions{}
+	global.register(fs, true)
+	opts := &jobsListOptions{}
+	fs.IntVar(&opts.limit, "limit", 20, "show at most this many activities; 0 shows all of them")
+	fs.StringVar(&opts.output, "output", outputText, "output format: text for a table, or json")
+	return fs, global, opts
+}
+
+// `jobs list <id>`: prints the workspace's activity history as a table or JSON.
+func runJobsListCommand(name string, args []string) {
+	fs, global, opts := jobsListFlags(name)
+	switch rest := parseFlagsArgs(fs, args); len(rest) {
+	case 0:
+	case 1:
+		global.workspaceID = rest[0]
+	default:
+		usageError(fs, fmt.Errorf("unexpected argument %q", rest[1]))
+	}
+	if opts.output != outputText && opts.output != outputJSON {
+		usageError(fs, fmt.Errorf("--output %q: must be %s or %s", opts.output, outputText, outputJSON))
+	}
+	if opts.limit < 0 {
+		usageError(fs, fmt.Errorf("--limit %d: must not be negative", opts.limit))
+	}
+	if err := global.validate(true); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	activities, err := client.ListActivities(ctx, global.workspaceID)
+	if err != nil {
+		fatal(err)
+	}
+	if opts.limit > 0 && len(activities) > opts.limit {
+		activities = activities[:opts.limit]
+	}
+	out := redactingWriter{os.Stdout}
+	if opts.output == outputJSON {
+		err = writeActivitiesJSON(out, activities)
+	} else {
+		err = writeActivitiesTable(out, activities)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// Writes activities as an indented JSON array.
+func writeActivitiesJSON(out io.Writer, activities []schematics.Activity) error {
+	if activities == nil {
+		activities = []schematics.Activity{}
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(activities)
+}
+
+// Writes activities as an aligned table.
+func writeActivitiesTable(out io.Writer, activities []schematics.Activity) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTYPE\tSTATUS\tSTARTED\tENDED\tTRIGGERED BY")
+	for _, activity := range activities {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", activity.ActionID, activity.Name, activity.Status,
+			orDash(activity.StartTime()), orDash(activity.EndTime()), orDash(activity.PerformedBy))
+	}
+	return w.Flush()
+}
+
+// s, or "-" when it is empty, for table cells.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// flags of `job status`
+type jobStatusOptions struct {
+	watch        bool
+	pollInterval time.Duration
+	followLogs   bool
+	output       string
+}
+
+// Builds the flag set for `job status`.
+func jobStatusFlags(name string) (*flag.FlagSet, *globalOptions, *jobStatusOptions) {
+	fs := newFlagSet(name, name+" <workspace-id> [activity-id] [flags]", "Prints the state of an activity of a Schematics workspace: the one given, or else the running one, or else the latest. "+
+		"With --watch it checks again until the activity finishes, which re-attaches to a job after the run that submitted it was interrupted. "+
+		"The workspace id may also be given with --workspace-id or --crn.")
+	global := &globalOptions{}
+	global.register(fs, true)
+	opts := &jobStatusOptions{}
+	fs.BoolVar(&opts.watch, "watch", false, "keep checking until the activity reaches COMPLETED, FAILED or STOPPED, then exit non-zero unless it completed")
+	fs.DurationVar(&opts.pollInterval, "poll-interval", 10*time.Second, "how often --watch checks the status")
+	fs.BoolVar(&opts.followLogs, "follow-logs", false, "with --watch, print the job's Terraform output on stdout as it runs")
+	fs.StringVar(&opts.output, "output", outputText, "output format: text for a table, or json")
+	return fs, global, opts
+}
+
+// `job status <workspace-id> [activity-id]`: prints the activity, after it finished with --watch.
+func runJobStatusCommand(name string, args []string) {
+	fs, global, opts := jobStatusFlags(name)
+	var activityID string
+	switch rest := parseFlagsArgs(fs, args); len(rest) {
+	case 0:
+	case 1:
+		if len(global.workspaceIDs) == 0 && global.workspaceCRN == "" && len(global.workspaceNames) == 0 {
+			global.workspaceID = rest[0]
+		} else {
+			activityID = rest[0]
+		}
+	case 2:
+		global.workspaceID, activityID = rest[0], rest[1]
+	default:
+		usageError(fs, fmt.Errorf("unexpected argument %q", rest[2]))
+	}
+	if opts.output != outputText && opts.output != outputJSON {
+		usageError(fs, fmt.Errorf("--output %q: must be %s or %s", opts.output, outputText, outputJSON))
+	}
+	if err := global.validate(true); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	wsID := global.workspaceID
+
+	var activity schematics.Activity
+	var err error
+	if activityID != "" {
+		activity, err = client.GetActivity(ctx, wsID, activityID)
+	} else {
+		activity, err = currentActivity(ctx, client, wsID)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if opts.watch && !schematics.IsTerminalStatus(activity.Status) {
+		logger.Info("watching activity", "workspace", wsID, "activity", activity.ActionID, "status", activity.Status)
+		lastStatus := activity.Status
+		follower := &logFollower{client: client, workspaceID: wsID, activityID: activity.ActionID, out: redactingWriter{os.Stdout}}
+		activity, err = client.WaitForActivity(ctx, wsID, activity.ActionID, schematics.WaitOptions{
+			Interval: opts.pollInterval,
+			OnPoll: func(a schematics.Activity) {
+				if opts.followLogs {
+					follower.poll(ctx, schematics.IsTerminalStatus(a.Status))
+				}
+				if a.Status != lastStatus {
+					logger.Info("job status", "activity", a.ActionID, "status", a.Status)
+					lastStatus = a.Status
+				}
+			},
+		})
+		if err != nil {
+			if interrupted.Load() {
+				logger.Warn("stopped watching; the job keeps running", "workspace", wsID, "activity", activity.ActionID)
+				exit(exitInterrupted)
+			}
+			fatal(err)
+		}
+	}
+	out := redactingWriter{os.Stdout}
+	if opts.output == outputJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(activity)
+	} else {
+		err = writeActivitiesTable(out, []schematics.Activity{activity})
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if opts.watch && activity.Status != "COMPLETED" {
+		exit(exitFailed)
+	}
+	exit(exitOK)
+}
+
+// The workspace's running activity, or else its most recent one.
+func currentActivity(ctx context.Context, client *schematics.Client, schematicsWorkspaceID string) (schematics.Activity, error) {
+	activities, err := client.ListActivities(ctx, schematicsWorkspaceID)
+	if err != nil {
+		return schematics.Activity{}, err
+	}
+	if active := schematics.ActiveActivity(activities); active != nil {
+		return *active, nil
+	}
+	if len(activities) == 0 {
+		return schematics.Activity{}, fmt.Errorf("workspace %s has no activities", schematicsWorkspaceID)
+	}
+	return activities[0], nil
+}
+
+// Builds the flag set for `job plan`.
+func jobPlanFlags(name string) (*flag.FlagSet, *globalOptions, *string) {
+	fs := newFlagSet(name, name+" <workspace-id> [activity-id] [flags]", "Prints the resource changes of a finished plan activity of a Schematics workspace, the one given or else the latest plan, as JSON. "+
+		"The document keeps the same schema, version "+fmt.Sprint(schematics.PlanChangesVersion)+", whatever shape Schematics returns the plan in: the counts, then the resources to create, update, delete and replace "+
+		"and those that drifted, each with its address, type, name and module. The workspace id may also be given with --workspace-id or --crn.")
+	global := &globalOptions{}
+	global.register(fs, true)
+	out := fs.String("out", "", "write the JSON to this file instead of stdout")
+	return fs, global, out
+}
+
+// `job plan <workspace-id> [activity-id]`: prints the plan's changes as JSON.
+func runJobPlanCommand(name string, args []string) {
+	fs, global, out := jobPlanFlags(name)
+	var activityID string
+	switch rest := parseFlagsArgs(fs, args); len(rest) {
+	case 0:
+	case 1:
+		if len(global.workspaceIDs) == 0 && global.workspaceCRN == "" && len(global.workspaceNames) == 0 {
+			global.workspaceID = rest[0]
+		} else {
+			activityID = rest[0]
+		}
+	case 2:
+		global.workspaceID, activityID = rest[0], rest[1]
+	default:
+		usageError(fs, fmt.Errorf("unexpected argument %q", rest[2]))
+	}
+	if err := global.validate(true); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	changes, err := planChanges(ctx, client, global.workspaceID, activityID)
+	if err != nil {
+		fatal(err)
+	}
+	data, err := json.MarshalIndent(changes, "", "  ")
+	if err != nil {
+		fatal(err)
+	}
+	data = append(data, '\n')
+	if *out == "" {
+		if _, err := (redactingWriter{os.Stdout}).Write(data); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		fatal(fmt.Errorf("writing plan: %w", err))
+	}
+	logger.Info("wrote plan", "workspace", global.workspaceID, "activity", changes.ActivityID, "path", *out, "add", changes.Add, "change", changes.Change, "destroy", changes.Destroy)
+}
+
+// The changes of the finished plan activityID of the workspace, or of its latest plan when activityID is empty.
+func planChanges(ctx context.Context, client *schematics.Client, schematicsWorkspaceID string, activityID string) (schematics.PlanChanges, error) {
+	var activity schematics.Activity
+	if activityID != "" {
+		var err error
+		if activity, err = client.GetActivity(ctx, schematicsWorkspaceID, activityID); err != nil {
+			return schematics.PlanChanges{}, err
+		}
+		if !isPlanActivity(activity) {
+			return schematics.PlanChanges{}, fmt.Errorf("activity %s is %s, not a plan", activityID, activity.Name)
+		}
+	} else {
+		activities, err := client.ListActivities(ctx, schematicsWorkspaceID)
+		if err != nil {
+			return schematics.PlanChanges{}, err
+		}
+		found := false
+		for _, a := range activities {
+			if isPlanActivity(a) {
+				activity, found = a, true
+				break
+			}
+		}
+		if !found {
+			return schematics.PlanChanges{}, fmt.Errorf("workspace %s has no plan activities", schematicsWorkspaceID)
+		}
+	}
+	if !schematics.IsTerminalStatus(activity.Status) {
+		return schematics.PlanChanges{}, fmt.Errorf("plan %s is still %s; wait for it with `%s job status %s %s --watch`", activity.ActionID, activity.Status,
+			programName(), schematicsWorkspaceID, activity.ActionID)
+	}
+	summary, err := planSummaryFromJSON(ctx, client, activity.ActionID)
+	if err != nil {
+		return schematics.PlanChanges{}, err
+	}
+	changes := schematics.NewPlanChanges(summary)
+	changes.WorkspaceID, changes.ActivityID = schematicsWorkspaceID, activity.ActionID
+	return changes, nil
+}
+
+// Reports whether activity is a plan job, which Schematics names PLAN or WORKSPACE_PLAN.
+func isPlanActivity(activity schematics.Activity) bool {
+	name := strings.ToUpper(activity.Name)
+	return name == "PLAN" || strings.HasSuffix(name, "_PLAN")
+}
+
+// Builds the flag set for `job cancel`.
+func jobCancelFlags(name string) (*flag.FlagSet, *globalOptions, *bool) {
+	fs := newFlagSet(name, name+" <workspace-id> <activity-id> [flags]", "Stops a running activity of a Schematics workspace. The workspace id may also be given with --workspace-id or --crn, leaving just the activity id.")
+	global := &globalOptions{}
+	global.register(fs, true)
+	force := fs.Bool("force", false, "terminate the job at once instead of letting Terraform finish its current resource; the state may no longer match the resources")
+	return fs, global, force
+}
+
+// `job cancel <workspace-id> <activity-id>`: stops the activity.
+func runJobCancelCommand(name string, args []string) {
+	fs, global, force := jobCancelFlags(name)
+	var activityID string
+	switch rest := parseFlagsArgs(fs, args); len(rest) {
+	case 1:
+		activityID = rest[0]
+	case 2:
+		global.workspaceID, activityID = rest[0], rest[1]
+	case 0:
+		usageError(fs, errors.New("no activity id given"))
+	default:
+		usageError(fs, fmt.Errorf("unexpected argument %q", rest[2]))
+	}
+	if err := global.validate(true); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	if err := client.CancelActivity(ctx, global.workspaceID, activityID, *force); err != nil {
+		fatal(err)
+	}
+	logger.Info("cancelled activity", "workspace", global.workspaceID, "activity", activityID, "force", *force)
+}
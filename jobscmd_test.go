@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"schematics-apply-destroy/pkg/schematics"
+	"schematics-apply-destroy/pkg/schematics/schematicstest"
+)
+
+func TestJobCancelPositionalIDs(t *testing.T) {
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+	srv.SetJobOptions(schematicstest.JobOptions{Polls: 100})
+	client := srv.Client()
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, schematicstest.APIKey); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Apply(ctx, ws.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code, stderr := runMain(t, srv, "job", "cancel", ws.ID, resp.ActivityID); code != exitOK {
+		t.Fatalf("job cancel %s %s exited %d: %s", ws.ID, resp.ActivityID, code, stderr)
+	}
+	if activities := srv.Activities(ws.ID); len(activities) != 1 || activities[0].Status != "STOPPED" {
+		t.Errorf("activities = %+v, want the job STOPPED", activities)
+	}
+}
+
+func TestJobPlanWritesChanges(t *testing.T) {
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+	srv.SetJobOptions(schematicstest.JobOptions{PlanJSON: `{"resource_changes": [
+  {"address": "module.net.ibm_is_vpc.vpc", "module_address": "module.net", "type": "ibm_is_vpc", "name": "vpc", "change": {"actions": ["create"]}},
+  {"address": "ibm_cos_bucket.logs", "type": "ibm_cos_bucket", "name": "logs", "change": {"actions": ["delete"]}}
+]}`})
+	client := srv.Client()
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, schematicstest.APIKey); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Plan(ctx, ws.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fake finishes a job once it is polled
+	if _, err := client.GetActivity(ctx, ws.ID, resp.ActivityID); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "plan.json")
+	if code, stderr := runMain(t, srv, "job", "plan", ws.ID, "--out", out); code != exitOK {
+		t.Fatalf("job plan %s exited %d: %s", ws.ID, code, stderr)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes schematics.PlanChanges
+	if err := json.Unmarshal(data, &changes); err != nil {
+		t.Fatal(err)
+	}
+	want := schematics.PlanChanges{
+		Version:     schematics.PlanChangesVersion,
+		WorkspaceID: ws.ID,
+		ActivityID:  resp.ActivityID,
+		Add:         1,
+		Destroy:     1,
+		Create:      []schematics.PlannedResource{{Address: "module.net.ibm_is_vpc.vpc", Type: "ibm_is_vpc", Name: "vpc", Module: "module.net"}},
+		Update:      []schematics.PlannedResource{},
+		Delete:      []schematics.PlannedResource{{Address: "ibm_cos_bucket.logs", Type: "ibm_cos_bucket", Name: "logs"}},
+		Replace:     []schematics.PlannedResource{},
+		Drift:       []schematics.PlannedResource{},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("plan =\n%+v\nwant\n%+v", changes, want)
+	}
+}
+
+func TestJobPlanRejectsOtherActivities(t *testing.T) {
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+	client := srv.Client()
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, schematicstest.APIKey); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Apply(ctx, ws.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, stderr := runMain(t, srv, "job", "plan", ws.ID, resp.ActivityID)
+	if code == exitOK || !strings.Contains(stderr, "not a plan") {
+		t.Errorf("job plan of an apply exited %d: %s", code, stderr)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// service name the API keys are stored under in the OS keyring
+const keyringService = "schematics-apply-destroy"
+
+// keyring entry used when no --profile is selected
+const keyringDefaultAccount = "default"
+
+var (
+	errKeyringNotFound    = errors.New("no API key stored in the keyring")
+	errKeyringUnsupported = errors.New("no OS keyring is supported on this platform")
+)
+
+// The keyring entry for the selected config profile, or the default one.
+func (o *globalOptions) keyringAccount() string {
+	if o.fileProfileName != "" {
+		return o.fileProfileName
+	}
+	return keyringDefaultAccount
+}
+
+// Reads the API key stored by `auth login` for account. A missing entry, or a keyring that can't be reached,
+// is only logged: the caller goes on without a key.
+func lookupKeyringAPIKey(account string) string {
+	key, err := keyringGet(account)
+	if err != nil {
+		if !errors.Is(err, errKeyringNotFound) {
+			logger.Debug("keyring: " + err.Error())
+		}
+		return ""
+	}
+	logger.Debug("using the API key from the OS keyring", "entry", account)
+	return strings.TrimSpace(key)
+}
+
+// Wraps the stderr of a failed keyring tool into its error.
+func keyringToolError(tool string, err error, stderr string) error {
+	if msg := strings.TrimSpace(stderr); msg != "" {
+		return fmt.Errorf("%s failed: %w: %s", tool, err, msg)
+	}
+	return fmt.Errorf("%s failed: %w", tool, err)
+}
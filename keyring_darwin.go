@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The macOS Keychain through security(1). The key is written with `security -i`, which reads the command from
+// stdin, so it never appears in a process listing.
+
+// exit status of security(1) when the item does not exist
+const securityNotFound = 44
+
+func keyringGet(account string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("security", "find-generic-password", "-s", keyringService, "-a", account, "-w")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == securityNotFound {
+			return "", errKeyringNotFound
+		}
+		return "", keyringToolError("security find-generic-password", err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+func keyringSet(account string, secret string) error {
+	if strings.ContainsAny(secret, "\"\\\n") || strings.ContainsAny(account, "\"\\\n") {
+		return fmt.Errorf("the keychain entry cannot hold quotes, backslashes or newlines")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s \"%s\" -a \"%s\" -w \"%s\"\n", keyringService, account, secret))
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil || stderr.Len() > 0 {
+		if err == nil {
+			err = errors.New("error reported")
+		}
+		return keyringToolError("security add-generic-password", err, stderr.String())
+	}
+	return nil
+}
+
+func keyringDelete(account string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", account)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == securityNotFound {
+			return errKeyringNotFound
+		}
+		return keyringToolError("security delete-generic-password", err, stderr.String())
+	}
+	return nil
+}
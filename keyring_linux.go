@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// The Secret Service (GNOME Keyring, KWallet) through secret-tool from libsecret, which reads the secret from
+// stdin so it never appears in a process listing.
+
+func keyringGet(account string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", keyringService, "account", account)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		// secret-tool exits 1 without a message when nothing matches
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && stderr.Len() == 0 {
+			return "", errKeyringNotFound
+		}
+		return "", keyringToolError("secret-tool lookup", err, stderr.String())
+	}
+	if stdout.Len() == 0 {
+		return "", errKeyringNotFound
+	}
+	return stdout.String(), nil
+}
+
+func keyringSet(account string, secret string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "store", "--label="+keyringService+" API key ("+account+")", "service", keyringService, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return keyringToolError("secret-tool store", err, stderr.String())
+	}
+	return nil
+}
+
+func keyringDelete(account string) error {
+	if _, err := keyringGet(account); err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "clear", "service", keyringService, "account", account)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return keyringToolError("secret-tool clear", err, stderr.String())
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !darwin && !linux && !windows
+
+package main
+
+func keyringGet(account string) (string, error) {
+	return "", errKeyringUnsupported
+}
+
+func keyringSet(account string, secret string) error {
+	return errKeyringUnsupported
+}
+
+func keyringDelete(account string) error {
+	return errKeyringUnsupported
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// where Kubernetes mounts a pod's service account credentials
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// API group and version of the SchematicsWorkspace custom resource; deploy/operator/crd.yaml defines it
+const (
+	crdGroup    = "schematics.apply-destroy.io"
+	crdVersion  = "v1alpha1"
+	crdResource = "schematicsworkspaces"
+)
+
+// A minimal client of the Kubernetes API, for the one custom resource the operator reconciles.
+type kubeClient struct {
+	server    string // e.g. https://10.0.0.1:443, or http://127.0.0.1:8001 from kubectl proxy
+	tokenFile string // re-read for every request, since projected service account tokens rotate; none when empty
+	http      *http.Client
+}
+
+// Connects to server with the token in tokenFile, trusting caCert. With no server, uses the service account of the
+// pod the operator runs in.
+func newKubeClient(server string, tokenFile string, caCert string) (*kubeClient, error) {
+	if server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("not running in a Kubernetes pod; pass --kube-api-server, e.g. http://127.0.0.1:8001 from `kubectl proxy`")
+		}
+		server = "https://" + net.JoinHostPort(host, port)
+		if tokenFile == "" {
+			tokenFile = serviceAccountDir + "/token"
+		}
+		if caCert == "" {
+			caCert = serviceAccountDir + "/ca.crt"
+		}
+	}
+	httpClient, err := schematics.NewHTTPClient(schematics.TransportOptions{CACertFile: caCert})
+	if err != nil {
+		return nil, fmt.Errorf("--kube-ca-cert: %w", err)
+	}
+	return &kubeClient{server: strings.TrimSuffix(server, "/"), tokenFile: tokenFile, http: httpClient}, nil
+}
+
+// The name of the namespace the operator's pod runs in, or "" outside a pod.
+func podNamespace() string {
+	data, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// A SchematicsWorkspace: one Schematics workspace and the state it should be in.
+type schematicsWorkspaceResource struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		Generation      int64  `json:"generation"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Spec   schematicsWorkspaceSpec   `json:"spec"`
+	Status schematicsWorkspaceStatus `json:"status"`
+}
+
+type schematicsWorkspaceSpec struct {
+	// existing workspace to drive; when empty, Template creates one
+	WorkspaceID string `json:"workspaceID,omitempty"`
+	Template    *struct {
+		Repo             string `json:"repo"`
+		Branch           string `json:"branch,omitempty"`
+		Folder           string `json:"folder,omitempty"`
+		TerraformVersion string `json:"terraformVersion,omitempty"`
+		// workspace name; the resource's name when empty
+		Name          string   `json:"name,omitempty"`
+		ResourceGroup string   `json:"resourceGroup,omitempty"`
+		Location      string   `json:"location,omitempty"`
+		Tags          []string `json:"tags,omitempty"`
+	} `json:"template,omitempty"`
+	// Applied or Destroyed
+	State string `json:"state"`
+	// Terraform variables set before every job; plain values only, never secrets
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+type schematicsWorkspaceStatus struct {
+	WorkspaceID string `json:"workspaceID,omitempty"`
+	// Applying, Applied, Destroying, Destroyed or Failed
+	Phase          string `json:"phase,omitempty"`
+	LastAction     string `json:"lastAction,omitempty"`
+	LastActivityID string `json:"lastActivityID,omitempty"`
+	// SUBMITTED, then the Schematics activity status
+	LastResult string `json:"lastResult,omitempty"`
+	// not omitted when empty, so a merge patch clears an old message
+	Message string `json:"message"`
+	// the spec generation the last job was submitted for
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	UpdatedAt          string `json:"updatedAt,omitempty"`
+}
+
+// The collection URL of the resource, in namespace or across all of them when it is empty.
+func (k *kubeClient) resourceURL(namespace string) string {
+	u := k.server + "/apis/" + crdGroup + "/" + crdVersion
+	if namespace != "" {
+		u += "/namespaces/" + url.PathEscape(namespace)
+	}
+	return u + "/" + crdResource
+}
+
+func (k *kubeClient) request(ctx context.Context, method string, endpoint string, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if k.tokenFile != "" {
+		token, err := ioutil.ReadFile(k.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading the Kubernetes token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := k.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		var status struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &status) == nil && status.Message != "" {
+			return nil, fmt.Errorf("%s %s: %s: %s", method, endpoint, resp.Status, status.Message)
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, endpoint, resp.Status)
+	}
+	return resp, nil
+}
+
+// Lists the resources in namespace, returning the list's resource version to watch from.
+func (k *kubeClient) list(ctx context.Context, namespace string) ([]schematicsWorkspaceResource, string, error) {
+	resp, err := k.request(ctx, "GET", k.resourceURL(namespace), "", nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("listing SchematicsWorkspaces: %w", err)
+	}
+	defer resp.Body.Close()
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []schematicsWorkspaceResource `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, "", fmt.Errorf("listing SchematicsWorkspaces: %w", err)
+	}
+	return list.Items, list.Metadata.ResourceVersion, nil
+}
+
+// Watches the resources in namespace from resourceVersion for up to timeout, calling onChange for every one added
+// or modified. Returns nil when the server ends the watch, which it does after timeout.
+func (k *kubeClient) watch(ctx context.Context, namespace string, resourceVersion string, timeout time.Duration, onChange func(schematicsWorkspaceResource)) error {
+	query := url.Values{
+		"watch":           {"true"},
+		"resourceVersion": {resourceVersion},
+		"timeoutSeconds":  {fmt.Sprint(int(timeout.Seconds()))},
+	}
+	resp, err := k.request(ctx, "GET", k.resourceURL(namespace)+"?"+query.Encode(), "", nil)
+	if err != nil {
+		return fmt.Errorf("watching SchematicsWorkspaces: %w", err)
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("watching SchematicsWorkspaces: %w", err)
+		}
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			var resource schematicsWorkspaceResource
+			if err := json.Unmarshal(event.Object, &resource); err != nil {
+				return fmt.Errorf("watching SchematicsWorkspaces: %w", err)
+			}
+			onChange(resource)
+		case "ERROR":
+			// typically 410 Gone: the resource version is too old, and a fresh list is needed
+			return fmt.Errorf("watching SchematicsWorkspaces: %s", event.Object)
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("watching SchematicsWorkspaces: %w", err)
+	}
+	return nil
+}
+
+// Replaces the resource's status through the status subresource.
+func (k *kubeClient) updateStatus(ctx context.Context, resource schematicsWorkspaceResource) error {
+	patch, err := json.Marshal(map[string]interface{}{"status": resource.Status})
+	if err != nil {
+		return err
+	}
+	endpoint := k.resourceURL(resource.Metadata.Namespace) + "/" + url.PathEscape(resource.Metadata.Name) + "/status"
+	resp, err := k.request(ctx, "PATCH", endpoint, "application/merge-patch+json", patch)
+	if err != nil {
+		return fmt.Errorf("updating the status of %s/%s: %w", resource.Metadata.Namespace, resource.Metadata.Name, err)
+	}
+	resp.Body.Close()
+	return nil
+}
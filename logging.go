@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// set by --verbose; logs request and response details and raw errors
+	verbose bool
+	// set by --quiet; logs nothing but errors
+	quiet bool
+
+	// threshold of logger, set from --verbose and --quiet once the flags are parsed
+	logLevel = new(slog.LevelVar)
+
+	// the program's logger, also handed to the Schematics client; writes redacted lines to stderr
+	logger = slog.New(newLogHandler(redactingWriter{os.Stderr}, logLevel))
+)
+
+// Sets logLevel from --verbose and --quiet.
+func applyLogLevel() {
+	switch {
+	case verbose:
+		logLevel.Set(slog.LevelDebug)
+	case quiet:
+		logLevel.Set(slog.LevelError)
+	default:
+		logLevel.Set(slog.LevelInfo)
+	}
+}
+
+// slog.Handler printing one human-readable line per record, in the format of the standard log package:
+// a timestamp, a "warning:" or "error:" prefix by level, the message, then the attributes as key=value.
+type logHandler struct {
+	out    io.Writer
+	level  slog.Leveler
+	mu     *sync.Mutex
+	prefix string // group names, each followed by "."
+	attrs  string // attributes from WithAttrs, already formatted
+}
+
+func newLogHandler(out io.Writer, level slog.Leveler) *logHandler {
+	return &logHandler{out: out, level: level, mu: &sync.Mutex{}}
+}
+
+func (h *logHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *logHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	if !r.Time.IsZero() {
+		b.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	}
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("warning: ")
+	}
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		writeLogAttr(&b, h.prefix, a)
+		return true
+	})
+	b.WriteString("\n")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.out, b.String())
+	return err
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, a := range attrs {
+		writeLogAttr(&b, h.prefix, a)
+	}
+	clone := *h
+	clone.attrs += b.String()
+	return &clone
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix += name + "."
+	return &clone
+}
+
+// Appends " key=value" for a, quoting values with spaces and flattening groups into dotted keys.
+func writeLogAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, member := range a.Value.Group() {
+			writeLogAttr(b, prefix, member)
+		}
+		return
+	}
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+	fmt.Fprintf(b, " %s%s=%s", prefix, a.Key, value)
+}
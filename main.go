@@ -1,119 +1,727 @@
 // Program that takes user input to either create or delete resources using the IBM Cloud Schematics service.
 // Requires a pre-configured Schematics workspace.
-// Expected input: `program <ibmcloud apikey> <schematics-workspace-id> <`apply` or `destroy`>`
+// Expected input: `IBMCLOUD_API_KEY=<ibmcloud apikey> program <apply|destroy> --workspace-id <schematics-workspace-id> [flags]`
+// Run `program help` for every command and `program help <command>` for its flags.
 // Apply sends a post call to IBM Cloud schematics to apply the configured workspace. Destroy sends a post call to tear down all resources in the workspace.
 package main
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
-	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
 )
 
-// struct for holding IAM response
-type Iam struct {
-	AccessToken       string `json:"access_token"`
-	RefreshToken      string `json:"refresh_token"`
-	UserID            int    `json:"ims_user_id"`
-	TokenType         string `json:"token_type"`
-	Expires           int    `json:"expires_in"`
-	Expiration        int    `json:"expiration"`
-	RefreshExpiration int    `json:"refresh_token_expiration"`
-	Scope             string `json:"scope"`
+// a subcommand of the CLI
+type command struct {
+	name    string
+	aliases []string
+	summary string
+	run     func(name string, args []string)
+	// builds the flag set `help` prints; unset for help itself and for groups
+	flags func(name string) *flag.FlagSet
+	// for a group such as `workspace`, the commands under it
+	subcommands []command
+}
+
+// every subcommand, in the order help lists them
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "apply", summary: "apply the workspace's Terraform template", run: runActionsCommand, flags: actionFlagSet},
+		{name: "destroy", summary: "tear down all resources in the workspace", run: runActionsCommand, flags: actionFlagSet},
+		{name: "plan", summary: "preview the changes an apply would make; prints the plan summary with --wait", run: runActionsCommand, flags: actionFlagSet},
+		{name: "refresh", summary: "refresh the Terraform state against real infrastructure to detect drift without applying", run: runActionsCommand, flags: actionFlagSet},
+		{name: "drift", summary: "refresh and plan the workspace and report the resources that changed outside of Terraform", run: runDriftCommand, flags: func(name string) *flag.FlagSet {
+			fs, _, _ := driftFlags(name)
+			return fs
+		}},
+		{name: "auth", summary: "store or delete the API key in the OS keyring", subcommands: authCommands()},
+		{name: "vars", summary: "update the workspace's Terraform variables", subcommands: varsCommands()},
+		{name: "jobs", aliases: []string{"job"}, summary: "list, inspect, watch and cancel the workspace's activities", subcommands: jobsCommands()},
+		{name: "outputs", summary: "print the workspace's Terraform outputs as JSON, dotenv or shell exports", run: runOutputsCommand, flags: func(name string) *flag.FlagSet {
+			fs, _, _ := outputsFlags(name)
+			return fs
+		}},
+		{name: "state", summary: "download the workspace's Terraform state", subcommands: stateCommands()},
+		{name: "workspace", aliases: []string{"workspaces"}, summary: "list, create, clone, delete, freeze and unfreeze workspaces and switch their Terraform version", subcommands: workspaceCommands()},
+		{name: "serve-stdio", summary: "read newline-delimited JSON commands on stdin and write JSON results on stdout", run: runServeStdioCommand, flags: func(string) *flag.FlagSet {
+			fs, _, _ := serveStdioFlags()
+			return fs
+		}},
+		{name: "serve", summary: "serve a REST API, authenticated with API tokens, for submitting actions and reading job status", run: runServeCommand, flags: func(string) *flag.FlagSet {
+			fs, _, _ := serveFlags()
+			return fs
+		}},
+		{name: "operator", summary: "reconcile SchematicsWorkspace resources in a Kubernetes cluster by applying or destroying their workspaces", run: runOperatorCommand, flags: func(string) *flag.FlagSet {
+			fs, _, _ := operatorFlags()
+			return fs
+		}},
+		{name: "reaper", summary: "destroy the workspaces whose `apply --ttl` expiry has passed", run: runReaperCommand, flags: func(string) *flag.FlagSet {
+			fs, _, _ := reaperFlags()
+			return fs
+		}},
+		{name: "schedule", summary: "run actions on a cron schedule as a long-lived process, e.g. apply weekdays at 08:00 and destroy at 19:00", run: runScheduleCommand, flags: func(string) *flag.FlagSet {
+			fs, _, _ := scheduleFlags()
+			return fs
+		}},
+		{name: "ui", summary: "browse workspaces and their jobs interactively, run plan, apply or destroy and tail logs", run: runUICommand, flags: func(string) *flag.FlagSet {
+			fs, _, _ := uiFlags()
+			return fs
+		}},
+		{name: "completion", summary: "print a bash, zsh, fish or PowerShell completion script", run: runCompletionCommand, flags: func(string) *flag.FlagSet {
+			return completionFlags()
+		}},
+		{name: "version", summary: "print the version, git commit, build date and Go version, and check for a newer release with --check", run: runVersionCommand, flags: func(string) *flag.FlagSet {
+			fs, _, _ := versionFlags()
+			return fs
+		}},
+		{name: "help", summary: "show help for a command", run: runHelpCommand},
+	}
 }
 
-// Main function. Parses commandline and sends request for tokens and the desired post call to IBM Cloud Schematics.
-// Expected input: `main <ibmcloud apikey> <schematics-workspace-id> <`apply` or `destroy`>`
+// Main function. Dispatches to the subcommand named by the first argument.
+// Expected input: `main <command> [flags]`, e.g. `main apply --api-key-stdin --workspace-id <schematics-workspace-id>`
+// The command may also be a comma-separated list of actions such as `apply,destroy`, run in order against the same workspace.
 func main() {
+	defer recoverFatal()
+	slog.SetDefault(logger)
 
-	schematicsWorkspaceID := os.Args[2]
-	action := os.Args[3]
-	accessToken, refreshToken := getTokens(os.Args[1])
-	clusterCreateOrDestroy(accessToken, refreshToken, action, schematicsWorkspaceID)
-}
-
-// The call to IAM that this command translates into GoLang:
-//
-//	curl --header "Content-Type: application/x-www-form-urlencoded" \
-//	    --header "Accept: application/json" \
-//	    --header --header "Authorization: Basic Yng6Yng=" \ ## this equals the url encoded authorization for username bx and password bx
-//	    --data "grant_type=urn:ibm:params:oauth:grant-type:apikey" \
-//	    --data "apikey=<apikey>" \
-//		https://iam.cloud.ibm.com/identity/token
-//
-// Required input is an IBM Cloud API Key
-// Output is loaded into the Iam struct and returns two strings holding the Access Token and Refresh Token
-func getTokens(apiKey string) (string, string) {
-	endpoint := "https://iam.cloud.ibm.com/identity/token"
-	data := url.Values{}
-	data.Set("grant_type", "urn:ibm:params:oauth:grant-type:apikey")
-	data.Set("apikey", apiKey)
-	req, err := http.NewRequest("POST", endpoint, strings.NewReader(data.Encode()))
-	if err != nil {
-		panic(err.Error())
+	if len(os.Args) < 2 {
+		printUsage(os.Stderr)
+		exit(exitInvalidInput)
+	}
+	name, args := os.Args[1], os.Args[2:]
+	if name == "-h" || name == "--help" || name == "-help" {
+		name = "help"
+	}
+	if cmd, ok := findCommand(commands, name); ok {
+		runCommand(cmd, name, args)
+		exit(exitOK)
+	}
+	if strings.Contains(name, ",") {
+		runActionsCommand(name, args)
+		exit(exitOK)
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	printUsage(os.Stderr)
+	exit(exitInvalidInput)
+}
+
+// Looks a command up by name or alias in cmds.
+func findCommand(cmds []command, name string) (command, bool) {
+	for _, cmd := range cmds {
+		if cmd.name == name {
+			return cmd, true
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd, true
+			}
+		}
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", "Basic Yng6Yng=")
+	return command{}, false
+}
+
+// Runs cmd, or for a group the subcommand named by the first argument.
+func runCommand(cmd command, name string, args []string) {
+	if cmd.subcommands == nil {
+		cmd.run(name, args)
+		return
+	}
+	if len(args) == 0 {
+		printGroupUsage(os.Stderr, cmd)
+		exit(exitInvalidInput)
+	}
+	if args[0] == "-h" || args[0] == "--help" || args[0] == "-help" {
+		printGroupUsage(os.Stdout, cmd)
+		return
+	}
+	sub, ok := findCommand(cmd.subcommands, args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", cmd.name+" "+args[0])
+		printGroupUsage(os.Stderr, cmd)
+		exit(exitInvalidInput)
+	}
+	runCommand(sub, cmd.name+" "+sub.name, args[1:])
+}
+
+// Prints the list of commands.
+func printUsage(out io.Writer) {
+	fmt.Fprintf(out, "usage: %s <command> [flags]\n\ncommands:\n", programName())
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nActions can be chained with commas, e.g. `%s apply,destroy`.\n", programName())
+	fmt.Fprintf(out, "Run `%s help <command>` for the flags of a command.\n", programName())
+	printExitCodes(out)
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// Prints the subcommands of a group.
+func printGroupUsage(out io.Writer, group command) {
+	fmt.Fprintf(out, "usage: %s %s <command> [flags]\n\ncommands:\n", programName(), group.name)
+	for _, cmd := range group.subcommands {
+		fmt.Fprintf(out, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nRun `%s help %s <command>` for the flags of a command.\n", programName(), group.name)
+	printExitCodes(out)
+}
+
+// `help [command [subcommand]]`: prints the command list, a group's commands, or one command's flags.
+func runHelpCommand(_ string, args []string) {
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return
+	}
+	if strings.Contains(args[0], ",") {
+		fs := actionFlagSet(args[0])
+		fs.SetOutput(os.Stdout)
+		fs.Usage()
+		return
+	}
+	cmds, path := commands, ""
+	for i, name := range args {
+		cmd, ok := findCommand(cmds, name)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", strings.TrimSpace(path+" "+name))
+			printUsage(os.Stderr)
+			exit(exitInvalidInput)
+		}
+		path = strings.TrimSpace(path + " " + cmd.name)
+		switch {
+		case cmd.subcommands != nil && i == len(args)-1:
+			printGroupUsage(os.Stdout, cmd)
+			return
+		case cmd.subcommands != nil:
+			cmds = cmd.subcommands
+			continue
+		case cmd.flags == nil:
+			printUsage(os.Stdout)
+		default:
+			fs := cmd.flags(path)
+			fs.SetOutput(os.Stdout)
+			fs.Usage()
+		}
+		return
+	}
+}
+
+// flags specific to the apply and destroy commands
+type actionOptions struct {
+	steps    stepOptions
+	reportMD string
+	resultFD int
+	output   string
+	vars     varOptions
+	// skip the confirmation before destroy
+	yes          bool
+	manifest     string
+	parallel     int
+	dryRun       bool
+	savePlan     string
+	requirePlan  string
+	githubOutput bool
+	notifyURL    string
+	// with --wait, where and how often to POST that a job is still running
+	heartbeatURL      string
+	heartbeatInterval time.Duration
+	// Event Notifications instance and API source the job lifecycle is published to
+	eventsCRN      string
+	eventsSource   string
+	eventsEndpoint string
+	// with apply, how long until `reaper` may destroy the workspace
+	ttl time.Duration
+}
+
+// Builds the flag set for an action command such as `apply` or `apply,destroy`.
+func actionFlags(name string) (*flag.FlagSet, *globalOptions, *actionOptions) {
+	fs := newFlagSet(name, name+" [flags]", "Submits "+name+" for a pre-configured Schematics workspace. Comma-separated actions run in order. "+
+		"--workspace-id may be repeated or given a comma-separated list to run against each workspace in turn with one IAM token.")
+	global := &globalOptions{multiWorkspace: true}
+	global.register(fs, true)
+	opts := &actionOptions{}
+	fs.BoolVar(&opts.steps.WaitForReady, "wait-for-ready", false, "before destroy, wait for any in-progress activity on the workspace to finish instead of refusing")
+	fs.DurationVar(&opts.steps.WaitForReadyTimeout, "wait-for-ready-timeout", 30*time.Minute, "how long --wait-for-ready waits before giving up")
+	fs.BoolVar(&opts.steps.ContinueOnFailure, "continue", false, "with a comma-separated action list, keep running later actions after one fails")
+	fs.BoolVar(&opts.steps.FromFailed, "from-failed", false, "allow destroying a workspace whose last run FAILED")
+	fs.DurationVar(&opts.steps.OnlyIfOlderThan, "only-if-older-than", 0, "skip apply (exit 0) when the workspace was successfully applied more recently than this")
+	fs.BoolVar(&opts.steps.Wait, "wait", false, "wait for each job to reach COMPLETED or FAILED and exit non-zero unless it completed")
+	fs.BoolVar(&opts.steps.Attach, "attach", false, "when Schematics refuses an action because the same action is already running on the workspace, wait for that job instead of failing")
+	fs.DurationVar(&opts.steps.PollInterval, "poll-interval", 10*time.Second, "how often --wait checks the job status")
+	fs.DurationVar(&opts.steps.JobTimeout, "job-timeout", 0, "with --wait, stop waiting for a job after this long and fail, leaving it running; 0 waits as long as --max-runtime allows")
+	fs.Var((*stringList)(&opts.steps.Targets), "target", "limit each action to this Terraform resource `address`, e.g. module.cluster.ibm_container_cluster.this, like terraform -target; may be repeated")
+	fs.BoolVar(&opts.steps.FollowLogs, "follow-logs", true, "with --wait, print the job's Terraform output on stdout as it runs")
+	fs.BoolVar(&opts.steps.Progress, "progress", true, "with --wait on a terminal, keep a live line with the job's phase, e.g. applying resource 3 of 12, and the elapsed time; "+
+		"status changes are logged as plain lines otherwise")
+	fs.StringVar(&opts.reportMD, "report-md", "", "write a Markdown summary of the run to this path")
+	fs.IntVar(&opts.resultFD, "result-fd", 0, "also write the final JSON result object to this file descriptor")
+	fs.StringVar(&opts.notifyURL, "notify-url", "", "POST a JSON summary of each finished step (workspace, action, activity id, status, duration) to this webhook, "+
+		"signed with HMAC-SHA256 of "+notifySecretEnv+" in the "+notifySignatureHeader+" header")
+	fs.StringVar(&opts.heartbeatURL, "heartbeat-url", "", "with --wait, POST a JSON heartbeat (workspace, action, activity id, status, elapsed seconds) to this URL "+
+		"every --heartbeat-interval while a job runs, e.g. for a dead man's switch monitor; failures are only logged")
+	fs.DurationVar(&opts.heartbeatInterval, "heartbeat-interval", time.Minute, "how often --heartbeat-url is sent while a job runs; it goes out at the first --poll-interval check after")
+	fs.StringVar(&global.slackWebhook, "slack-webhook", "", "Slack incoming webhook URL to post each finished apply and destroy to, with the workspace name, result, duration and a console link; "+
+		"slack_webhook in the profile keeps it off the command line")
+	fs.StringVar(&opts.eventsCRN, "event-notifications-crn", "", "CRN of an Event Notifications instance to publish each job's lifecycle to (com.ibm.cloud.schematics.job.submitted, started, completed and failed), for its rules to route")
+	fs.StringVar(&opts.eventsSource, "event-notifications-source", "", "`id` of the API source in the --event-notifications-crn instance that the events come from")
+	fs.StringVar(&opts.eventsEndpoint, "event-notifications-endpoint", "", "Event Notifications base URL, overriding the one derived from --event-notifications-crn")
+	fs.BoolVar(&opts.githubOutput, "github-output", false, "in a GitHub Actions step: write activity_id, status, ok and the Terraform outputs to $"+githubOutputEnv+
+		", annotate failures with ::error and fold each job's logs into a group")
+	fs.DurationVar(&opts.ttl, "ttl", 0, "after a successful apply, tag the workspace "+expiryTagPrefix+"<time> this long from now, e.g. 8h, so `reaper` destroys it once it expires")
+	fs.StringVar(&opts.manifest, "manifest", "", "YAML file listing several workspaces with depends_on; apply, plan and refresh run in dependency order and destroy in reverse. Replaces --workspace-id")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "for apply: run a plan instead, wait for it and print what would be added, changed and destroyed; exits "+fmt.Sprint(exitChangesPending)+" when there are changes")
+	fs.Var(optionalAmount{&opts.steps.MaxCostIncrease}, "max-cost-increase", "for apply: run a plan first and refuse to apply if its estimated monthly cost increase is above this amount, e.g. 0")
+	fs.Var(optionalCount{&opts.steps.MaxDestroy}, "max-destroy", "fail a plan, or run a plan first and refuse to apply, when it would destroy more than this many resources, e.g. 0; "+
+		"exits "+fmt.Sprint(exitChangesPending))
+	fs.Var(optionalCount{&opts.steps.ExpectChanges}, "expect-changes", "fail a plan, or run a plan first and refuse to apply, unless it adds, changes and destroys exactly this many resources in total; "+
+		"exits "+fmt.Sprint(exitChangesPending))
+	fs.BoolVar(&opts.steps.Review, "review", false, "for apply: run a plan first, show what it changes and the apply request, and ask before applying; --auto-approve applies without asking")
+	fs.StringVar(&opts.savePlan, "save", "", "for plan: wait for it, then record its activity id, summary and a fingerprint of the workspace's repository and variables in this file")
+	fs.StringVar(&opts.requirePlan, "require-plan", "", "for apply: refuse to run unless this file from `plan --save` has a plan for the workspace and neither its repository nor its variables changed since")
+	fs.IntVar(&opts.parallel, "parallel", 1, "with several --workspace-id, run against at most this many workspaces at once; --follow-logs is off when above 1")
+	fs.BoolVar(&opts.yes, "yes", false, "destroy without asking to type the workspace name first, and apply --review without asking")
+	fs.BoolVar(&opts.yes, "auto-approve", false, "same as --yes")
+	opts.vars.register(fs, "Terraform variable to set as key=value in the workspace before the first action; may be repeated")
+	fs.StringVar(&opts.output, "output", outputText, "output format: text; json for a single JSON document with every step's result on stdout; or go-template=TEMPLATE, executed for each step, e.g. go-template='{{.ActivityID}}'")
+	return fs, global, opts
+}
+
+// actionFlags for help, without the option structs.
+func actionFlagSet(name string) *flag.FlagSet {
+	fs, _, _ := actionFlags(name)
+	return fs
+}
+
+// `apply`, `destroy`, or a comma-separated list of them: runs each action against the workspace in order.
+func runActionsCommand(name string, args []string) {
+	fs, global, opts := actionFlags(name)
+	parseFlags(fs, args)
+	actions, err := parseActions(name)
 	if err != nil {
-		panic(err.Error())
+		usageError(fs, err)
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	tmpl, err := parseOutput(opts.output)
 	if err != nil {
-		panic(err.Error())
+		usageError(fs, err)
+	}
+	vars, err := opts.vars.variables(opts.vars.vars)
+	if err != nil {
+		usageError(fs, err)
+	}
+	if opts.dryRun {
+		for i, action := range actions {
+			if action != "apply" {
+				usageError(fs, fmt.Errorf("--dry-run only works with apply, not %s", action))
+			}
+			actions[i] = "plan"
+		}
+		opts.steps.Wait = true
+	}
+	if opts.steps.Review {
+		if opts.dryRun {
+			usageError(fs, errors.New("--review cannot be used with --dry-run, which never applies"))
+		}
+		if !containsAction(actions, "apply") {
+			usageError(fs, errors.New("--review needs an apply action"))
+		}
+		if opts.parallel > 1 && !opts.yes {
+			usageError(fs, errors.New("--review cannot ask about several workspaces at once; drop --parallel or add --auto-approve"))
+		}
+		if !opts.yes {
+			opts.steps.Confirm = func(question string) bool {
+				ok, err := confirm(question, "--auto-approve")
+				if err != nil {
+					fatalCode(exitInvalidInput, err)
+				}
+				return ok
+			}
+		}
+	}
+	if opts.savePlan != "" {
+		if !containsAction(actions, "plan") {
+			usageError(fs, errors.New("--save needs a plan action"))
+		}
+		opts.steps.Wait = true
+	}
+	if opts.requirePlan != "" {
+		if !containsAction(actions, "apply") {
+			usageError(fs, errors.New("--require-plan needs an apply action"))
+		}
+		if len(vars) > 0 {
+			usageError(fs, errors.New("--require-plan cannot be used with --var, --sensitive-var or --var-file, which would change the planned variables"))
+		}
+	}
+	for _, target := range opts.steps.Targets {
+		if target == "" || strings.ContainsAny(target, " \t\n") {
+			usageError(fs, fmt.Errorf("--target %q: expected a resource address such as module.cluster.ibm_container_cluster.this", target))
+		}
+	}
+	if err := validateTTL(opts.ttl, actions); err != nil {
+		usageError(fs, err)
+	}
+	if opts.steps.checksChanges() {
+		if !containsAction(actions, "plan") && !containsAction(actions, "apply") {
+			usageError(fs, errors.New("--max-destroy and --expect-changes need a plan or apply action"))
+		}
+		// the counts are read from the finished plan
+		if containsAction(actions, "plan") {
+			opts.steps.Wait = true
+		}
+	}
+	if opts.parallel < 1 {
+		usageError(fs, fmt.Errorf("--parallel %d: must be at least 1", opts.parallel))
+	}
+	githubOutputPath := os.Getenv(githubOutputEnv)
+	if opts.githubOutput && githubOutputPath == "" {
+		usageError(fs, errors.New("--github-output: "+githubOutputEnv+" is not set; it is meant for a GitHub Actions step"))
+	}
+	var webhook *notifier
+	if opts.notifyURL != "" {
+		if webhook, err = newNotifier(opts.notifyURL); err != nil {
+			usageError(fs, err)
+		}
+	}
+	var beat *heartbeat
+	if opts.heartbeatURL != "" {
+		if !opts.steps.Wait && !opts.steps.Attach {
+			usageError(fs, errors.New("--heartbeat-url needs --wait or --attach, which follow the job it reports on"))
+		}
+		if beat, err = newHeartbeat(opts.heartbeatURL, opts.heartbeatInterval); err != nil {
+			usageError(fs, err)
+		}
+	}
+	var m *manifest
+	if opts.manifest != "" {
+		if opts.parallel > 1 {
+			usageError(fs, errors.New("--parallel cannot be used with --manifest"))
+		}
+		if len(global.workspaceIDs) > 0 || global.workspaceCRN != "" || len(global.workspaceNames) > 0 || len(global.workspaceTags) > 0 {
+			usageError(fs, errors.New("--manifest cannot be used with --workspace-id, --workspace-name, --workspace-tag or --crn"))
+		}
+		if m, err = loadManifest(opts.manifest); err != nil {
+			fatalCode(exitInvalidInput, err)
+		}
+		global.workspaceIDs = m.workspaceIDs()
+	}
+	if err := global.validate(true); err != nil {
+		usageError(fs, err)
+	}
+
+	var events *eventPublisher
+	if opts.eventsCRN != "" || opts.eventsSource != "" {
+		if events, err = newEventPublisher(opts.eventsCRN, opts.eventsSource, global.private); err != nil {
+			usageError(fs, err)
+		}
+		if opts.eventsEndpoint != "" {
+			events.endpoint = opts.eventsEndpoint
+		}
+	}
+	var slack *slackNotifier
+	if global.slackWebhook != "" {
+		if slack, err = newSlackNotifier(global.slackWebhook); err != nil {
+			usageError(fs, err)
+		}
 	}
 
-	//print out status and response
-	log.Println("IAM response:")
-	log.Println(resp.Status)
+	// collected as each step finishes so the report is still written if a later step is fatal
+	var results []runResult
+	configureOutput(opts.output, tmpl, &results, &opts.steps)
+	ctx, client := global.connect()
 
-	var iam Iam
-	json.Unmarshal([]byte(body), &iam)
-	//debugging
-	// log.Println(iam)
+	if opts.resultFD != 0 {
+		f, err := openResultFD(opts.resultFD)
+		if err != nil {
+			fatalCode(exitInvalidInput, err)
+		}
+		atExit(func() {
+			if err := writeResultFD(f, results); err != nil {
+				logger.Error(formatError(err))
+			}
+		})
+	}
+	if opts.githubOutput {
+		configureGitHubOutput(ctx, client, githubOutputPath, &results, global.workspaceIDs, &opts.steps)
+	}
+	if opts.reportMD != "" {
+		atExit(func() {
+			if err := writeMarkdownReport(opts.reportMD, results); err != nil {
+				logger.Error(formatError(err))
+			}
+		})
+	}
 
-	return iam.AccessToken, iam.RefreshToken
+	if webhook != nil {
+		webhook.client = client.HTTPClient
+	}
+	if slack != nil {
+		slack.client = client.HTTPClient
+	}
+	if beat != nil {
+		beat.client = client.HTTPClient
+		opts.steps.OnPoll = func(result runResult, elapsed time.Duration) {
+			beat.poll(ctx, result, elapsed)
+		}
+	}
+	if events != nil {
+		opts.steps.OnJobEvent = func(event string, result runResult) {
+			events.publish(ctx, client, event, result)
+		}
+	}
+	opts.steps.OnResult = func(result runResult) {
+		results = append(results, result)
+		if webhook != nil {
+			webhook.notify(ctx, result)
+		}
+		if slack != nil {
+			slack.notify(ctx, client, result)
+		}
+		if event := finalEvent(result); events != nil && event != "" {
+			events.publish(ctx, client, event, result)
+		}
+		if opts.ttl > 0 && result.Action == "apply" && result.ActivityID != "" && !result.failed() {
+			expiry := time.Now().Add(opts.ttl)
+			if err := setWorkspaceExpiry(ctx, client, result.WorkspaceID, expiry); err != nil {
+				logger.Error("recording the --ttl expiry failed; reaper won't destroy the workspace: "+formatError(err), "workspace", result.WorkspaceID)
+			} else {
+				logger.Info("workspace expires", "workspace", result.WorkspaceID, "at", expiry.UTC().Format(time.RFC3339))
+			}
+		}
+		if quiet && opts.output == outputText && result.ActivityID != "" {
+			fmt.Fprintln(os.Stdout, result.ActivityID)
+		}
+	}
+	if opts.requirePlan != "" {
+		meta, err := loadPlanMeta(opts.requirePlan)
+		if err != nil {
+			fatalCode(exitInvalidInput, err)
+		}
+		if err := verifyPlanMeta(ctx, client, meta, opts.requirePlan, global.workspaceIDs); err != nil {
+			fatal(err)
+		}
+	}
+	if m != nil {
+		runManifest(ctx, client, m, actions, vars, opts.yes, opts.steps)
+	} else {
+		runWorkspaces(ctx, client, actions, global.workspaceIDs, vars, opts.yes, opts.parallel, opts.steps)
+	}
+	if len(global.workspaceIDs) > 1 {
+		logWorkspaceSummary(global.workspaceIDs, results)
+	}
+	if opts.savePlan != "" {
+		if err := savePlanMeta(ctx, client, opts.savePlan, results); err != nil {
+			logger.Error(formatError(err))
+			exit(exitFailed)
+		}
+	}
+	code := exitCodeFor(results)
+	if opts.dryRun && code == exitOK {
+		code = dryRunSummary(results, opts.output == outputText)
+	}
+	exit(code)
+}
+
+// Reports what the plans of a --dry-run would change, one line per workspace on stdout when print is set, and
+// returns exitChangesPending when any of them changes something.
+func dryRunSummary(results []runResult, print bool) int {
+	code := exitOK
+	out := redactingWriter{os.Stdout}
+	for _, result := range results {
+		if result.Skipped {
+			continue
+		}
+		if result.Plan == nil {
+			logger.Error("cannot tell what apply would change: no plan summary in the job logs", "workspace", result.WorkspaceID, "activity", result.ActivityID)
+			return exitFailed
+		}
+		if result.Plan.HasChanges() {
+			code = exitChangesPending
+		}
+		if print {
+			summary := "no changes"
+			if result.Plan.HasChanges() {
+				summary = result.Plan.String()
+			}
+			fmt.Fprintf(out, "%s: %s\n", result.WorkspaceID, summary)
+		}
+	}
+	return code
 }
 
-// The calls to IBM Cloud Schematics that this function translates to golang:
-// apply: curl -X PUT https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}}/apply -H "Authorization: Bearer $IAM" -H "refresh_token: $REFRESH"
-// destroy: curl -X PUT https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}/destroy -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
-// Requires Access Token, Refresh Token, the action (either `apply` or `destroy`), and the IBM Cloud Schematics workspace ID
-func clusterCreateOrDestroy(accessToken string, refreshToken string, action string, schematicsWorkspaceID string) {
+// Runs the actions against each workspace, moving on to the next one after a failure. Up to parallel workspaces
+// run at once; any destroy confirmations are asked for up front so prompts don't interleave.
+func runWorkspaces(ctx context.Context, client *schematics.Client, actions []string, workspaceIDs []string, vars []schematics.Variable, yes bool, parallel int, opts stepOptions) {
+	if !yes {
+		for _, wsID := range workspaceIDs {
+			confirmDestroy(ctx, client, actions, wsID)
+		}
+	}
+	run := func(wsID string) {
+		if err := updateVariables(ctx, client, wsID, vars); err != nil {
+			opts.OnResult(preflightFailed(actions[0], wsID, err))
+			return
+		}
+		runSteps(ctx, client, actions, wsID, opts)
+	}
+	if parallel <= 1 || len(workspaceIDs) <= 1 {
+		for _, wsID := range workspaceIDs {
+			run(wsID)
+		}
+		return
+	}
 
-	endpoint := "https://schematics.cloud.ibm.com/v1/workspaces/" + schematicsWorkspaceID + "/" + action
-	log.Println("endpoint to target:")
-	log.Println(endpoint)
+	// the job logs and status lines of concurrent runs would interleave
+	opts.FollowLogs = false
+	opts.Progress = false
+	var mu sync.Mutex
+	onResult := opts.OnResult
+	opts.OnResult = func(result runResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		onResult(result)
+	}
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel && i < len(workspaceIDs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for wsID := range queue {
+				run(wsID)
+			}
+		}()
+	}
+	for _, wsID := range workspaceIDs {
+		queue <- wsID
+	}
+	close(queue)
+	wg.Wait()
+}
 
-	reqSchematics, err := http.NewRequest("PUT", endpoint, nil)
-	if err != nil {
-		panic(err.Error())
+// Logs whether each workspace of a batch run succeeded.
+func logWorkspaceSummary(workspaceIDs []string, results []runResult) {
+	logger.Info("workspaces:")
+	for _, wsID := range workspaceIDs {
+		outcome := "ok"
+		for _, result := range results {
+			if result.WorkspaceID != wsID {
+				continue
+			}
+			if result.Skipped && outcome == "ok" {
+				outcome = result.Action + ": " + result.Status
+			}
+			if !result.failed() {
+				continue
+			}
+			outcome = "failed: " + result.Action
+			if result.Error != "" {
+				outcome += ": " + result.Error
+			} else if result.Status != "" {
+				outcome += ": " + result.Status
+			}
+			break
+		}
+		logger.Info("  " + wsID + ": " + outcome)
 	}
+}
 
-	reqSchematics.Header.Set("Authorization", accessToken)
-	reqSchematics.Header.Set("Refresh_token", refreshToken)
+// Reports whether actions includes action.
+func containsAction(actions []string, action string) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
 
-	// send requesting to schematics to apply or destroy resources in Schematics
-	respClusterCreate, err := http.DefaultClient.Do(reqSchematics)
+// Asks for the workspace name before a run that includes destroy, exiting unless it is typed back.
+func confirmDestroy(ctx context.Context, client *schematics.Client, actions []string, schematicsWorkspaceID string) {
+	if !containsAction(actions, "destroy") {
+		return
+	}
+	ws, err := client.GetWorkspace(ctx, schematicsWorkspaceID)
 	if err != nil {
-		panic(err.Error())
+		fatal(err)
 	}
+	name := ws.Name
+	if name == "" {
+		name = schematicsWorkspaceID
+	}
+	ok, err := confirmTyped("Destroy every resource in workspace "+name+" ("+schematicsWorkspaceID+")?", name, "--yes or --auto-approve")
+	if err != nil {
+		fatalCode(exitInvalidInput, err)
+	}
+	if !ok {
+		logger.Error("not confirmed; nothing was destroyed")
+		exit(exitFailed)
+	}
+}
 
-	defer respClusterCreate.Body.Close()
+// Exit code for a finished run: exitAuthFailed if Schematics rejected the token, exitFailed if any step failed,
+// and exitChangesPending if the only failures are plans outside --max-destroy or --expect-changes.
+func exitCodeFor(results []runResult) int {
+	code := exitOK
+	for _, result := range results {
+		if result.StatusCode == http.StatusUnauthorized {
+			return exitAuthFailed
+		}
+		switch {
+		case result.ChangesRefused && code == exitOK:
+			code = exitChangesPending
+		case result.failed() && !result.ChangesRefused:
+			code = exitFailed
+		}
+	}
+	return code
+}
 
-	bodyClusterCreate, err := ioutil.ReadAll(respClusterCreate.Body)
+// Submits the action (either `apply` or `destroy`) for the IBM Cloud Schematics workspace, limited to targets when
+// any are given, and logs the response.
+// Requests that never reached Schematics are fatal; anything else is returned as the outcome of the call.
+// Duration is left for the caller to fill in.
+func clusterCreateOrDestroy(ctx context.Context, client *schematics.Client, action string, schematicsWorkspaceID string, targets []string) runResult {
+	resp, err := client.RunActionWithOptions(ctx, action, schematicsWorkspaceID, schematics.ActionOptions{Targets: targets})
+	result := runResult{
+		Action:        action,
+		WorkspaceID:   schematicsWorkspaceID,
+		ActivityID:    resp.ActivityID,
+		StatusCode:    resp.StatusCode,
+		Status:        resp.Status,
+		TransactionID: resp.TransactionID,
+	}
+	var apiErr *schematics.APIError
+	if err != nil && !errors.As(err, &apiErr) {
+		if isNetworkUnreachable(err) {
+			fatal(err)
+		}
+		logger.Error(formatError(err))
+		result.Error = formatError(err)
+		return result
+	}
+	if err != nil && apiErr.StatusCode == http.StatusConflict {
+		describeConflict(ctx, client, &result)
+		return result
+	}
 	if err != nil {
-		panic(err.Error())
+		logger.Error(formatError(err))
+		return result
 	}
 
-	log.Println("Schematics response:")
-	log.Println(respClusterCreate.Status)
-	log.Println(string(bodyClusterCreate))
+	if len(targets) > 0 {
+		logger.Info("submitted "+action, "workspace", schematicsWorkspaceID, "activity", result.ActivityID, "status", resp.Status, "targets", strings.Join(targets, ","))
+	} else {
+		logger.Info("submitted "+action, "workspace", schematicsWorkspaceID, "activity", result.ActivityID, "status", resp.Status)
+	}
+	logger.Debug("Schematics response: " + string(resp.Body))
+	return result
 }
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// One workspace of a --manifest.
+type manifestWorkspace struct {
+	Name        string
+	WorkspaceID string
+	DependsOn   []string // names of workspaces that must be applied first and destroyed last
+	Vars        []schematics.Variable
+	// Terraform version the workspace is expected to run, such as 1.6; apply warns when it runs another
+	TerraformVersion string
+	line             int
+}
+
+// A --manifest file: several workspaces and the order they depend on each other in.
+//
+//	workspaces:
+//	  - name: network
+//	    workspace_id: us-south.workspace.network.1a2b3c4d
+//	  - name: cluster
+//	    workspace_id: us-south.workspace.cluster.5e6f7a8b
+//	    depends_on: [network]
+//	    terraform_version: "1.6"
+//	    vars:
+//	      workers: 3
+type manifest struct {
+	// in dependency order: every workspace comes after the ones it depends on
+	Workspaces []manifestWorkspace
+}
+
+// Reads and orders the manifest at path.
+func loadManifest(path string) (*manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	m, err := parseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Builds the manifest from its YAML document and sorts its workspaces by their dependencies. Unknown keys,
+// unknown dependencies and cycles are errors.
+func parseManifest(data []byte) (*manifest, error) {
+	root, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range root.Keys {
+		if key != "workspaces" {
+			return nil, fmt.Errorf("line %d: unknown key %q", root.Map[key].Line, key)
+		}
+	}
+	list := root.Map["workspaces"]
+	if list == nil || len(list.List) == 0 {
+		return nil, errors.New("no workspaces listed")
+	}
+	var workspaces []manifestWorkspace
+	for _, node := range list.List {
+		ws, err := parseManifestWorkspace(node)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, ws)
+	}
+	ordered, err := sortManifestWorkspaces(workspaces)
+	if err != nil {
+		return nil, err
+	}
+	return &manifest{Workspaces: ordered}, nil
+}
+
+// Reads one entry of the workspaces list.
+func parseManifestWorkspace(node *yamlNode) (manifestWorkspace, error) {
+	ws := manifestWorkspace{line: node.Line}
+	if node.Map == nil {
+		return ws, fmt.Errorf("line %d: expected a mapping with name and workspace_id", node.Line)
+	}
+	for _, key := range node.Keys {
+		child := node.Map[key]
+		switch key {
+		case "name", "workspace_id", "terraform_version":
+			if child.Map != nil || child.List != nil {
+				return ws, fmt.Errorf("line %d: %s must be a string", child.Line, key)
+			}
+			switch key {
+			case "name":
+				ws.Name = child.Scalar
+			case "workspace_id":
+				ws.WorkspaceID = child.Scalar
+			default:
+				if err := validateTerraformVersion(child.Scalar); err != nil {
+					return ws, fmt.Errorf("line %d: %w", child.Line, err)
+				}
+				ws.TerraformVersion = strings.TrimPrefix(child.Scalar, "v")
+			}
+		case "depends_on":
+			if child.Map != nil || (child.List == nil && child.Scalar != "") {
+				return ws, fmt.Errorf("line %d: depends_on must be a list of workspace names", child.Line)
+			}
+			for _, dep := range child.List {
+				if dep.Map != nil || dep.List != nil || dep.Scalar == "" {
+					return ws, fmt.Errorf("line %d: depends_on must be a list of workspace names", dep.Line)
+				}
+				ws.DependsOn = append(ws.DependsOn, dep.Scalar)
+			}
+		case "vars":
+			if child.List != nil || (child.Map == nil && child.Scalar != "") {
+				return ws, fmt.Errorf("line %d: vars must be a mapping", child.Line)
+			}
+			for _, name := range child.Keys {
+				v := child.Map[name]
+				if v.Map != nil || v.List != nil {
+					return ws, fmt.Errorf("line %d: variable %s must be a string; use a --var-file for lists and maps", v.Line, name)
+				}
+				ws.Vars = append(ws.Vars, schematics.Variable{Name: name, Value: v.Scalar})
+			}
+		default:
+			return ws, fmt.Errorf("line %d: unknown key %q", child.Line, key)
+		}
+	}
+	if ws.Name == "" || ws.WorkspaceID == "" {
+		return ws, fmt.Errorf("line %d: name and workspace_id are required", node.Line)
+	}
+	return ws, nil
+}
+
+// Orders workspaces so each comes after its dependencies, keeping the file order where they don't constrain it.
+func sortManifestWorkspaces(workspaces []manifestWorkspace) ([]manifestWorkspace, error) {
+	byName := map[string]int{}
+	for i, ws := range workspaces {
+		if _, dup := byName[ws.Name]; dup {
+			return nil, fmt.Errorf("line %d: duplicate workspace name %q", ws.line, ws.Name)
+		}
+		byName[ws.Name] = i
+	}
+	for _, ws := range workspaces {
+		for _, dep := range ws.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("line %d: %s depends on unknown workspace %q", ws.line, ws.Name, dep)
+			}
+		}
+	}
+
+	var ordered []manifestWorkspace
+	done := map[string]bool{}
+	for len(ordered) < len(workspaces) {
+		progress := false
+		for _, ws := range workspaces {
+			if done[ws.Name] {
+				continue
+			}
+			ready := true
+			for _, dep := range ws.DependsOn {
+				ready = ready && done[dep]
+			}
+			if ready {
+				ordered = append(ordered, ws)
+				done[ws.Name] = true
+				progress = true
+			}
+		}
+		if !progress {
+			var stuck []string
+			for _, ws := range workspaces {
+				if !done[ws.Name] {
+					stuck = append(stuck, ws.Name)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between %v", stuck)
+		}
+	}
+	return ordered, nil
+}
+
+// The workspace ids in dependency order.
+func (m *manifest) workspaceIDs() []string {
+	ids := make([]string, len(m.Workspaces))
+	for i, ws := range m.Workspaces {
+		ids[i] = ws.WorkspaceID
+	}
+	return ids
+}
+
+// The workspaces in the order action runs against them: destroy tears down dependents before what they depend on.
+func (m *manifest) order(action string) []manifestWorkspace {
+	ordered := append([]manifestWorkspace(nil), m.Workspaces...)
+	if action == "destroy" {
+		for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		}
+	}
+	return ordered
+}
+
+// Runs each action across the manifest's workspaces, in dependency order or, for destroy, in reverse. A workspace
+// is skipped when a workspace it depends on failed or was skipped, or for destroy when one depending on it did.
+// Later actions are not started after a failure unless opts.ContinueOnFailure is set.
+func runManifest(ctx context.Context, client *schematics.Client, m *manifest, actions []string, vars []schematics.Variable, yes bool, opts stepOptions) {
+	updated := map[string]bool{}
+	for _, action := range actions {
+		blocked := map[string]string{} // workspace name -> the workspace that blocks it
+		failed := false
+		for _, ws := range m.order(action) {
+			if blocker := manifestBlocker(m, ws, action, blocked); blocker != "" {
+				blocked[ws.Name] = blocker
+				logger.Warn(fmt.Sprintf("skipping %s of %s because %s did not succeed", action, ws.Name, blocker))
+				opts.OnResult(runResult{Action: action, WorkspaceID: ws.WorkspaceID, Status: "skipped: " + blocker + " did not succeed", Skipped: true})
+				continue
+			}
+			if action == "destroy" && !yes {
+				confirmDestroy(ctx, client, []string{action}, ws.WorkspaceID)
+			}
+			ok := true
+			if !updated[ws.Name] {
+				updated[ws.Name] = true
+				if err := updateVariables(ctx, client, ws.WorkspaceID, append(append([]schematics.Variable(nil), ws.Vars...), vars...)); err != nil {
+					opts.OnResult(preflightFailed(action, ws.WorkspaceID, err))
+					ok = false
+				}
+			}
+			if ok && action == "apply" && ws.TerraformVersion != "" {
+				checkTerraformVersion(ctx, client, ws)
+			}
+			if ok {
+				for _, result := range runSteps(ctx, client, []string{action}, ws.WorkspaceID, opts) {
+					ok = ok && !result.failed()
+				}
+			}
+			if !ok {
+				blocked[ws.Name] = ws.Name
+				failed = true
+			}
+		}
+		if failed && !opts.ContinueOnFailure {
+			return
+		}
+	}
+}
+
+// Warns when the workspace runs another Terraform version than the manifest pins. The apply goes ahead either way.
+func checkTerraformVersion(ctx context.Context, client *schematics.Client, ws manifestWorkspace) {
+	w, err := client.GetWorkspace(ctx, ws.WorkspaceID)
+	if err != nil {
+		logger.Warn("could not check the Terraform version: "+formatError(err), "workspace", ws.WorkspaceID)
+		return
+	}
+	if actual := w.TerraformVersion(); actual != ws.TerraformVersion {
+		logger.Warn(fmt.Sprintf("%s runs Terraform %s but the manifest pins %s; use workspace set-terraform-version to switch it",
+			ws.Name, orDash(actual), ws.TerraformVersion), "workspace", ws.WorkspaceID)
+	}
+}
+
+// Returns the name of the workspace that keeps ws from running action, or "" when there is none.
+func manifestBlocker(m *manifest, ws manifestWorkspace, action string, blocked map[string]string) string {
+	if action != "destroy" {
+		for _, dep := range ws.DependsOn {
+			if _, ok := blocked[dep]; ok {
+				return dep
+			}
+		}
+		return ""
+	}
+	for _, other := range m.Workspaces {
+		for _, dep := range other.DependsOn {
+			if _, ok := blocked[other.Name]; ok && dep == ws.Name {
+				return other.Name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The names of workspaces, in order.
+func manifestNames(workspaces []manifestWorkspace) []string {
+	names := make([]string, len(workspaces))
+	for i, ws := range workspaces {
+		names[i] = ws.Name
+	}
+	return names
+}
+
+func TestSortManifestWorkspaces(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifest  string
+		want      []string
+		wantError string
+	}{
+		{
+			name:     "no dependencies keeps the file order",
+			manifest: "c\nb\na",
+			want:     []string{"c", "b", "a"},
+		},
+		{
+			name:     "dependency first",
+			manifest: "cluster network\nnetwork",
+			want:     []string{"network", "cluster"},
+		},
+		{
+			name:     "chain",
+			manifest: "app cluster\ncluster network\nnetwork",
+			want:     []string{"network", "cluster", "app"},
+		},
+		{
+			name:     "diamond",
+			manifest: "app db cache\ndb network\ncache network\nnetwork",
+			want:     []string{"network", "db", "cache", "app"},
+		},
+		{
+			// each pass takes the ready workspaces in file order, so c, waiting for b, comes after a and d
+			name:     "stable around dependents",
+			manifest: "c b\nb\na\nd",
+			want:     []string{"b", "a", "d", "c"},
+		},
+		{
+			name:     "already ordered",
+			manifest: "network\ncluster network\napp cluster",
+			want:     []string{"network", "cluster", "app"},
+		},
+		{
+			name:      "cycle",
+			manifest:  "a b\nb c\nc a\nd",
+			wantError: "dependency cycle between [a b c]",
+		},
+		{
+			name:      "self dependency",
+			manifest:  "a a",
+			wantError: "dependency cycle between [a]",
+		},
+		{
+			name:      "cycle behind a dependency",
+			manifest:  "base\nx base y\ny x",
+			wantError: "dependency cycle between [x y]",
+		},
+		{
+			name:      "missing dependency",
+			manifest:  "cluster network",
+			wantError: `line 1: cluster depends on unknown workspace "network"`,
+		},
+		{
+			name:      "duplicate name",
+			manifest:  "a\na",
+			wantError: `line 2: duplicate workspace name "a"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// each line is a name followed by the names it depends on
+			var workspaces []manifestWorkspace
+			for i, line := range strings.Split(test.manifest, "\n") {
+				fields := strings.Fields(line)
+				workspaces = append(workspaces, manifestWorkspace{Name: fields[0], WorkspaceID: "ws-" + fields[0], DependsOn: fields[1:], line: i + 1})
+			}
+			ordered, err := sortManifestWorkspaces(workspaces)
+			if test.wantError != "" {
+				if err == nil || err.Error() != test.wantError {
+					t.Fatalf("error = %v, want %q", err, test.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := manifestNames(ordered); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("order = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	m, err := parseManifest([]byte(`workspaces:
+  - name: cluster
+    workspace_id: us-south.workspace.cluster.5e6f7a8b
+    depends_on: [network]
+    terraform_version: "v1.6"
+    vars:
+      workers: 3
+  - name: network
+    workspace_id: us-south.workspace.network.1a2b3c4d
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := manifestNames(m.Workspaces); !reflect.DeepEqual(got, []string{"network", "cluster"}) {
+		t.Errorf("order = %v, want [network cluster]", got)
+	}
+	if got := manifestNames(m.order("destroy")); !reflect.DeepEqual(got, []string{"cluster", "network"}) {
+		t.Errorf("destroy order = %v, want [cluster network]", got)
+	}
+	cluster := m.Workspaces[1]
+	if cluster.TerraformVersion != "1.6" || len(cluster.Vars) != 1 || cluster.Vars[0].Name != "workers" || cluster.Vars[0].Value != "3" {
+		t.Errorf("cluster = %+v", cluster)
+	}
+	if ids := m.workspaceIDs(); ids[0] != "us-south.workspace.network.1a2b3c4d" {
+		t.Errorf("workspace ids = %v", ids)
+	}
+
+	errors := []struct {
+		manifest string
+		want     string
+	}{
+		{"other: 1", `line 1: unknown key "other"`},
+		{"workspaces: []", "no workspaces listed"},
+		{"workspaces:\n  - name: a\n", "line 2: name and workspace_id are required"},
+		{"workspaces:\n  - name: a\n    workspace_id: x\n    colour: red", `line 4: unknown key "colour"`},
+		{"workspaces:\n  - name: a\n    workspace_id: x\n    depends_on: b", "line 4: depends_on must be a list"},
+		{"workspaces:\n  - name: a\n    workspace_id: x\n    depends_on: [b]", `a depends on unknown workspace "b"`},
+		{"workspaces:\n  - name: a\n    workspace_id: x\n    depends_on: [b]\n  - name: b\n    workspace_id: y\n    depends_on: [a]", "dependency cycle between [a b]"},
+	}
+	for _, test := range errors {
+		if _, err := parseManifest([]byte(test.manifest)); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("parseManifest(%q) error = %v, want %q", test.manifest, err, test.want)
+		}
+	}
+}
+
+func TestManifestBlocker(t *testing.T) {
+	m := &manifest{Workspaces: []manifestWorkspace{
+		{Name: "network"},
+		{Name: "cluster", DependsOn: []string{"network"}},
+		{Name: "app", DependsOn: []string{"cluster"}},
+	}}
+	blocked := map[string]string{"cluster": "failed"}
+	if got := manifestBlocker(m, m.Workspaces[2], "apply", blocked); got != "cluster" {
+		t.Errorf("apply of app blocked by %q, want cluster", got)
+	}
+	if got := manifestBlocker(m, m.Workspaces[0], "apply", blocked); got != "" {
+		t.Errorf("apply of network blocked by %q, want nothing", got)
+	}
+	// destroy runs in reverse: a failed dependent keeps what it depends on
+	if got := manifestBlocker(m, m.Workspaces[0], "destroy", blocked); got != "cluster" {
+		t.Errorf("destroy of network blocked by %q, want cluster", got)
+	}
+	if got := manifestBlocker(m, m.Workspaces[2], "destroy", blocked); got != "" {
+		t.Errorf("destroy of app blocked by %q, want nothing", got)
+	}
+}
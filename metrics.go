@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// upper bounds, in seconds, of the job duration histogram's buckets; Schematics jobs take from seconds to hours
+var jobDurationBuckets = []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600, 7200}
+
+// Counters and histograms of what a long-running mode did, served in the Prometheus text format on /metrics.
+type metrics struct {
+	mu            sync.Mutex
+	submitted     map[string]float64    // by action
+	failures      map[[2]string]float64 // by action and failure reason
+	durations     map[string]*histogram // by action, of jobs waited on to the end
+	tokenRenewals map[string]float64    // by result: ok or error
+}
+
+type histogram struct {
+	counts []float64 // per bucket of jobDurationBuckets, not cumulative
+	sum    float64
+	count  float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		submitted:     map[string]float64{},
+		failures:      map[[2]string]float64{},
+		durations:     map[string]*histogram{},
+		tokenRenewals: map[string]float64{},
+	}
+}
+
+// Records a finished step. Only jobs whose final status is known add to the duration histogram.
+func (m *metrics) observe(result runResult) {
+	if result.Skipped {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if result.ActivityID != "" {
+		m.submitted[result.Action]++
+	}
+	if result.failed() {
+		m.failures[[2]string{result.Action, failureReason(result)}]++
+	}
+	if result.JobStatus == "" || result.Error != "" {
+		return
+	}
+	h := m.durations[result.Action]
+	if h == nil {
+		h = &histogram{counts: make([]float64, len(jobDurationBuckets))}
+		m.durations[result.Action] = h
+	}
+	seconds := result.Duration.Seconds()
+	for i, bound := range jobDurationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// Records an attempt to renew the IAM token; for schematics.Client.OnTokenRenewal.
+func (m *metrics) tokenRenewed(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.tokenRenewals["error"]++
+	} else {
+		m.tokenRenewals["ok"]++
+	}
+}
+
+// The failure label for a failed step: job_<status> when the job itself failed, timeout when waiting on it gave up,
+// http_<code> when Schematics refused the call, and error for anything else, such as a preflight check.
+func failureReason(result runResult) string {
+	switch {
+	case result.JobStatus == "FAILED" || result.JobStatus == "CANCELLED" || result.JobStatus == "STOPPED":
+		return "job_" + strings.ToLower(result.JobStatus)
+	case result.JobStatus != "" && result.JobStatus != "COMPLETED":
+		return "timeout"
+	case result.StatusCode != 0 && (result.StatusCode < 200 || result.StatusCode >= 300):
+		return fmt.Sprintf("http_%d", result.StatusCode)
+	}
+	return "error"
+}
+
+// Writes every metric in the Prometheus text exposition format.
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP schematics_jobs_submitted_total Schematics jobs submitted, by action.")
+	fmt.Fprintln(w, "# TYPE schematics_jobs_submitted_total counter")
+	for _, action := range sortedKeys(m.submitted) {
+		fmt.Fprintf(w, "schematics_jobs_submitted_total{action=%s} %v\n", promLabel(action), m.submitted[action])
+	}
+
+	fmt.Fprintln(w, "# HELP schematics_job_failures_total Steps that failed, by action and reason (job_failed, timeout, http_<code> or error).")
+	fmt.Fprintln(w, "# TYPE schematics_job_failures_total counter")
+	keys := make([][2]string, 0, len(m.failures))
+	for key := range m.failures {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i][0]+"\x00"+keys[i][1] < keys[j][0]+"\x00"+keys[j][1] })
+	for _, key := range keys {
+		fmt.Fprintf(w, "schematics_job_failures_total{action=%s,reason=%s} %v\n", promLabel(key[0]), promLabel(key[1]), m.failures[key])
+	}
+
+	fmt.Fprintln(w, "# HELP schematics_job_duration_seconds Time from submitting a job to its final status, for jobs waited on.")
+	fmt.Fprintln(w, "# TYPE schematics_job_duration_seconds histogram")
+	actions := make([]string, 0, len(m.durations))
+	for action := range m.durations {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	for _, action := range actions {
+		h := m.durations[action]
+		cumulative := 0.0
+		for i, bound := range jobDurationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "schematics_job_duration_seconds_bucket{action=%s,le=\"%v\"} %v\n", promLabel(action), bound, cumulative)
+		}
+		fmt.Fprintf(w, "schematics_job_duration_seconds_bucket{action=%s,le=\"+Inf\"} %v\n", promLabel(action), h.count)
+		fmt.Fprintf(w, "schematics_job_duration_seconds_sum{action=%s} %v\n", promLabel(action), h.sum)
+		fmt.Fprintf(w, "schematics_job_duration_seconds_count{action=%s} %v\n", promLabel(action), h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP schematics_iam_token_renewals_total Attempts to renew the IAM access token, by result.")
+	fmt.Fprintln(w, "# TYPE schematics_iam_token_renewals_total counter")
+	for _, result := range sortedKeys(m.tokenRenewals) {
+		fmt.Fprintf(w, "schematics_iam_token_renewals_total{result=%s} %v\n", promLabel(result), m.tokenRenewals[result])
+	}
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+// Starts serving m on /metrics at addr, e.g. :9090, in the background. A listen failure is fatal.
+func serveMetrics(addr string, m *metrics) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fatalCode(exitInvalidInput, fmt.Errorf("--metrics-addr: %w", err))
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	logger.Info("serving metrics", "url", "http://"+listener.Addr().String()+"/metrics")
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("metrics server stopped", "error", err)
+		}
+	}()
+}
+
+// A quoted Prometheus label value.
+func promLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
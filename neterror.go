@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// exit code used when IBM Cloud cannot be reached at all
+const exitNetworkUnreachable = 4
+
+// Reports whether err means the host could not be reached: DNS failures, refused or
+// unreachable connections, dial timeouts and proxy connection failures.
+// Running out of the run's deadline is not treated as unreachable.
+func isNetworkUnreachable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "proxyconnect") {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENETUNREACH) || errors.Is(err, syscall.EHOSTUNREACH) {
+		return true
+	}
+	// proxy CONNECT failures surface as plain errors from net/http
+	return strings.Contains(err.Error(), "proxyconnect")
+}
+
+// Prints the "cannot reach" hint for endpoint and exits with exitNetworkUnreachable.
+func exitUnreachable(endpoint string, err error) {
+	host := endpoint
+	if u, perr := url.Parse(endpoint); perr == nil && u.Host != "" {
+		host = u.Host
+	}
+	logger.Debug(err.Error())
+	logger.Error(fmt.Sprintf("cannot reach %s; check network/proxy", host))
+	exit(exitNetworkUnreachable)
+}
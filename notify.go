@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// key that signs --notify-url payloads
+const notifySecretEnv = "SCHEMATICS_NOTIFY_SECRET"
+
+// header carrying the payload's signature: sha256= and the hex HMAC-SHA256 of the body under the notify secret
+const notifySignatureHeader = "X-Schematics-Signature"
+
+// The JSON body POSTed to --notify-url when a step finishes.
+type jobNotification struct {
+	WorkspaceID string `json:"workspace_id"`
+	Action      string `json:"action"`
+	ActivityID  string `json:"activity_id,omitempty"`
+	// COMPLETED or FAILED with --wait, otherwise SUBMITTED or FAILED
+	Status          string    `json:"status"`
+	OK              bool      `json:"ok"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Error           string    `json:"error,omitempty"`
+	FinishedAt      time.Time `json:"finished_at"`
+}
+
+// POSTs a jobNotification to a webhook for each finished step, signed when a secret is set.
+type notifier struct {
+	// set once connected to the schematics client's, so --ca-cert, proxies and --timeout apply
+	client *http.Client
+	url    string
+	host   string // logged instead of url, whose path may hold a token
+	secret []byte
+}
+
+// Checks --notify-url and reads the signing secret from the environment.
+func newNotifier(rawURL string) (*notifier, error) {
+	host, ok := webhookHost(rawURL, true)
+	if !ok {
+		return nil, fmt.Errorf("--notify-url %q: must be an http or https URL", rawURL)
+	}
+	n := &notifier{url: rawURL, host: host}
+	if secret := os.Getenv(notifySecretEnv); secret != "" {
+		n.secret = []byte(secret)
+		addSecret(secret)
+	} else {
+		logger.Warn("--notify-url: " + notifySecretEnv + " is not set, so the payloads are not signed")
+	}
+	return n, nil
+}
+
+// Sends the notification for result. Failures are logged and never fail the run; the job itself already finished.
+func (n *notifier) notify(ctx context.Context, result runResult) {
+	if result.Skipped {
+		return
+	}
+	payload := jobNotification{
+		WorkspaceID:     result.WorkspaceID,
+		Action:          result.Action,
+		ActivityID:      result.ActivityID,
+		Status:          stepStatus(result),
+		OK:              !result.failed(),
+		DurationSeconds: result.Duration.Seconds(),
+		Error:           redactString(result.Error),
+		FinishedAt:      time.Now().UTC(),
+	}
+	if err := n.post(ctx, payload); err != nil {
+		logger.Warn("webhook notification failed", "host", n.host, "error", formatError(err))
+	}
+}
+
+func (n *notifier) post(ctx context.Context, payload jobNotification) error {
+	var sign func(body []byte) http.Header
+	if n.secret != nil {
+		sign = func(body []byte) http.Header {
+			return http.Header{notifySignatureHeader: {signPayload(n.secret, body)}}
+		}
+	}
+	resp, _, err := postJSON(ctx, n.client, n.url, payload, sign)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("webhook answered " + resp.Status)
+	}
+	logger.Debug("sent webhook notification", "host", n.host, "action", payload.Action, "workspace", payload.WorkspaceID)
+	return nil
+}
+
+// The signature header value for body: sha256= and the hex HMAC-SHA256 under secret. A receiver recomputes it over
+// the raw body and compares in constant time.
+func signPayload(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// desired states of a SchematicsWorkspace, its spec.state
+const (
+	stateApplied   = "Applied"
+	stateDestroyed = "Destroyed"
+)
+
+// flags of `operator`
+type operatorOptions struct {
+	namespace      string
+	kubeAPIServer  string
+	kubeTokenFile  string
+	kubeCACert     string
+	resyncInterval time.Duration
+}
+
+// Builds the flag set for `operator`.
+func operatorFlags() (*flag.FlagSet, *globalOptions, *operatorOptions) {
+	fs := newFlagSet("operator", "operator [flags]", "Authenticates once, then watches SchematicsWorkspace resources in a Kubernetes cluster and reconciles each by "+
+		"setting its variables and applying or destroying the workspace until it is in the state the resource asks for. "+
+		"The last activity and its result are written to the resource's status. deploy/operator has the CRD and RBAC.")
+	global := &globalOptions{}
+	global.register(fs, false)
+	opts := &operatorOptions{}
+	fs.StringVar(&opts.namespace, "namespace", "", "only reconcile resources in this `namespace`; all namespaces when empty")
+	fs.StringVar(&opts.kubeAPIServer, "kube-api-server", "", "`URL` of the Kubernetes API, e.g. http://127.0.0.1:8001 from `kubectl proxy`; the pod's service account when empty")
+	fs.StringVar(&opts.kubeTokenFile, "kube-token-file", "", "`file` holding a bearer token for --kube-api-server")
+	fs.StringVar(&opts.kubeCACert, "kube-ca-cert", "", "PEM `file` of the CA that signed --kube-api-server's certificate")
+	fs.DurationVar(&opts.resyncInterval, "resync-interval", time.Minute, "how often every resource is reconciled again, which is also how often running jobs are checked")
+	return fs, global, opts
+}
+
+// `operator`: reconciles SchematicsWorkspaces until SIGINT or SIGTERM.
+// Each round lists every resource and reconciles it, then watches for changes until the next resync.
+func runOperatorCommand(_ string, args []string) {
+	fs, global, opts := operatorFlags()
+	parseFlags(fs, args)
+	if opts.resyncInterval < time.Second {
+		usageError(fs, errors.New("--resync-interval must be at least 1s"))
+	}
+	if err := global.validate(false); err != nil {
+		usageError(fs, err)
+	}
+	kube, err := newKubeClient(opts.kubeAPIServer, opts.kubeTokenFile, opts.kubeCACert)
+	if err != nil {
+		fatalCode(exitInvalidInput, err)
+	}
+	ctx, client := global.connect()
+	logger.Info("operator started", "api", kube.server, "namespace", orDash(opts.namespace))
+	for ctx.Err() == nil {
+		resources, resourceVersion, err := kube.list(ctx, opts.namespace)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			logger.Error(formatError(err))
+			sleep(ctx, opts.resyncInterval)
+			continue
+		}
+		for _, resource := range resources {
+			reconcileWorkspace(ctx, kube, client, resource)
+		}
+		err = kube.watch(ctx, opts.namespace, resourceVersion, opts.resyncInterval, func(resource schematicsWorkspaceResource) {
+			reconcileWorkspace(ctx, kube, client, resource)
+		})
+		if err != nil && ctx.Err() == nil {
+			logger.Warn(formatError(err) + "; listing again")
+		}
+	}
+	exit(exitOK)
+}
+
+// Moves one resource a step towards its spec and records what happened in its status. A job in progress is only
+// checked on; a new job is submitted when the spec changed since the last one, or when the last one never started.
+// Failed jobs are not retried until the spec changes.
+func reconcileWorkspace(ctx context.Context, kube *kubeClient, client *schematics.Client, resource schematicsWorkspaceResource) {
+	name := resource.Metadata.Namespace + "/" + resource.Metadata.Name
+	before := resource.Status
+	status := &resource.Status
+	defer func() {
+		if *status == before {
+			return
+		}
+		status.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		if err := kube.updateStatus(ctx, resource); err != nil && ctx.Err() == nil {
+			logger.Error(formatError(err), "resource", name)
+		}
+	}()
+	fail := func(message string) {
+		if status.Message != message {
+			logger.Error(message, "resource", name)
+		}
+		status.Message = message
+	}
+
+	action := ""
+	switch resource.Spec.State {
+	case stateApplied:
+		action = "apply"
+	case stateDestroyed:
+		action = "destroy"
+	default:
+		fail(fmt.Sprintf("spec.state is %q; it must be %s or %s", resource.Spec.State, stateApplied, stateDestroyed))
+		return
+	}
+
+	workspaceID := resource.Spec.WorkspaceID
+	if workspaceID == "" {
+		workspaceID = status.WorkspaceID
+	}
+	if workspaceID == "" {
+		if resource.Spec.State == stateDestroyed {
+			// nothing was ever created, so nothing needs destroying
+			status.Phase, status.ObservedGeneration, status.Message = stateDestroyed, resource.Metadata.Generation, ""
+			return
+		}
+		ws, err := createResourceWorkspace(ctx, client, resource)
+		if err != nil {
+			fail(formatError(err))
+			return
+		}
+		logger.Info("created workspace", "resource", name, "workspace", ws.ID)
+		workspaceID = ws.ID
+	}
+	status.WorkspaceID = workspaceID
+
+	if status.LastActivityID != "" && !schematics.IsTerminalStatus(status.LastResult) {
+		activity, err := client.GetActivity(ctx, workspaceID, status.LastActivityID)
+		if err != nil {
+			fail(formatError(err))
+			return
+		}
+		if activity.Status != status.LastResult {
+			logger.Info("job status", "resource", name, "activity", status.LastActivityID, "status", activity.Status)
+		}
+		status.LastResult, status.Message = activity.Status, activity.Message
+		if !schematics.IsTerminalStatus(activity.Status) {
+			return
+		}
+		switch {
+		case activity.Status != "COMPLETED":
+			status.Phase = "Failed"
+			if status.Message == "" {
+				status.Message = fmt.Sprintf("%s job finished with status %s", status.LastAction, activity.Status)
+			}
+		case status.LastAction == "destroy":
+			status.Phase = stateDestroyed
+		default:
+			status.Phase = stateApplied
+		}
+	}
+	if status.LastActivityID != "" && status.ObservedGeneration == resource.Metadata.Generation {
+		// the job for this spec has already run, or is still running
+		return
+	}
+
+	if len(resource.Spec.Variables) > 0 && action == "apply" {
+		if err := client.SetVariables(ctx, workspaceID, resourceVariables(resource.Spec.Variables)); err != nil {
+			fail(formatError(err))
+			return
+		}
+	}
+	result, err := client.RunAction(ctx, action, workspaceID)
+	if err != nil {
+		// e.g. 409 while another job runs on the workspace; tried again on the next event or resync
+		fail(formatError(err))
+		return
+	}
+	logger.Info("submitted job", "resource", name, "action", action, "workspace", workspaceID, "activity", result.ActivityID)
+	status.LastAction, status.LastActivityID, status.LastResult = action, result.ActivityID, "SUBMITTED"
+	status.ObservedGeneration, status.Message = resource.Metadata.Generation, ""
+	status.Phase = "Applying"
+	if action == "destroy" {
+		status.Phase = "Destroying"
+	}
+}
+
+// Creates the workspace spec.template describes, named after the resource unless the template names it.
+func createResourceWorkspace(ctx context.Context, client *schematics.Client, resource schematicsWorkspaceResource) (schematics.Workspace, error) {
+	template := resource.Spec.Template
+	if template == nil || template.Repo == "" {
+		return schematics.Workspace{}, errors.New("spec needs a workspaceID or a template.repo to create the workspace from")
+	}
+	name := template.Name
+	if name == "" {
+		name = resource.Metadata.Name
+	}
+	return client.CreateWorkspace(ctx, schematics.CreateWorkspaceOptions{
+		Name:             name,
+		Description:      "managed by the SchematicsWorkspace " + resource.Metadata.Namespace + "/" + resource.Metadata.Name,
+		ResourceGroup:    template.ResourceGroup,
+		Location:         template.Location,
+		Tags:             template.Tags,
+		TemplateRepo:     template.Repo,
+		Branch:           template.Branch,
+		Folder:           template.Folder,
+		TerraformVersion: template.TerraformVersion,
+	})
+}
+
+// spec.variables as Schematics variables, sorted by name so every reconcile writes them in the same order.
+func resourceVariables(variables map[string]string) []schematics.Variable {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	updates := make([]schematics.Variable, len(names))
+	for i, name := range names {
+		updates[i] = schematics.Variable{Name: strings.TrimSpace(name), Value: variables[name]}
+	}
+	return updates
+}
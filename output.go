@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// formats --output accepts; go-template is followed by =TEMPLATE
+const (
+	outputText       = "text"
+	outputJSON       = "json"
+	outputGoTemplate = "go-template"
+)
+
+// Checks the --output value and parses its template, if any.
+func parseOutput(format string) (*template.Template, error) {
+	switch format {
+	case outputText, outputJSON:
+		return nil, nil
+	}
+	if text, ok := strings.CutPrefix(format, outputGoTemplate+"="); ok {
+		tmpl, err := template.New("output").Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("--output: %w", err)
+		}
+		// catch unknown fields now rather than after the jobs ran
+		if err := tmpl.Execute(io.Discard, runResult{Plan: &schematics.PlanSummary{}}); err != nil {
+			return nil, fmt.Errorf("--output: %w", err)
+		}
+		return tmpl, nil
+	}
+	return nil, fmt.Errorf("--output %q: must be %s, %s or %s=TEMPLATE", format, outputText, outputJSON, outputGoTemplate)
+}
+
+// Sets up the run's output on stdout. In text mode stdout carries the job logs. In JSON and template mode it carries
+// only the results, written when the run ends (even if it ends early), and the job logs move to stderr.
+// A template is executed once per step with its runResult, e.g. {{.ActivityID}}, {{.JobStatus}} or {{.Duration}}.
+// --quiet text output carries only the activity ids, so job logs are not followed.
+func configureOutput(format string, tmpl *template.Template, results *[]runResult, opts *stepOptions) {
+	if format == outputText {
+		opts.LogOutput = redactingWriter{os.Stdout}
+		opts.Progress = opts.Progress && isTerminal(os.Stdout)
+		if quiet {
+			opts.FollowLogs = false
+			opts.Progress = false
+		}
+		return
+	}
+	opts.LogOutput = redactingWriter{os.Stderr}
+	opts.Progress = opts.Progress && isTerminal(os.Stderr)
+	atExit(func() {
+		var err error
+		if tmpl != nil {
+			err = writeResultTemplate(tmpl, *results)
+		} else {
+			err = writeResultJSON(os.Stdout, *results)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, formatError(err))
+		}
+	})
+}
+
+// Executes tmpl for each result, ending each one's output with a newline.
+func writeResultTemplate(tmpl *template.Template, results []runResult) error {
+	for _, result := range results {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, result); err != nil {
+			return fmt.Errorf("--output: %w", err)
+		}
+		out := b.String()
+		if !strings.HasSuffix(out, "\n") {
+			out += "\n"
+		}
+		if _, err := (redactingWriter{os.Stdout}).Write([]byte(out)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// --format values of `outputs`
+const (
+	outputsJSON   = "json"
+	outputsDotenv = "dotenv"
+	outputsExport = "export"
+)
+
+// Builds the flag set for `outputs`.
+func outputsFlags(name string) (*flag.FlagSet, *globalOptions, *string) {
+	fs := newFlagSet(name, name+" <workspace-id> [flags]", "Prints the Terraform outputs of a Schematics workspace. The id may also be given with --workspace-id or --crn. "+
+		"dotenv and export print one NAME=value line per output, with the name upper-cased, for `source` or an env file. Sensitive outputs are included.")
+	global := &globalOptions{}
+	global.register(fs, true)
+	format := fs.String("format", outputsJSON, "output format: json for an object of output values, dotenv, or export for shell `export` lines")
+	return fs, global, format
+}
+
+// `outputs <id>`: prints the workspace's outputs in --format.
+func runOutputsCommand(name string, args []string) {
+	fs, global, format := outputsFlags(name)
+	switch rest := parseFlagsArgs(fs, args); len(rest) {
+	case 0:
+	case 1:
+		global.workspaceID = rest[0]
+	default:
+		usageError(fs, fmt.Errorf("unexpected argument %q", rest[1]))
+	}
+	switch *format {
+	case outputsJSON, outputsDotenv, outputsExport:
+	default:
+		usageError(fs, fmt.Errorf("--format %q: must be %s, %s or %s", *format, outputsJSON, outputsDotenv, outputsExport))
+	}
+	if err := global.validate(true); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	outputs, err := client.GetOutputs(ctx, global.workspaceID)
+	if err != nil {
+		fatal(err)
+	}
+	if err := writeOutputs(os.Stdout, *format, outputs); err != nil {
+		fatal(err)
+	}
+}
+
+// Writes outputs to w in format. The values are written verbatim, since the next stage needs them.
+func writeOutputs(w io.Writer, format string, outputs []schematics.Output) error {
+	if format == outputsJSON {
+		values := map[string]json.RawMessage{}
+		for _, output := range outputs {
+			values[output.Name] = output.Value
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(values)
+	}
+	for _, output := range outputs {
+		name, value := envName(output.Name), outputString(output.Value)
+		var line string
+		if format == outputsExport {
+			line = "export " + name + "=" + shellQuote(value)
+		} else {
+			line = name + "=" + dotenvQuote(value)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// An environment variable name for a Terraform output: upper case, with anything but letters, digits and _ replaced by _.
+func envName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// A string output as its text, anything else as compact JSON.
+func outputString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return string(raw)
+	}
+	return compact.String()
+}
+
+// Quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Quotes s as a double-quoted dotenv value.
+func dotenvQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "$", `\$`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,110 @@
+package schematics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// An Authenticator obtains the IAM token Schematics calls are made with. Login calls it once, and the client
+// calls it again whenever the token nears expiry and its refresh token can't be used. That happens with the
+// client's token lock held, so Token must not call Token, SetToken or Login on c.
+type Authenticator interface {
+	Token(ctx context.Context, c *Client) (Token, error)
+}
+
+// Authenticates with auth and keeps it for renewing the token.
+func (c *Client) Login(ctx context.Context, auth Authenticator) error {
+	token, err := auth.Token(ctx, c)
+	if err != nil {
+		return err
+	}
+	c.SetToken(token)
+	c.SetAuthenticator(auth, TrustedProfile{})
+	return nil
+}
+
+// APIKeyAuthenticator exchanges an IBM Cloud API key for a token.
+type APIKeyAuthenticator struct {
+	APIKey string
+}
+
+// The call to IAM is the one shown on Authenticate.
+func (a APIKeyAuthenticator) Token(ctx context.Context, c *Client) (Token, error) {
+	if a.APIKey == "" {
+		return Token{}, errors.New("no API key")
+	}
+	token, err := c.requestToken(ctx, apiKeyGrant(a.APIKey), "Basic Yng6Yng=")
+	if err != nil {
+		return token, fmt.Errorf("requesting IAM token: %w", err)
+	}
+	return token, nil
+}
+
+// BearerTokenAuthenticator passes on a token obtained elsewhere, e.g. `ibmcloud iam oauth-tokens`. It can't
+// obtain a new one, so once the token expires only its refresh token, if any, keeps the client going.
+type BearerTokenAuthenticator struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+func (a BearerTokenAuthenticator) Token(ctx context.Context, c *Client) (Token, error) {
+	token := Token{AccessToken: strings.TrimPrefix(a.AccessToken, "Bearer "), RefreshToken: a.RefreshToken}
+	if token.AccessToken == "" {
+		return token, errors.New("no bearer token")
+	}
+	if claims, err := DecodeTokenClaims(token.AccessToken); err == nil {
+		token.Expiration = int(claims.ExpiresAt)
+	}
+	if token.ExpiresWithin(0) {
+		return token, errors.New("the bearer token has expired and cannot be renewed")
+	}
+	return token, nil
+}
+
+// TokenFileAuthenticator reads the token from a file that something else keeps current, such as a sidecar.
+// The file holds a bare access token or a JSON object like the IAM token response; it is read again on
+// every renewal.
+type TokenFileAuthenticator struct {
+	Path string
+}
+
+func (a TokenFileAuthenticator) Token(ctx context.Context, c *Client) (Token, error) {
+	data, err := ioutil.ReadFile(a.Path)
+	if err != nil {
+		return Token{}, fmt.Errorf("reading token file: %w", err)
+	}
+	token, err := ParseToken(string(data))
+	if err != nil {
+		return token, fmt.Errorf("token file %s: %w", a.Path, err)
+	}
+	return token, nil
+}
+
+// Reads a token printed by a credential helper or written to a token file: either a bare access token or a
+// JSON object with access_token and optionally refresh_token and expiration.
+func ParseToken(text string) (Token, error) {
+	var token Token
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return token, errors.New("no token")
+	}
+	if strings.HasPrefix(text, "{") {
+		if err := json.Unmarshal([]byte(text), &token); err != nil {
+			return token, fmt.Errorf("malformed JSON: %w", err)
+		}
+		if token.AccessToken == "" {
+			return token, errors.New("JSON has no access_token")
+		}
+		return token, nil
+	}
+	// a bare token must be a single line without spaces
+	if strings.ContainsAny(text, " \t\r\n") {
+		return token, errors.New("neither a JSON object nor a single token")
+	}
+	token.AccessToken = text
+	return token, nil
+}
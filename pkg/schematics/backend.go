@@ -0,0 +1,19 @@
+package schematics
+
+import "context"
+
+// Backend sends a Client's workspace and job calls in its place, for instance through the official IBM Cloud
+// Schematics Go SDK as package sdkbackend does. Apply, Destroy, Plan, Refresh, RunAction, GetWorkspace,
+// ListWorkspaces, ListActivities, GetActivity and everything built on them go through it; authentication, logs,
+// outputs, state and variables stay with the Client.
+// Errors for non-2xx responses should be *APIError, so callers can tell a 409 from other failures.
+type Backend interface {
+	// submits the action (apply, destroy, plan or refresh); the result is filled in on a non-2xx answer too
+	RunAction(ctx context.Context, action string, workspaceID string, opts ActionOptions) (ActionResult, error)
+	GetWorkspace(ctx context.Context, workspaceID string) (Workspace, error)
+	// every workspace in the region, across pages
+	ListWorkspaces(ctx context.Context) ([]Workspace, error)
+	// most recent first
+	ListActivities(ctx context.Context, workspaceID string) ([]Activity, error)
+	GetActivity(ctx context.Context, workspaceID string, activityID string) (Activity, error)
+}
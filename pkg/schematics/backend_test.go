@@ -0,0 +1,139 @@
+package schematics_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// A Backend recording its calls and answering from its fields.
+type stubBackend struct {
+	calls      []string
+	options    schematics.ActionOptions
+	result     schematics.ActionResult
+	workspace  schematics.Workspace
+	workspaces []schematics.Workspace
+	activities []schematics.Activity
+	err        error
+}
+
+func (b *stubBackend) RunAction(_ context.Context, action string, workspaceID string, opts schematics.ActionOptions) (schematics.ActionResult, error) {
+	b.calls = append(b.calls, action+" "+workspaceID)
+	b.options = opts
+	return b.result, b.err
+}
+
+func (b *stubBackend) GetWorkspace(_ context.Context, workspaceID string) (schematics.Workspace, error) {
+	b.calls = append(b.calls, "get "+workspaceID)
+	return b.workspace, b.err
+}
+
+func (b *stubBackend) ListWorkspaces(context.Context) ([]schematics.Workspace, error) {
+	b.calls = append(b.calls, "list")
+	return b.workspaces, b.err
+}
+
+func (b *stubBackend) ListActivities(_ context.Context, workspaceID string) ([]schematics.Activity, error) {
+	b.calls = append(b.calls, "activities "+workspaceID)
+	return b.activities, b.err
+}
+
+func (b *stubBackend) GetActivity(_ context.Context, workspaceID string, activityID string) (schematics.Activity, error) {
+	b.calls = append(b.calls, "activity "+workspaceID+" "+activityID)
+	for _, activity := range b.activities {
+		if activity.ActionID == activityID {
+			return activity, b.err
+		}
+	}
+	return schematics.Activity{}, b.err
+}
+
+// Fails the test on any HTTP request: with a Backend set, the delegated calls must not send their own.
+type noRequests struct {
+	t *testing.T
+}
+
+func (n noRequests) RoundTrip(req *http.Request) (*http.Response, error) {
+	n.t.Errorf("unexpected %s %s", req.Method, req.URL)
+	return nil, errors.New("no requests expected")
+}
+
+func backendClient(t *testing.T, backend schematics.Backend) *schematics.Client {
+	client := schematics.NewClient(schematics.WithHTTPClient(&http.Client{Transport: noRequests{t}}))
+	client.Backend = backend
+	return client
+}
+
+func TestBackendReceivesWorkspaceCalls(t *testing.T) {
+	backend := &stubBackend{
+		result:     schematics.ActionResult{ActivityID: "act-1", StatusCode: http.StatusAccepted},
+		workspace:  schematics.Workspace{ID: "ws-1", Status: "ACTIVE"},
+		workspaces: []schematics.Workspace{{ID: "ws-1"}, {ID: "ws-2"}},
+		activities: []schematics.Activity{{ActionID: "act-1", Status: "COMPLETED"}},
+	}
+	client := backendClient(t, backend)
+	ctx := context.Background()
+
+	result, err := client.RunActionWithOptions(ctx, "apply", "ws-1", schematics.ActionOptions{Targets: []string{"module.a"}})
+	if err != nil || result.ActivityID != "act-1" {
+		t.Fatalf("RunActionWithOptions = %+v, %v", result, err)
+	}
+	if !reflect.DeepEqual(backend.options.Targets, []string{"module.a"}) {
+		t.Errorf("targets = %v, want [module.a]", backend.options.Targets)
+	}
+	if _, err := client.Plan(ctx, "ws-1"); err != nil {
+		t.Fatal(err)
+	}
+	if ws, err := client.GetWorkspace(ctx, "ws-1"); err != nil || ws.Status != "ACTIVE" {
+		t.Fatalf("GetWorkspace = %+v, %v", ws, err)
+	}
+	if list, err := client.ListWorkspaces(ctx); err != nil || len(list) != 2 {
+		t.Fatalf("ListWorkspaces = %+v, %v", list, err)
+	}
+	if list, err := client.ListActivities(ctx, "ws-1"); err != nil || len(list) != 1 {
+		t.Fatalf("ListActivities = %+v, %v", list, err)
+	}
+	if activity, err := client.GetActivity(ctx, "ws-1", "act-1"); err != nil || activity.Status != "COMPLETED" {
+		t.Fatalf("GetActivity = %+v, %v", activity, err)
+	}
+
+	want := []string{"apply ws-1", "plan ws-1", "get ws-1", "list", "activities ws-1", "activity ws-1 act-1"}
+	if !reflect.DeepEqual(backend.calls, want) {
+		t.Errorf("calls = %q, want %q", backend.calls, want)
+	}
+}
+
+func TestBackendErrorsKeepAPIError(t *testing.T) {
+	backend := &stubBackend{
+		result: schematics.ActionResult{StatusCode: http.StatusConflict, Status: "409 Conflict"},
+		err:    &schematics.APIError{StatusCode: http.StatusConflict, Status: "409 Conflict"},
+	}
+	client := backendClient(t, backend)
+
+	result, err := client.Apply(context.Background(), "ws-1")
+	var apiErr *schematics.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Fatalf("Apply error = %v, want a 409 *APIError", err)
+	}
+	if result.StatusCode != http.StatusConflict {
+		t.Errorf("result status = %d, want the backend's 409", result.StatusCode)
+	}
+	if _, err := client.GetWorkspace(context.Background(), "ws-1"); !errors.As(err, &apiErr) {
+		t.Errorf("GetWorkspace error = %v, want an *APIError", err)
+	}
+}
+
+func TestBackendUnknownActionNotDelegated(t *testing.T) {
+	backend := &stubBackend{}
+	client := backendClient(t, backend)
+	if _, err := client.RunAction(context.Background(), "import", "ws-1"); err == nil {
+		t.Fatal("RunAction(import) succeeded, want an unsupported action error")
+	}
+	if len(backend.calls) != 0 {
+		t.Errorf("backend received %q", backend.calls)
+	}
+}
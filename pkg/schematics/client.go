@@ -0,0 +1,369 @@
+// Package schematics is a small client for the IBM Cloud IAM token endpoint and the IBM Cloud Schematics workspace API.
+// It backs the schematics-apply-destroy command and can be imported by other Go programs.
+// Every call returns an error instead of panicking or exiting.
+package schematics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// default base URLs for IAM and the global Schematics API
+const (
+	DefaultIAMEndpoint        = "https://iam.cloud.ibm.com"
+	DefaultSchematicsEndpoint = "https://schematics.cloud.ibm.com"
+
+	// IAM on the IBM Cloud private network; see PrivateRegionEndpoint for Schematics
+	DefaultPrivateIAMEndpoint = "https://private.iam.cloud.ibm.com"
+)
+
+// Client talks to IAM and Schematics on behalf of one identity.
+// Create it with NewClient, adjust the exported fields if needed, then call Authenticate (or Login, or SetTokens) before any workspace call,
+// unless it was built WithAPIKey, which logs it in on its first call.
+// The access token is renewed transparently when it nears expiry, so a Client can outlive its first token.
+// A Client is not safe for concurrent use while it is being authenticated.
+type Client struct {
+	// base URLs, without a trailing slash
+	IAMEndpoint        string
+	SchematicsEndpoint string
+
+	// client used for every request
+	HTTPClient *http.Client
+
+	// sent as the User-Agent of every request when set
+	UserAgent string
+
+	// extra attempts a request gets when the host name can't be resolved, and the delay before the first of them (doubled after each)
+	DNSRetries    int
+	DNSRetryDelay time.Duration
+
+	// how IAM and Schematics requests answered with 429 or a 5xx status are retried
+	Retry RetryPolicy
+
+	// shared by every request, retries included; nil sends requests as fast as they come
+	RateLimit *RateLimiter
+
+	// receives progress messages at Info and Warn, and every request and response at Debug; nil silences them
+	Logger *slog.Logger
+
+	// how long before its expiry the access token is renewed; 0 disables renewal
+	TokenRefreshMargin time.Duration
+
+	// sends the workspace and job calls instead of the client's own requests when set; see Backend
+	Backend Backend
+
+	// keep what the last Schematics response carried for LastResponse; off by default
+	KeepLastResponse bool
+
+	// called with each token the client obtains by itself, logging in on its first call or renewing, e.g. to mask
+	// it in logs; nil is not called. Like OnTokenRenewal it runs with the token lock held.
+	OnNewToken func(Token)
+
+	// called after each attempt to renew the access token, with its error or nil; nil is not called. It runs while
+	// the client holds its token lock, so it must not call the client.
+	OnTokenRenewal func(err error)
+
+	// the token Schematics calls are made with, and what renewing it takes; guarded by tokenMu
+	tokenMu sync.Mutex
+	token   Token
+	auth    Authenticator   // obtains a new token; nil when the token can only be refreshed
+	profile *TrustedProfile // assumed on top of what auth obtains
+
+	// the last Schematics response when KeepLastResponse is set; guarded by responseMu
+	responseMu   sync.Mutex
+	lastResponse *ResponseInfo
+
+	// set by an Option that couldn't be applied; every request fails with it
+	optionErr error
+}
+
+// at most this much of a response body is kept for LastResponse
+const MaxKeptResponseBody = 64 << 10
+
+// ResponseInfo is what a Schematics response carried, for callers who need more than a method's result models.
+type ResponseInfo struct {
+	Method        string
+	URL           string
+	StatusCode    int
+	Status        string
+	Header        http.Header
+	TransactionID string
+	// the first MaxKeptResponseBody bytes of the body; Truncated says whether there was more
+	Body      []byte
+	Truncated bool
+}
+
+// Returns the last Schematics response the client received, with ok false if KeepLastResponse is off or no
+// response came yet. Error responses count; IAM token responses, calls sent through Backend and requests that
+// got no response don't. Safe to call while other calls are in flight.
+func (c *Client) LastResponse() (info ResponseInfo, ok bool) {
+	c.responseMu.Lock()
+	defer c.responseMu.Unlock()
+	if c.lastResponse == nil {
+		return ResponseInfo{}, false
+	}
+	return *c.lastResponse, true
+}
+
+// Keeps resp, whose body was body, for LastResponse when KeepLastResponse is set.
+func (c *Client) keepResponse(method string, endpoint string, resp *http.Response, body []byte) {
+	if !c.KeepLastResponse {
+		return
+	}
+	info := &ResponseInfo{
+		Method:        method,
+		URL:           endpoint,
+		StatusCode:    resp.StatusCode,
+		Status:        resp.Status,
+		Header:        resp.Header.Clone(),
+		TransactionID: TransactionID(resp.Header),
+	}
+	if len(body) > MaxKeptResponseBody {
+		body, info.Truncated = body[:MaxKeptResponseBody], true
+	}
+	info.Body = append([]byte(nil), body...)
+	c.responseMu.Lock()
+	c.lastResponse = info
+	c.responseMu.Unlock()
+}
+
+// Returns a Client targeting the global IAM and Schematics endpoints with its own http.Client, which honours
+// HTTPS_PROXY and NO_PROXY; replace it with one from NewHTTPClient to trust extra CAs. opts adjust it in order, e.g.
+//
+//	client := schematics.NewClient(schematics.WithAPIKey(apiKey), schematics.WithRegion("eu-de"), schematics.WithRetry(5))
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		IAMEndpoint:        DefaultIAMEndpoint,
+		SchematicsEndpoint: DefaultSchematicsEndpoint,
+		HTTPClient:         &http.Client{Transport: newTransport()},
+		DNSRetries:         3,
+		DNSRetryDelay:      500 * time.Millisecond,
+		Retry:              DefaultRetryPolicy(),
+		TokenRefreshMargin: 5 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Like NewClient, with every request sent through httpClient, e.g. one with a recording or fake Transport, or the
+// client of an httptest.Server such as the one package schematicstest provides. nil means NewClient's own.
+func NewClientWithHTTPClient(httpClient *http.Client) *Client {
+	return NewClient(WithHTTPClient(httpClient))
+}
+
+// Error returned for a non-2xx response from IAM or Schematics.
+type APIError struct {
+	Method        string
+	URL           string
+	StatusCode    int
+	Status        string
+	TransactionID string
+	// the correlation id the request was sent with, and the X-Request-Id IBM Cloud answered with
+	CorrelationID string
+	RequestID     string
+	Body          []byte
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Status)
+	switch {
+	case e.CorrelationID != "" && e.RequestID != "":
+		msg += fmt.Sprintf(" (correlation id %s, request id %s)", e.CorrelationID, e.RequestID)
+	case e.CorrelationID != "":
+		msg += fmt.Sprintf(" (correlation id %s)", e.CorrelationID)
+	case e.RequestID != "":
+		msg += fmt.Sprintf(" (request id %s)", e.RequestID)
+	}
+	if len(e.Body) > 0 {
+		msg += ": " + string(e.Body)
+	}
+	return msg
+}
+
+// Builds the *APIError for a non-2xx resp to method and endpoint, whose body was body.
+func newAPIError(method string, endpoint string, resp *http.Response, body []byte) *APIError {
+	err := &APIError{
+		Method:        method,
+		URL:           endpoint,
+		StatusCode:    resp.StatusCode,
+		Status:        resp.Status,
+		TransactionID: TransactionID(resp.Header),
+		RequestID:     resp.Header.Get(RequestIDHeader),
+		Body:          body,
+	}
+	if resp.Request != nil {
+		err.CorrelationID = resp.Request.Header.Get(CorrelationIDHeader)
+	}
+	return err
+}
+
+// Returns the transaction id IBM Cloud attached to a response, for quoting in support cases.
+func TransactionID(header http.Header) string {
+	for _, name := range []string{"Transaction-Id", "X-Request-Id", "X-Correlation-Id"} {
+		if id := header.Get(name); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+func (c *Client) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	if c.Logger != nil {
+		c.Logger.Log(ctx, level, msg, args...)
+	}
+}
+
+// Sends req under ctx. Name-resolution failures, which are common in freshly-started containers whose resolver
+// isn't ready yet, are retried up to DNSRetries times with a short doubling delay. Responses with a retryable
+// status are retried according to c.Retry. Every other error is returned straight away.
+func (c *Client) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if c.optionErr != nil {
+		return nil, c.optionErr
+	}
+	req = req.WithContext(ctx)
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	// every request of an operation shares its id; one without an operation gets one of its own
+	correlationID := CorrelationID(ctx)
+	if correlationID == "" {
+		correlationID = NewCorrelationID()
+	}
+	req.Header.Set(CorrelationIDHeader, correlationID)
+	// a body that can't be replayed can only be sent once
+	canRetry := req.Body == nil || req.GetBody != nil
+	dnsDelay := c.DNSRetryDelay
+	dnsAttempts, statusAttempts := 0, 1
+	for {
+		if c.RateLimit != nil {
+			if err := c.RateLimit.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		start := time.Now()
+		resp, err := c.HTTPClient.Do(req)
+		if err == nil {
+			args := []any{"method", req.Method, "url", req.URL.Redacted(), "status", resp.Status, "duration", time.Since(start).Round(time.Millisecond)}
+			if id := resp.Header.Get(RequestIDHeader); id != "" {
+				args = append(args, "request_id", id)
+			}
+			c.log(ctx, slog.LevelDebug, "HTTP request", args...)
+		}
+		var delay time.Duration
+		var dnsErr *net.DNSError
+		switch {
+		case !canRetry:
+			return resp, err
+		case err != nil && errors.As(err, &dnsErr) && dnsAttempts < c.DNSRetries:
+			dnsAttempts++
+			delay = dnsDelay
+			dnsDelay *= 2
+			c.log(ctx, slog.LevelWarn, "cannot resolve host, retrying", "host", dnsErr.Name, "delay", delay)
+		case err == nil && retryableStatus(resp.StatusCode) && statusAttempts < c.Retry.MaxAttempts:
+			delay = c.Retry.backoff(statusAttempts, resp.Header)
+			statusAttempts++
+			c.log(ctx, slog.LevelWarn, "request failed, retrying", "method", req.Method, "url", req.URL.Redacted(), "status", resp.Status, "delay", delay.Round(time.Millisecond), "attempt", statusAttempts, "max_attempts", c.Retry.MaxAttempts)
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		default:
+			return resp, err
+		}
+		if req.Body != nil {
+			body, berr := req.GetBody()
+			if berr != nil {
+				return nil, berr
+			}
+			req.Body = body
+		}
+		if serr := sleep(ctx, delay); serr != nil {
+			return nil, serr
+		}
+	}
+}
+
+// Sends an authenticated Schematics request and returns the response with its body read.
+// Non-2xx responses are returned as *APIError.
+func (c *Client) send(ctx context.Context, method string, endpoint string, body io.Reader) (*http.Response, []byte, error) {
+	if c.optionErr != nil {
+		return nil, nil, c.optionErr
+	}
+	token, err := c.currentToken(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, nil, errors.New("schematics: client is not authenticated")
+	}
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Refresh_token", token.RefreshToken)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, nil, err
+	}
+	c.keepResponse(method, endpoint, resp, data)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, data, newAPIError(method, endpoint, resp, data)
+	}
+	return resp, data, nil
+}
+
+// Sends an authenticated GET to endpoint and decodes the JSON response into v.
+func (c *Client) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	_, body, err := c.send(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// Sends an authenticated request with v encoded as its JSON body and decodes the JSON response into out, if set.
+func (c *Client) sendJSON(ctx context.Context, method string, endpoint string, v interface{}, out interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, body, err := c.send(ctx, method, endpoint, bytes.NewReader(data))
+	if err != nil || out == nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+// Waits for d, returning early with the context error if ctx ends first. A var so tests can record the delays
+// instead of waiting them out.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
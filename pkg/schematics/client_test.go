@@ -0,0 +1,109 @@
+package schematics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A Transport failing its first failures requests with a name-resolution error and answering 200 after that.
+type dnsFailures struct {
+	failures int
+	calls    int
+}
+
+func (d *dnsFailures) RoundTrip(req *http.Request) (*http.Response, error) {
+	d.calls++
+	if d.calls <= d.failures {
+		return nil, &net.DNSError{Err: "no such host", Name: req.URL.Hostname(), IsNotFound: true}
+	}
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{}")), Request: req}, nil
+}
+
+// Replaces sleep for the test, returning the delays it was asked for.
+func recordSleeps(t *testing.T) *[]time.Duration {
+	var delays []time.Duration
+	saved := sleep
+	sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	t.Cleanup(func() { sleep = saved })
+	return &delays
+}
+
+func dnsClient(transport http.RoundTripper, retries int) *Client {
+	c := NewClient(WithHTTPClient(&http.Client{Transport: transport}))
+	c.DNSRetries = retries
+	c.DNSRetryDelay = 100 * time.Millisecond
+	return c
+}
+
+func TestDNSRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		retries    int
+		wantCalls  int
+		wantDelays []time.Duration
+		wantErr    bool
+	}{
+		{"one failure", 1, 3, 2, []time.Duration{100 * time.Millisecond}, false},
+		{"delay doubles", 3, 3, 4, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}, false},
+		{"beyond DNSRetries", 2, 1, 2, []time.Duration{100 * time.Millisecond}, true},
+		{"retries disabled", 1, 0, 1, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delays := recordSleeps(t)
+			transport := &dnsFailures{failures: test.failures}
+			c := dnsClient(transport, test.retries)
+			req, _ := http.NewRequest(http.MethodGet, "https://schematics.invalid/v1/workspaces", nil)
+
+			resp, err := c.do(context.Background(), req)
+			if transport.calls != test.wantCalls {
+				t.Errorf("sent %d requests, want %d", transport.calls, test.wantCalls)
+			}
+			if !reflect.DeepEqual(*delays, test.wantDelays) {
+				t.Errorf("delays = %v, want %v", *delays, test.wantDelays)
+			}
+			if !test.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				return
+			}
+			// the last error is returned as the HTTP client reported it
+			var dnsErr *net.DNSError
+			if !errors.As(err, &dnsErr) || dnsErr.Name != "schematics.invalid" {
+				t.Fatalf("error = %v, want the *net.DNSError for schematics.invalid", err)
+			}
+		})
+	}
+}
+
+func TestDNSRetryStopsWithContext(t *testing.T) {
+	saved := sleep
+	t.Cleanup(func() { sleep = saved })
+	ctx, cancel := context.WithCancel(context.Background())
+	sleep = func(ctx context.Context, _ time.Duration) error {
+		cancel()
+		return ctx.Err()
+	}
+	transport := &dnsFailures{failures: 5}
+	req, _ := http.NewRequest(http.MethodGet, "https://schematics.invalid/v1/workspaces", nil)
+
+	if _, err := dnsClient(transport, 3).do(ctx, req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	if transport.calls != 1 {
+		t.Errorf("sent %d requests, want 1", transport.calls)
+	}
+}
@@ -0,0 +1,21 @@
+package schematics
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time and waits, for WaitForActivity. Tests pass a fake one, such as schematicstest.Clock, so
+// polling runs without waiting out its intervals.
+type Clock interface {
+	Now() time.Time
+	// waits for d, returning early with the context error if ctx ends first
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// the wall clock; what a nil Clock means
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error { return sleep(ctx, d) }
@@ -0,0 +1,206 @@
+package schematics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Where IBM Cloud Kubernetes Service projects the compute resource token into pods, in the order they are tried.
+var DefaultCRTokenFiles = []string{"/var/run/secrets/tokens/vault-token", "/var/run/secrets/tokens/sa-token"}
+
+// DefaultMetadataEndpoint is the base URL of the VPC instance metadata service.
+const DefaultMetadataEndpoint = "http://169.254.169.254"
+
+// the instance metadata API version the requests below are written against
+const metadataVersion = "2022-03-01"
+
+// ComputeResource says where the compute resource token identifying this pod or virtual server comes from.
+type ComputeResource struct {
+	// file holding the token; when empty the first of DefaultCRTokenFiles that exists is used
+	TokenFile string
+	// VPC instance metadata service, used when there is no token file; DefaultMetadataEndpoint when empty
+	MetadataEndpoint string
+}
+
+// TrustedProfileAuthenticator obtains a token acting as Profile from the compute resource identity of the pod
+// or virtual server it runs on, without an API key. Renewing re-reads the token file, since Kubernetes rotates it.
+type TrustedProfileAuthenticator struct {
+	ComputeResource ComputeResource
+	Profile         TrustedProfile
+}
+
+// The call to IAM that this method translates into GoLang, for a compute resource token read from a file:
+//
+//	curl --header "Content-Type: application/x-www-form-urlencoded" \
+//	    --header "Accept: application/json" \
+//	    --data "grant_type=urn:ibm:params:oauth:grant-type:cr-token" \
+//	    --data "cr_token=<compute resource token>" \
+//	    --data "profile_id=<profile id>" \ ## or profile_name=<name> and account=<account id>
+//		https://iam.cloud.ibm.com/identity/token
+//
+// Without a token file, the VPC instance metadata service is asked for an identity token and then for an IAM
+// token acting as the profile, which must be given by id there.
+func (a TrustedProfileAuthenticator) Token(ctx context.Context, c *Client) (Token, error) {
+	if err := a.Profile.Validate(); err != nil {
+		return Token{}, err
+	}
+	if !a.Profile.IsSet() {
+		return Token{}, errors.New("trusted profile: a profile id or name is required")
+	}
+	return c.computeResourceToken(ctx, a.ComputeResource, a.Profile)
+}
+
+// Authenticates as the trusted profile through the compute resource identity; see TrustedProfileAuthenticator.
+func (c *Client) AuthenticateTrustedProfile(ctx context.Context, cr ComputeResource, profile TrustedProfile) error {
+	return c.Login(ctx, TrustedProfileAuthenticator{ComputeResource: cr, Profile: profile})
+}
+
+// Exchanges the compute resource's identity for a validated token acting as the trusted profile.
+func (c *Client) computeResourceToken(ctx context.Context, cr ComputeResource, profile TrustedProfile) (Token, error) {
+	file, err := cr.tokenFile()
+	if err != nil {
+		return Token{}, err
+	}
+	var token Token
+	if file != "" {
+		token, err = c.crTokenGrant(ctx, file, profile)
+	} else {
+		token, err = c.instanceIAMToken(ctx, cr.metadataEndpoint(), profile)
+	}
+	if err != nil {
+		return token, fmt.Errorf("obtaining trusted profile token: %w", err)
+	}
+
+	claims, err := DecodeTokenClaims(token.AccessToken)
+	if err != nil {
+		return token, fmt.Errorf("validating trusted profile token: %w", err)
+	}
+	if err := claims.matchProfile(profile); err != nil {
+		return token, fmt.Errorf("validating trusted profile token: %w", err)
+	}
+	c.log(ctx, slog.LevelInfo, "acting as trusted profile", "name", claims.Name, "iam_id", claims.IAMID)
+	return token, nil
+}
+
+// The token file to read: TokenFile when set, else the first default that exists, else "" for the metadata service.
+func (cr ComputeResource) tokenFile() (string, error) {
+	if cr.TokenFile != "" {
+		return cr.TokenFile, nil
+	}
+	for _, file := range DefaultCRTokenFiles {
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+	return "", nil
+}
+
+func (cr ComputeResource) metadataEndpoint() string {
+	if cr.MetadataEndpoint != "" {
+		return strings.TrimSuffix(cr.MetadataEndpoint, "/")
+	}
+	return DefaultMetadataEndpoint
+}
+
+// Exchanges the compute resource token in file for a token acting as profile.
+func (c *Client) crTokenGrant(ctx context.Context, file string, profile TrustedProfile) (Token, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Token{}, fmt.Errorf("reading compute resource token: %w", err)
+	}
+	crToken := strings.TrimSpace(string(data))
+	if crToken == "" {
+		return Token{}, fmt.Errorf("compute resource token file %s is empty", file)
+	}
+	form := url.Values{}
+	form.Set("grant_type", "urn:ibm:params:oauth:grant-type:cr-token")
+	form.Set("cr_token", crToken)
+	if profile.ID != "" {
+		form.Set("profile_id", profile.ID)
+	} else {
+		form.Set("profile_name", profile.Name)
+		form.Set("account", profile.Account)
+	}
+	return c.requestToken(ctx, form, "")
+}
+
+// The calls to the VPC instance metadata service that this method translates into GoLang:
+//
+//	curl -X PUT "http://169.254.169.254/instance_identity/v1/token?version=2022-03-01" \
+//	    -H "Metadata-Flavor: ibm" -H "Content-Type: application/json" -d '{"expires_in": 300}'
+//	curl -X POST "http://169.254.169.254/instance_identity/v1/iam_token?version=2022-03-01" \
+//	    -H "Authorization: Bearer <instance identity token>" -H "Content-Type: application/json" \
+//	    -d '{"trusted_profile": {"id": "<profile id>"}}'
+func (c *Client) instanceIAMToken(ctx context.Context, endpoint string, profile TrustedProfile) (Token, error) {
+	if profile.ID == "" {
+		return Token{}, errors.New("the VPC instance metadata service needs the trusted profile's id, not its name")
+	}
+	var identity struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := c.metadataRequest(ctx, "PUT", endpoint+"/instance_identity/v1/token", "", map[string]int{"expires_in": 300}, &identity); err != nil {
+		return Token{}, fmt.Errorf("requesting instance identity token: %w", err)
+	}
+	if identity.AccessToken == "" {
+		return Token{}, errors.New("instance identity response has no access token")
+	}
+	var iam struct {
+		AccessToken string    `json:"access_token"`
+		ExpiresAt   time.Time `json:"expires_at"`
+	}
+	body := map[string]interface{}{"trusted_profile": map[string]string{"id": profile.ID}}
+	if err := c.metadataRequest(ctx, "POST", endpoint+"/instance_identity/v1/iam_token", identity.AccessToken, body, &iam); err != nil {
+		return Token{}, fmt.Errorf("requesting IAM token from the instance metadata service: %w", err)
+	}
+	if iam.AccessToken == "" {
+		return Token{}, errors.New("instance metadata response has no access token")
+	}
+	token := Token{AccessToken: iam.AccessToken, TokenType: "Bearer"}
+	if !iam.ExpiresAt.IsZero() {
+		token.Expiration = int(iam.ExpiresAt.Unix())
+	}
+	return token, nil
+}
+
+// Sends a JSON request to the instance metadata service, with the instance identity token when one is given.
+func (c *Client) metadataRequest(ctx context.Context, method string, endpoint string, identityToken string, in interface{}, out interface{}) error {
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	endpoint += "?version=" + metadataVersion
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if identityToken != "" {
+		req.Header.Set("Authorization", "Bearer "+identityToken)
+	} else {
+		req.Header.Set("Metadata-Flavor", "ibm")
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return newAPIError(method, endpoint, resp, body)
+	}
+	return json.Unmarshal(body, out)
+}
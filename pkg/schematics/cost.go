@@ -0,0 +1,95 @@
+package schematics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// CostEstimate is the estimated monthly cost of a workspace's resources before and after a plan.
+type CostEstimate struct {
+	Currency string `json:"currency"`
+	// monthly cost of the resources as they are
+	Before float64 `json:"before"`
+	// monthly cost once the plan is applied
+	After float64 `json:"after"`
+	// After minus Before
+	Delta float64 `json:"delta"`
+}
+
+func (e CostEstimate) String() string {
+	return fmt.Sprintf("%+.2f %s per month (%.2f -> %.2f)", e.Delta, e.Currency, e.Before, e.After)
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl "https://schematics.cloud.ibm.com/v2/jobs/{activity-id}/files?file_type=cost_estimate_json" -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+// Returns the cost estimate Schematics computed for a finished plan job. The file uses the infracost breakdown
+// format, whose totals are decimal strings.
+func (c *Client) GetCostEstimate(ctx context.Context, activityID string) (CostEstimate, error) {
+	var file struct {
+		Content string `json:"file_content"`
+	}
+	if err := c.getJSON(ctx, c.SchematicsEndpoint+"/v2/jobs/"+activityID+"/files?file_type=cost_estimate_json", &file); err != nil {
+		return CostEstimate{}, fmt.Errorf("reading cost estimate of activity %s: %w", activityID, err)
+	}
+	if file.Content == "" {
+		return CostEstimate{}, fmt.Errorf("reading cost estimate of activity %s: Schematics returned no estimate", activityID)
+	}
+	estimate, err := ParseCostEstimate([]byte(file.Content))
+	if err != nil {
+		return estimate, fmt.Errorf("reading cost estimate of activity %s: %w", activityID, err)
+	}
+	return estimate, nil
+}
+
+// Parses an infracost-style breakdown: totalMonthlyCost, pastTotalMonthlyCost and diffTotalMonthlyCost, given as
+// strings or numbers, and currency (USD when absent).
+func ParseCostEstimate(data []byte) (CostEstimate, error) {
+	var doc struct {
+		Currency string          `json:"currency"`
+		Total    json.RawMessage `json:"totalMonthlyCost"`
+		Past     json.RawMessage `json:"pastTotalMonthlyCost"`
+		Diff     json.RawMessage `json:"diffTotalMonthlyCost"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return CostEstimate{}, fmt.Errorf("parsing cost estimate: %w", err)
+	}
+	if doc.Total == nil {
+		return CostEstimate{}, fmt.Errorf("parsing cost estimate: no totalMonthlyCost")
+	}
+	estimate := CostEstimate{Currency: doc.Currency}
+	if estimate.Currency == "" {
+		estimate.Currency = "USD"
+	}
+	var err error
+	if estimate.After, err = parseCost(doc.Total); err != nil {
+		return estimate, err
+	}
+	if estimate.Before, err = parseCost(doc.Past); err != nil {
+		return estimate, err
+	}
+	estimate.Delta = estimate.After - estimate.Before
+	if doc.Diff != nil {
+		if estimate.Delta, err = parseCost(doc.Diff); err != nil {
+			return estimate, err
+		}
+	}
+	return estimate, nil
+}
+
+// Reads a cost given as a JSON number or decimal string; absent and null are zero.
+func parseCost(raw json.RawMessage) (float64, error) {
+	if raw == nil || string(raw) == "null" {
+		return 0, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		s = string(raw)
+	}
+	cost, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing cost estimate: invalid amount %s", raw)
+	}
+	return cost, nil
+}
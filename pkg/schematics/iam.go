@@ -0,0 +1,348 @@
+package schematics
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Token holds an IAM token response.
+type Token struct {
+	AccessToken       string `json:"access_token"`
+	RefreshToken      string `json:"refresh_token"`
+	UserID            int    `json:"ims_user_id"`
+	TokenType         string `json:"token_type"`
+	Expires           int    `json:"expires_in"`
+	Expiration        int    `json:"expiration"`
+	RefreshExpiration int    `json:"refresh_token_expiration"`
+	Scope             string `json:"scope"`
+}
+
+// Sets the tokens used for Schematics calls, e.g. ones obtained from an external credential helper.
+// A leading "Bearer " on accessToken is ignored. The expiration is unknown afterwards.
+func (c *Client) SetTokens(accessToken string, refreshToken string) {
+	c.SetToken(Token{AccessToken: accessToken, RefreshToken: refreshToken})
+}
+
+// Returns the current Access Token and Refresh Token.
+func (c *Client) Tokens() (string, string) {
+	token := c.Token()
+	return token.AccessToken, token.RefreshToken
+}
+
+// Uses token for Schematics calls, e.g. one restored from a cache. A leading "Bearer " on the access token is ignored.
+// Without an expiration the one in the access token's claims is used, if it has any.
+func (c *Client) SetToken(token Token) {
+	token.AccessToken = strings.TrimPrefix(token.AccessToken, "Bearer ")
+	if token.Expiration == 0 {
+		if claims, err := DecodeTokenClaims(token.AccessToken); err == nil {
+			token.Expiration = int(claims.ExpiresAt)
+		}
+	}
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.token = token
+}
+
+// Returns the full token the client is using, including its expiration when known.
+func (c *Client) Token() Token {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	return c.token
+}
+
+// Gives the client the credentials to renew its token with when it nears expiry, for a token set with SetToken
+// that was originally obtained from apiKey (and, if set, profile). Authenticate and AssumeTrustedProfile do this themselves.
+func (c *Client) SetRenewalCredentials(apiKey string, profile TrustedProfile) {
+	var auth Authenticator
+	if apiKey != "" {
+		auth = APIKeyAuthenticator{APIKey: apiKey}
+	}
+	c.SetAuthenticator(auth, profile)
+}
+
+// Like SetRenewalCredentials, for a token originally obtained from auth. A nil auth leaves only the refresh token.
+func (c *Client) SetAuthenticator(auth Authenticator, profile TrustedProfile) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.auth = auth
+	c.profile = nil
+	if profile.IsSet() {
+		c.profile = &profile
+	}
+}
+
+// Returns the token for the next Schematics call like the client's own requests use it, renewed when it nears
+// expiry. For a Backend sending the calls itself.
+func (c *Client) CurrentToken(ctx context.Context) (Token, error) {
+	return c.currentToken(ctx)
+}
+
+// Returns the token for the next Schematics call, renewing it first when it expires within TokenRefreshMargin.
+// A client with an authenticator but no token yet logs in first.
+// A failed renewal is only logged while the old token is still valid.
+func (c *Client) currentToken(ctx context.Context) (Token, error) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if c.token.AccessToken == "" && c.auth != nil {
+		// not logged in yet, as a client built WithAPIKey before its first call
+		token, err := c.renewToken(ctx)
+		if err != nil {
+			return c.token, err
+		}
+		c.setRenewedToken(token)
+		return c.token, nil
+	}
+	if c.TokenRefreshMargin <= 0 || !c.token.ExpiresWithin(c.TokenRefreshMargin) {
+		return c.token, nil
+	}
+	c.log(ctx, slog.LevelInfo, "renewing IAM token", "expires", time.Unix(int64(c.token.Expiration), 0).Format(time.RFC3339))
+	token, err := c.renewToken(ctx)
+	if c.OnTokenRenewal != nil {
+		c.OnTokenRenewal(err)
+	}
+	if err != nil {
+		if c.token.ExpiresWithin(0) {
+			return c.token, fmt.Errorf("renewing expired IAM token: %w", err)
+		}
+		c.log(ctx, slog.LevelWarn, "renewing IAM token failed, keeping the current one", "error", err)
+		return c.token, nil
+	}
+	c.setRenewedToken(token)
+	return c.token, nil
+}
+
+// Keeps a token the client obtained by itself and passes it to OnNewToken. Called with tokenMu held.
+func (c *Client) setRenewedToken(token Token) {
+	c.token = token
+	if c.OnNewToken != nil {
+		c.OnNewToken(token)
+	}
+}
+
+// Obtains a fresh token: with the refresh token when there is one and no trusted profile is involved,
+// otherwise (or when that fails) from the authenticator, re-assuming the trusted profile on top.
+// Called with tokenMu held.
+func (c *Client) renewToken(ctx context.Context) (Token, error) {
+	var err error
+	if c.token.RefreshToken != "" && c.profile == nil {
+		data := url.Values{}
+		data.Set("grant_type", "refresh_token")
+		data.Set("refresh_token", c.token.RefreshToken)
+		var token Token
+		if token, err = c.requestToken(ctx, data, "Basic Yng6Yng="); err == nil {
+			return token, nil
+		}
+		if c.auth == nil {
+			return token, err
+		}
+		c.log(ctx, slog.LevelWarn, "refreshing IAM token failed, authenticating again", "error", err)
+	}
+	if c.auth == nil {
+		return Token{}, errors.New("no refresh token or credentials to renew the token with")
+	}
+	token, err := c.auth.Token(ctx, c)
+	if err != nil {
+		return token, err
+	}
+	if c.profile != nil {
+		return c.assume(ctx, token.AccessToken, *c.profile)
+	}
+	return token, nil
+}
+
+// Reports whether the token expires within margin of now. Tokens without a known expiration never do.
+func (t Token) ExpiresWithin(margin time.Duration) bool {
+	if t.Expiration == 0 {
+		return false
+	}
+	return time.Until(time.Unix(int64(t.Expiration), 0)) < margin
+}
+
+// The call to IAM that this method translates into GoLang:
+//
+//	curl --header "Content-Type: application/x-www-form-urlencoded" \
+//	    --header "Accept: application/json" \
+//	    --header --header "Authorization: Basic Yng6Yng=" \ ## this equals the url encoded authorization for username bx and password bx
+//	    --data "grant_type=urn:ibm:params:oauth:grant-type:apikey" \
+//	    --data "apikey=<apikey>" \
+//		https://iam.cloud.ibm.com/identity/token
+//
+// Exchanges an IBM Cloud API Key for tokens and keeps them on the client.
+// The API key is kept so the token can be renewed during long waits.
+func (c *Client) Authenticate(ctx context.Context, apiKey string) error {
+	return c.Login(ctx, APIKeyAuthenticator{APIKey: apiKey})
+}
+
+// Form data exchanging an API key for a token.
+func apiKeyGrant(apiKey string) url.Values {
+	data := url.Values{}
+	data.Set("grant_type", "urn:ibm:params:oauth:grant-type:apikey")
+	data.Set("apikey", apiKey)
+	return data
+}
+
+// Posts a grant to the IAM token endpoint and decodes the token response.
+// authorization is sent as the Authorization header when not empty.
+func (c *Client) requestToken(ctx context.Context, data url.Values, authorization string) (Token, error) {
+	var token Token
+	endpoint := c.IAMEndpoint + "/identity/token"
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return token, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return token, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return token, err
+	}
+	c.log(ctx, slog.LevelDebug, "IAM response", "status", resp.Status)
+
+	if resp.StatusCode != http.StatusOK {
+		return token, newAPIError("POST", endpoint, resp, body)
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return token, fmt.Errorf("decoding IAM response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return token, fmt.Errorf("IAM response has no access token")
+	}
+	return token, nil
+}
+
+// TrustedProfile identifies the trusted profile to assume: either ID, or Name together with Account.
+type TrustedProfile struct {
+	ID      string
+	Name    string
+	Account string
+}
+
+// Reports whether a profile was given at all.
+func (p TrustedProfile) IsSet() bool {
+	return p.ID != "" || p.Name != ""
+}
+
+// Checks that exactly one way of naming the profile was given.
+func (p TrustedProfile) Validate() error {
+	switch {
+	case p.ID != "" && p.Name != "":
+		return fmt.Errorf("trusted profile: use either an id or a name, not both")
+	case p.Name != "" && p.Account == "":
+		return fmt.Errorf("trusted profile: a name requires an account")
+	}
+	return nil
+}
+
+// The call to IAM that this method translates into GoLang:
+//
+//	curl --header "Content-Type: application/x-www-form-urlencoded" \
+//	    --header "Accept: application/json" \
+//	    --data "grant_type=urn:ibm:params:oauth:grant-type:assume" \
+//	    --data "access_token=<access token>" \
+//	    --data "profile_id=<profile id>" \ ## or profile_name=<name> and account=<account id>
+//		https://iam.cloud.ibm.com/identity/token
+//
+// Exchanges the client's access token for one acting as the trusted profile, checks the new token really
+// carries the profile's identity, and keeps the delegated tokens on the client.
+func (c *Client) AssumeTrustedProfile(ctx context.Context, profile TrustedProfile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	token, err := c.assume(ctx, c.Token().AccessToken, profile)
+	if err != nil {
+		return err
+	}
+	c.SetToken(token)
+	c.tokenMu.Lock()
+	c.profile = &profile
+	c.tokenMu.Unlock()
+	return nil
+}
+
+// Exchanges accessToken for a validated token acting as the trusted profile.
+func (c *Client) assume(ctx context.Context, accessToken string, profile TrustedProfile) (Token, error) {
+	data := url.Values{}
+	data.Set("grant_type", "urn:ibm:params:oauth:grant-type:assume")
+	data.Set("access_token", accessToken)
+	if profile.ID != "" {
+		data.Set("profile_id", profile.ID)
+	} else {
+		data.Set("profile_name", profile.Name)
+		data.Set("account", profile.Account)
+	}
+	token, err := c.requestToken(ctx, data, "")
+	if err != nil {
+		return token, fmt.Errorf("assuming trusted profile: %w", err)
+	}
+
+	claims, err := DecodeTokenClaims(token.AccessToken)
+	if err != nil {
+		return token, fmt.Errorf("validating trusted profile token: %w", err)
+	}
+	if err := claims.matchProfile(profile); err != nil {
+		return token, fmt.Errorf("validating trusted profile token: %w", err)
+	}
+	c.log(ctx, slog.LevelInfo, "acting as trusted profile", "name", claims.Name, "iam_id", claims.IAMID)
+	return token, nil
+}
+
+// TokenClaims holds the claims we read from an IAM access token.
+type TokenClaims struct {
+	IAMID   string `json:"iam_id"`
+	SubType string `json:"sub_type"`
+	Name    string `json:"name"`
+	// expiry as a Unix time
+	ExpiresAt int64 `json:"exp"`
+	Account   struct {
+		BSS string `json:"bss"`
+	} `json:"account"`
+}
+
+// Decodes the claims of an IAM access token. The signature is not checked; the token is expected to come straight from IAM over TLS.
+func DecodeTokenClaims(accessToken string) (TokenClaims, error) {
+	var claims TokenClaims
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return claims, fmt.Errorf("access token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, fmt.Errorf("decoding access token: %w", err)
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, fmt.Errorf("decoding access token: %w", err)
+	}
+	return claims, nil
+}
+
+// Confirms the claims belong to the requested trusted profile rather than the original identity.
+func (claims TokenClaims) matchProfile(profile TrustedProfile) error {
+	if claims.SubType != "Profile" {
+		return fmt.Errorf("identity %s is a %q, not a trusted profile", claims.IAMID, claims.SubType)
+	}
+	if profile.ID != "" && claims.IAMID != "iam-"+profile.ID {
+		return fmt.Errorf("got identity %s, expected iam-%s", claims.IAMID, profile.ID)
+	}
+	if profile.Account != "" && claims.Account.BSS != profile.Account {
+		return fmt.Errorf("token is for account %s, expected %s", claims.Account.BSS, profile.Account)
+	}
+	return nil
+}
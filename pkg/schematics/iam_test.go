@@ -0,0 +1,66 @@
+package schematics_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"schematics-apply-destroy/pkg/schematics"
+	"schematics-apply-destroy/pkg/schematics/schematicstest"
+)
+
+// A client for srv built the way library users build one, with the server's http.Client.
+func fakeClient(srv *schematicstest.Server) *schematics.Client {
+	client := schematics.NewClientWithHTTPClient(srv.Server.Client())
+	client.IAMEndpoint = srv.URL
+	client.SchematicsEndpoint = srv.URL
+	client.Retry.InitialBackoff = 0
+	client.Retry.MaxBackoff = 0
+	client.Retry.Jitter = 0
+	return client
+}
+
+func TestAuthenticate(t *testing.T) {
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	client := fakeClient(srv)
+
+	if err := client.Authenticate(context.Background(), schematicstest.APIKey); err != nil {
+		t.Fatal(err)
+	}
+	token := client.Token()
+	if token.AccessToken == "" || token.RefreshToken == "" {
+		t.Fatalf("token = %+v, want an access and a refresh token", token)
+	}
+	if _, err := client.ListWorkspaces(context.Background()); err != nil {
+		t.Errorf("ListWorkspaces with the new token: %v", err)
+	}
+}
+
+func TestAuthenticateWrongAPIKey(t *testing.T) {
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	client := fakeClient(srv)
+
+	err := client.Authenticate(context.Background(), "not-the-key")
+	var apiErr *schematics.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Authenticate error = %v, want a 400 *APIError", err)
+	}
+}
+
+func TestAPIKeyOptionLogsInLazily(t *testing.T) {
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	client := schematics.NewClient(schematics.WithHTTPClient(srv.Server.Client()), schematics.WithAPIKey(schematicstest.APIKey),
+		schematics.WithEndpoints(srv.URL, srv.URL))
+
+	if _, err := client.ListWorkspaces(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	requests := srv.Requests()
+	if len(requests) != 2 || requests[0].Path != "/identity/token" {
+		t.Errorf("requests = %+v, want a login and then the list", requests)
+	}
+}
@@ -0,0 +1,83 @@
+package schematics
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}/actions/{activity-id}/logs -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+// followed by a GET of each template's log_url.
+// Returns the Terraform output of every template in the activity, concatenated in template order.
+func (c *Client) GetActivityLogs(ctx context.Context, workspaceID string, activityID string) (string, error) {
+	var summary struct {
+		Templates []struct {
+			TemplateID string `json:"template_id"`
+			LogURL     string `json:"log_url"`
+		} `json:"templates"`
+	}
+	if err := c.getJSON(ctx, c.SchematicsEndpoint+"/v1/workspaces/"+workspaceID+"/actions/"+activityID+"/logs", &summary); err != nil {
+		return "", fmt.Errorf("listing logs for activity %s: %w", activityID, err)
+	}
+
+	var logs strings.Builder
+	for _, template := range summary.Templates {
+		if template.LogURL == "" {
+			continue
+		}
+		_, body, err := c.send(ctx, "GET", template.LogURL, nil)
+		if err != nil {
+			return logs.String(), fmt.Errorf("reading logs for template %s: %w", template.TemplateID, err)
+		}
+		logs.Write(body)
+	}
+	return logs.String(), nil
+}
+
+// PlanSummary holds the resource change counts of a Terraform plan.
+type PlanSummary struct {
+	Add     int `json:"add"`
+	Change  int `json:"change"`
+	Destroy int `json:"destroy"`
+	// the resources that change, when the plan lists them
+	Resources []ResourceChange `json:"resources,omitempty"`
+	// resources that changed outside of Terraform since the last apply: update for changed, delete for deleted
+	Drift []ResourceChange `json:"drift,omitempty"`
+}
+
+// Reports whether the plan changes anything.
+func (p PlanSummary) HasChanges() bool {
+	return p.Add+p.Change+p.Destroy > 0
+}
+
+func (p PlanSummary) String() string {
+	return fmt.Sprintf("%d to add, %d to change, %d to destroy", p.Add, p.Change, p.Destroy)
+}
+
+// the summary line Terraform prints at the end of a plan
+var planLine = regexp.MustCompile(`Plan: (\d+) to add, (\d+) to change, (\d+) to destroy`)
+
+// Extracts the change counts and changed resources from Terraform plan output. ok is false when the output has
+// no plan summary. When the log holds several plans (one per template) their counts are added up.
+func ParsePlanSummary(log string) (summary PlanSummary, ok bool) {
+	for _, match := range planLine.FindAllStringSubmatch(log, -1) {
+		add, _ := strconv.Atoi(match[1])
+		change, _ := strconv.Atoi(match[2])
+		destroy, _ := strconv.Atoi(match[3])
+		summary.Add += add
+		summary.Change += change
+		summary.Destroy += destroy
+		ok = true
+	}
+	if !ok && (strings.Contains(log, "No changes.") || strings.Contains(log, "Your infrastructure matches the configuration")) {
+		ok = true
+	}
+	if ok {
+		summary.Resources = parsePlanResources(log)
+		summary.Drift = parsePlanDrift(log)
+	}
+	return summary, ok
+}
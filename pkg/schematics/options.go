@@ -0,0 +1,80 @@
+package schematics
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// Option adjusts a Client built by NewClient.
+type Option func(*Client)
+
+// Logs the client in with the IBM Cloud API key on its first call, and again with it whenever the token needs
+// renewing, so no explicit Authenticate is needed.
+func WithAPIKey(apiKey string) Option {
+	return func(c *Client) {
+		c.SetAuthenticator(APIKeyAuthenticator{APIKey: apiKey}, TrustedProfile{})
+	}
+}
+
+// Targets the Schematics endpoint of region, such as eu-de. With a region Regions doesn't list, every call of
+// the client fails with RegionEndpoint's error.
+func WithRegion(region string) Option {
+	return func(c *Client) {
+		endpoint, err := RegionEndpoint(region)
+		if err != nil {
+			c.optionErr = err
+			return
+		}
+		c.SchematicsEndpoint = endpoint
+	}
+}
+
+// Targets the given IAM and Schematics base URLs, without a trailing slash; an empty one is left as it is.
+func WithEndpoints(iamEndpoint string, schematicsEndpoint string) Option {
+	return func(c *Client) {
+		if iamEndpoint != "" {
+			c.IAMEndpoint = iamEndpoint
+		}
+		if schematicsEndpoint != "" {
+			c.SchematicsEndpoint = schematicsEndpoint
+		}
+	}
+}
+
+// Sends every request through httpClient, as NewClientWithHTTPClient does.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		if httpClient != nil {
+			c.HTTPClient = httpClient
+		}
+	}
+}
+
+// Sends userAgent, e.g. ci-bot/1.2, as the User-Agent of every request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.UserAgent = userAgent
+	}
+}
+
+// Gives each request up to maxAttempts attempts in total when IAM or Schematics answers 429 or a 5xx status,
+// keeping the default backoff; 1 disables retries.
+func WithRetry(maxAttempts int) Option {
+	return func(c *Client) {
+		c.Retry.MaxAttempts = maxAttempts
+	}
+}
+
+// Replaces the whole retry policy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.Retry = policy
+	}
+}
+
+// Sends the client's progress messages and, at Debug, its requests and responses to logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.Logger = logger
+	}
+}
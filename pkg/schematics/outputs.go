@@ -0,0 +1,43 @@
+package schematics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Output is one Terraform output of a workspace.
+type Output struct {
+	Name string `json:"name"`
+	// the value as JSON, e.g. "abc", 3 or ["a","b"]
+	Value     json.RawMessage `json:"value"`
+	Type      string          `json:"type,omitempty"`
+	Sensitive bool            `json:"sensitive,omitempty"`
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}/output_values -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+// Returns the outputs of every template in the workspace, sorted by name.
+func (c *Client) GetOutputs(ctx context.Context, workspaceID string) ([]Output, error) {
+	var templates []struct {
+		OutputValues []map[string]struct {
+			Value     json.RawMessage `json:"value"`
+			Type      string          `json:"type"`
+			Sensitive bool            `json:"sensitive"`
+		} `json:"output_values"`
+	}
+	if err := c.getJSON(ctx, c.SchematicsEndpoint+"/v1/workspaces/"+workspaceID+"/output_values", &templates); err != nil {
+		return nil, fmt.Errorf("reading outputs: %w", err)
+	}
+	var outputs []Output
+	for _, template := range templates {
+		for _, values := range template.OutputValues {
+			for name, v := range values {
+				outputs = append(outputs, Output{Name: name, Value: v.Value, Type: v.Type, Sensitive: v.Sensitive})
+			}
+		}
+	}
+	sort.Slice(outputs, func(i, j int) bool { return outputs[i].Name < outputs[j].Name })
+	return outputs, nil
+}
@@ -0,0 +1,267 @@
+package schematics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ResourceChange is one resource a Terraform plan changes.
+type ResourceChange struct {
+	Address string `json:"address"`
+	// create, update, delete or replace
+	Action string `json:"action"`
+	// the resource type and name, e.g. ibm_is_vpc and vpc, and its module's address, e.g. module.network; only set
+	// for plans read from Terraform's JSON
+	Type   string `json:"type,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Module string `json:"module,omitempty"`
+}
+
+// Symbol is the marker Terraform prints for the action, e.g. "+" for create.
+func (r ResourceChange) Symbol() string {
+	switch r.Action {
+	case "create":
+		return "+"
+	case "update":
+		return "~"
+	case "delete":
+		return "-"
+	case "replace":
+		return "-/+"
+	}
+	return "?"
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl "https://schematics.cloud.ibm.com/v2/jobs/{activity-id}/files?file_type=plan_json" -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+// Returns the `terraform show -json` document of a finished plan job.
+func (c *Client) GetPlanJSON(ctx context.Context, activityID string) ([]byte, error) {
+	var file struct {
+		Content string `json:"file_content"`
+	}
+	if err := c.getJSON(ctx, c.SchematicsEndpoint+"/v2/jobs/"+activityID+"/files?file_type=plan_json", &file); err != nil {
+		return nil, fmt.Errorf("reading plan of activity %s: %w", activityID, err)
+	}
+	if file.Content == "" {
+		return nil, fmt.Errorf("reading plan of activity %s: Schematics returned no plan", activityID)
+	}
+	return []byte(file.Content), nil
+}
+
+// Builds the summary of a Terraform JSON plan from its resource_changes and resource_drift. As in Terraform's own summary,
+// a replaced resource counts both as added and as destroyed, and reads and no-ops are left out.
+func ParsePlanJSON(data []byte) (PlanSummary, error) {
+	var plan struct {
+		ResourceChanges []planResourceChange `json:"resource_changes"`
+		ResourceDrift   []planResourceChange `json:"resource_drift"`
+	}
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return PlanSummary{}, fmt.Errorf("parsing plan JSON: %w", err)
+	}
+	var summary PlanSummary
+	for _, rc := range plan.ResourceChanges {
+		action := planAction(rc.Change.Actions)
+		if action == "" {
+			continue
+		}
+		summary.add(ResourceChange{Address: rc.Address, Action: action, Type: rc.Type, Name: rc.Name, Module: rc.ModuleAddress})
+	}
+	for _, rc := range plan.ResourceDrift {
+		if action := planAction(rc.Change.Actions); action != "" {
+			summary.Drift = append(summary.Drift, ResourceChange{Address: rc.Address, Action: action, Type: rc.Type, Name: rc.Name, Module: rc.ModuleAddress})
+		}
+	}
+	return summary, nil
+}
+
+// an entry of resource_changes or resource_drift in a JSON plan
+type planResourceChange struct {
+	Address       string `json:"address"`
+	Type          string `json:"type"`
+	Name          string `json:"name"`
+	ModuleAddress string `json:"module_address"`
+	Change        struct {
+		Actions []string `json:"actions"`
+	} `json:"change"`
+}
+
+// PlanChangesVersion is the Version of the PlanChanges schema. It only changes when fields are removed or change
+// meaning; new fields may be added at any version.
+const PlanChangesVersion = 1
+
+// PlanChanges is the resource changes of a plan in a stable schema for policy checks, independent of the shape of
+// Schematics' and Terraform's plan documents. Every list is present, possibly empty, and sorted by address. A
+// replaced resource is only listed under Replace, though the counts take it as both added and destroyed.
+type PlanChanges struct {
+	Version     int    `json:"version"`
+	WorkspaceID string `json:"workspace_id,omitempty"`
+	ActivityID  string `json:"activity_id,omitempty"`
+	Add         int    `json:"add"`
+	Change      int    `json:"change"`
+	Destroy     int    `json:"destroy"`
+
+	Create  []PlannedResource `json:"create"`
+	Update  []PlannedResource `json:"update"`
+	Delete  []PlannedResource `json:"delete"`
+	Replace []PlannedResource `json:"replace"`
+	// resources that changed outside of Terraform: update for changed, delete for deleted
+	Drift []PlannedResource `json:"drift"`
+}
+
+// PlannedResource is a resource in PlanChanges.
+type PlannedResource struct {
+	Address string `json:"address"`
+	// e.g. ibm_is_vpc
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// the address of the module the resource is in, e.g. module.network; empty in the root module
+	Module string `json:"module"`
+	// only set in Drift
+	Action string `json:"action,omitempty"`
+}
+
+// NewPlanChanges maps summary into the PlanChanges schema. Changes from a plan's log, which carry no type, name or
+// module, have them taken from the address.
+func NewPlanChanges(summary PlanSummary) PlanChanges {
+	changes := PlanChanges{
+		Version: PlanChangesVersion,
+		Add:     summary.Add,
+		Change:  summary.Change,
+		Destroy: summary.Destroy,
+		Create:  []PlannedResource{},
+		Update:  []PlannedResource{},
+		Delete:  []PlannedResource{},
+		Replace: []PlannedResource{},
+		Drift:   []PlannedResource{},
+	}
+	for _, rc := range summary.Resources {
+		resource := plannedResource(rc)
+		switch rc.Action {
+		case "create":
+			changes.Create = append(changes.Create, resource)
+		case "update":
+			changes.Update = append(changes.Update, resource)
+		case "delete":
+			changes.Delete = append(changes.Delete, resource)
+		case "replace":
+			changes.Replace = append(changes.Replace, resource)
+		}
+	}
+	for _, rc := range summary.Drift {
+		resource := plannedResource(rc)
+		resource.Action = rc.Action
+		changes.Drift = append(changes.Drift, resource)
+	}
+	for _, list := range [][]PlannedResource{changes.Create, changes.Update, changes.Delete, changes.Replace, changes.Drift} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+	}
+	return changes
+}
+
+// The PlannedResource for rc, without its action.
+func plannedResource(rc ResourceChange) PlannedResource {
+	if rc.Type == "" {
+		rc.Module, rc.Type, rc.Name = splitResourceAddress(rc.Address)
+	}
+	return PlannedResource{Address: rc.Address, Type: rc.Type, Name: rc.Name, Module: rc.Module}
+}
+
+// Splits a resource address such as module.network.ibm_is_subnet.zone["us-south-1"] into its module address, type
+// and name. Index keys may hold dots, so only dots outside brackets separate the parts.
+func splitResourceAddress(address string) (module string, resourceType string, name string) {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range address {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case r == '.' && depth == 0:
+			parts = append(parts, address[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, address[start:])
+	if len(parts) < 2 {
+		return "", "", ""
+	}
+	prefix := parts[:len(parts)-2]
+	if n := len(prefix); n > 0 && prefix[n-1] == "data" {
+		prefix = prefix[:n-1]
+	}
+	module = strings.Join(prefix, ".")
+	name = parts[len(parts)-1]
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	return module, parts[len(parts)-2], name
+}
+
+// Maps the actions list of a JSON plan to a single action, or "" for no-op and read.
+func planAction(actions []string) string {
+	switch {
+	case len(actions) == 2:
+		return "replace"
+	case len(actions) == 1 && (actions[0] == "create" || actions[0] == "update" || actions[0] == "delete"):
+		return actions[0]
+	}
+	return ""
+}
+
+// Records change and counts it.
+func (p *PlanSummary) add(change ResourceChange) {
+	p.Resources = append(p.Resources, change)
+	switch change.Action {
+	case "create":
+		p.Add++
+	case "update":
+		p.Change++
+	case "delete":
+		p.Destroy++
+	case "replace":
+		p.Add++
+		p.Destroy++
+	}
+}
+
+// the per-resource headings of Terraform's human-readable plan, e.g. `# ibm_is_vpc.vpc will be created`
+var planResourceLine = regexp.MustCompile(`(?m)^\s*# (\S+) (will be created|will be updated in-place|will be destroyed|must be replaced|is tainted, so must be replaced)`)
+
+// the action each planResourceLine heading stands for
+var planHeadingActions = map[string]string{
+	"will be created":                 "create",
+	"will be updated in-place":        "update",
+	"will be destroyed":               "delete",
+	"must be replaced":                "replace",
+	"is tainted, so must be replaced": "replace",
+}
+
+// Extracts the per-resource changes from Terraform plan output.
+func parsePlanResources(log string) []ResourceChange {
+	var changes []ResourceChange
+	for _, match := range planResourceLine.FindAllStringSubmatch(log, -1) {
+		changes = append(changes, ResourceChange{Address: match[1], Action: planHeadingActions[match[2]]})
+	}
+	return changes
+}
+
+// the headings Terraform prints for resources changed outside of it, e.g. `# ibm_is_vpc.vpc has changed`
+var planDriftLine = regexp.MustCompile(`(?m)^\s*# (\S+) (has changed|has been deleted)`)
+
+// Extracts the resources that drifted from Terraform plan output.
+func parsePlanDrift(log string) []ResourceChange {
+	var drift []ResourceChange
+	for _, match := range planDriftLine.FindAllStringSubmatch(log, -1) {
+		action := "update"
+		if match[2] == "has been deleted" {
+			action = "delete"
+		}
+		drift = append(drift, ResourceChange{Address: match[1], Action: action})
+	}
+	return drift
+}
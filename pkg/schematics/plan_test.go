@@ -0,0 +1,79 @@
+package schematics_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+const testPlanJSON = `{
+  "format_version": "1.2",
+  "resource_changes": [
+    {"address": "module.network.ibm_is_subnet.zone[\"us-south-1\"]", "module_address": "module.network", "type": "ibm_is_subnet", "name": "zone", "change": {"actions": ["delete", "create"]}},
+    {"address": "ibm_is_vpc.vpc", "type": "ibm_is_vpc", "name": "vpc", "change": {"actions": ["update"]}},
+    {"address": "ibm_is_instance.b", "type": "ibm_is_instance", "name": "b", "change": {"actions": ["create"]}},
+    {"address": "ibm_is_instance.a", "type": "ibm_is_instance", "name": "a", "change": {"actions": ["create"]}},
+    {"address": "ibm_cos_bucket.logs", "type": "ibm_cos_bucket", "name": "logs", "change": {"actions": ["delete"]}},
+    {"address": "data.ibm_resource_group.rg", "type": "ibm_resource_group", "name": "rg", "change": {"actions": ["read"]}},
+    {"address": "ibm_is_ssh_key.key", "type": "ibm_is_ssh_key", "name": "key", "change": {"actions": ["no-op"]}}
+  ],
+  "resource_drift": [
+    {"address": "ibm_is_security_group.sg", "type": "ibm_is_security_group", "name": "sg", "change": {"actions": ["update"]}}
+  ]
+}`
+
+func TestNewPlanChanges(t *testing.T) {
+	summary, err := schematics.ParsePlanJSON([]byte(testPlanJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := schematics.NewPlanChanges(summary)
+	want := schematics.PlanChanges{
+		Version: schematics.PlanChangesVersion,
+		Add:     3,
+		Change:  1,
+		Destroy: 2,
+		Create: []schematics.PlannedResource{
+			{Address: "ibm_is_instance.a", Type: "ibm_is_instance", Name: "a"},
+			{Address: "ibm_is_instance.b", Type: "ibm_is_instance", Name: "b"},
+		},
+		Update: []schematics.PlannedResource{{Address: "ibm_is_vpc.vpc", Type: "ibm_is_vpc", Name: "vpc"}},
+		Delete: []schematics.PlannedResource{{Address: "ibm_cos_bucket.logs", Type: "ibm_cos_bucket", Name: "logs"}},
+		Replace: []schematics.PlannedResource{
+			{Address: `module.network.ibm_is_subnet.zone["us-south-1"]`, Type: "ibm_is_subnet", Name: "zone", Module: "module.network"},
+		},
+		Drift: []schematics.PlannedResource{{Address: "ibm_is_security_group.sg", Type: "ibm_is_security_group", Name: "sg", Action: "update"}},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes =\n%+v\nwant\n%+v", changes, want)
+	}
+}
+
+func TestNewPlanChangesFromAddresses(t *testing.T) {
+	// a summary parsed from the log has only addresses
+	changes := schematics.NewPlanChanges(schematics.PlanSummary{Destroy: 2, Resources: []schematics.ResourceChange{
+		{Address: `module.a.module.b.ibm_is_vpc.vpc["x.y"]`, Action: "delete"},
+		{Address: "module.a.data.ibm_is_image.img[0]", Action: "delete"},
+	}})
+	want := []schematics.PlannedResource{
+		{Address: "module.a.data.ibm_is_image.img[0]", Type: "ibm_is_image", Name: "img", Module: "module.a"},
+		{Address: `module.a.module.b.ibm_is_vpc.vpc["x.y"]`, Type: "ibm_is_vpc", Name: "vpc", Module: "module.a.module.b"},
+	}
+	if !reflect.DeepEqual(changes.Delete, want) {
+		t.Errorf("delete = %+v, want %+v", changes.Delete, want)
+	}
+}
+
+func TestPlanChangesSchema(t *testing.T) {
+	// the lists are always present, so policies can iterate them without checking for null
+	data, err := json.Marshal(schematics.NewPlanChanges(schematics.PlanSummary{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"version":1,"add":0,"change":0,"destroy":0,"create":[],"update":[],"delete":[],"replace":[],"drift":[]}`
+	if string(data) != want {
+		t.Errorf("JSON = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,53 @@
+package schematics
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket that every request of a Client, to IAM and Schematics alike, draws from, so a
+// batch across many workspaces stays under the account's rate limits. It is safe for concurrent use.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// Returns a limiter allowing perSecond requests per second on average and bursts of up to burst requests.
+// A burst below 1 is taken as the rate rounded up.
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(perSecond)))
+	}
+	return &RateLimiter{rate: perSecond, burst: float64(burst), tokens: float64(burst), last: now()}
+}
+
+// Blocks until a request may be sent, or returns the context's error if ctx ends first. The token is taken
+// up front, so concurrent callers queue in the order they arrived, and given back when ctx ends during the wait,
+// so a request that was never sent doesn't delay the ones after it.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	t := now()
+	l.tokens = math.Min(l.burst, l.tokens+t.Sub(l.last).Seconds()*l.rate)
+	l.last = t
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+	if err := sleep(ctx, delay); err != nil {
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package schematics
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	fixClock(t, at, 0)
+	delays := recordSleeps(t)
+	l := NewRateLimiter(2, 2)
+	ctx := context.Background()
+
+	// the burst goes out straight away, then each request waits for its token
+	for i := 0; i < 4; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []time.Duration{500 * time.Millisecond, time.Second}
+	if !reflect.DeepEqual(*delays, want) {
+		t.Errorf("delays = %v, want %v", *delays, want)
+	}
+
+	// ten seconds later the bucket is full again, but no fuller than the burst
+	*delays = nil
+	fixClock(t, at.Add(10*time.Second), 0)
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []time.Duration{500 * time.Millisecond}; !reflect.DeepEqual(*delays, want) {
+		t.Errorf("delays after refilling = %v, want %v", *delays, want)
+	}
+}
+
+func TestRateLimiterCancelledWaitReturnsToken(t *testing.T) {
+	fixClock(t, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), 0)
+	var delays []time.Duration
+	saved := sleep
+	t.Cleanup(func() { sleep = saved })
+	sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+	l := NewRateLimiter(1, 1)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(cancelled); err != context.Canceled {
+			t.Fatalf("Wait = %v, want context.Canceled", err)
+		}
+	}
+	// the cancelled waits gave their tokens back, so the next request waits one interval, not four
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{time.Second, time.Second, time.Second, time.Second}
+	if !reflect.DeepEqual(delays, want) {
+		t.Errorf("delays = %v, want %v", delays, want)
+	}
+}
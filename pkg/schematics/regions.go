@@ -0,0 +1,88 @@
+package schematics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schematics API endpoint for each IBM Cloud region
+var regionEndpoints = map[string]string{
+	"us-south": "https://us.schematics.cloud.ibm.com",
+	"us-east":  "https://us.schematics.cloud.ibm.com",
+	"eu-de":    "https://eu.schematics.cloud.ibm.com",
+	"eu-gb":    "https://eu.schematics.cloud.ibm.com",
+	"ca-tor":   "https://ca-tor.schematics.cloud.ibm.com",
+}
+
+// Returns the regions that have a Schematics endpoint, sorted.
+func Regions() []string {
+	var regions []string
+	for region := range regionEndpoints {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// Returns the Schematics endpoint for region, or an error listing the known regions.
+func RegionEndpoint(region string) (string, error) {
+	endpoint, ok := regionEndpoints[region]
+	if !ok {
+		return "", fmt.Errorf("unknown Schematics region %q (known: %s)", region, strings.Join(Regions(), ", "))
+	}
+	return endpoint, nil
+}
+
+// Returns the Schematics endpoint on the IBM Cloud private network for region, for hosts without public egress.
+// An empty region selects the US endpoint, which serves the same workspaces as the global public one.
+func PrivateRegionEndpoint(region string) (string, error) {
+	if region == "" {
+		region = "us-south"
+	}
+	endpoint, err := RegionEndpoint(region)
+	if err != nil {
+		return "", err
+	}
+	// the private hosts carry certificates for their own names, so TLS is verified as usual
+	return strings.Replace(endpoint, "https://", "https://private-", 1), nil
+}
+
+// CRN locations that name a geography rather than a region, mapped to a region served by the same Schematics endpoint
+var crnGeographies = map[string]string{
+	"us": "us-south",
+	"eu": "eu-de",
+}
+
+// Extracts the region and workspace id from a Schematics workspace CRN of the form
+//
+//	crn:v1:bluemix:public:schematics:<location>:a/<account-id>:<service-instance>:workspace:<workspace-id>
+//
+// Returns an error naming the offending segment when the CRN is malformed or isn't a Schematics workspace.
+func ParseWorkspaceCRN(crn string) (string, string, error) {
+	segments := strings.Split(crn, ":")
+	if len(segments) != 10 || segments[0] != "crn" {
+		return "", "", fmt.Errorf("malformed CRN %q: expected 10 colon-separated segments starting with \"crn\"", crn)
+	}
+	if segments[1] != "v1" {
+		return "", "", fmt.Errorf("malformed CRN %q: unsupported version %q", crn, segments[1])
+	}
+	if segments[4] != "schematics" {
+		return "", "", fmt.Errorf("CRN %q is for service %q, not schematics", crn, segments[4])
+	}
+	if segments[8] != "workspace" {
+		return "", "", fmt.Errorf("CRN %q is for a %q, not a workspace", crn, segments[8])
+	}
+	if segments[9] == "" {
+		return "", "", fmt.Errorf("malformed CRN %q: missing workspace id", crn)
+	}
+
+	region := segments[5]
+	if mapped, ok := crnGeographies[region]; ok {
+		region = mapped
+	}
+	if _, ok := regionEndpoints[region]; !ok {
+		return "", "", fmt.Errorf("CRN %q has unknown Schematics location %q", crn, segments[5])
+	}
+	return region, segments[9], nil
+}
@@ -0,0 +1,38 @@
+package schematics
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+)
+
+// header every IAM and Schematics request carries the operation's correlation id in
+const CorrelationIDHeader = "X-Correlation-Id"
+
+// header IBM Cloud returns its own id for a request in, for quoting in support tickets
+const RequestIDHeader = "X-Request-Id"
+
+type correlationIDKey struct{}
+
+// Returns a context whose IAM and Schematics requests all carry id as their correlation id, tying together the
+// requests of one operation such as an apply and its wait.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// Returns the correlation id WithCorrelationID put on ctx, or "".
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// Returns a random id, a version 4 UUID, for WithCorrelationID.
+func NewCorrelationID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
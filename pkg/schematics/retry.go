@@ -0,0 +1,77 @@
+package schematics
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how requests answered with 429 Too Many Requests or a transient 5xx status are retried.
+// The delay before retry n is InitialBackoff doubled n-1 times, capped at MaxBackoff and shortened by up to
+// Jitter (a fraction between 0 and 1) at random. A Retry-After header on the response replaces the computed delay.
+type RetryPolicy struct {
+	// total attempts, including the first; 1 or less disables retries
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Jitter         float64
+}
+
+// Returns the policy NewClient uses: 4 attempts starting at 1s, capped at 30s, with 20% jitter.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		Jitter:         0.2,
+	}
+}
+
+// Reports whether a response with this status is worth retrying.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Delay before the retry following the given (1-based) failed attempt.
+func (p RetryPolicy) backoff(attempt int, header http.Header) time.Duration {
+	if d, ok := retryAfter(header.Get("Retry-After")); ok {
+		return d
+	}
+	d := float64(p.InitialBackoff) * math.Pow(2, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d -= d * math.Min(p.Jitter, 1) * random()
+	}
+	return time.Duration(d)
+}
+
+// the current time, and the jitter's random fraction in [0, 1); vars so tests can fix them
+var (
+	now    = time.Now
+	random = rand.Float64
+)
+
+// Parses a Retry-After header given either in seconds or as an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now()); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
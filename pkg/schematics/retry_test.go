@@ -0,0 +1,157 @@
+package schematics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Fixes now and the jitter's random fraction for the test.
+func fixClock(t *testing.T, at time.Time, fraction float64) {
+	savedNow, savedRandom := now, random
+	now = func() time.Time { return at }
+	random = func() float64 { return fraction }
+	t.Cleanup(func() { now, random = savedNow, savedRandom })
+}
+
+func TestRetryAfter(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	fixClock(t, at, 0)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"7", 7 * time.Second, true},
+		{"-3", 0, false},
+		{"soon", 0, false},
+		{at.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		// a date in the past means retry now
+		{at.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"Fri, 01 Mar 2024 12:00:30 GMT", 30 * time.Second, true},
+		{"Friday, 01-Mar-24 12:00:45 GMT", 45 * time.Second, true},
+	}
+	for _, test := range tests {
+		got, ok := retryAfter(test.value)
+		if got != test.want || ok != test.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	policy := RetryPolicy{MaxAttempts: 6, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Jitter: 0.2}
+	tests := []struct {
+		name     string
+		attempt  int
+		header   http.Header
+		fraction float64
+		want     time.Duration
+	}{
+		{"first", 1, nil, 0, time.Second},
+		{"doubles", 2, nil, 0, 2 * time.Second},
+		{"doubles again", 3, nil, 0, 4 * time.Second},
+		{"capped", 4, nil, 0, 5 * time.Second},
+		{"full jitter", 2, nil, 1, 1600 * time.Millisecond},
+		{"half jitter", 4, nil, 0.5, 4500 * time.Millisecond},
+		{"Retry-After seconds", 1, http.Header{"Retry-After": {"12"}}, 1, 12 * time.Second},
+		{"Retry-After date", 3, http.Header{"Retry-After": {at.Add(3 * time.Second).Format(http.TimeFormat)}}, 1, 3 * time.Second},
+		{"invalid Retry-After", 2, http.Header{"Retry-After": {"later"}}, 0, 2 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fixClock(t, at, test.fraction)
+			if got := policy.backoff(test.attempt, test.header); got != test.want {
+				t.Errorf("backoff(%d) = %v, want %v", test.attempt, got, test.want)
+			}
+		})
+	}
+
+	uncapped := RetryPolicy{InitialBackoff: time.Second, Jitter: 3}
+	fixClock(t, at, 0.5)
+	if got := uncapped.backoff(5, nil); got != 8*time.Second {
+		t.Errorf("uncapped backoff(5) with jitter over 1 = %v, want 8s", got)
+	}
+}
+
+// A Transport answering every request with status.
+type statusTransport struct {
+	status int
+	calls  int
+}
+
+func (s *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.calls++
+	return &http.Response{StatusCode: s.status, Status: http.StatusText(s.status), Header: http.Header{}, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func TestMaxAttempts(t *testing.T) {
+	tests := []struct {
+		status      int
+		maxAttempts int
+		wantCalls   int
+	}{
+		{http.StatusServiceUnavailable, 4, 4},
+		{http.StatusTooManyRequests, 2, 2},
+		{http.StatusGatewayTimeout, 1, 1},
+		{http.StatusInternalServerError, 0, 1},
+		{http.StatusNotImplemented, 4, 1},
+		{http.StatusBadRequest, 4, 1},
+	}
+	for _, test := range tests {
+		delays := recordSleeps(t)
+		fixClock(t, time.Now(), 0)
+		transport := &statusTransport{status: test.status}
+		c := NewClient(WithHTTPClient(&http.Client{Transport: transport}), WithRetry(test.maxAttempts))
+		req, _ := http.NewRequest(http.MethodGet, "https://schematics.invalid/v1/workspaces", nil)
+
+		resp, err := c.do(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status || transport.calls != test.wantCalls {
+			t.Errorf("%d with MaxAttempts %d: got %d after %d requests, want %d requests", test.status, test.maxAttempts, resp.StatusCode, transport.calls, test.wantCalls)
+		}
+		if len(*delays) != test.wantCalls-1 {
+			t.Errorf("%d with MaxAttempts %d: waited %v", test.status, test.maxAttempts, *delays)
+		}
+	}
+}
+
+func TestRetryReplaysBody(t *testing.T) {
+	recordSleeps(t)
+	var bodies []string
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		data, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, string(data))
+		status := http.StatusServiceUnavailable
+		if len(bodies) == 2 {
+			status = http.StatusOK
+		}
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+	})
+	c := NewClient(WithHTTPClient(&http.Client{Transport: transport}))
+	req, _ := http.NewRequest(http.MethodPut, "https://schematics.invalid/v1/workspaces/ws-1/apply", strings.NewReader(`{"a":1}`))
+
+	resp, err := c.do(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(bodies) != 2 || bodies[0] != `{"a":1}` || bodies[1] != `{"a":1}` {
+		t.Errorf("bodies = %q, want the same body twice", bodies)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,54 @@
+package schematicstest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is a fake schematics.Clock, e.g. for WaitOptions.Clock. Sleep returns at once and moves the time Now
+// tells forward instead, so a test polls through a job's intervals and timeouts without waiting them out.
+// Its methods are safe for concurrent use.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+// Returns a Clock telling start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Returns the time the clock tells.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Records d and moves the clock forward by it, or returns ctx's error if it has ended.
+func (c *Clock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+// Moves the clock forward by d without recording a sleep, e.g. for a slow request.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Returns the durations Sleep was called with, in order.
+func (c *Clock) Sleeps() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.sleeps...)
+}
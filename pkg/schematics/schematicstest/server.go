@@ -0,0 +1,703 @@
+// Package schematicstest runs an in-memory fake of the IBM Cloud IAM token endpoint and the Schematics workspace API
+// on an httptest.Server, so code built on package schematics can be tested without network access or an account.
+//
+// The fake keeps workspaces, their variables, outputs and state, and the jobs submitted against them. A job starts
+// INPROGRESS and finishes after the number of status checks JobOptions says, ending as JobOptions' status:
+//
+//	server := schematicstest.NewServer()
+//	defer server.Close()
+//	ws := server.AddWorkspace(schematics.Workspace{Name: "demo"})
+//	client := server.Client()
+//	if err := client.Authenticate(ctx, schematicstest.APIKey); err != nil { ... }
+//	result, err := client.Apply(ctx, ws.ID)
+package schematicstest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// the API key IAM accepts unless SetAPIKey changes it
+const APIKey = "schematicstest-api-key"
+
+// how long the access tokens the fake IAM issues are valid
+const tokenLifetime = time.Hour
+
+// JobOptions control how the jobs submitted after SetJobOptions run.
+type JobOptions struct {
+	// status the job ends in: COMPLETED unless set, or FAILED, STOPPED or ERROR
+	Status string
+	// how many status checks of the job report INPROGRESS before it ends; 0 ends it at the first check
+	Polls int
+	// the Terraform output the job's logs return
+	Logs string
+	// the `terraform show -json` document a finished plan job's plan_json file returns; without it the file is
+	// answered with 404
+	PlanJSON string
+	// the infracost breakdown a finished plan job's cost_estimate_json file returns, 404 without it
+	CostEstimateJSON string
+}
+
+// Request is one request the server received.
+type Request struct {
+	Method string
+	// the path and query, e.g. /v1/workspaces/ws-1/apply
+	Path string
+}
+
+// Server is the fake IAM and Schematics. Its methods are safe for concurrent use, also while requests are served.
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	apiKey     string
+	tokens     map[string]bool // access and refresh tokens issued
+	nextID     int
+	workspaces []*workspace
+	job        JobOptions
+	failures   []int // statuses the next requests are answered with
+	requests   []Request
+}
+
+// a workspace and everything the fake keeps about it
+type workspace struct {
+	ws        schematics.Workspace
+	variables []schematics.Variable
+	outputs   []schematics.Output
+	state     []byte
+	jobs      []*job // most recent first
+}
+
+type job struct {
+	activity schematics.Activity
+	polls    int // status checks left before the job ends
+	final    string
+	logs     string
+	planJSON string
+	costJSON string
+	// the workspace's status before the job, which a plan or refresh leaves it in
+	before string
+}
+
+// Starts a server. Close it when done.
+func NewServer() *Server {
+	s := &Server{apiKey: APIKey, tokens: map[string]bool{}, job: JobOptions{Status: "COMPLETED"}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Returns a Client whose IAM and Schematics endpoints are the server, not yet authenticated, and which doesn't
+// wait before retrying answers queued with FailNext.
+func (s *Server) Client() *schematics.Client {
+	client := schematics.NewClientWithHTTPClient(s.Server.Client())
+	client.IAMEndpoint = s.URL
+	client.SchematicsEndpoint = s.URL
+	client.Retry.InitialBackoff = time.Millisecond
+	client.Retry.MaxBackoff = time.Millisecond
+	return client
+}
+
+// Changes the API key IAM accepts.
+func (s *Server) SetAPIKey(apiKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiKey = apiKey
+}
+
+// Sets how jobs submitted from now on run.
+func (s *Server) SetJobOptions(opts JobOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if opts.Status == "" {
+		opts.Status = "COMPLETED"
+	}
+	s.job = opts
+}
+
+// Answers the next request, to IAM or Schematics, with status instead of serving it. Each call queues one answer.
+func (s *Server) FailNext(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, status)
+}
+
+// Returns every request received so far, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Adds ws and returns it as Schematics would, with an id, a status and a template filled in when they are empty.
+func (s *Server) AddWorkspace(ws schematics.Workspace) schematics.Workspace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addWorkspace(ws, nil).ws
+}
+
+func (s *Server) addWorkspace(ws schematics.Workspace, variables []schematics.Variable) *workspace {
+	if ws.ID == "" {
+		ws.ID = s.newID("ws")
+	}
+	if ws.Status == "" {
+		ws.Status = "INACTIVE"
+	}
+	if len(ws.Templates) == 0 {
+		ws.Templates = []schematics.WorkspaceTemplate{{ID: s.newID("tpl"), Folder: ".", Type: "terraform_v1.5"}}
+	}
+	w := &workspace{ws: ws, variables: variables}
+	s.workspaces = append(s.workspaces, w)
+	return w
+}
+
+// Returns the workspace with id as the server holds it.
+func (s *Server) Workspace(id string) (schematics.Workspace, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.find(id)
+	if w == nil {
+		return schematics.Workspace{}, false
+	}
+	return w.ws, true
+}
+
+// Replaces the workspace's variable store. Secure values are kept but never returned, as in Schematics.
+func (s *Server) SetVariables(id string, variables []schematics.Variable) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w := s.find(id); w != nil {
+		w.variables = append([]schematics.Variable(nil), variables...)
+	}
+}
+
+// Returns the workspace's variable store, secure values included.
+func (s *Server) Variables(id string) []schematics.Variable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w := s.find(id); w != nil {
+		return append([]schematics.Variable(nil), w.variables...)
+	}
+	return nil
+}
+
+// Sets the Terraform outputs the workspace returns.
+func (s *Server) SetOutputs(id string, outputs []schematics.Output) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w := s.find(id); w != nil {
+		w.outputs = append([]schematics.Output(nil), outputs...)
+	}
+}
+
+// Sets the Terraform state the workspace returns.
+func (s *Server) SetState(id string, state []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w := s.find(id); w != nil {
+		w.state = append([]byte(nil), state...)
+	}
+}
+
+// Returns the workspace's jobs, most recent first.
+func (s *Server) Activities(id string) []schematics.Activity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.find(id)
+	if w == nil {
+		return nil
+	}
+	activities := make([]schematics.Activity, len(w.jobs))
+	for i, j := range w.jobs {
+		activities[i] = j.activity
+	}
+	return activities
+}
+
+// The caller holds s.mu.
+func (s *Server) find(id string) *workspace {
+	for _, w := range s.workspaces {
+		if w.ws.ID == id {
+			return w
+		}
+	}
+	return nil
+}
+
+// A new id with prefix. The caller holds s.mu.
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%d", prefix, s.nextID)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.RequestURI()})
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		writeError(w, status, "injected failure")
+		return
+	}
+	if r.URL.Path == "/identity/token" {
+		s.serveToken(w, r)
+		return
+	}
+	if !s.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+		writeError(w, http.StatusUnauthorized, "missing or unknown access token")
+		return
+	}
+	s.serveSchematics(w, r, strings.Split(strings.Trim(r.URL.Path, "/"), "/"))
+}
+
+// POST /identity/token with an apikey, refresh_token or assume grant.
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	claims := map[string]interface{}{"iam_id": "IBMid-schematicstest", "sub_type": "user", "name": "schematicstest", "account": map[string]string{"bss": "schematicstest-account"}}
+	switch r.PostForm.Get("grant_type") {
+	case "urn:ibm:params:oauth:grant-type:apikey":
+		if r.PostForm.Get("apikey") != s.apiKey {
+			writeError(w, http.StatusBadRequest, "Provided API key could not be found.")
+			return
+		}
+	case "refresh_token":
+		if !s.tokens[r.PostForm.Get("refresh_token")] {
+			writeError(w, http.StatusBadRequest, "Provided refresh token is invalid.")
+			return
+		}
+	case "urn:ibm:params:oauth:grant-type:assume":
+		if !s.tokens[r.PostForm.Get("access_token")] {
+			writeError(w, http.StatusBadRequest, "Provided access token is invalid.")
+			return
+		}
+		claims["sub_type"] = "Profile"
+		if id := r.PostForm.Get("profile_id"); id != "" {
+			claims["iam_id"], claims["name"] = "iam-"+id, id
+		} else {
+			claims["iam_id"], claims["name"] = "iam-Profile-"+r.PostForm.Get("profile_name"), r.PostForm.Get("profile_name")
+			claims["account"] = map[string]string{"bss": r.PostForm.Get("account")}
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported grant_type")
+		return
+	}
+	expiration := time.Now().Add(tokenLifetime).Unix()
+	claims["exp"] = expiration
+	claims["jti"] = s.newID("token")
+	payload, _ := json.Marshal(claims)
+	// an unsigned JWT: the client reads its claims without checking a signature
+	accessToken := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+	refreshToken := s.newID("refresh")
+	s.tokens[accessToken] = true
+	s.tokens[refreshToken] = true
+	writeJSON(w, http.StatusOK, schematics.Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		Expires:      int(tokenLifetime.Seconds()),
+		Expiration:   int(expiration),
+		Scope:        "ibm openid",
+	})
+}
+
+// Routes a Schematics request by its path segments, e.g. v1, workspaces, ws-1, apply.
+func (s *Server) serveSchematics(w http.ResponseWriter, r *http.Request, path []string) {
+	if len(path) < 2 || path[0] != "v1" || path[1] != "workspaces" {
+		if len(path) == 4 && path[0] == "logs" {
+			s.serveLogFile(w, path[1], path[2])
+			return
+		}
+		if len(path) == 4 && path[0] == "v2" && path[1] == "jobs" && path[3] == "files" && r.Method == http.MethodGet {
+			s.serveJobFile(w, r, path[2])
+			return
+		}
+		writeError(w, http.StatusNotFound, "no such endpoint")
+		return
+	}
+	if len(path) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			s.listWorkspaces(w, r)
+		case http.MethodPost:
+			s.createWorkspace(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "use GET or POST")
+		}
+		return
+	}
+	ws := s.find(path[2])
+	if ws == nil {
+		writeError(w, http.StatusNotFound, "workspace "+path[2]+" not found")
+		return
+	}
+	switch rest := path[3:]; {
+	case len(rest) == 0:
+		s.serveWorkspace(w, r, ws)
+	case len(rest) == 1 && rest[0] == "actions" && r.Method == http.MethodGet:
+		activities := make([]interface{}, len(ws.jobs))
+		for i, j := range ws.jobs {
+			activities[i] = activityJSON(j.activity)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"actions": activities})
+	case len(rest) == 1 && rest[0] == "output_values" && r.Method == http.MethodGet:
+		s.serveOutputs(w, ws)
+	case len(rest) == 1:
+		s.submitJob(w, r, ws, rest[0])
+	case len(rest) >= 2 && rest[0] == "actions":
+		s.serveJob(w, r, ws, rest[1], rest[2:])
+	case len(rest) == 3 && rest[0] == "template_data" && rest[2] == "values":
+		s.serveVariables(w, r, ws)
+	case len(rest) == 3 && rest[0] == "runtime_data" && rest[2] == "state_store" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(ws.state)
+	default:
+		writeError(w, http.StatusNotFound, "no such endpoint")
+	}
+}
+
+// GET /v1/workspaces?offset=&limit=
+func (s *Server) listWorkspaces(w http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	page := []schematics.Workspace{}
+	for i := offset; i >= 0 && i < len(s.workspaces) && len(page) < limit; i++ {
+		page = append(page, s.workspaces[i].ws)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"count": len(s.workspaces), "workspaces": page})
+}
+
+// POST /v1/workspaces
+func (s *Server) createWorkspace(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Name          string                   `json:"name"`
+		Description   string                   `json:"description"`
+		ResourceGroup string                   `json:"resource_group"`
+		Location      string                   `json:"location"`
+		Tags          []string                 `json:"tags"`
+		Type          []string                 `json:"type"`
+		TemplateRepo  schematics.WorkspaceRepo `json:"template_repo"`
+		TemplateData  []struct {
+			Folder    string                `json:"folder"`
+			Type      string                `json:"type"`
+			Variables []schematics.Variable `json:"variablestore"`
+		} `json:"template_data"`
+	}
+	if !readJSON(w, r, &payload) {
+		return
+	}
+	if payload.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	ws := schematics.Workspace{Name: payload.Name, Description: payload.Description, ResourceGroup: payload.ResourceGroup,
+		Location: payload.Location, Tags: payload.Tags, Repo: &payload.TemplateRepo}
+	var variables []schematics.Variable
+	for _, t := range payload.TemplateData {
+		ws.Templates = append(ws.Templates, schematics.WorkspaceTemplate{ID: s.newID("tpl"), Folder: t.Folder, Type: t.Type})
+		variables = append(variables, t.Variables...)
+	}
+	created := s.addWorkspace(ws, variables)
+	writeJSON(w, http.StatusCreated, created.ws)
+}
+
+// GET, PATCH and DELETE /v1/workspaces/{id}
+func (s *Server) serveWorkspace(w http.ResponseWriter, r *http.Request, ws *workspace) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, ws.ws)
+	case http.MethodPatch:
+		var payload struct {
+			Name          *string                        `json:"name"`
+			Description   *string                        `json:"description"`
+			Tags          *[]string                      `json:"tags"`
+			TemplateData  []schematics.WorkspaceTemplate `json:"template_data"`
+			WorkspaceInfo *struct {
+				Frozen *bool `json:"frozen"`
+			} `json:"workspace_status"`
+		}
+		if !readJSON(w, r, &payload) {
+			return
+		}
+		if payload.Name != nil {
+			ws.ws.Name = *payload.Name
+		}
+		if payload.Description != nil {
+			ws.ws.Description = *payload.Description
+		}
+		if payload.Tags != nil {
+			ws.ws.Tags = *payload.Tags
+		}
+		if len(payload.TemplateData) > 0 {
+			ws.ws.Templates = payload.TemplateData
+		}
+		if payload.WorkspaceInfo != nil && payload.WorkspaceInfo.Frozen != nil {
+			ws.ws.State.Frozen = *payload.WorkspaceInfo.Frozen
+			ws.ws.State.FrozenBy, ws.ws.State.FrozenAt = "", ""
+			if ws.ws.State.Frozen {
+				ws.ws.State.FrozenBy, ws.ws.State.FrozenAt = "schematicstest", time.Now().UTC().Format(time.RFC3339)
+			}
+		}
+		ws.ws.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		writeJSON(w, http.StatusOK, ws.ws)
+	case http.MethodDelete:
+		for i, other := range s.workspaces {
+			if other == ws {
+				s.workspaces = append(s.workspaces[:i], s.workspaces[i+1:]...)
+				break
+			}
+		}
+		writeJSON(w, http.StatusOK, "Workspace deleted")
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "use GET, PATCH or DELETE")
+	}
+}
+
+// the HTTP method of each job Schematics runs, as package schematics sends them
+var jobMethods = map[string]string{
+	"apply":   http.MethodPut,
+	"destroy": http.MethodPut,
+	"plan":    http.MethodPost,
+	"refresh": http.MethodPut,
+}
+
+// PUT or POST /v1/workspaces/{id}/{action}. Like Schematics, it refuses with 409 while the workspace is frozen or
+// another job runs.
+func (s *Server) submitJob(w http.ResponseWriter, r *http.Request, ws *workspace, action string) {
+	method, ok := jobMethods[action]
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such endpoint")
+		return
+	}
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, "use "+method)
+		return
+	}
+	if ws.ws.State.Frozen {
+		writeError(w, http.StatusConflict, "workspace "+ws.ws.ID+" is frozen")
+		return
+	}
+	for _, j := range ws.jobs {
+		if !schematics.IsTerminalStatus(j.activity.Status) {
+			writeError(w, http.StatusConflict, "workspace "+ws.ws.ID+" is locked by job "+j.activity.ActionID)
+			return
+		}
+	}
+	io.Copy(io.Discard, r.Body)
+	now := time.Now().UTC().Format(time.RFC3339)
+	j := &job{
+		activity: schematics.Activity{
+			ActionID:    s.newID("act"),
+			Name:        strings.ToUpper(action),
+			Status:      "INPROGRESS",
+			PerformedBy: "schematicstest",
+			PerformedAt: now,
+		},
+		polls:    s.job.Polls,
+		final:    s.job.Status,
+		logs:     s.job.Logs,
+		planJSON: s.job.PlanJSON,
+		costJSON: s.job.CostEstimateJSON,
+		before:   ws.ws.Status,
+	}
+	for _, t := range ws.ws.Templates {
+		j.activity.Templates = append(j.activity.Templates, schematics.ActivityTemplate{TemplateID: t.ID, Status: "INPROGRESS", StartTime: now})
+	}
+	ws.jobs = append([]*job{j}, ws.jobs...)
+	ws.ws.Status = "INPROGRESS"
+	writeJSON(w, http.StatusAccepted, map[string]string{"activityid": j.activity.ActionID})
+}
+
+// GET and DELETE /v1/workspaces/{id}/actions/{activity-id} and GET .../logs
+func (s *Server) serveJob(w http.ResponseWriter, r *http.Request, ws *workspace, activityID string, rest []string) {
+	var j *job
+	for _, candidate := range ws.jobs {
+		if candidate.activity.ActionID == activityID {
+			j = candidate
+		}
+	}
+	if j == nil {
+		writeError(w, http.StatusNotFound, "activity "+activityID+" not found")
+		return
+	}
+	switch {
+	case len(rest) == 1 && rest[0] == "logs" && r.Method == http.MethodGet:
+		var templates []map[string]string
+		for _, t := range j.activity.Templates {
+			templates = append(templates, map[string]string{"template_id": t.TemplateID, "log_url": s.URL + "/logs/" + ws.ws.ID + "/" + activityID + "/" + t.TemplateID})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"action_id": activityID, "templates": templates})
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		if !schematics.IsTerminalStatus(j.activity.Status) {
+			if j.polls > 0 {
+				j.polls--
+			} else {
+				s.finishJob(ws, j, j.final)
+			}
+		}
+		writeJSON(w, http.StatusOK, activityJSON(j.activity))
+	case len(rest) == 0 && r.Method == http.MethodDelete:
+		if !schematics.IsTerminalStatus(j.activity.Status) {
+			s.finishJob(ws, j, "STOPPED")
+		}
+		writeJSON(w, http.StatusOK, activityJSON(j.activity))
+	default:
+		writeError(w, http.StatusNotFound, "no such endpoint")
+	}
+}
+
+// Ends j with status and sets the workspace's status as Schematics would after it.
+func (s *Server) finishJob(ws *workspace, j *job, status string) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	j.activity.Status = status
+	for i := range j.activity.Templates {
+		j.activity.Templates[i].Status = status
+		j.activity.Templates[i].EndTime = now
+	}
+	switch {
+	case status != "COMPLETED":
+		ws.ws.Status = "FAILED"
+	case j.activity.Name == "DESTROY":
+		ws.ws.Status = "INACTIVE"
+	case j.activity.Name == "APPLY":
+		ws.ws.Status = "ACTIVE"
+	default:
+		ws.ws.Status = j.before
+	}
+	ws.ws.UpdatedAt = now
+}
+
+// GET /logs/{id}/{activity-id}/{template-id}, the log_url of a job's template
+func (s *Server) serveLogFile(w http.ResponseWriter, workspaceID string, activityID string) {
+	if ws := s.find(workspaceID); ws != nil {
+		for _, j := range ws.jobs {
+			if j.activity.ActionID == activityID {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, j.logs)
+				return
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, "no such log")
+}
+
+// GET /v2/jobs/{activity-id}/files?file_type=plan_json or cost_estimate_json
+func (s *Server) serveJobFile(w http.ResponseWriter, r *http.Request, activityID string) {
+	fileType := r.URL.Query().Get("file_type")
+	if fileType != "plan_json" && fileType != "cost_estimate_json" {
+		writeError(w, http.StatusBadRequest, "only file_type=plan_json and cost_estimate_json are supported")
+		return
+	}
+	for _, ws := range s.workspaces {
+		for _, j := range ws.jobs {
+			if j.activity.ActionID != activityID || !schematics.IsTerminalStatus(j.activity.Status) {
+				continue
+			}
+			content := j.planJSON
+			if fileType == "cost_estimate_json" {
+				content = j.costJSON
+			}
+			if content != "" {
+				writeJSON(w, http.StatusOK, map[string]string{"file_content": content})
+				return
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, "no "+fileType+" file for activity "+activityID)
+}
+
+// GET /v1/workspaces/{id}/output_values
+func (s *Server) serveOutputs(w http.ResponseWriter, ws *workspace) {
+	type value struct {
+		Value     json.RawMessage `json:"value"`
+		Type      string          `json:"type,omitempty"`
+		Sensitive bool            `json:"sensitive,omitempty"`
+	}
+	values := []map[string]value{}
+	for _, o := range ws.outputs {
+		values = append(values, map[string]value{o.Name: {Value: o.Value, Type: o.Type, Sensitive: o.Sensitive}})
+	}
+	writeJSON(w, http.StatusOK, []map[string]interface{}{{"id": ws.ws.Templates[0].ID, "output_values": values}})
+}
+
+// GET and PUT /v1/workspaces/{id}/template_data/{template-id}/values
+func (s *Server) serveVariables(w http.ResponseWriter, r *http.Request, ws *workspace) {
+	switch r.Method {
+	case http.MethodGet:
+		variables := []schematics.Variable{}
+		for _, v := range ws.variables {
+			if v.Secure {
+				v.Value = ""
+			}
+			variables = append(variables, v)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"variablestore": variables})
+	case http.MethodPut:
+		var payload struct {
+			Variables []schematics.Variable `json:"variablestore"`
+		}
+		if !readJSON(w, r, &payload) {
+			return
+		}
+		ws.variables = payload.Variables
+		writeJSON(w, http.StatusOK, map[string]interface{}{"variablestore": payload.Variables})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "use GET or PUT")
+	}
+}
+
+// Decodes the request body into v, answering 400 when it isn't valid JSON.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// An activity as Schematics sends it, with its message as a list of lines.
+func activityJSON(a schematics.Activity) interface{} {
+	wire := struct {
+		schematics.Activity
+		Message []string `json:"message,omitempty"`
+	}{Activity: a}
+	if a.Message != "" {
+		wire.Message = []string{a.Message}
+	}
+	return wire
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Transaction-Id", "schematicstest-"+strconv.FormatInt(time.Now().UnixNano(), 36))
+	w.WriteHeader(status)
+	data, _ := json.Marshal(v)
+	w.Write(data)
+}
+
+// Answers in the shape of an IBM Cloud error.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"errors":      []map[string]string{{"message": message}},
+		"status_code": status,
+	})
+}
@@ -0,0 +1,328 @@
+//go:build schematicssdk
+
+// Package sdkbackend implements schematics.Backend on top of the official IBM Cloud Schematics Go SDK
+// (github.com/IBM/schematics-go-sdk) and the go-sdk-core authenticators, so workspace and job calls pick up the
+// SDK's retries and request handling.
+//
+// It is only compiled with the schematicssdk build tag, which keeps the SDK out of the default build:
+//
+//	go build -tags schematicssdk ./...
+package sdkbackend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/schematics-go-sdk/schematicsv1"
+	"github.com/go-openapi/strfmt"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// page size used when listing workspaces
+const workspacePageSize = 100
+
+// Backend sends a schematics.Client's workspace and job calls through the SDK. Create it with New and set it as the
+// client's Backend.
+type Backend struct {
+	service *schematicsv1.SchematicsV1
+	// the client it is the backend of: Schematics wants its refresh token on every action
+	client *schematics.Client
+}
+
+// Returns a Backend for client, sending to client.SchematicsEndpoint over client.HTTPClient with client.Retry's
+// attempts. authenticator signs the requests; nil uses client's own token, renewed as the client renews it, so
+// every way the client can log in keeps working. Pass e.g. a core.IamAuthenticator to have the SDK manage the
+// token instead.
+func New(client *schematics.Client, authenticator core.Authenticator) (*Backend, error) {
+	if authenticator == nil {
+		authenticator = clientAuthenticator{client: client}
+	}
+	service, err := schematicsv1.NewSchematicsV1(&schematicsv1.SchematicsV1Options{
+		URL:           client.SchematicsEndpoint,
+		Authenticator: authenticator,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating Schematics SDK service: %w", err)
+	}
+	service.Service.SetHTTPClient(client.HTTPClient)
+	if client.Retry.MaxAttempts > 1 {
+		service.EnableRetries(client.Retry.MaxAttempts-1, client.Retry.MaxBackoff)
+	}
+	return &Backend{service: service, client: client}, nil
+}
+
+// Returns an IAM API key authenticator that gets its tokens from client.IAMEndpoint over client.HTTPClient.
+func NewIAMAuthenticator(client *schematics.Client, apiKey string) (core.Authenticator, error) {
+	authenticator, err := core.NewIamAuthenticatorBuilder().SetApiKey(apiKey).SetURL(client.IAMEndpoint).SetClient(client.HTTPClient).Build()
+	if err != nil {
+		return nil, err
+	}
+	return authenticator, nil
+}
+
+// A core.Authenticator signing requests with the schematics.Client's current access token.
+type clientAuthenticator struct {
+	client *schematics.Client
+}
+
+func (a clientAuthenticator) AuthenticationType() string {
+	return core.AUTHTYPE_BEARER_TOKEN
+}
+
+func (a clientAuthenticator) Authenticate(req *http.Request) error {
+	token, err := a.client.CurrentToken(req.Context())
+	if err != nil {
+		return err
+	}
+	if token.AccessToken == "" {
+		return errors.New("schematics: client is not authenticated")
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	return nil
+}
+
+func (a clientAuthenticator) Validate() error {
+	return nil
+}
+
+// the refresh token Schematics requires on workspace actions
+func (b *Backend) refreshToken(ctx context.Context) (*string, error) {
+	token, err := b.client.CurrentToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return core.StringPtr(token.RefreshToken), nil
+}
+
+// Submits the action with the SDK's Apply-, Destroy-, Plan- or RefreshWorkspaceCommand.
+func (b *Backend) RunAction(ctx context.Context, action string, workspaceID string, opts schematics.ActionOptions) (schematics.ActionResult, error) {
+	h := headers(ctx)
+	var result schematics.ActionResult
+	refreshToken, err := b.refreshToken(ctx)
+	if err != nil {
+		return result, err
+	}
+	var actionOptions *schematicsv1.WorkspaceActivityOptionsTemplate
+	if len(opts.Targets) > 0 {
+		actionOptions = &schematicsv1.WorkspaceActivityOptionsTemplate{Target: opts.Targets}
+	}
+	var activityID *string
+	var response *core.DetailedResponse
+	switch action {
+	case "apply":
+		var r *schematicsv1.WorkspaceActivityApplyResult
+		r, response, err = b.service.ApplyWorkspaceCommandWithContext(ctx, &schematicsv1.ApplyWorkspaceCommandOptions{
+			WID: &workspaceID, RefreshToken: refreshToken, ActionOptions: actionOptions, Headers: h,
+		})
+		if r != nil {
+			activityID = r.Activityid
+		}
+	case "destroy":
+		var r *schematicsv1.WorkspaceActivityDestroyResult
+		r, response, err = b.service.DestroyWorkspaceCommandWithContext(ctx, &schematicsv1.DestroyWorkspaceCommandOptions{
+			WID: &workspaceID, RefreshToken: refreshToken, ActionOptions: actionOptions, Headers: h,
+		})
+		if r != nil {
+			activityID = r.Activityid
+		}
+	case "plan":
+		var r *schematicsv1.WorkspaceActivityPlanResult
+		r, response, err = b.service.PlanWorkspaceCommandWithContext(ctx, &schematicsv1.PlanWorkspaceCommandOptions{
+			WID: &workspaceID, RefreshToken: refreshToken, Headers: h,
+		})
+		if r != nil {
+			activityID = r.Activityid
+		}
+	case "refresh":
+		var r *schematicsv1.WorkspaceActivityRefreshResult
+		r, response, err = b.service.RefreshWorkspaceCommandWithContext(ctx, &schematicsv1.RefreshWorkspaceCommandOptions{
+			WID: &workspaceID, RefreshToken: refreshToken, Headers: h,
+		})
+		if r != nil {
+			activityID = r.Activityid
+		}
+	default:
+		return result, fmt.Errorf("unsupported workspace action %q", action)
+	}
+	if response != nil {
+		result.StatusCode = response.StatusCode
+		result.Status = statusLine(response.StatusCode)
+		result.TransactionID = schematics.TransactionID(response.Headers)
+		result.Body = responseBody(response)
+	}
+	result.ActivityID = str(activityID)
+	// plan is the one action Schematics takes as a POST
+	method := http.MethodPut
+	if action == "plan" {
+		method = http.MethodPost
+	}
+	return result, apiError(err, response, h[schematics.CorrelationIDHeader], method, "/v1/workspaces/"+workspaceID+"/"+action)
+}
+
+func (b *Backend) GetWorkspace(ctx context.Context, workspaceID string) (schematics.Workspace, error) {
+	h := headers(ctx)
+	ws, response, err := b.service.GetWorkspaceWithContext(ctx, &schematicsv1.GetWorkspaceOptions{WID: &workspaceID, Headers: h})
+	if err != nil {
+		return schematics.Workspace{}, apiError(err, response, h[schematics.CorrelationIDHeader], http.MethodGet, "/v1/workspaces/"+workspaceID)
+	}
+	return workspace(ws), nil
+}
+
+// Lists every workspace, following the pagination.
+func (b *Backend) ListWorkspaces(ctx context.Context) ([]schematics.Workspace, error) {
+	h := headers(ctx)
+	var workspaces []schematics.Workspace
+	for offset := int64(0); ; {
+		page, response, err := b.service.ListWorkspacesWithContext(ctx, &schematicsv1.ListWorkspacesOptions{
+			Offset: core.Int64Ptr(offset), Limit: core.Int64Ptr(workspacePageSize), Headers: h,
+		})
+		if err != nil {
+			return workspaces, apiError(err, response, h[schematics.CorrelationIDHeader], http.MethodGet, "/v1/workspaces")
+		}
+		for i := range page.Workspaces {
+			workspaces = append(workspaces, workspace(&page.Workspaces[i]))
+		}
+		offset += int64(len(page.Workspaces))
+		if len(page.Workspaces) == 0 || page.Count == nil || offset >= *page.Count {
+			return workspaces, nil
+		}
+	}
+}
+
+func (b *Backend) ListActivities(ctx context.Context, workspaceID string) ([]schematics.Activity, error) {
+	h := headers(ctx)
+	list, response, err := b.service.ListWorkspaceActivitiesWithContext(ctx, &schematicsv1.ListWorkspaceActivitiesOptions{WID: &workspaceID, Headers: h})
+	if err != nil {
+		return nil, apiError(err, response, h[schematics.CorrelationIDHeader], http.MethodGet, "/v1/workspaces/"+workspaceID+"/actions")
+	}
+	activities := make([]schematics.Activity, len(list.Actions))
+	for i := range list.Actions {
+		activities[i] = activity(&list.Actions[i])
+	}
+	return activities, nil
+}
+
+func (b *Backend) GetActivity(ctx context.Context, workspaceID string, activityID string) (schematics.Activity, error) {
+	h := headers(ctx)
+	a, response, err := b.service.GetWorkspaceActivityWithContext(ctx, &schematicsv1.GetWorkspaceActivityOptions{WID: &workspaceID, ActivityID: &activityID, Headers: h})
+	if err != nil {
+		return schematics.Activity{}, apiError(err, response, h[schematics.CorrelationIDHeader], http.MethodGet, "/v1/workspaces/"+workspaceID+"/actions/"+activityID)
+	}
+	return activity(a), nil
+}
+
+// Converts the SDK's workspace into package schematics' own.
+func workspace(ws *schematicsv1.WorkspaceResponse) schematics.Workspace {
+	out := schematics.Workspace{
+		ID:            str(ws.ID),
+		Name:          str(ws.Name),
+		Description:   str(ws.Description),
+		Status:        str(ws.Status),
+		ResourceGroup: str(ws.ResourceGroup),
+		Location:      str(ws.Location),
+		Tags:          ws.Tags,
+		UpdatedAt:     date(ws.UpdatedAt),
+		UpdatedBy:     str(ws.UpdatedBy),
+	}
+	for _, t := range ws.TemplateData {
+		out.Templates = append(out.Templates, schematics.WorkspaceTemplate{ID: str(t.ID), Folder: str(t.Folder), Type: str(t.Type)})
+	}
+	if ws.TemplateRepo != nil {
+		out.Repo = &schematics.WorkspaceRepo{URL: str(ws.TemplateRepo.URL), Branch: str(ws.TemplateRepo.Branch), CommitSHA: str(ws.TemplateRepo.RepoShaValue)}
+	}
+	if ws.WorkspaceStatus != nil {
+		out.State = schematics.WorkspaceState{
+			Frozen:   ws.WorkspaceStatus.Frozen != nil && *ws.WorkspaceStatus.Frozen,
+			FrozenBy: str(ws.WorkspaceStatus.FrozenBy),
+			FrozenAt: date(ws.WorkspaceStatus.FrozenAt),
+		}
+	}
+	return out
+}
+
+// Converts the SDK's activity into package schematics' own.
+func activity(a *schematicsv1.WorkspaceActivity) schematics.Activity {
+	out := schematics.Activity{
+		ActionID:    str(a.ActionID),
+		Name:        str(a.Name),
+		Status:      str(a.Status),
+		Message:     strings.Join(a.Message, "; "),
+		PerformedBy: str(a.PerformedBy),
+		PerformedAt: date(a.PerformedAt),
+	}
+	for _, t := range a.Templates {
+		out.Templates = append(out.Templates, schematics.ActivityTemplate{
+			TemplateID: str(t.TemplateID),
+			Status:     str(t.Status),
+			StartTime:  date(t.StartTime),
+			EndTime:    date(t.EndTime),
+		})
+	}
+	return out
+}
+
+// Turns a failed SDK call into a *schematics.APIError when Schematics answered, so a 409 reads as one.
+// correlationID is the one the call was sent with.
+func apiError(err error, response *core.DetailedResponse, correlationID string, method string, path string) error {
+	if err == nil || response == nil || response.StatusCode < 300 {
+		return err
+	}
+	return &schematics.APIError{
+		Method:        method,
+		URL:           path,
+		StatusCode:    response.StatusCode,
+		Status:        statusLine(response.StatusCode),
+		TransactionID: schematics.TransactionID(response.Headers),
+		CorrelationID: correlationID,
+		RequestID:     response.Headers.Get(schematics.RequestIDHeader),
+		Body:          responseBody(response),
+	}
+}
+
+// The headers of an SDK call under ctx: its correlation id, as the client's own requests send it.
+func headers(ctx context.Context) map[string]string {
+	id := schematics.CorrelationID(ctx)
+	if id == "" {
+		id = schematics.NewCorrelationID()
+	}
+	return map[string]string{schematics.CorrelationIDHeader: id}
+}
+
+// The response body: the raw one when the SDK kept it, otherwise what it decoded re-encoded.
+func responseBody(response *core.DetailedResponse) []byte {
+	if len(response.RawResult) > 0 {
+		return response.RawResult
+	}
+	if response.Result == nil {
+		return nil
+	}
+	body, _ := json.Marshal(response.Result)
+	return body
+}
+
+// e.g. "409 Conflict", as http.Response.Status reads
+func statusLine(code int) string {
+	return fmt.Sprintf("%d %s", code, http.StatusText(code))
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// The time as the RFC 3339 text Schematics' JSON carries.
+func date(t *strfmt.DateTime) string {
+	if t == nil {
+		return ""
+	}
+	return time.Time(*t).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,101 @@
+//go:build schematicssdk
+
+package sdkbackend_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+	"schematics-apply-destroy/pkg/schematics/schematicstest"
+	"schematics-apply-destroy/pkg/schematics/sdkbackend"
+)
+
+// A client logged in to srv with the SDK as its backend.
+func sdkClient(t *testing.T, srv *schematicstest.Server) *schematics.Client {
+	client := srv.Client()
+	if err := client.Authenticate(context.Background(), schematicstest.APIKey); err != nil {
+		t.Fatal(err)
+	}
+	backend, err := sdkbackend.New(client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Backend = backend
+	return client
+}
+
+func TestApplyThroughSDK(t *testing.T) {
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+	client := sdkClient(t, srv)
+	ctx := context.Background()
+
+	result, err := client.Apply(ctx, ws.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ActivityID == "" || result.StatusCode != http.StatusAccepted {
+		t.Fatalf("Apply = %+v, want a 202 with an activity id", result)
+	}
+	activity, err := client.WaitForActivity(ctx, ws.ID, result.ActivityID, schematics.WaitOptions{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if activity.Status != "COMPLETED" {
+		t.Errorf("activity status = %q, want COMPLETED", activity.Status)
+	}
+	got, err := client.GetWorkspace(ctx, ws.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "demo" || got.Status != "ACTIVE" {
+		t.Errorf("workspace = %+v, want demo ACTIVE", got)
+	}
+	activities, err := client.ListActivities(ctx, ws.ID)
+	if err != nil || len(activities) != 1 {
+		t.Fatalf("ListActivities = %+v, %v", activities, err)
+	}
+}
+
+func TestSDKConflictIsAPIError(t *testing.T) {
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+	srv.SetJobOptions(schematicstest.JobOptions{Polls: 100})
+	client := sdkClient(t, srv)
+	ctx := schematics.WithCorrelationID(context.Background(), "corr-1")
+
+	if _, err := client.Apply(ctx, ws.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err := client.Plan(ctx, ws.ID)
+	var apiErr *schematics.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("second job error = %v, want an *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusConflict || apiErr.Method != http.MethodPost || apiErr.CorrelationID != "corr-1" {
+		t.Errorf("APIError = %+v, want a 409 POST with correlation id corr-1", apiErr)
+	}
+}
+
+func TestListWorkspacesThroughSDK(t *testing.T) {
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	for i := 0; i < 150; i++ {
+		srv.AddWorkspace(schematics.Workspace{Name: "ws"})
+	}
+	client := sdkClient(t, srv)
+
+	list, err := client.ListWorkspaces(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 150 {
+		t.Errorf("listed %d workspaces, want 150 across two pages", len(list))
+	}
+}
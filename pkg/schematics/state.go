@@ -0,0 +1,22 @@
+package schematics
+
+import (
+	"context"
+	"fmt"
+)
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}/runtime_data/{template-id}/state_store -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+// Returns the Terraform state of the workspace's template exactly as Schematics stores it.
+func (c *Client) GetState(ctx context.Context, workspaceID string) ([]byte, error) {
+	templateID, err := c.templateID(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("reading state: %w", err)
+	}
+	endpoint := c.SchematicsEndpoint + "/v1/workspaces/" + workspaceID + "/runtime_data/" + templateID + "/state_store"
+	_, body, err := c.send(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading state: %w", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,60 @@
+package schematics
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// TransportOptions adjust how the client checks TLS certificates, e.g. behind a proxy that intercepts TLS.
+type TransportOptions struct {
+	// PEM file of CA certificates to trust on top of the system ones
+	CACertFile string
+	// skips certificate verification altogether
+	InsecureSkipVerify bool
+}
+
+// Returns a dedicated http.Client that goes through the proxy in HTTPS_PROXY or HTTP_PROXY, except for the hosts
+// in NO_PROXY and link-local addresses such as the instance metadata service, and checks certificates as opts say.
+func NewHTTPClient(opts TransportOptions) (*http.Client, error) {
+	transport := newTransport()
+	if opts.CACertFile == "" && !opts.InsecureSkipVerify {
+		return &http.Client{Transport: transport}, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: opts.InsecureSkipVerify}
+	if opts.CACertFile != "" {
+		pem, err := ioutil.ReadFile(opts.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificates: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s contains no PEM certificates", opts.CACertFile)
+		}
+		config.RootCAs = pool
+	}
+	transport.TLSClientConfig = config
+	return &http.Client{Transport: transport}, nil
+}
+
+// A copy of http.DefaultTransport with the proxy rules of NewHTTPClient.
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFor
+	return transport
+}
+
+// The proxy for req from the environment; link-local hosts are always reached directly.
+func proxyFor(req *http.Request) (*url.URL, error) {
+	if ip := net.ParseIP(req.URL.Hostname()); ip != nil && ip.IsLinkLocalUnicast() {
+		return nil, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
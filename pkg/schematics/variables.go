@@ -0,0 +1,114 @@
+package schematics
+
+import (
+	"context"
+	"fmt"
+)
+
+// Variable is one entry of a workspace template's variable store.
+type Variable struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Terraform type, e.g. string, number or list(string); Schematics assumes string when empty
+	Type string `json:"type,omitempty"`
+	// secure values are write-only: Schematics never returns them
+	Secure      bool   `json:"secure,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Returns the id of the workspace's template, which its variables belong to.
+func (c *Client) templateID(ctx context.Context, workspaceID string) (string, error) {
+	ws, err := c.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return "", err
+	}
+	if len(ws.Templates) == 0 || ws.Templates[0].ID == "" {
+		return "", fmt.Errorf("workspace %s has no template", workspaceID)
+	}
+	return ws.Templates[0].ID, nil
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}/template_data/{template-id}/values -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+// Returns the variables of the workspace's template. Secure variables come back without their values.
+func (c *Client) GetVariables(ctx context.Context, workspaceID string) ([]Variable, error) {
+	templateID, err := c.templateID(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("reading variables: %w", err)
+	}
+	return c.getVariables(ctx, workspaceID, templateID)
+}
+
+func (c *Client) getVariables(ctx context.Context, workspaceID string, templateID string) ([]Variable, error) {
+	var values struct {
+		Variables []Variable `json:"variablestore"`
+	}
+	endpoint := c.SchematicsEndpoint + "/v1/workspaces/" + workspaceID + "/template_data/" + templateID + "/values"
+	if err := c.getJSON(ctx, endpoint, &values); err != nil {
+		return nil, fmt.Errorf("reading variables: %w", err)
+	}
+	return values.Variables, nil
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl -X PUT https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}/template_data/{template-id}/values -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>" -d '{"variablestore": [...]}'
+// Sets updates in the workspace's variable store, keeping every other variable. Updated variables keep their
+// existing type and description unless the update gives one.
+// Schematics replaces the whole store and never returns secure values, so writing back an unchanged secure variable
+// would clear it; SetVariables refuses instead unless every existing secure variable is among the updates.
+func (c *Client) SetVariables(ctx context.Context, workspaceID string, updates []Variable) error {
+	templateID, err := c.templateID(ctx, workspaceID)
+	if err != nil {
+		return fmt.Errorf("updating variables: %w", err)
+	}
+	existing, err := c.getVariables(ctx, workspaceID, templateID)
+	if err != nil {
+		return fmt.Errorf("updating variables: %w", err)
+	}
+	merged, err := mergeVariables(existing, updates)
+	if err != nil {
+		return fmt.Errorf("updating variables of workspace %s: %w", workspaceID, err)
+	}
+	payload := struct {
+		Variables []Variable `json:"variablestore"`
+	}{merged}
+	endpoint := c.SchematicsEndpoint + "/v1/workspaces/" + workspaceID + "/template_data/" + templateID + "/values"
+	if err := c.sendJSON(ctx, "PUT", endpoint, payload, nil); err != nil {
+		return fmt.Errorf("updating variables: %w", err)
+	}
+	return nil
+}
+
+// Applies updates to existing, in order, appending variables that don't exist yet.
+func mergeVariables(existing []Variable, updates []Variable) ([]Variable, error) {
+	merged := append([]Variable(nil), existing...)
+	updated := map[string]bool{}
+	for _, update := range updates {
+		updated[update.Name] = true
+		found := false
+		for i := range merged {
+			if merged[i].Name != update.Name {
+				continue
+			}
+			found = true
+			if update.Type == "" {
+				update.Type = merged[i].Type
+			}
+			if update.Description == "" {
+				update.Description = merged[i].Description
+			}
+			// a variable stays secure once it was
+			update.Secure = update.Secure || merged[i].Secure
+			merged[i] = update
+		}
+		if !found {
+			merged = append(merged, update)
+		}
+	}
+	for _, v := range existing {
+		if v.Secure && !updated[v.Name] {
+			return nil, fmt.Errorf("secure variable %s would be cleared because Schematics does not return its value; set it again in the same call", v.Name)
+		}
+	}
+	return merged, nil
+}
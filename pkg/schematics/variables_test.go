@@ -0,0 +1,111 @@
+package schematics
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeVariables(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []Variable
+		updates  []Variable
+		want     []Variable
+		wantErr  string
+	}{
+		{
+			name:     "update keeps type and description",
+			existing: []Variable{{Name: "size", Value: "2", Type: "number", Description: "workers"}},
+			updates:  []Variable{{Name: "size", Value: "3"}},
+			want:     []Variable{{Name: "size", Value: "3", Type: "number", Description: "workers"}},
+		},
+		{
+			name:     "update overrides type and description",
+			existing: []Variable{{Name: "zones", Value: "a", Description: "old"}},
+			updates:  []Variable{{Name: "zones", Value: `["a","b"]`, Type: "list(string)", Description: "new"}},
+			want:     []Variable{{Name: "zones", Value: `["a","b"]`, Type: "list(string)", Description: "new"}},
+		},
+		{
+			name:     "others kept, new appended in order",
+			existing: []Variable{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}},
+			updates:  []Variable{{Name: "d", Value: "4"}, {Name: "b", Value: "20"}, {Name: "c", Value: "3"}},
+			want:     []Variable{{Name: "a", Value: "1"}, {Name: "b", Value: "20"}, {Name: "d", Value: "4"}, {Name: "c", Value: "3"}},
+		},
+		{
+			name:     "later update wins",
+			existing: []Variable{{Name: "a", Value: "1"}},
+			updates:  []Variable{{Name: "a", Value: "2"}, {Name: "a", Value: "3"}},
+			want:     []Variable{{Name: "a", Value: "3"}},
+		},
+		{
+			name:    "later update of a new variable wins",
+			updates: []Variable{{Name: "n", Value: "1"}, {Name: "n", Value: "2"}},
+			want:    []Variable{{Name: "n", Value: "2"}},
+		},
+		{
+			name:     "secure variable set again",
+			existing: []Variable{{Name: "api_key", Secure: true}, {Name: "region", Value: "us-south"}},
+			updates:  []Variable{{Name: "api_key", Value: "new"}},
+			want:     []Variable{{Name: "api_key", Value: "new", Secure: true}, {Name: "region", Value: "us-south"}},
+		},
+		{
+			name:     "variable stays secure",
+			existing: []Variable{{Name: "token", Secure: true}},
+			updates:  []Variable{{Name: "token", Value: "t", Secure: false}},
+			want:     []Variable{{Name: "token", Value: "t", Secure: true}},
+		},
+		{
+			name:     "variable becomes secure",
+			existing: []Variable{{Name: "token", Value: "plain"}},
+			updates:  []Variable{{Name: "token", Value: "t", Secure: true}},
+			want:     []Variable{{Name: "token", Value: "t", Secure: true}},
+		},
+		{
+			name:     "secure variable would be cleared",
+			existing: []Variable{{Name: "api_key", Secure: true}, {Name: "region", Value: "us-south"}},
+			updates:  []Variable{{Name: "region", Value: "eu-de"}},
+			wantErr:  "secure variable api_key would be cleared",
+		},
+		{
+			name:     "every secure variable checked",
+			existing: []Variable{{Name: "a", Secure: true}, {Name: "b", Secure: true}},
+			updates:  []Variable{{Name: "a", Value: "1"}},
+			wantErr:  "secure variable b would be cleared",
+		},
+		{
+			name:     "no updates with a secure variable",
+			existing: []Variable{{Name: "a", Secure: true}},
+			wantErr:  "secure variable a would be cleared",
+		},
+		{
+			name:     "no updates",
+			existing: []Variable{{Name: "a", Value: "1"}},
+			want:     []Variable{{Name: "a", Value: "1"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			existing := append([]Variable(nil), test.existing...)
+			got, err := mergeVariables(test.existing, test.updates)
+			if !reflect.DeepEqual(test.existing, existing) {
+				t.Errorf("existing changed to %+v", test.existing)
+			}
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error = %v, want %q", err, test.wantErr)
+				}
+				if got != nil {
+					t.Errorf("got %+v with the error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,720 @@
+package schematics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// ActionResult describes a submitted workspace action.
+type ActionResult struct {
+	// Schematics activity id for the job, when the response carried one
+	ActivityID    string
+	StatusCode    int
+	Status        string
+	TransactionID string
+	Body          []byte
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl -X PUT https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}/apply -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+func (c *Client) Apply(ctx context.Context, workspaceID string) (ActionResult, error) {
+	return c.RunAction(ctx, "apply", workspaceID)
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl -X PUT https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}/destroy -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+func (c *Client) Destroy(ctx context.Context, workspaceID string) (ActionResult, error) {
+	return c.RunAction(ctx, "destroy", workspaceID)
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl -X POST https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}/plan -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+func (c *Client) Plan(ctx context.Context, workspaceID string) (ActionResult, error) {
+	return c.RunAction(ctx, "plan", workspaceID)
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl -X PUT https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}/refresh -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+// Refreshes the Terraform state against the real infrastructure without changing it.
+func (c *Client) Refresh(ctx context.Context, workspaceID string) (ActionResult, error) {
+	return c.RunAction(ctx, "refresh", workspaceID)
+}
+
+// HTTP method Schematics expects for each workspace action
+var actionMethods = map[string]string{
+	"apply":   "PUT",
+	"destroy": "PUT",
+	"plan":    "POST",
+	"refresh": "PUT",
+}
+
+// Submits the named workspace action (the last path segment of the Schematics endpoint, e.g. "apply").
+// When Schematics answers with a non-2xx status the result is still filled in and the error is an *APIError.
+func (c *Client) RunAction(ctx context.Context, action string, workspaceID string) (ActionResult, error) {
+	return c.RunActionWithOptions(ctx, action, workspaceID, ActionOptions{})
+}
+
+// ActionOptions adjust the Terraform command a workspace action runs.
+type ActionOptions struct {
+	// resource addresses such as module.cluster.ibm_container_cluster.this to limit the job to, like terraform -target
+	Targets []string
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl -X PUT https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}/apply -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>" -d '{"action_options": {"target": ["module.cluster"]}}'
+// Like RunAction, with opts sent in the request body.
+func (c *Client) RunActionWithOptions(ctx context.Context, action string, workspaceID string, opts ActionOptions) (ActionResult, error) {
+	var result ActionResult
+	req, err := c.ActionRequest(action, workspaceID, opts)
+	if err != nil {
+		return result, err
+	}
+	if c.Backend != nil {
+		result, err := c.Backend.RunAction(ctx, action, workspaceID, opts)
+		if err != nil {
+			return result, fmt.Errorf("submitting %s for workspace %s: %w", action, workspaceID, err)
+		}
+		return result, nil
+	}
+	c.log(ctx, slog.LevelDebug, "submitting workspace action", "action", action, "url", req.URL)
+
+	var payload io.Reader
+	if req.Body != nil {
+		payload = bytes.NewReader(req.Body)
+	}
+	resp, body, err := c.send(ctx, req.Method, req.URL, payload)
+	if resp != nil {
+		result.StatusCode = resp.StatusCode
+		result.Status = resp.Status
+		result.TransactionID = TransactionID(resp.Header)
+		result.Body = body
+		result.ActivityID = activityID(body)
+	}
+	if err != nil {
+		return result, fmt.Errorf("submitting %s for workspace %s: %w", action, workspaceID, err)
+	}
+	return result, nil
+}
+
+// ActionRequest is the Schematics request that submits a workspace action, without its authorization headers.
+type ActionRequest struct {
+	Method string
+	URL    string
+	// the JSON body; nil when the action takes none
+	Body []byte
+}
+
+// Returns the request RunActionWithOptions sends for the action, e.g. to show it before asking to go ahead.
+// With a Backend set, the backend makes the same call its own way.
+func (c *Client) ActionRequest(action string, workspaceID string, opts ActionOptions) (ActionRequest, error) {
+	method, ok := actionMethods[action]
+	if !ok {
+		return ActionRequest{}, fmt.Errorf("unsupported workspace action %q", action)
+	}
+	req := ActionRequest{Method: method, URL: c.SchematicsEndpoint + "/v1/workspaces/" + workspaceID + "/" + action}
+	if len(opts.Targets) > 0 {
+		data, err := json.Marshal(map[string]interface{}{"action_options": map[string][]string{"target": opts.Targets}})
+		if err != nil {
+			return ActionRequest{}, err
+		}
+		req.Body = data
+	}
+	return req, nil
+}
+
+// Pulls the activity id out of a Schematics action response body, e.g. {"activityid": "..."}.
+func activityID(body []byte) string {
+	var activity struct {
+		ActivityID string `json:"activityid"`
+	}
+	json.Unmarshal(body, &activity)
+	return activity.ActivityID
+}
+
+// Workspace holds the fields we use from a Schematics workspace.
+type Workspace struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	Status        string `json:"status"`
+	ResourceGroup string `json:"resource_group,omitempty"`
+	Location      string `json:"location,omitempty"`
+	// user tags such as env:ephemeral
+	Tags []string `json:"tags,omitempty"`
+	// when the workspace last changed, e.g. through a job, as an RFC 3339 time
+	UpdatedAt string `json:"updated_at,omitempty"`
+	UpdatedBy string `json:"updated_by,omitempty"`
+	// the Terraform templates, normally exactly one
+	Templates []WorkspaceTemplate `json:"template_data,omitempty"`
+	Repo      *WorkspaceRepo      `json:"template_repo,omitempty"`
+	State     WorkspaceState      `json:"workspace_status"`
+}
+
+// WorkspaceRepo is the git repository a workspace's template is pulled from.
+type WorkspaceRepo struct {
+	URL    string `json:"url,omitempty"`
+	Branch string `json:"branch,omitempty"`
+	// the commit Schematics last pulled
+	CommitSHA string `json:"repo_sha_value,omitempty"`
+}
+
+// WorkspaceState holds whether a workspace is frozen. Schematics refuses to run jobs on a frozen workspace.
+type WorkspaceState struct {
+	Frozen   bool   `json:"frozen"`
+	FrozenBy string `json:"frozen_by,omitempty"`
+	FrozenAt string `json:"frozen_at,omitempty"`
+}
+
+// WorkspaceTemplate describes a Terraform template of a workspace.
+type WorkspaceTemplate struct {
+	ID     string `json:"id"`
+	Folder string `json:"folder,omitempty"`
+	// e.g. terraform_v1.5
+	Type string `json:"type,omitempty"`
+}
+
+// CreateWorkspaceOptions describes a workspace to create from a Terraform template in a git repository.
+type CreateWorkspaceOptions struct {
+	Name        string
+	Description string
+	// resource group id; the account's default group when empty
+	ResourceGroup string
+	// region the workspace's jobs run in, e.g. us-south; Schematics picks one for the endpoint when empty
+	Location string
+	Tags     []string
+
+	// git URL of the template, optionally pointing at a branch or folder, e.g. https://github.com/org/repo/tree/main/terraform
+	TemplateRepo string
+	Branch       string
+	// folder inside the repository holding the template, "." by default
+	Folder string
+	// Terraform version such as 1.5; becomes the workspace type terraform_v1.5
+	TerraformVersion string
+	// initial contents of the template's variable store
+	Variables []Variable
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl -X POST https://schematics.cloud.ibm.com/v1/workspaces -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>" -d '{"name": ..., "type": ["terraform_v1.5"], "template_repo": {"url": ...}, "template_data": [...]}'
+// Creates a workspace and returns it, including the id Schematics assigned.
+func (c *Client) CreateWorkspace(ctx context.Context, opts CreateWorkspaceOptions) (Workspace, error) {
+	var ws Workspace
+	if opts.Name == "" || opts.TemplateRepo == "" {
+		return ws, fmt.Errorf("creating workspace: a name and a template repository are required")
+	}
+	folder := opts.Folder
+	if folder == "" {
+		folder = "."
+	}
+	templateType := ""
+	if opts.TerraformVersion != "" {
+		templateType = terraformTemplateType(opts.TerraformVersion)
+	}
+	type templateData struct {
+		Folder    string     `json:"folder"`
+		Type      string     `json:"type,omitempty"`
+		Variables []Variable `json:"variablestore,omitempty"`
+	}
+	type templateRepo struct {
+		URL    string `json:"url"`
+		Branch string `json:"branch,omitempty"`
+	}
+	payload := struct {
+		Name          string         `json:"name"`
+		Description   string         `json:"description,omitempty"`
+		ResourceGroup string         `json:"resource_group,omitempty"`
+		Location      string         `json:"location,omitempty"`
+		Tags          []string       `json:"tags,omitempty"`
+		Type          []string       `json:"type,omitempty"`
+		TemplateRepo  templateRepo   `json:"template_repo"`
+		TemplateData  []templateData `json:"template_data"`
+	}{
+		Name:          opts.Name,
+		Description:   opts.Description,
+		ResourceGroup: opts.ResourceGroup,
+		Location:      opts.Location,
+		Tags:          opts.Tags,
+		TemplateRepo:  templateRepo{URL: opts.TemplateRepo, Branch: opts.Branch},
+		TemplateData:  []templateData{{Folder: folder, Type: templateType, Variables: opts.Variables}},
+	}
+	if templateType != "" {
+		payload.Type = []string{templateType}
+	}
+	if err := c.sendJSON(ctx, "POST", c.SchematicsEndpoint+"/v1/workspaces", payload, &ws); err != nil {
+		return ws, fmt.Errorf("creating workspace: %w", err)
+	}
+	return ws, nil
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl -X DELETE "https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}?destroy_resources=true" -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+// Deletes the workspace. With destroyResources Schematics first destroys every resource the workspace manages.
+func (c *Client) DeleteWorkspace(ctx context.Context, workspaceID string, destroyResources bool) error {
+	endpoint := c.SchematicsEndpoint + "/v1/workspaces/" + workspaceID
+	if destroyResources {
+		endpoint += "?destroy_resources=true"
+	}
+	if _, _, err := c.send(ctx, "DELETE", endpoint, nil); err != nil {
+		return fmt.Errorf("deleting workspace %s: %w", workspaceID, err)
+	}
+	return nil
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl -X DELETE "https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}/actions/{activity-id}?signal=terminate" -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+// Stops a running activity. Without force Terraform is interrupted and finishes the resource it is working on;
+// with force the job is terminated at once, which can leave the state out of step with the resources.
+func (c *Client) CancelActivity(ctx context.Context, workspaceID string, activityID string, force bool) error {
+	endpoint := c.SchematicsEndpoint + "/v1/workspaces/" + workspaceID + "/actions/" + activityID
+	if force {
+		endpoint += "?signal=terminate"
+	}
+	if _, _, err := c.send(ctx, "DELETE", endpoint, nil); err != nil {
+		return fmt.Errorf("cancelling activity %s of workspace %s: %w", activityID, workspaceID, err)
+	}
+	return nil
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl -X PATCH https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id} -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>" -d '{"workspace_status": {"frozen": true}}'
+// Freezes or unfreezes the workspace.
+func (c *Client) SetFrozen(ctx context.Context, workspaceID string, frozen bool) error {
+	payload := map[string]interface{}{"workspace_status": map[string]bool{"frozen": frozen}}
+	if err := c.sendJSON(ctx, "PATCH", c.SchematicsEndpoint+"/v1/workspaces/"+workspaceID, payload, nil); err != nil {
+		if frozen {
+			return fmt.Errorf("freezing workspace %s: %w", workspaceID, err)
+		}
+		return fmt.Errorf("unfreezing workspace %s: %w", workspaceID, err)
+	}
+	return nil
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl -X PATCH https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id} -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>" -d '{"tags": ["env:test", ...]}'
+// Replaces the workspace's user tags with tags.
+func (c *Client) SetWorkspaceTags(ctx context.Context, workspaceID string, tags []string) error {
+	payload := map[string][]string{"tags": tags}
+	if tags == nil {
+		payload["tags"] = []string{}
+	}
+	if err := c.sendJSON(ctx, "PATCH", c.SchematicsEndpoint+"/v1/workspaces/"+workspaceID, payload, nil); err != nil {
+		return fmt.Errorf("tagging workspace %s: %w", workspaceID, err)
+	}
+	return nil
+}
+
+// The workspace type for a Terraform version such as 1.6 or v1.6.
+func terraformTemplateType(version string) string {
+	return "terraform_v" + strings.TrimPrefix(version, "v")
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl -X PATCH https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id} -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>" -d '{"type": ["terraform_v1.6"], "template_data": [{"id": ..., "folder": ..., "type": "terraform_v1.6"}]}'
+// Switches the workspace and each of its templates to the Terraform version, such as 1.6. The next job runs with it;
+// Schematics only allows moving to a newer version.
+func (c *Client) SetTerraformVersion(ctx context.Context, workspaceID string, version string) error {
+	ws, err := c.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	templateType := terraformTemplateType(version)
+	templates := make([]WorkspaceTemplate, len(ws.Templates))
+	for i, t := range ws.Templates {
+		templates[i] = WorkspaceTemplate{ID: t.ID, Folder: t.Folder, Type: templateType}
+	}
+	payload := struct {
+		Type         []string            `json:"type"`
+		TemplateData []WorkspaceTemplate `json:"template_data,omitempty"`
+	}{Type: []string{templateType}, TemplateData: templates}
+	if err := c.sendJSON(ctx, "PATCH", c.SchematicsEndpoint+"/v1/workspaces/"+workspaceID, payload, nil); err != nil {
+		return fmt.Errorf("setting Terraform version of workspace %s: %w", workspaceID, err)
+	}
+	return nil
+}
+
+// page size used when listing workspaces
+const workspacePageSize = 100
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl "https://schematics.cloud.ibm.com/v1/workspaces?offset=0&limit=100" -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+// Returns every workspace the caller can see in the endpoint's region, following the pagination.
+func (c *Client) ListWorkspaces(ctx context.Context) ([]Workspace, error) {
+	if c.Backend != nil {
+		workspaces, err := c.Backend.ListWorkspaces(ctx)
+		if err != nil {
+			return workspaces, fmt.Errorf("listing workspaces: %w", err)
+		}
+		return workspaces, nil
+	}
+	var workspaces []Workspace
+	for offset := 0; ; {
+		var page struct {
+			Count      int         `json:"count"`
+			Workspaces []Workspace `json:"workspaces"`
+		}
+		endpoint := fmt.Sprintf("%s/v1/workspaces?offset=%d&limit=%d", c.SchematicsEndpoint, offset, workspacePageSize)
+		if err := c.getJSON(ctx, endpoint, &page); err != nil {
+			return workspaces, fmt.Errorf("listing workspaces: %w", err)
+		}
+		workspaces = append(workspaces, page.Workspaces...)
+		offset += len(page.Workspaces)
+		if len(page.Workspaces) == 0 || offset >= page.Count {
+			return workspaces, nil
+		}
+	}
+}
+
+// errors from FindWorkspace when the name doesn't pick out exactly one workspace
+var (
+	ErrWorkspaceNotFound  = errors.New("no workspace with that name")
+	ErrAmbiguousWorkspace = errors.New("several workspaces have that name")
+)
+
+// AmbiguousWorkspaceError is what FindWorkspace returns when several workspaces have the name, e.g. for a caller
+// to let the user pick one of Matches. It wraps ErrAmbiguousWorkspace.
+type AmbiguousWorkspaceError struct {
+	Name    string
+	Matches []Workspace
+}
+
+func (e *AmbiguousWorkspaceError) Error() string {
+	ids := make([]string, len(e.Matches))
+	for i, ws := range e.Matches {
+		ids[i] = ws.ID
+	}
+	return fmt.Sprintf("workspace %q: %s (%s); use --workspace-id", e.Name, ErrAmbiguousWorkspace, strings.Join(ids, ", "))
+}
+
+func (e *AmbiguousWorkspaceError) Unwrap() error {
+	return ErrAmbiguousWorkspace
+}
+
+// Returns the workspace with exactly this name among those ListWorkspaces returns, looking only in resourceGroup
+// unless it is empty. Errors wrap ErrWorkspaceNotFound when there is none and are an *AmbiguousWorkspaceError,
+// listing their ids, when there are several.
+func (c *Client) FindWorkspace(ctx context.Context, name string, resourceGroup string) (Workspace, error) {
+	workspaces, err := c.ListWorkspaces(ctx)
+	if err != nil {
+		return Workspace{}, err
+	}
+	var matches []Workspace
+	for _, ws := range workspaces {
+		if ws.Name == name && ws.InResourceGroup(resourceGroup) {
+			matches = append(matches, ws)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		if resourceGroup != "" {
+			return Workspace{}, fmt.Errorf("workspace %q: %w in resource group %s in %s", name, ErrWorkspaceNotFound, resourceGroup, c.SchematicsEndpoint)
+		}
+		return Workspace{}, fmt.Errorf("workspace %q: %w in %s", name, ErrWorkspaceNotFound, c.SchematicsEndpoint)
+	case 1:
+		return matches[0], nil
+	}
+	return Workspace{}, &AmbiguousWorkspaceError{Name: name, Matches: matches}
+}
+
+// Returns the workspaces among those ListWorkspaces returns that carry every one of tags, looking only in
+// resourceGroup unless it is empty. Tags compare without regard to case, as IBM Cloud tagging treats them.
+func (c *Client) FindWorkspacesByTag(ctx context.Context, resourceGroup string, tags ...string) ([]Workspace, error) {
+	workspaces, err := c.ListWorkspaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var matches []Workspace
+	for _, ws := range workspaces {
+		all := ws.InResourceGroup(resourceGroup)
+		for _, tag := range tags {
+			all = all && ws.HasTag(tag)
+		}
+		if all {
+			matches = append(matches, ws)
+		}
+	}
+	return matches, nil
+}
+
+// Reports whether the workspace belongs to resourceGroup, given as the id Schematics reports in resource_group.
+// Every workspace belongs to the empty group.
+func (ws Workspace) InResourceGroup(resourceGroup string) bool {
+	return resourceGroup == "" || strings.EqualFold(ws.ResourceGroup, resourceGroup)
+}
+
+// The Terraform version of the workspace's first template, such as 1.5, or "" when Schematics didn't report one.
+func (ws Workspace) TerraformVersion() string {
+	if len(ws.Templates) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(ws.Templates[0].Type, "terraform_v")
+}
+
+// Reports whether the workspace carries tag.
+func (ws Workspace) HasTag(tag string) bool {
+	for _, t := range ws.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id} -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+func (c *Client) GetWorkspace(ctx context.Context, workspaceID string) (Workspace, error) {
+	var ws Workspace
+	var err error
+	if c.Backend != nil {
+		ws, err = c.Backend.GetWorkspace(ctx, workspaceID)
+	} else {
+		err = c.getJSON(ctx, c.SchematicsEndpoint+"/v1/workspaces/"+workspaceID, &ws)
+	}
+	if err != nil {
+		return ws, fmt.Errorf("reading workspace: %w", err)
+	}
+	return ws, nil
+}
+
+// Activity is one entry of a workspace's activity history.
+type Activity struct {
+	ActionID    string `json:"action_id"`
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+	PerformedBy string `json:"performed_by"`
+	PerformedAt string `json:"performed_at"`
+	// one entry per template the activity ran against
+	Templates []ActivityTemplate `json:"templates,omitempty"`
+}
+
+// Schematics sends an activity's message as a list of lines, which are joined with "; "; a single string, as the
+// tool's own JSON output has it, is taken as it is.
+func (a *Activity) UnmarshalJSON(data []byte) error {
+	type plain Activity
+	var wire struct {
+		plain
+		Message json.RawMessage `json:"message"`
+	}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	*a = Activity(wire.plain)
+	a.Message = ""
+	if len(wire.Message) == 0 || string(wire.Message) == "null" {
+		return nil
+	}
+	var lines []string
+	if err := json.Unmarshal(wire.Message, &lines); err == nil {
+		a.Message = strings.Join(lines, "; ")
+		return nil
+	}
+	return json.Unmarshal(wire.Message, &a.Message)
+}
+
+// ActivityTemplate is an activity's run against one of the workspace's templates.
+type ActivityTemplate struct {
+	TemplateID string `json:"template_id"`
+	Status     string `json:"status"`
+	StartTime  string `json:"start_time"`
+	EndTime    string `json:"end_time"`
+}
+
+// Returns when the activity started running: its earliest template start, or when it was submitted.
+func (a Activity) StartTime() string {
+	start := ""
+	for _, t := range a.Templates {
+		if t.StartTime != "" && (start == "" || t.StartTime < start) {
+			start = t.StartTime
+		}
+	}
+	if start == "" {
+		return a.PerformedAt
+	}
+	return start
+}
+
+// Returns when the activity finished, the latest template end, or "" while it is still running.
+func (a Activity) EndTime() string {
+	end := ""
+	for _, t := range a.Templates {
+		if t.EndTime > end {
+			end = t.EndTime
+		}
+	}
+	return end
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}/actions -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+// Returns the workspace's activity history, most recent first.
+func (c *Client) ListActivities(ctx context.Context, workspaceID string) ([]Activity, error) {
+	var list struct {
+		Actions []Activity `json:"actions"`
+	}
+	var err error
+	if c.Backend != nil {
+		list.Actions, err = c.Backend.ListActivities(ctx, workspaceID)
+	} else {
+		err = c.getJSON(ctx, c.SchematicsEndpoint+"/v1/workspaces/"+workspaceID+"/actions", &list)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing workspace activities: %w", err)
+	}
+	return list.Actions, nil
+}
+
+// Returns the first activity that has not reached a terminal state, or nil when the workspace is idle.
+func ActiveActivity(activities []Activity) *Activity {
+	for i, activity := range activities {
+		switch activity.Status {
+		case "CREATED", "PENDING", "INPROGRESS":
+			return &activities[i]
+		}
+	}
+	return nil
+}
+
+// Returns the most recent failed activity, or nil when there is none.
+func LastFailedActivity(activities []Activity) *Activity {
+	for i, activity := range activities {
+		if activity.Status == "FAILED" {
+			return &activities[i]
+		}
+	}
+	return nil
+}
+
+// Returns the most recent successfully completed activity of the given kind (e.g. "APPLY") and when it was performed,
+// or nil when there is none.
+func LastSuccessfulActivity(activities []Activity, name string) (*Activity, time.Time) {
+	var latest *Activity
+	var latestAt time.Time
+	for i, activity := range activities {
+		if !strings.EqualFold(activity.Name, name) || activity.Status != "COMPLETED" {
+			continue
+		}
+		performedAt, err := time.Parse(time.RFC3339, activity.PerformedAt)
+		if err != nil {
+			continue
+		}
+		if latest == nil || performedAt.After(latestAt) {
+			latest, latestAt = &activities[i], performedAt
+		}
+	}
+	return latest, latestAt
+}
+
+// The call to IBM Cloud Schematics that this method translates to golang:
+// curl https://schematics.cloud.ibm.com/v1/workspaces/{workspace-id}/actions/{activity-id} -H "Authorization: Bearer <iam_token>" -H "refresh_token: <refresh_token>"
+func (c *Client) GetActivity(ctx context.Context, workspaceID string, activityID string) (Activity, error) {
+	var activity Activity
+	var err error
+	if c.Backend != nil {
+		activity, err = c.Backend.GetActivity(ctx, workspaceID, activityID)
+	} else {
+		err = c.getJSON(ctx, c.SchematicsEndpoint+"/v1/workspaces/"+workspaceID+"/actions/"+activityID, &activity)
+	}
+	if err != nil {
+		return activity, fmt.Errorf("reading activity %s: %w", activityID, err)
+	}
+	return activity, nil
+}
+
+// Reports whether an activity status is final.
+func IsTerminalStatus(status string) bool {
+	switch status {
+	case "COMPLETED", "FAILED", "STOPPED", "ERROR":
+		return true
+	}
+	return false
+}
+
+// WaitOptions controls WaitForActivity.
+type WaitOptions struct {
+	// time between status checks; 10s when zero
+	Interval time.Duration
+	// give up once the wait has taken this long, with an error wrapping context.DeadlineExceeded; 0 waits as long
+	// as ctx allows
+	Timeout time.Duration
+	// the longest a single status check may take, cut short to what is left of Timeout; 0 leaves it to ctx
+	PollTimeout time.Duration
+	// called after every status check, if set
+	OnPoll func(Activity)
+	// measures Interval and Timeout; the wall clock when nil
+	Clock Clock
+}
+
+// Polls the activity until it reaches a terminal status, opts.Timeout passes or ctx ends, and returns its final
+// state, or the last one seen with the error. A FAILED or STOPPED activity is not an error; check Status on the result.
+// Each status check runs under the earliest of ctx's deadline, opts.PollTimeout and the end of opts.Timeout, so no
+// slow check outlasts the wait.
+func (c *Client) WaitForActivity(ctx context.Context, workspaceID string, activityID string, opts WaitOptions) (Activity, error) {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	clock := opts.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	var deadline time.Time
+	if opts.Timeout > 0 {
+		deadline = clock.Now().Add(opts.Timeout)
+	}
+	var activity Activity
+	for {
+		pollTimeout, cutByDeadline := opts.PollTimeout, false
+		if !deadline.IsZero() {
+			left := deadline.Sub(clock.Now())
+			if left <= 0 {
+				return activity, fmt.Errorf("waiting for activity %s: %w", activityID, context.DeadlineExceeded)
+			}
+			if pollTimeout <= 0 || left < pollTimeout {
+				pollTimeout, cutByDeadline = left, true
+			}
+		}
+		polled, timedOut, err := c.pollActivity(ctx, workspaceID, activityID, pollTimeout)
+		switch {
+		case timedOut && cutByDeadline:
+			return activity, fmt.Errorf("waiting for activity %s: %w", activityID, context.DeadlineExceeded)
+		case timedOut:
+			return activity, fmt.Errorf("checking activity %s: no answer within %s", activityID, pollTimeout)
+		case err != nil:
+			return activity, err
+		}
+		activity = polled
+		if opts.OnPoll != nil {
+			opts.OnPoll(activity)
+		}
+		if IsTerminalStatus(activity.Status) {
+			return activity, nil
+		}
+		wait := interval
+		if left := deadline.Sub(clock.Now()); !deadline.IsZero() && left < wait {
+			wait = left
+		}
+		if err := clock.Sleep(ctx, wait); err != nil {
+			return activity, fmt.Errorf("waiting for activity %s: %w", activityID, err)
+		}
+	}
+}
+
+// Checks the activity's status once, giving up after timeout unless it is 0. timedOut says the check ran out of
+// that time, as opposed to ctx ending or the check failing.
+func (c *Client) pollActivity(ctx context.Context, workspaceID string, activityID string, timeout time.Duration) (activity Activity, timedOut bool, err error) {
+	if timeout <= 0 {
+		activity, err = c.GetActivity(ctx, workspaceID, activityID)
+		return activity, false, err
+	}
+	pollCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	activity, err = c.GetActivity(pollCtx, workspaceID, activityID)
+	return activity, err != nil && ctx.Err() == nil && pollCtx.Err() != nil, err
+}
@@ -0,0 +1,428 @@
+package schematics_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+	"schematics-apply-destroy/pkg/schematics/schematicstest"
+)
+
+func TestActivityMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{"lines", `{"action_id":"a","message":["plan failed","see the log"]}`, "plan failed; see the log"},
+		{"string", `{"action_id":"a","message":"plan failed"}`, "plan failed"},
+		{"empty list", `{"action_id":"a","message":[]}`, ""},
+		{"null", `{"action_id":"a","message":null}`, ""},
+		{"missing", `{"action_id":"a"}`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var activity schematics.Activity
+			if err := json.Unmarshal([]byte(test.json), &activity); err != nil {
+				t.Fatal(err)
+			}
+			if activity.ActionID != "a" || activity.Message != test.want {
+				t.Errorf("got %+v, want message %q", activity, test.want)
+			}
+		})
+	}
+	var activity schematics.Activity
+	if err := json.Unmarshal([]byte(`{"message":42}`), &activity); err == nil {
+		t.Error("a number as message decoded without an error")
+	}
+}
+
+// A fake server holding one workspace and a client logged in to it.
+func fakeWorkspace(t *testing.T) (*schematicstest.Server, *schematics.Client, schematics.Workspace) {
+	srv := schematicstest.NewServer()
+	t.Cleanup(srv.Close)
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+	client := fakeClient(srv)
+	if err := client.Authenticate(context.Background(), schematicstest.APIKey); err != nil {
+		t.Fatal(err)
+	}
+	return srv, client, ws
+}
+
+func TestApplyAndWait(t *testing.T) {
+	tests := []struct {
+		status          string
+		workspaceStatus string
+	}{
+		{"COMPLETED", "ACTIVE"},
+		{"FAILED", "FAILED"},
+	}
+	for _, test := range tests {
+		t.Run(test.status, func(t *testing.T) {
+			srv, client, ws := fakeWorkspace(t)
+			srv.SetJobOptions(schematicstest.JobOptions{Status: test.status, Polls: 2})
+			ctx := context.Background()
+
+			result, err := client.Apply(ctx, ws.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.StatusCode != http.StatusAccepted || result.ActivityID == "" || result.TransactionID == "" {
+				t.Fatalf("Apply = %+v, want a 202 with an activity and a transaction id", result)
+			}
+			var polled []string
+			activity, err := client.WaitForActivity(ctx, ws.ID, result.ActivityID, schematics.WaitOptions{
+				Interval: time.Millisecond,
+				OnPoll:   func(a schematics.Activity) { polled = append(polled, a.Status) },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if activity.Status != test.status {
+				t.Errorf("activity status = %q, want %q", activity.Status, test.status)
+			}
+			if want := []string{"INPROGRESS", "INPROGRESS", test.status}; !reflect.DeepEqual(polled, want) {
+				t.Errorf("polled %q, want %q", polled, want)
+			}
+			if got, _ := srv.Workspace(ws.ID); got.Status != test.workspaceStatus {
+				t.Errorf("workspace status = %q, want %q", got.Status, test.workspaceStatus)
+			}
+		})
+	}
+}
+
+func TestWaitForActivityInterval(t *testing.T) {
+	srv, client, ws := fakeWorkspace(t)
+	srv.SetJobOptions(schematicstest.JobOptions{Polls: 3})
+	ctx := context.Background()
+	result, err := client.Apply(ctx, ws.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := schematicstest.NewClock(time.Now())
+	activity, err := client.WaitForActivity(ctx, ws.ID, result.ActivityID, schematics.WaitOptions{Interval: 7 * time.Second, Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if activity.Status != "COMPLETED" {
+		t.Errorf("status = %q, want COMPLETED", activity.Status)
+	}
+	if want := []time.Duration{7 * time.Second, 7 * time.Second, 7 * time.Second}; !reflect.DeepEqual(clock.Sleeps(), want) {
+		t.Errorf("slept %v, want %v", clock.Sleeps(), want)
+	}
+}
+
+func TestWaitForActivityTerminalStatuses(t *testing.T) {
+	for _, status := range []string{"COMPLETED", "FAILED", "STOPPED", "ERROR"} {
+		t.Run(status, func(t *testing.T) {
+			srv, client, ws := fakeWorkspace(t)
+			srv.SetJobOptions(schematicstest.JobOptions{Status: status})
+			ctx := context.Background()
+			result, err := client.Apply(ctx, ws.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			clock := schematicstest.NewClock(time.Now())
+			activity, err := client.WaitForActivity(ctx, ws.ID, result.ActivityID, schematics.WaitOptions{Clock: clock, Timeout: time.Minute})
+			if err != nil {
+				t.Fatalf("WaitForActivity error = %v, want a %s activity and no error", err, status)
+			}
+			if activity.Status != status || len(clock.Sleeps()) != 0 {
+				t.Errorf("status %q after sleeping %v, want %q at the first check", activity.Status, clock.Sleeps(), status)
+			}
+		})
+	}
+}
+
+func TestWaitForActivityTimeout(t *testing.T) {
+	srv, client, ws := fakeWorkspace(t)
+	srv.SetJobOptions(schematicstest.JobOptions{Polls: 100})
+	ctx := context.Background()
+	result, err := client.Apply(ctx, ws.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := schematicstest.NewClock(time.Now())
+	activity, err := client.WaitForActivity(ctx, ws.ID, result.ActivityID, schematics.WaitOptions{Interval: 10 * time.Second, Timeout: 25 * time.Second, Clock: clock})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForActivity error = %v, want context.DeadlineExceeded", err)
+	}
+	if activity.Status != "INPROGRESS" {
+		t.Errorf("status = %q, want the last one seen, INPROGRESS", activity.Status)
+	}
+	// the last interval is cut short to what is left of the timeout
+	if want := []time.Duration{10 * time.Second, 10 * time.Second, 5 * time.Second}; !reflect.DeepEqual(clock.Sleeps(), want) {
+		t.Errorf("slept %v, want %v", clock.Sleeps(), want)
+	}
+	if n := countRequests(srv, "/v1/workspaces/"+ws.ID+"/actions/"+result.ActivityID); n != 3 {
+		t.Errorf("checked the status %d times, want 3", n)
+	}
+}
+
+// A Backend whose status checks run poll, after the stub's own bookkeeping.
+type pollBackend struct {
+	stubBackend
+	poll func(ctx context.Context) (schematics.Activity, error)
+}
+
+func (b *pollBackend) GetActivity(ctx context.Context, workspaceID string, activityID string) (schematics.Activity, error) {
+	b.stubBackend.GetActivity(ctx, workspaceID, activityID)
+	return b.poll(ctx)
+}
+
+func TestWaitForActivityPollDeadline(t *testing.T) {
+	clock := schematicstest.NewClock(time.Now())
+	var left []time.Duration
+	backend := &pollBackend{poll: func(ctx context.Context) (schematics.Activity, error) {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Fatal("status check without a deadline")
+		}
+		left = append(left, time.Until(deadline))
+		// every check takes 20s
+		clock.Advance(20 * time.Second)
+		return schematics.Activity{ActionID: "act-1", Status: "INPROGRESS"}, nil
+	}}
+	client := backendClient(t, backend)
+
+	_, err := client.WaitForActivity(context.Background(), "ws-1", "act-1", schematics.WaitOptions{
+		Interval: time.Second, Timeout: 30 * time.Second, PollTimeout: 15 * time.Second, Clock: clock})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForActivity error = %v, want context.DeadlineExceeded", err)
+	}
+	// PollTimeout bounds the first check; the 9s left of the timeout after it and a 1s interval bound the second
+	want := []time.Duration{15 * time.Second, 9 * time.Second}
+	if len(left) != len(want) {
+		t.Fatalf("checks had %v left, want %v", left, want)
+	}
+	for i := range want {
+		if left[i] > want[i] || left[i] < want[i]-time.Second {
+			t.Errorf("check %d had %v left, want %v", i+1, left[i], want[i])
+		}
+	}
+}
+
+func TestWaitForActivitySlowPoll(t *testing.T) {
+	backend := &pollBackend{poll: func(ctx context.Context) (schematics.Activity, error) {
+		<-ctx.Done()
+		return schematics.Activity{}, ctx.Err()
+	}}
+	client := backendClient(t, backend)
+	ctx := context.Background()
+
+	// a check outlasting PollTimeout fails the wait, but not as its timeout
+	_, err := client.WaitForActivity(ctx, "ws-1", "act-1", schematics.WaitOptions{PollTimeout: 10 * time.Millisecond})
+	if err == nil || errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "no answer within 10ms") {
+		t.Errorf("WaitForActivity error = %v, want no answer within 10ms", err)
+	}
+	// one cut short by the end of Timeout is the wait timing out
+	_, err = client.WaitForActivity(ctx, "ws-1", "act-1", schematics.WaitOptions{Timeout: 10 * time.Millisecond, PollTimeout: time.Minute})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitForActivity error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestFindWorkspaceAmbiguous(t *testing.T) {
+	srv, client, ws := fakeWorkspace(t)
+	other := srv.AddWorkspace(schematics.Workspace{Name: ws.Name})
+	srv.AddWorkspace(schematics.Workspace{Name: "unrelated"})
+
+	_, err := client.FindWorkspace(context.Background(), ws.Name, "")
+	var ambiguous *schematics.AmbiguousWorkspaceError
+	if !errors.As(err, &ambiguous) || !errors.Is(err, schematics.ErrAmbiguousWorkspace) {
+		t.Fatalf("FindWorkspace error = %v, want an *AmbiguousWorkspaceError", err)
+	}
+	if len(ambiguous.Matches) != 2 || ambiguous.Matches[0].ID != ws.ID || ambiguous.Matches[1].ID != other.ID {
+		t.Errorf("matches = %+v, want %s and %s", ambiguous.Matches, ws.ID, other.ID)
+	}
+	if want := fmt.Sprintf("(%s, %s); use --workspace-id", ws.ID, other.ID); !strings.Contains(err.Error(), want) {
+		t.Errorf("error = %q, want it to list %q", err, want)
+	}
+}
+
+func TestApplyWhileJobRuns(t *testing.T) {
+	srv, client, ws := fakeWorkspace(t)
+	srv.SetJobOptions(schematicstest.JobOptions{Polls: 10})
+	ctx := context.Background()
+
+	if _, err := client.Apply(ctx, ws.ID); err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.Destroy(ctx, ws.ID)
+	var apiErr *schematics.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Fatalf("Destroy error = %v, want a 409 *APIError", err)
+	}
+	if result.StatusCode != http.StatusConflict {
+		t.Errorf("result status = %d, want 409", result.StatusCode)
+	}
+}
+
+func TestListWorkspacesPages(t *testing.T) {
+	srv, client, _ := fakeWorkspace(t)
+	for i := 1; i < 250; i++ {
+		srv.AddWorkspace(schematics.Workspace{Name: fmt.Sprintf("ws-%d", i)})
+	}
+
+	list, err := client.ListWorkspaces(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 250 {
+		t.Fatalf("listed %d workspaces, want 250", len(list))
+	}
+	seen := map[string]bool{}
+	for _, ws := range list {
+		if seen[ws.ID] {
+			t.Errorf("workspace %s listed twice", ws.ID)
+		}
+		seen[ws.ID] = true
+	}
+	var pages []string
+	for _, r := range srv.Requests() {
+		if strings.HasPrefix(r.Path, "/v1/workspaces?") {
+			pages = append(pages, r.Path)
+		}
+	}
+	want := []string{"/v1/workspaces?offset=0&limit=100", "/v1/workspaces?offset=100&limit=100", "/v1/workspaces?offset=200&limit=100"}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("pages = %q, want %q", pages, want)
+	}
+}
+
+func TestSetVariables(t *testing.T) {
+	srv, client, ws := fakeWorkspace(t)
+	srv.SetVariables(ws.ID, []schematics.Variable{
+		{Name: "region", Value: "us-south", Description: "where to deploy"},
+		{Name: "size", Value: "2", Type: "number"},
+	})
+	ctx := context.Background()
+
+	err := client.SetVariables(ctx, ws.ID, []schematics.Variable{{Name: "size", Value: "3"}, {Name: "api_key", Value: "s3cret", Secure: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []schematics.Variable{
+		{Name: "region", Value: "us-south", Description: "where to deploy"},
+		{Name: "size", Value: "3", Type: "number"},
+		{Name: "api_key", Value: "s3cret", Secure: true},
+	}
+	if got := srv.Variables(ws.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("variables = %+v, want %+v", got, want)
+	}
+	read, err := client.GetVariables(ctx, ws.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read[2].Value != "" {
+		t.Errorf("GetVariables returned the secure value %q", read[2].Value)
+	}
+
+	// api_key is secure now and comes back empty, so writing the store without it would clear it
+	if err := client.SetVariables(ctx, ws.ID, []schematics.Variable{{Name: "region", Value: "eu-de"}}); err == nil {
+		t.Fatal("SetVariables without the secure variable succeeded")
+	}
+	if got := srv.Variables(ws.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("variables after the refused update = %+v, want them unchanged", got)
+	}
+}
+
+func TestRetryOnTransientStatus(t *testing.T) {
+	srv, client, ws := fakeWorkspace(t)
+	srv.FailNext(http.StatusServiceUnavailable)
+	srv.FailNext(http.StatusTooManyRequests)
+
+	got, err := client.GetWorkspace(context.Background(), ws.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != ws.ID {
+		t.Errorf("workspace = %+v, want %s", got, ws.ID)
+	}
+	if n := countRequests(srv, "/v1/workspaces/"+ws.ID); n != 3 {
+		t.Errorf("sent %d requests, want 2 failures and a success", n)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	srv, client, ws := fakeWorkspace(t)
+	client.Retry.MaxAttempts = 3
+	for i := 0; i < 3; i++ {
+		srv.FailNext(http.StatusBadGateway)
+	}
+
+	_, err := client.GetWorkspace(context.Background(), ws.ID)
+	var apiErr *schematics.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("GetWorkspace error = %v, want a 502 *APIError", err)
+	}
+	if n := countRequests(srv, "/v1/workspaces/"+ws.ID); n != 3 {
+		t.Errorf("sent %d requests, want MaxAttempts 3", n)
+	}
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	srv, client, ws := fakeWorkspace(t)
+	srv.FailNext(http.StatusNotFound)
+
+	if _, err := client.GetWorkspace(context.Background(), ws.ID); err == nil {
+		t.Fatal("GetWorkspace succeeded after a 404")
+	}
+	if n := countRequests(srv, "/v1/workspaces/"+ws.ID); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
+
+func TestLastResponse(t *testing.T) {
+	srv, client, ws := fakeWorkspace(t)
+	ctx := context.Background()
+	if _, err := client.GetWorkspace(ctx, ws.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.LastResponse(); ok {
+		t.Fatal("LastResponse kept a response without KeepLastResponse")
+	}
+
+	client.KeepLastResponse = true
+	if _, err := client.GetWorkspace(ctx, "nope"); err == nil {
+		t.Fatal("GetWorkspace of an unknown workspace succeeded")
+	}
+	last, ok := client.LastResponse()
+	if !ok || last.StatusCode != http.StatusNotFound || last.Method != "GET" || !strings.HasSuffix(last.URL, "/v1/workspaces/nope") {
+		t.Fatalf("LastResponse = %+v, %v; want the 404 of the GET", last, ok)
+	}
+	if last.TransactionID == "" || last.Header.Get("Content-Type") == "" || len(last.Body) == 0 || last.Truncated {
+		t.Errorf("LastResponse = %+v, want the transaction id, headers and whole body", last)
+	}
+
+	state := strings.Repeat("x", schematics.MaxKeptResponseBody+10)
+	srv.SetState(ws.ID, []byte(state))
+	got, err := client.GetState(ctx, ws.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != state {
+		t.Errorf("GetState returned %d bytes, want %d", len(got), len(state))
+	}
+	if last, _ = client.LastResponse(); len(last.Body) != schematics.MaxKeptResponseBody || !last.Truncated {
+		t.Errorf("kept %d bytes of the state, truncated %v; want %d and true", len(last.Body), last.Truncated, schematics.MaxKeptResponseBody)
+	}
+}
+
+// How many of the requests srv received were for path.
+func countRequests(srv *schematicstest.Server, path string) int {
+	n := 0
+	for _, r := range srv.Requests() {
+		if r.Path == path {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// A plan recorded by `plan --save`, for `apply --require-plan` to check against.
+type savedPlan struct {
+	WorkspaceID string                  `json:"workspace_id"`
+	ActivityID  string                  `json:"activity_id"`
+	CreatedAt   time.Time               `json:"created_at"`
+	Plan        *schematics.PlanSummary `json:"plan"`
+	// sha256 of the plan summary
+	PlanHash string `json:"plan_hash"`
+	// sha256 of the template repository, templates and variables the plan ran against
+	Fingerprint string `json:"fingerprint"`
+}
+
+// the file written by `plan --save`
+type planMeta struct {
+	Plans []savedPlan `json:"plans"`
+}
+
+// What a plan depends on: if any of it changes, the plan no longer describes what an apply would do.
+// Secure variables are included by name and type only, since Schematics never returns their values.
+type workspaceInputs struct {
+	Repo      *schematics.WorkspaceRepo      `json:"repo"`
+	Templates []schematics.WorkspaceTemplate `json:"templates"`
+	Variables []schematics.Variable          `json:"variables"`
+}
+
+// Returns the fingerprint of the workspace's current template repository, templates and variables.
+func workspaceFingerprint(ctx context.Context, client *schematics.Client, schematicsWorkspaceID string) (string, error) {
+	ws, err := client.GetWorkspace(ctx, schematicsWorkspaceID)
+	if err != nil {
+		return "", err
+	}
+	vars, err := client.GetVariables(ctx, schematicsWorkspaceID)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	for i := range vars {
+		vars[i].Description = ""
+	}
+	return sha256JSON(workspaceInputs{Repo: ws.Repo, Templates: ws.Templates, Variables: vars})
+}
+
+func sha256JSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Writes every completed plan in results, with the fingerprint of its workspace, to path.
+func savePlanMeta(ctx context.Context, client *schematics.Client, path string, results []runResult) error {
+	var meta planMeta
+	for _, result := range results {
+		if result.Action != "plan" || result.failed() || result.Skipped || result.JobStatus != "COMPLETED" {
+			continue
+		}
+		fingerprint, err := workspaceFingerprint(ctx, client, result.WorkspaceID)
+		if err != nil {
+			return fmt.Errorf("saving plan: %w", err)
+		}
+		planHash, err := sha256JSON(result.Plan)
+		if err != nil {
+			return fmt.Errorf("saving plan: %w", err)
+		}
+		meta.Plans = append(meta.Plans, savedPlan{
+			WorkspaceID: result.WorkspaceID,
+			ActivityID:  result.ActivityID,
+			CreatedAt:   time.Now().UTC().Truncate(time.Second),
+			Plan:        result.Plan,
+			PlanHash:    planHash,
+			Fingerprint: fingerprint,
+		})
+	}
+	if len(meta.Plans) == 0 {
+		return fmt.Errorf("saving plan: no plan completed")
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("saving plan: %w", err)
+	}
+	logger.Info("saved plan", "path", path, "workspaces", len(meta.Plans))
+	return nil
+}
+
+// Reads the plans saved at path.
+func loadPlanMeta(path string) (planMeta, error) {
+	var meta planMeta
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return meta, fmt.Errorf("reading saved plan: %w", err)
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("parsing saved plan %s: %w", path, err)
+	}
+	return meta, nil
+}
+
+// Checks that meta holds a plan for each workspace and that none of them changed since it was saved.
+func verifyPlanMeta(ctx context.Context, client *schematics.Client, meta planMeta, path string, workspaceIDs []string) error {
+	for _, wsID := range workspaceIDs {
+		var saved *savedPlan
+		for i := range meta.Plans {
+			if meta.Plans[i].WorkspaceID == wsID {
+				saved = &meta.Plans[i]
+			}
+		}
+		if saved == nil {
+			return fmt.Errorf("%s has no plan for workspace %s; run `%s plan --save %s` first", path, wsID, programName(), path)
+		}
+		fingerprint, err := workspaceFingerprint(ctx, client, wsID)
+		if err != nil {
+			return err
+		}
+		if fingerprint != saved.Fingerprint {
+			return fmt.Errorf("workspace %s changed since plan %s was saved at %s (template repository or variables differ); plan again before applying",
+				wsID, saved.ActivityID, saved.CreatedAt.Format(time.RFC3339))
+		}
+		logger.Info("workspace matches the saved plan", "workspace", wsID, "activity", saved.ActivityID)
+	}
+	return nil
+}
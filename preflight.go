@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// interval between checks while waiting for an in-progress activity to finish
+var activityPollInterval = 10 * time.Second
+
+// Makes sure no other activity is running on the workspace before action is submitted.
+// When wait is true it polls until the workspace is idle or timeout passes; otherwise it returns an error straight away.
+func ensureWorkspaceIdle(ctx context.Context, client *schematics.Client, action string, schematicsWorkspaceID string, wait bool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		activities, err := client.ListActivities(ctx, schematicsWorkspaceID)
+		if err != nil {
+			return err
+		}
+		active := schematics.ActiveActivity(activities)
+		if active == nil {
+			return nil
+		}
+		if !wait {
+			return fmt.Errorf("workspace %s has %s activity %s in status %s; refusing to %s (use --wait-for-ready to wait for it)", schematicsWorkspaceID, active.Name, active.ActionID, active.Status, action)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("workspace %s still has %s activity %s in status %s after %s; refusing to %s", schematicsWorkspaceID, active.Name, active.ActionID, active.Status, timeout, action)
+		}
+		logger.Info(fmt.Sprintf("waiting for %s activity to finish before %s", active.Name, action), "activity", active.ActionID, "status", active.Status)
+		if err := sleep(ctx, activityPollInterval); err != nil {
+			return fmt.Errorf("waiting for workspace %s to be ready: %w", schematicsWorkspaceID, err)
+		}
+	}
+}
+
+// Fills in result after Schematics refused its action with 409 Conflict, which it does while another activity runs
+// on the workspace: the running activity is looked up and named instead of the bare error body being reported.
+func describeConflict(ctx context.Context, client *schematics.Client, result *runResult) {
+	activities, err := client.ListActivities(ctx, result.WorkspaceID)
+	if err != nil {
+		result.Error = fmt.Sprintf("Schematics refused %s with %s, probably because another activity is running on workspace %s", result.Action, result.Status, result.WorkspaceID)
+		logger.Error(result.Error, "error", formatError(err))
+		return
+	}
+	active := schematics.ActiveActivity(activities)
+	if active == nil {
+		result.Error = fmt.Sprintf("Schematics refused %s with %s, but no activity is running on workspace %s any more; try again", result.Action, result.Status, result.WorkspaceID)
+		logger.Error(result.Error)
+		return
+	}
+	result.RunningActivityID, result.RunningAction = active.ActionID, active.Name
+	result.Error = fmt.Sprintf("workspace %s already has %s activity %s in status %s", result.WorkspaceID, active.Name, active.ActionID, active.Status)
+	logger.Warn("Schematics refused "+result.Action+": "+result.Error, "activity", active.ActionID)
+}
+
+// Turns a result refused because the same action was already running into one for that running job, so waiting
+// on it stands in for the job that could not be submitted. Reports false when the running activity is another action.
+func attachToRunning(result *runResult) bool {
+	if result.RunningActivityID == "" || !strings.EqualFold(result.RunningAction, result.Action) {
+		return false
+	}
+	result.ActivityID = result.RunningActivityID
+	result.Attached = true
+	result.Error = ""
+	logger.Info("attaching to the running "+result.Action, "workspace", result.WorkspaceID, "activity", result.ActivityID)
+	return true
+}
+
+// Reports whether the workspace was successfully applied less than window ago, so a scheduled apply can be skipped.
+func recentlyApplied(ctx context.Context, client *schematics.Client, schematicsWorkspaceID string, window time.Duration) (bool, error) {
+	activities, err := client.ListActivities(ctx, schematicsWorkspaceID)
+	if err != nil {
+		return false, err
+	}
+	last, at := schematics.LastSuccessfulActivity(activities, "APPLY")
+	if last == nil {
+		return false, nil
+	}
+	age := time.Since(at)
+	if age >= window {
+		return false, nil
+	}
+	logger.Info(fmt.Sprintf("workspace %s was applied %s ago", schematicsWorkspaceID, age.Round(time.Second)), "activity", last.ActionID)
+	return true, nil
+}
+
+// Refuses to submit action to a frozen workspace, which Schematics would reject with a bare 4xx.
+func checkFrozenWorkspace(ws schematics.Workspace, action string) error {
+	if !ws.State.Frozen {
+		return nil
+	}
+	by := ""
+	if ws.State.FrozenBy != "" {
+		by = " by " + ws.State.FrozenBy
+	}
+	return fmt.Errorf("workspace %s is frozen%s; refusing to %s (run `%s workspace unfreeze %s` first)", ws.ID, by, action, programName(), ws.ID)
+}
+
+// Checks whether the workspace's last run failed before action is submitted.
+// Applying a FAILED workspace only warns, since re-applying is the usual fix; destroying one
+// requires fromFailed to be set. Either way the failed activity is named so the operator has context.
+func checkFailedWorkspace(ctx context.Context, client *schematics.Client, action string, ws schematics.Workspace, fromFailed bool) error {
+	schematicsWorkspaceID := ws.ID
+	if ws.Status != "FAILED" {
+		return nil
+	}
+
+	prior := "its last activity"
+	activities, err := client.ListActivities(ctx, schematicsWorkspaceID)
+	if err != nil {
+		return err
+	}
+	if failed := schematics.LastFailedActivity(activities); failed != nil {
+		prior = fmt.Sprintf("%s activity %s", failed.Name, failed.ActionID)
+	}
+
+	if action == "destroy" && !fromFailed {
+		return fmt.Errorf("workspace %s is FAILED after %s; destroying it may leave resources behind, rerun with --from-failed to proceed", schematicsWorkspaceID, prior)
+	}
+	logger.Warn(fmt.Sprintf("workspace %s is FAILED after %s; continuing with %s", schematicsWorkspaceID, prior, action))
+	return nil
+}
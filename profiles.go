@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// overrides the path of the runner config, ~/.schematics-runner.yaml by default
+	runnerConfigEnv = "SCHEMATICS_RUNNER_CONFIG"
+	// selects a profile when --profile is not given
+	profileEnv = "SCHEMATICS_PROFILE"
+)
+
+// settings a named profile in ~/.schematics-runner.yaml can supply; flags and environment variables take precedence
+type runnerProfile struct {
+	APIKey             string // the key itself; prefer api_key_env or auth_command
+	APIKeyEnv          string // name of the environment variable holding the key
+	AuthCommand        string
+	APIKeySecretCRN    string // Secrets Manager secret holding the key, read with the identity the other settings give
+	Region             string
+	WorkspaceID        string
+	CRN                string
+	IAMEndpoint        string
+	SchematicsEndpoint string
+	SlackWebhook       string // incoming webhook apply and destroy report to
+}
+
+// struct for holding ~/.schematics-runner.yaml
+type runnerConfig struct {
+	DefaultProfile string
+	Defaults       runnerProfile // inherited by every profile
+	Profiles       map[string]runnerProfile
+}
+
+// Path of the runner config, honouring SCHEMATICS_RUNNER_CONFIG.
+func runnerConfigPath() (string, error) {
+	if path := os.Getenv(runnerConfigEnv); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".schematics-runner.yaml"), nil
+}
+
+// Reads the runner config at path. ok is false when the file does not exist.
+func loadRunnerConfig(path string) (config runnerConfig, ok bool, err error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, false, nil
+	}
+	if err != nil {
+		return config, false, fmt.Errorf("reading config: %w", err)
+	}
+	if config, err = parseRunnerConfig(data); err != nil {
+		return config, false, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0o077 != 0 && config.hasInlineKey() {
+		logger.Warn(fmt.Sprintf("%s contains an api_key but is readable by other users; chmod 600 it", path))
+	}
+	return config, true, nil
+}
+
+// Builds the config from its YAML document. Unknown keys are errors so typos do not silently fall back to defaults.
+func parseRunnerConfig(data []byte) (runnerConfig, error) {
+	config := runnerConfig{Profiles: map[string]runnerProfile{}}
+	root, err := parseYAML(data)
+	if err != nil {
+		return config, err
+	}
+	for _, key := range root.Keys {
+		node := root.Map[key]
+		switch key {
+		case "default_profile":
+			config.DefaultProfile = node.Scalar
+		case "defaults":
+			if config.Defaults, err = parseRunnerProfile(node); err != nil {
+				return config, fmt.Errorf("defaults: %w", err)
+			}
+		case "profiles":
+			if node.Map == nil && (node.Scalar != "" || node.List != nil) {
+				return config, fmt.Errorf("line %d: profiles must be a mapping", node.Line)
+			}
+			for _, name := range node.Keys {
+				profile, err := parseRunnerProfile(node.Map[name])
+				if err != nil {
+					return config, fmt.Errorf("profile %s: %w", name, err)
+				}
+				config.Profiles[name] = profile
+			}
+		default:
+			return config, fmt.Errorf("line %d: unknown key %q", node.Line, key)
+		}
+	}
+	if config.DefaultProfile != "" {
+		if _, ok := config.Profiles[config.DefaultProfile]; !ok {
+			return config, fmt.Errorf("default_profile %q is not defined", config.DefaultProfile)
+		}
+	}
+	return config, nil
+}
+
+// Reads one profile mapping.
+func parseRunnerProfile(node *yamlNode) (runnerProfile, error) {
+	var profile runnerProfile
+	if node.Map == nil && (node.Scalar != "" || node.List != nil) {
+		return profile, fmt.Errorf("line %d: expected a mapping", node.Line)
+	}
+	fields := map[string]*string{
+		"api_key":             &profile.APIKey,
+		"api_key_env":         &profile.APIKeyEnv,
+		"auth_command":        &profile.AuthCommand,
+		"apikey_secret_crn":   &profile.APIKeySecretCRN,
+		"region":              &profile.Region,
+		"workspace_id":        &profile.WorkspaceID,
+		"crn":                 &profile.CRN,
+		"iam_endpoint":        &profile.IAMEndpoint,
+		"schematics_endpoint": &profile.SchematicsEndpoint,
+		"slack_webhook":       &profile.SlackWebhook,
+	}
+	for _, key := range node.Keys {
+		child := node.Map[key]
+		field, ok := fields[key]
+		if !ok {
+			return profile, fmt.Errorf("line %d: unknown key %q", child.Line, key)
+		}
+		if child.Map != nil || child.List != nil {
+			return profile, fmt.Errorf("line %d: %s must be a string", child.Line, key)
+		}
+		*field = child.Scalar
+	}
+	sources := 0
+	for _, source := range []string{profile.APIKey, profile.APIKeyEnv, profile.AuthCommand} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return profile, errors.New("only one of api_key, api_key_env and auth_command may be set")
+	}
+	if profile.WorkspaceID != "" && profile.CRN != "" {
+		return profile, errors.New("workspace_id and crn cannot be used together")
+	}
+	return profile, nil
+}
+
+// Returns the defaults overlaid with the named profile, or just the defaults when name is empty.
+func (c runnerConfig) profile(name string) (runnerProfile, error) {
+	if name == "" {
+		return c.Defaults, nil
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return profile, fmt.Errorf("unknown profile %q (defined: %s)", name, strings.Join(names, ", "))
+	}
+	merged := c.Defaults
+	if profile.APIKey != "" || profile.APIKeyEnv != "" || profile.AuthCommand != "" {
+		merged.APIKey, merged.APIKeyEnv, merged.AuthCommand = profile.APIKey, profile.APIKeyEnv, profile.AuthCommand
+	}
+	if profile.WorkspaceID != "" || profile.CRN != "" {
+		merged.WorkspaceID, merged.CRN = profile.WorkspaceID, profile.CRN
+	}
+	if profile.APIKeySecretCRN != "" {
+		merged.APIKeySecretCRN = profile.APIKeySecretCRN
+	}
+	if profile.Region != "" {
+		merged.Region = profile.Region
+	}
+	if profile.IAMEndpoint != "" {
+		merged.IAMEndpoint = profile.IAMEndpoint
+	}
+	if profile.SchematicsEndpoint != "" {
+		merged.SchematicsEndpoint = profile.SchematicsEndpoint
+	}
+	if profile.SlackWebhook != "" {
+		merged.SlackWebhook = profile.SlackWebhook
+	}
+	return merged, nil
+}
+
+// Reports whether any profile stores an API key in the file itself.
+func (c runnerConfig) hasInlineKey() bool {
+	if c.Defaults.APIKey != "" {
+		return true
+	}
+	for _, profile := range c.Profiles {
+		if profile.APIKey != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Loads the profile selected by --profile, SCHEMATICS_PROFILE or default_profile and fills in every setting the
+// flags left empty. The API key source is kept aside for resolveAPIKey, since IBMCLOUD_API_KEY overrides it.
+// Without a config file this is a no-op unless a profile was asked for.
+func (o *globalOptions) applyProfile() error {
+	name := o.profileName
+	if name == "" {
+		name = os.Getenv(profileEnv)
+	}
+	path, err := runnerConfigPath()
+	if err != nil {
+		if name != "" {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+		return nil
+	}
+	config, ok, err := loadRunnerConfig(path)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if name != "" {
+			return fmt.Errorf("profile %s: %s does not exist", name, path)
+		}
+		return nil
+	}
+	if name == "" {
+		name = config.DefaultProfile
+	}
+	profile, err := config.profile(name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	// a --crn on the command line carries its own region
+	if o.region == "" && o.workspaceCRN == "" {
+		o.region = profile.Region
+	}
+	if o.workspaceID == "" && o.workspaceCRN == "" && len(o.workspaceNames) == 0 && len(o.workspaceTags) == 0 {
+		o.workspaceID, o.workspaceCRN = profile.WorkspaceID, profile.CRN
+	}
+	if o.iamEndpoint == "" {
+		o.iamEndpoint = profile.IAMEndpoint
+	}
+	if o.apiKeySecretCRN == "" {
+		o.apiKeySecretCRN = profile.APIKeySecretCRN
+	}
+	if o.schematicsEndpoint == "" {
+		o.schematicsEndpoint = profile.SchematicsEndpoint
+	}
+	if o.slackWebhook == "" {
+		o.slackWebhook = profile.SlackWebhook
+	}
+	if name == "" {
+		name = "defaults"
+	}
+	o.fileProfile = &profile
+	o.fileProfileName = name
+	return nil
+}
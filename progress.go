@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// frames of the spinner drawn in front of the status line
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// how often the status line is redrawn, which moves the spinner and the elapsed time
+const progressRedrawInterval = 200 * time.Millisecond
+
+// the line Terraform prints when it finished creating, updating or destroying a resource
+var resourceCompleteLine = regexp.MustCompile(`(?m)^.*: (Creation|Modifications|Destruction) complete after `)
+
+// Reports whether f is a terminal rather than a pipe or file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// A status line redrawn in place while --wait follows a job: a spinner, the job's phase and the time since it was
+// submitted. Output written through it, such as the followed Terraform logs, goes above the line.
+type progressLine struct {
+	out        io.Writer
+	action     string
+	activityID string
+	start      time.Time
+
+	mu    sync.Mutex
+	phase string
+	frame int
+	drawn bool // whether the line is on screen
+	ended bool // set by finish; nothing is drawn after it
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// Draws the status line on out, a terminal, until finish is called.
+func startProgress(out io.Writer, action string, activityID string, start time.Time) *progressLine {
+	p := &progressLine{out: out, action: action, activityID: activityID, start: start, phase: "pending", stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(progressRedrawInterval)
+		defer ticker.Stop()
+		for {
+			p.mu.Lock()
+			p.draw()
+			p.mu.Unlock()
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return p
+}
+
+// Records the job's latest state. logs is its Terraform output so far, or "" when it wasn't fetched.
+func (p *progressLine) update(activity schematics.Activity, logs string) {
+	phase := jobPhase(p.action, activity.Status, logs)
+	p.mu.Lock()
+	p.phase = phase
+	p.mu.Unlock()
+}
+
+// Stops redrawing and clears the line, leaving the terminal as it was. Later calls do nothing.
+func (p *progressLine) finish() {
+	p.once.Do(func() {
+		close(p.stop)
+		<-p.done
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.clear()
+		p.ended = true
+	})
+}
+
+// Writes b above the status line.
+func (p *progressLine) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	n, err := p.out.Write(b)
+	if !p.ended && strings.HasSuffix(string(b), "\n") {
+		p.draw()
+	}
+	return n, err
+}
+
+// Draws the line over the previous one. The caller holds p.mu.
+func (p *progressLine) draw() {
+	elapsed := time.Since(p.start).Round(time.Second)
+	fmt.Fprintf(p.out, "\r\033[K%s %s %s: %s (%s)", spinnerFrames[p.frame%len(spinnerFrames)], p.action, p.activityID, p.phase, elapsed)
+	p.frame++
+	p.drawn = true
+}
+
+// Removes the line. The caller holds p.mu.
+func (p *progressLine) clear() {
+	if p.drawn {
+		fmt.Fprint(p.out, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+// Describes where a job is: pending, in progress or, for apply and destroy once the logs show the plan, which
+// resource Terraform is working on, e.g. "applying resource 3 of 12".
+func jobPhase(action string, status string, logs string) string {
+	switch status {
+	case "", "CREATED", "PENDING":
+		return "pending"
+	case "INPROGRESS":
+	default:
+		return strings.ToLower(status)
+	}
+	verb := map[string]string{"apply": "applying", "destroy": "destroying"}[action]
+	done, total := resourceProgress(logs)
+	switch {
+	case verb == "" || total == 0:
+		return "in progress"
+	case done >= total:
+		return fmt.Sprintf("%s: %d of %d resources done, finishing", verb, total, total)
+	}
+	return fmt.Sprintf("%s resource %d of %d", verb, done+1, total)
+}
+
+// Counts the resources in Terraform's output that are done and that the plan it printed first changes in all.
+func resourceProgress(logs string) (done int, total int) {
+	summary, ok := schematics.ParsePlanSummary(logs)
+	if !ok {
+		return 0, 0
+	}
+	return len(resourceCompleteLine.FindAllString(logs, -1)), summary.Add + summary.Change + summary.Destroy
+}
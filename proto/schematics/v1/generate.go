@@ -0,0 +1,4 @@
+// Package schematicsv1 holds the Go stubs of runner.proto, the gRPC service `serve --grpc-listen` serves.
+package schematicsv1
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative schematics/v1/runner.proto
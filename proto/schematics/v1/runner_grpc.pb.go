@@ -0,0 +1,267 @@
+// The gRPC form of the REST API served by `schematics-apply-destroy serve`: the same operations, the same API tokens
+// (sent as "authorization: Bearer <token>" metadata) and the same audit log. Status codes map from the REST ones:
+// 401 UNAUTHENTICATED, 403 PERMISSION_DENIED, 404 NOT_FOUND, 409 FAILED_PRECONDITION, 429 RESOURCE_EXHAUSTED and
+// unreachable Schematics UNAVAILABLE.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: schematics/v1/runner.proto
+
+package schematicsv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	SchematicsRunner_Apply_FullMethodName         = "/schematics.v1.SchematicsRunner/Apply"
+	SchematicsRunner_Destroy_FullMethodName       = "/schematics.v1.SchematicsRunner/Destroy"
+	SchematicsRunner_GetJob_FullMethodName        = "/schematics.v1.SchematicsRunner/GetJob"
+	SchematicsRunner_StreamJobLogs_FullMethodName = "/schematics.v1.SchematicsRunner/StreamJobLogs"
+)
+
+// SchematicsRunnerClient is the client API for SchematicsRunner service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SchematicsRunnerClient interface {
+	// POST /workspaces/{workspace_id}/apply
+	Apply(ctx context.Context, in *SubmitRequest, opts ...grpc.CallOption) (*Job, error)
+	// POST /workspaces/{workspace_id}/destroy
+	Destroy(ctx context.Context, in *SubmitRequest, opts ...grpc.CallOption) (*Job, error)
+	// GET /jobs/{activity_id}
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// GET /jobs/{activity_id}/logs: each new line of the job's Terraform output as it is seen; the stream ends when
+	// the job has finished.
+	StreamJobLogs(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (SchematicsRunner_StreamJobLogsClient, error)
+}
+
+type schematicsRunnerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSchematicsRunnerClient(cc grpc.ClientConnInterface) SchematicsRunnerClient {
+	return &schematicsRunnerClient{cc}
+}
+
+func (c *schematicsRunnerClient) Apply(ctx context.Context, in *SubmitRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, SchematicsRunner_Apply_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schematicsRunnerClient) Destroy(ctx context.Context, in *SubmitRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, SchematicsRunner_Destroy_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schematicsRunnerClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, SchematicsRunner_GetJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schematicsRunnerClient) StreamJobLogs(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (SchematicsRunner_StreamJobLogsClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SchematicsRunner_ServiceDesc.Streams[0], SchematicsRunner_StreamJobLogs_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &schematicsRunnerStreamJobLogsClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type SchematicsRunner_StreamJobLogsClient interface {
+	Recv() (*LogLine, error)
+	grpc.ClientStream
+}
+
+type schematicsRunnerStreamJobLogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *schematicsRunnerStreamJobLogsClient) Recv() (*LogLine, error) {
+	m := new(LogLine)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SchematicsRunnerServer is the server API for SchematicsRunner service.
+// All implementations must embed UnimplementedSchematicsRunnerServer
+// for forward compatibility
+type SchematicsRunnerServer interface {
+	// POST /workspaces/{workspace_id}/apply
+	Apply(context.Context, *SubmitRequest) (*Job, error)
+	// POST /workspaces/{workspace_id}/destroy
+	Destroy(context.Context, *SubmitRequest) (*Job, error)
+	// GET /jobs/{activity_id}
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	// GET /jobs/{activity_id}/logs: each new line of the job's Terraform output as it is seen; the stream ends when
+	// the job has finished.
+	StreamJobLogs(*GetJobRequest, SchematicsRunner_StreamJobLogsServer) error
+	mustEmbedUnimplementedSchematicsRunnerServer()
+}
+
+// UnimplementedSchematicsRunnerServer must be embedded to have forward compatible implementations.
+type UnimplementedSchematicsRunnerServer struct {
+}
+
+func (UnimplementedSchematicsRunnerServer) Apply(context.Context, *SubmitRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Apply not implemented")
+}
+func (UnimplementedSchematicsRunnerServer) Destroy(context.Context, *SubmitRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Destroy not implemented")
+}
+func (UnimplementedSchematicsRunnerServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedSchematicsRunnerServer) StreamJobLogs(*GetJobRequest, SchematicsRunner_StreamJobLogsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamJobLogs not implemented")
+}
+func (UnimplementedSchematicsRunnerServer) mustEmbedUnimplementedSchematicsRunnerServer() {}
+
+// UnsafeSchematicsRunnerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SchematicsRunnerServer will
+// result in compilation errors.
+type UnsafeSchematicsRunnerServer interface {
+	mustEmbedUnimplementedSchematicsRunnerServer()
+}
+
+func RegisterSchematicsRunnerServer(s grpc.ServiceRegistrar, srv SchematicsRunnerServer) {
+	s.RegisterService(&SchematicsRunner_ServiceDesc, srv)
+}
+
+func _SchematicsRunner_Apply_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchematicsRunnerServer).Apply(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SchematicsRunner_Apply_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchematicsRunnerServer).Apply(ctx, req.(*SubmitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SchematicsRunner_Destroy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchematicsRunnerServer).Destroy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SchematicsRunner_Destroy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchematicsRunnerServer).Destroy(ctx, req.(*SubmitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SchematicsRunner_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchematicsRunnerServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SchematicsRunner_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchematicsRunnerServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SchematicsRunner_StreamJobLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetJobRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SchematicsRunnerServer).StreamJobLogs(m, &schematicsRunnerStreamJobLogsServer{ServerStream: stream})
+}
+
+type SchematicsRunner_StreamJobLogsServer interface {
+	Send(*LogLine) error
+	grpc.ServerStream
+}
+
+type schematicsRunnerStreamJobLogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *schematicsRunnerStreamJobLogsServer) Send(m *LogLine) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// SchematicsRunner_ServiceDesc is the grpc.ServiceDesc for SchematicsRunner service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SchematicsRunner_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "schematics.v1.SchematicsRunner",
+	HandlerType: (*SchematicsRunnerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Apply",
+			Handler:    _SchematicsRunner_Apply_Handler,
+		},
+		{
+			MethodName: "Destroy",
+			Handler:    _SchematicsRunner_Destroy_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _SchematicsRunner_GetJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamJobLogs",
+			Handler:       _SchematicsRunner_StreamJobLogs_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "schematics/v1/runner.proto",
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// prefix of the workspace tag `apply --ttl` records the expiry in, followed by the expiry in Unix seconds;
+// IBM Cloud tags are lowercased and allow few punctuation marks, so an RFC 3339 time wouldn't survive
+const expiryTagPrefix = "expires-at:"
+
+// The tag recording that a workspace expires at expiry.
+func expiryTag(expiry time.Time) string {
+	return expiryTagPrefix + strconv.FormatInt(expiry.Unix(), 10)
+}
+
+// When the workspace expires according to its expires-at tag; false when it has none.
+// With several, the earliest wins.
+func workspaceExpiry(ws schematics.Workspace) (time.Time, bool) {
+	var expiry time.Time
+	found := false
+	for _, tag := range ws.Tags {
+		value, ok := strings.CutPrefix(strings.ToLower(tag), expiryTagPrefix)
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			logger.Warn("ignoring malformed tag "+tag, "workspace", ws.ID)
+			continue
+		}
+		if t := time.Unix(seconds, 0); !found || t.Before(expiry) {
+			expiry, found = t, true
+		}
+	}
+	return expiry, found
+}
+
+// The workspace's tags without any expires-at tag.
+func withoutExpiryTags(tags []string) []string {
+	var kept []string
+	for _, tag := range tags {
+		if !strings.HasPrefix(strings.ToLower(tag), expiryTagPrefix) {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
+
+// Records that the workspace expires at expiry, replacing any earlier expiry.
+func setWorkspaceExpiry(ctx context.Context, client *schematics.Client, schematicsWorkspaceID string, expiry time.Time) error {
+	ws, err := client.GetWorkspace(ctx, schematicsWorkspaceID)
+	if err != nil {
+		return err
+	}
+	return client.SetWorkspaceTags(ctx, schematicsWorkspaceID, append(withoutExpiryTags(ws.Tags), expiryTag(expiry)))
+}
+
+// flags of `reaper`
+type reaperOptions struct {
+	steps         stepOptions
+	resourceGroup string
+	dryRun        bool
+	delete        bool
+}
+
+// Builds the flag set for `reaper`.
+func reaperFlags() (*flag.FlagSet, *globalOptions, *reaperOptions) {
+	fs := newFlagSet("reaper", "reaper [flags]", "Destroys every workspace whose "+expiryTagPrefix+" tag, recorded by `apply --ttl`, has passed, "+
+		"waiting for each destroy and removing the tag once it completed. Meant to run on a schedule; it does not ask for confirmation.")
+	global := &globalOptions{}
+	global.register(fs, false)
+	opts := &reaperOptions{}
+	fs.StringVar(&opts.resourceGroup, "resource-group", "", "only reap workspaces in the resource group with this `id`")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "list the expired workspaces without destroying them")
+	fs.BoolVar(&opts.delete, "delete", false, "also delete each workspace once its resources are destroyed")
+	fs.BoolVar(&opts.steps.FromFailed, "from-failed", false, "also destroy expired workspaces whose last run FAILED")
+	fs.BoolVar(&opts.steps.WaitForReady, "wait-for-ready", false, "wait for any in-progress activity on an expired workspace to finish instead of refusing to destroy it")
+	fs.DurationVar(&opts.steps.WaitForReadyTimeout, "wait-for-ready-timeout", 30*time.Minute, "how long --wait-for-ready waits before giving up")
+	fs.DurationVar(&opts.steps.PollInterval, "poll-interval", 10*time.Second, "how often to check each destroy's status")
+	fs.DurationVar(&opts.steps.JobTimeout, "job-timeout", 0, "stop waiting for a destroy after this long and fail, leaving it running; 0 waits as long as --max-runtime allows")
+	fs.BoolVar(&opts.steps.FollowLogs, "follow-logs", false, "print each destroy's Terraform output on stdout as it runs")
+	return fs, global, opts
+}
+
+// `reaper`: destroys the expired workspaces one after another.
+func runReaperCommand(_ string, args []string) {
+	fs, global, opts := reaperFlags()
+	parseFlags(fs, args)
+	if err := global.validate(false); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	all, err := client.ListWorkspaces(ctx)
+	if err != nil {
+		fatal(err)
+	}
+	now := time.Now()
+	var expired []schematics.Workspace
+	for _, ws := range all {
+		if !ws.InResourceGroup(opts.resourceGroup) {
+			continue
+		}
+		if expiry, ok := workspaceExpiry(ws); ok && !expiry.After(now) {
+			logger.Info("workspace expired", "workspace", ws.ID, "name", ws.Name, "expired", expiry.UTC().Format(time.RFC3339))
+			expired = append(expired, ws)
+		}
+	}
+	if len(expired) == 0 {
+		logger.Info("no expired workspaces")
+		exit(exitOK)
+	}
+	if opts.dryRun {
+		out := redactingWriter{os.Stdout}
+		for _, ws := range expired {
+			fmt.Fprintf(out, "%s\t%s\n", ws.ID, ws.Name)
+		}
+		exit(exitOK)
+	}
+
+	opts.steps.Wait = true
+	opts.steps.LogOutput = redactingWriter{os.Stdout}
+	var results []runResult
+	for _, ws := range expired {
+		if ctx.Err() != nil {
+			break
+		}
+		steps := runSteps(ctx, client, []string{"destroy"}, ws.ID, opts.steps)
+		results = append(results, steps...)
+		if len(steps) == 0 || steps[0].failed() || steps[0].Skipped {
+			continue
+		}
+		if opts.delete {
+			if err := client.DeleteWorkspace(ctx, ws.ID, false); err != nil {
+				logger.Error(formatError(err), "workspace", ws.ID)
+				results = append(results, preflightFailed("delete", ws.ID, err))
+			} else {
+				logger.Info("deleted workspace", "workspace", ws.ID, "name", ws.Name)
+			}
+			continue
+		}
+		// so the next run doesn't destroy it again; a later apply --ttl records a new expiry
+		if err := client.SetWorkspaceTags(ctx, ws.ID, withoutExpiryTags(ws.Tags)); err != nil {
+			logger.Warn("destroyed, but removing the "+expiryTagPrefix+" tag failed: "+formatError(err), "workspace", ws.ID)
+		}
+	}
+	ids := make([]string, len(expired))
+	for i, ws := range expired {
+		ids[i] = ws.ID
+	}
+	if len(ids) > 1 {
+		logWorkspaceSummary(ids, results)
+	}
+	exit(exitCodeFor(results))
+}
+
+// Checks --ttl: it needs an apply to start the clock.
+func validateTTL(ttl time.Duration, actions []string) error {
+	switch {
+	case ttl == 0:
+		return nil
+	case ttl < 0:
+		return fmt.Errorf("--ttl %s: must be positive", ttl)
+	case !containsAction(actions, "apply"):
+		return errors.New("--ttl needs an apply action")
+	}
+	return nil
+}
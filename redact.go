@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// patterns from --redact-pattern; every match is masked in logs, stdout and reports along with the built-in secrets
+var redactPatterns regexpList
+
+// flag.Value collecting a repeatable regular expression flag
+type regexpList []*regexp.Regexp
+
+func (l *regexpList) String() string {
+	patterns := make([]string, len(*l))
+	for i, re := range *l {
+		patterns[i] = re.String()
+	}
+	return strings.Join(patterns, ", ")
+}
+
+func (l *regexpList) Set(pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, re)
+	return nil
+}
+
+// credentials that are always masked: JWTs such as IAM access tokens, bearer tokens, and the values of
+// sensitiveFields in JSON bodies and form data. The key names are kept so the output stays readable.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`),
+	regexp.MustCompile(`("(?:` + strings.Join(sensitiveFields, "|") + `)"\s*:\s*")[^"]*`),
+	regexp.MustCompile(`\b((?:` + strings.Join(sensitiveFields, "|") + `)=)[^&\s"]+`),
+}
+
+// literal secrets known at run time, such as the API key and the refresh token; masked wherever they appear.
+// Guarded by secretsMu, since tokens renewed while serving are added as other requests log.
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+)
+
+// Registers s to be masked in all output. Values too short to be a real credential are ignored so they
+// don't mask ordinary words.
+func addSecret(s string) {
+	if len(s) >= 8 {
+		secretsMu.Lock()
+		secrets = append(secrets, s)
+		secretsMu.Unlock()
+	}
+}
+
+// Registers a value the user marked sensitive, such as a secure workspace variable, to be masked in all output
+// whatever its length.
+func addSensitiveValue(s string) {
+	if s != "" {
+		secretsMu.Lock()
+		secrets = append(secrets, s)
+		secretsMu.Unlock()
+	}
+}
+
+// Registers the access and refresh token of token; for schematics.Client.OnNewToken, so the tokens a client
+// obtains by renewal are masked like the first ones.
+func addTokenSecrets(token schematics.Token) {
+	addSecret(token.AccessToken)
+	addSecret(token.RefreshToken)
+}
+
+// Masks the known secrets, credential-looking values and every match of the --redact-pattern expressions in s.
+func redactString(s string) string {
+	secretsMu.RLock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	secretsMu.RUnlock()
+	for _, re := range secretPatterns {
+		s = re.ReplaceAllString(s, "${1}"+redacted)
+	}
+	for _, re := range redactPatterns {
+		s = re.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+// io.Writer that masks secrets and --redact-pattern matches before passing output on.
+// Each Write is redacted on its own, which suits line-oriented output such as the log package and JSON lines.
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, redactString(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+	"schematics-apply-destroy/pkg/schematics/schematicstest"
+)
+
+// Clears the registered secrets and --redact-pattern expressions for the test and restores them after it.
+func resetSecrets(t *testing.T) {
+	savedSecrets, savedPatterns := secrets, redactPatterns
+	secrets, redactPatterns = nil, nil
+	t.Cleanup(func() { secrets, redactPatterns = savedSecrets, savedPatterns })
+}
+
+func TestRedactString(t *testing.T) {
+	resetSecrets(t)
+	addSecret("my-api-key-1234")
+	addSecret("short")
+	addSensitiveValue("pw")
+	redactPatterns = regexpList{regexp.MustCompile(`acct-[0-9]+`)}
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"api key my-api-key-1234 used", "api key REDACTED used"},
+		{"short words stay", "short words stay"},
+		{"password=pw", "password=REDACTED"},
+		{"token eyJhbGciOiJub25lIn0.eyJpYW1faWQiOiJ4In0.sig in a line", "token REDACTED in a line"},
+		{"token eyJhbGciOiJub25lIn0.eyJpYW1faWQiOiJ4In0. unsigned", "token REDACTED unsigned"},
+		{"Authorization: Bearer abc.def-123", "Authorization: Bearer REDACTED"},
+		{`{"refresh_token": "r-1", "status": "ok"}`, `{"refresh_token": "REDACTED", "status": "ok"}`},
+		{`{"apikey":"k"}`, `{"apikey":"REDACTED"}`},
+		{"grant_type=apikey&apikey=k123&x=1", "grant_type=apikey&apikey=REDACTED&x=1"},
+		{"account acct-42 in us-south", "account REDACTED in us-south"},
+		{"nothing secret here", "nothing secret here"},
+	}
+	for _, test := range tests {
+		if got := redactString(test.in); got != test.want {
+			t.Errorf("redactString(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestRenewedTokensAreRedacted(t *testing.T) {
+	resetSecrets(t)
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+	client := srv.Client()
+	// every call renews, since the fake's tokens last an hour
+	client.TokenRefreshMargin = 2 * time.Hour
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, schematicstest.APIKey); err != nil {
+		t.Fatal(err)
+	}
+	addTokenSecrets(client.Token())
+	client.OnNewToken = addTokenSecrets
+	first := client.Token().RefreshToken
+
+	if _, err := client.GetWorkspace(ctx, ws.ID); err != nil {
+		t.Fatal(err)
+	}
+	renewed := client.Token().RefreshToken
+	if renewed == first {
+		t.Fatal("the token was not renewed")
+	}
+	if got := redactString("tokens " + first + " and " + renewed); got != "tokens REDACTED and REDACTED" {
+		t.Errorf("redacted = %q, want both refresh tokens masked", got)
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	resetSecrets(t)
+	addSecret("my-api-key-1234")
+	var out strings.Builder
+	n, err := redactingWriter{&out}.Write([]byte("key=my-api-key-1234\n"))
+	if err != nil || n != len("key=my-api-key-1234\n") {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if out.String() != "key=REDACTED\n" {
+		t.Errorf("wrote %q", out.String())
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// struct for holding the outcome of a single apply or destroy call
+type runResult struct {
+	Action        string        `json:"action"`
+	WorkspaceID   string        `json:"workspace_id"`
+	ActivityID    string        `json:"activity_id,omitempty"`
+	StatusCode    int           `json:"status_code"`
+	Status        string        `json:"status"`
+	TransactionID string        `json:"transaction_id,omitempty"`
+	Duration      time.Duration `json:"duration_ns"`
+	Error         string        `json:"error,omitempty"`
+	Skipped       bool          `json:"skipped,omitempty"`
+	// final job status with --wait, e.g. COMPLETED or FAILED
+	JobStatus string `json:"job_status,omitempty"`
+	// change counts of a finished plan
+	Plan *schematics.PlanSummary `json:"plan,omitempty"`
+	// estimated monthly cost change of a finished plan, or of the plan run for --max-cost-increase
+	Cost *schematics.CostEstimate `json:"cost,omitempty"`
+	// when Schematics refused the action with 409 Conflict, the activity that was already running and its name
+	RunningActivityID string `json:"running_activity_id,omitempty"`
+	RunningAction     string `json:"running_action,omitempty"`
+	// with --attach, the step waited on RunningActivityID instead of a job of its own
+	Attached bool `json:"attached,omitempty"`
+	// the step failed because its plan is outside --max-destroy or --expect-changes
+	ChangesRefused bool `json:"changes_refused,omitempty"`
+}
+
+// Reports whether the call errored, Schematics refused it, or the job it started didn't complete. Skipped steps never fail.
+func (result runResult) failed() bool {
+	if result.Skipped {
+		return false
+	}
+	if result.JobStatus != "" && result.JobStatus != "COMPLETED" {
+		return true
+	}
+	if result.Attached {
+		return result.Error != ""
+	}
+	return result.Error != "" || result.StatusCode < 200 || result.StatusCode >= 300
+}
+
+// A step's outcome in one word: its final job status with --wait, otherwise SKIPPED, FAILED or SUBMITTED.
+func stepStatus(result runResult) string {
+	switch {
+	case result.JobStatus != "":
+		return result.JobStatus
+	case result.Skipped:
+		return "SKIPPED"
+	case result.failed():
+		return "FAILED"
+	}
+	return "SUBMITTED"
+}
+
+// Link to the workspace in the IBM Cloud console
+func consoleURL(schematicsWorkspaceID string) string {
+	return "https://cloud.ibm.com/schematics/workspaces/" + schematicsWorkspaceID
+}
+
+// Renders result as a short Markdown summary suitable for pasting into a PR comment.
+func renderMarkdownReport(result runResult) string {
+	outcome := "submitted"
+	if result.JobStatus == "COMPLETED" {
+		outcome = "completed"
+	}
+	if result.Skipped {
+		outcome = "skipped"
+	} else if result.failed() {
+		outcome = "failed"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Schematics %s %s\n\n", result.Action, outcome)
+	fmt.Fprintln(&b, "| | |")
+	fmt.Fprintln(&b, "|---|---|")
+	fmt.Fprintf(&b, "| Action | `%s` |\n", result.Action)
+	fmt.Fprintf(&b, "| Workspace | [`%s`](%s) |\n", result.WorkspaceID, consoleURL(result.WorkspaceID))
+	if result.Status != "" {
+		fmt.Fprintf(&b, "| Status | %s |\n", result.Status)
+	}
+	if result.Error != "" {
+		fmt.Fprintf(&b, "| Error | %s |\n", strings.ReplaceAll(result.Error, "|", "\\|"))
+	}
+	if result.ActivityID != "" {
+		fmt.Fprintf(&b, "| Activity | `%s` |\n", result.ActivityID)
+	}
+	if result.JobStatus != "" {
+		fmt.Fprintf(&b, "| Job status | %s |\n", result.JobStatus)
+	}
+	if result.Plan != nil {
+		fmt.Fprintf(&b, "| Changes | %s |\n", result.Plan)
+	}
+	if result.Cost != nil {
+		fmt.Fprintf(&b, "| Estimated cost | %s |\n", result.Cost)
+	}
+	if result.TransactionID != "" {
+		fmt.Fprintf(&b, "| Transaction | `%s` |\n", result.TransactionID)
+	}
+	fmt.Fprintf(&b, "| Duration | %s |\n", result.Duration.Round(time.Millisecond))
+	return b.String()
+}
+
+// Writes the Markdown summary of every result to path, one section per action.
+func writeMarkdownReport(path string, results []runResult) error {
+	sections := make([]string, len(results))
+	for i, result := range results {
+		sections[i] = renderMarkdownReport(result)
+	}
+	if err := os.WriteFile(path, []byte(redactString(strings.Join(sections, "\n"))), 0644); err != nil {
+		return fmt.Errorf("writing Markdown report: %w", err)
+	}
+	return nil
+}
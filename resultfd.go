@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// the JSON object written to --result-fd when the run ends
+type runSummary struct {
+	OK      bool        `json:"ok"`
+	Results []runResult `json:"results"`
+}
+
+// Opens file descriptor fd, inherited from the parent, for writing the final result.
+// Fails when the descriptor isn't open or isn't writable.
+func openResultFD(fd int) (*os.File, error) {
+	if fd < 1 {
+		return nil, fmt.Errorf("--result-fd %d: must be 1 or greater", fd)
+	}
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+	if f == nil {
+		return nil, fmt.Errorf("--result-fd %d: invalid file descriptor", fd)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("--result-fd %d is not open: %w", fd, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("--result-fd %d is a directory", fd)
+	}
+	if _, err := f.Write(nil); err != nil {
+		return nil, fmt.Errorf("--result-fd %d is not writable: %w", fd, err)
+	}
+	return f, nil
+}
+
+// Writes results to f as a single JSON line.
+func writeResultFD(f *os.File, results []runResult) error {
+	if err := writeResultJSON(f, results); err != nil {
+		return fmt.Errorf("writing result to %s: %w", f.Name(), err)
+	}
+	return nil
+}
+
+// Writes results to w as a single redacted JSON line.
+func writeResultJSON(w io.Writer, results []runResult) error {
+	summary := runSummary{OK: true, Results: results}
+	if summary.Results == nil {
+		summary.Results = []runResult{}
+		summary.OK = false
+	}
+	for _, result := range results {
+		if result.failed() {
+			summary.OK = false
+		}
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, redactString(string(data))+"\n")
+	return err
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// One entry of a schedule file: actions run against a workspace whenever the cron expression matches.
+type scheduledJob struct {
+	Name        string
+	Cron        string
+	Actions     []string
+	WorkspaceID string
+	schedule    *cronSchedule
+}
+
+// A schedule file:
+//
+//	timezone: Europe/Berlin
+//	jobs:
+//	  - name: dev up
+//	    cron: "0 8 * * mon-fri"
+//	    action: apply
+//	    workspace_id: us-south.workspace.dev.1a2b3c4d
+//	  - name: dev down
+//	    cron: "0 19 * * mon-fri"
+//	    action: destroy
+//	    workspace_id: us-south.workspace.dev.1a2b3c4d
+type scheduleConfig struct {
+	// the time zone cron expressions are read in; local time when not set
+	Location *time.Location
+	Jobs     []scheduledJob
+}
+
+// Reads and checks the schedule file at path.
+func loadSchedule(path string) (*scheduleConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading schedule: %w", err)
+	}
+	config, err := parseSchedule(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing schedule %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Builds the schedule from its YAML document. Unknown keys, bad cron expressions and unsupported actions are errors.
+func parseSchedule(data []byte) (*scheduleConfig, error) {
+	root, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	config := &scheduleConfig{Location: time.Local}
+	for _, key := range root.Keys {
+		node := root.Map[key]
+		switch key {
+		case "timezone":
+			if node.Map != nil || node.List != nil {
+				return nil, fmt.Errorf("line %d: timezone must be a string such as Europe/Berlin", node.Line)
+			}
+			if config.Location, err = time.LoadLocation(node.Scalar); err != nil {
+				return nil, fmt.Errorf("line %d: %w", node.Line, err)
+			}
+		case "jobs":
+			if node.List == nil {
+				return nil, fmt.Errorf("line %d: jobs must be a list", node.Line)
+			}
+			for _, item := range node.List {
+				job, err := parseScheduledJob(item)
+				if err != nil {
+					return nil, err
+				}
+				config.Jobs = append(config.Jobs, job)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %q", node.Line, key)
+		}
+	}
+	if len(config.Jobs) == 0 {
+		return nil, errors.New("no jobs listed")
+	}
+	return config, nil
+}
+
+// Reads one entry of the jobs list.
+func parseScheduledJob(node *yamlNode) (scheduledJob, error) {
+	var job scheduledJob
+	if node.Map == nil {
+		return job, fmt.Errorf("line %d: expected a mapping with cron, action and workspace_id", node.Line)
+	}
+	action := ""
+	for _, key := range node.Keys {
+		child := node.Map[key]
+		if child.Map != nil || child.List != nil {
+			return job, fmt.Errorf("line %d: %s must be a string", child.Line, key)
+		}
+		switch key {
+		case "name":
+			job.Name = child.Scalar
+		case "cron":
+			job.Cron = child.Scalar
+		case "action":
+			action = child.Scalar
+		case "workspace_id":
+			job.WorkspaceID = child.Scalar
+		default:
+			return job, fmt.Errorf("line %d: unknown key %q", child.Line, key)
+		}
+	}
+	if job.Cron == "" || action == "" || job.WorkspaceID == "" {
+		return job, fmt.Errorf("line %d: a job needs cron, action and workspace_id", node.Line)
+	}
+	var err error
+	if job.schedule, err = parseCron(job.Cron); err != nil {
+		return job, fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	if job.Actions, err = parseActions(action); err != nil {
+		return job, fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	if job.Name == "" {
+		job.Name = action + " " + job.WorkspaceID
+	}
+	return job, nil
+}
+
+// Builds the flag set for `schedule`.
+func scheduleFlags() (*flag.FlagSet, *globalOptions, *stepOptions) {
+	fs := newFlagSet("schedule", "schedule <schedule.yaml> [flags]", "Authenticates once, then runs as a long-lived process that submits each job of the schedule file "+
+		"whenever its cron expression matches, e.g. apply on weekdays at 08:00 and destroy at 19:00. Destroys are not confirmed.")
+	global := &globalOptions{}
+	global.register(fs, false)
+	opts := &stepOptions{}
+	fs.BoolVar(&opts.Wait, "wait", false, "wait for each job to finish and log its result before running the next one that is due")
+	fs.DurationVar(&opts.PollInterval, "poll-interval", 10*time.Second, "how often --wait checks the job status")
+	fs.DurationVar(&opts.JobTimeout, "job-timeout", 0, "with --wait, stop waiting for a job after this long, leaving it running")
+	fs.BoolVar(&opts.WaitForReady, "wait-for-ready", false, "before destroy, wait for any in-progress activity on the workspace to finish instead of refusing")
+	fs.DurationVar(&opts.WaitForReadyTimeout, "wait-for-ready-timeout", 30*time.Minute, "how long --wait-for-ready waits before giving up")
+	fs.BoolVar(&opts.FromFailed, "from-failed", false, "allow destroying a workspace whose last run FAILED")
+	return fs, global, opts
+}
+
+// `schedule`: runs the schedule file's jobs until SIGINT or SIGTERM, reusing one token.
+func runScheduleCommand(_ string, args []string) {
+	fs, global, opts := scheduleFlags()
+	rest := parseFlagsArgs(fs, args)
+	if len(rest) != 1 {
+		usageError(fs, errors.New("expected exactly one schedule file"))
+	}
+	config, err := loadSchedule(rest[0])
+	if err != nil {
+		fatalCode(exitInvalidInput, err)
+	}
+	if err := global.validate(false); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	opts.LogOutput = redactingWriter{os.Stdout}
+	runSchedule(ctx, client, config, *opts)
+	exit(exitOK)
+}
+
+// Runs each job whenever it is due until ctx ends. Jobs due at the same minute run one after another in file order;
+// a job that comes due while an earlier one is still running with --wait runs as soon as that one finishes.
+// A failed job is logged and never stops the schedule.
+func runSchedule(ctx context.Context, client *schematics.Client, config *scheduleConfig, opts stepOptions) {
+	now := time.Now().In(config.Location)
+	next := make([]time.Time, len(config.Jobs))
+	for i, job := range config.Jobs {
+		next[i] = job.schedule.next(now)
+		if next[i].IsZero() {
+			logger.Warn("job never runs", "job", job.Name, "cron", job.Cron)
+			continue
+		}
+		logger.Info("scheduled", "job", job.Name, "cron", job.Cron, "next", next[i].Format(time.RFC3339))
+	}
+	for ctx.Err() == nil {
+		due := earliest(next)
+		if due.IsZero() {
+			logger.Warn("no job will ever run; stopping")
+			return
+		}
+		if sleep(ctx, time.Until(due)) != nil {
+			return
+		}
+		for i, job := range config.Jobs {
+			if next[i].IsZero() || next[i].After(due) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Info("running scheduled job", "job", job.Name, "actions", strings.Join(job.Actions, ","), "workspace", job.WorkspaceID)
+			results := runSteps(ctx, client, job.Actions, job.WorkspaceID, opts)
+			if exitCodeFor(results) != exitOK {
+				logger.Error("scheduled job failed", "job", job.Name, "workspace", job.WorkspaceID)
+			}
+			next[i] = job.schedule.next(time.Now().In(config.Location))
+			if !next[i].IsZero() {
+				logger.Info("next run", "job", job.Name, "at", next[i].Format(time.RFC3339))
+			}
+		}
+	}
+}
+
+// The earliest non-zero time in times, or the zero time.
+func earliest(times []time.Time) time.Time {
+	var set []time.Time
+	for _, t := range times {
+		if !t.IsZero() {
+			set = append(set, t)
+		}
+	}
+	if len(set) == 0 {
+		return time.Time{}
+	}
+	sort.Slice(set, func(i, j int) bool { return set[i].Before(set[j]) })
+	return set[0]
+}
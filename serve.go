@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// The REST API of `serve`. Every request but GET /healthz needs Authorization: Bearer <token> with one of the
+// tokens from --api-tokens-file, and is logged with the name of the caller the token belongs to.
+//
+//	POST /workspaces/{workspace-id}/{action}    submits apply, destroy, plan or refresh; 202 with an apiJob
+//	GET  /jobs/{activity-id}[?workspace_id=...] the job's current status; workspace_id is only needed for jobs this server didn't submit
+//	GET  /jobs/{activity-id}/logs[?workspace_id=...] streams the job's Terraform output as text until the job finishes
+//
+// proto/schematics/v1/runner.proto describes the same operations as a gRPC service, which --grpc-listen serves in
+// binaries built with -tags schematicsgrpc.
+type apiServer struct {
+	client       *schematics.Client
+	tokens       []apiToken
+	metrics      *metrics // nil without --metrics-addr
+	pollInterval time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*submittedJob // by activity id
+}
+
+// an API token and the caller name it is logged under
+type apiToken struct {
+	name  string
+	token string
+}
+
+// a job submitted through the API, remembered so GET /jobs can find its workspace
+type submittedJob struct {
+	workspaceID string
+	action      string
+	caller      string
+	submitted   time.Time
+	observed    bool // its final status went into the metrics
+}
+
+// The job object the API returns.
+type apiJob struct {
+	ActivityID  string `json:"activity_id"`
+	WorkspaceID string `json:"workspace_id"`
+	Action      string `json:"action,omitempty"`
+	// SUBMITTED right after submission, then the Schematics activity status, e.g. INPROGRESS or COMPLETED
+	Status      string `json:"status"`
+	Message     string `json:"message,omitempty"`
+	SubmittedBy string `json:"submitted_by,omitempty"`
+}
+
+// The body of every error response.
+type apiErrorBody struct {
+	Error         string `json:"error"`
+	TransactionID string `json:"transaction_id,omitempty"`
+}
+
+// Reads --api-tokens-file: one token per line, optionally preceded by the caller's name and a space. Blank lines and
+// lines starting with # are skipped. Tokens shorter than 16 characters are refused.
+func loadAPITokens(path string) ([]apiToken, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading API tokens: %w", err)
+	}
+	defer f.Close()
+	var tokens []apiToken
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		t := apiToken{name: fmt.Sprintf("token-%d", line)}
+		switch fields := strings.Fields(text); len(fields) {
+		case 1:
+			t.token = fields[0]
+		case 2:
+			t.name, t.token = fields[0], fields[1]
+		default:
+			return nil, fmt.Errorf("%s line %d: expected [name] token", path, line)
+		}
+		if len(t.token) < 16 {
+			return nil, fmt.Errorf("%s line %d: token is shorter than 16 characters", path, line)
+		}
+		addSecret(t.token)
+		tokens = append(tokens, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading API tokens: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s holds no API tokens", path)
+	}
+	return tokens, nil
+}
+
+// A refused or failed API call: the HTTP status it is answered with and the error it carries. The gRPC service
+// maps the status to a gRPC code.
+type apiFailure struct {
+	status int
+	body   apiErrorBody
+}
+
+// The caller name for an Authorization value of "Bearer <token>", or "" when it carries none of the tokens.
+func (s *apiServer) caller(authorization string) string {
+	presented, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return ""
+	}
+	name := ""
+	for _, t := range s.tokens {
+		// compare against every token so the time taken doesn't tell which one nearly matched
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(t.token)) == 1 {
+			name = t.name
+		}
+	}
+	return name
+}
+
+// Makes each API request an operation of its own, under the caller's correlation id when it sent a usable one.
+// Returns the id the request runs under.
+func withRequestCorrelationID(ctx context.Context, presented string) (context.Context, string) {
+	if !validCorrelationID(presented) {
+		presented = schematics.NewCorrelationID()
+	}
+	return schematics.WithCorrelationID(ctx, presented), presented
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/healthz" && r.Method == http.MethodGet {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	ctx, correlationID := withRequestCorrelationID(r.Context(), r.Header.Get(schematics.CorrelationIDHeader))
+	w.Header().Set(schematics.CorrelationIDHeader, correlationID)
+	r = r.WithContext(ctx)
+	caller := s.caller(r.Header.Get("Authorization"))
+	if caller == "" {
+		logger.Warn("API request refused: missing or unknown token", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeAPIJSON(w, http.StatusUnauthorized, apiErrorBody{Error: "missing or unknown API token"})
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 3 && parts[0] == "workspaces" && parts[1] != "":
+		if r.Method != http.MethodPost {
+			writeAPIJSON(w, http.StatusMethodNotAllowed, apiErrorBody{Error: "use POST to submit " + parts[2]})
+			return
+		}
+		job, failure := s.submit(r.Context(), caller, parts[1], parts[2])
+		if failure != nil {
+			writeAPIJSON(w, failure.status, failure.body)
+			return
+		}
+		writeAPIJSON(w, http.StatusAccepted, job)
+	case len(parts) == 2 && parts[0] == "jobs" && parts[1] != "":
+		if r.Method != http.MethodGet {
+			writeAPIJSON(w, http.StatusMethodNotAllowed, apiErrorBody{Error: "use GET to read a job"})
+			return
+		}
+		job, failure := s.job(r.Context(), caller, parts[1], r.URL.Query().Get("workspace_id"))
+		if failure != nil {
+			writeAPIJSON(w, failure.status, failure.body)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, job)
+	case len(parts) == 3 && parts[0] == "jobs" && parts[1] != "" && parts[2] == "logs":
+		if r.Method != http.MethodGet {
+			writeAPIJSON(w, http.StatusMethodNotAllowed, apiErrorBody{Error: "use GET to read a job's logs"})
+			return
+		}
+		failure := s.logs(r.Context(), caller, parts[1], r.URL.Query().Get("workspace_id"), func() io.Writer {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(http.StatusOK)
+			return flushingWriter{w}
+		})
+		if failure != nil {
+			writeAPIJSON(w, failure.status, failure.body)
+		}
+	default:
+		writeAPIJSON(w, http.StatusNotFound, apiErrorBody{Error: "no such endpoint"})
+	}
+}
+
+// POST /workspaces/{id}/{action}: submits the action and returns the job as SUBMITTED.
+func (s *apiServer) submit(ctx context.Context, caller string, workspaceID string, action string) (apiJob, *apiFailure) {
+	if !supportedActions[action] {
+		logger.Info("API submit refused", "caller", caller, "action", action, "workspace", workspaceID)
+		return apiJob{}, &apiFailure{http.StatusNotFound, apiErrorBody{Error: unsupportedActionError(action).Error()}}
+	}
+	start := time.Now()
+	resp, err := s.client.RunAction(ctx, action, workspaceID)
+	if s.metrics != nil {
+		observed := runResult{Action: action, WorkspaceID: workspaceID, ActivityID: resp.ActivityID, StatusCode: resp.StatusCode, Status: resp.Status, Duration: time.Since(start)}
+		if err != nil {
+			observed.Error = formatError(err)
+		}
+		s.metrics.observe(observed)
+	}
+	if err != nil {
+		logger.Info("API submit failed", "caller", caller, "action", action, "workspace", workspaceID, "error", formatError(err))
+		if resp.StatusCode == http.StatusForbidden {
+			return apiJob{}, &apiFailure{http.StatusForbidden, apiErrorBody{Error: forbiddenMessage(action, workspaceID, resp.TransactionID), TransactionID: resp.TransactionID}}
+		}
+		return apiJob{}, schematicsFailure(err, resp.TransactionID)
+	}
+	logger.Info("API submitted job", "caller", caller, "action", action, "workspace", workspaceID, "activity", resp.ActivityID)
+	if resp.ActivityID != "" {
+		s.mu.Lock()
+		s.jobs[resp.ActivityID] = &submittedJob{workspaceID: workspaceID, action: action, caller: caller, submitted: start}
+		s.mu.Unlock()
+	}
+	return apiJob{ActivityID: resp.ActivityID, WorkspaceID: workspaceID, Action: action, Status: "SUBMITTED", SubmittedBy: caller}, nil
+}
+
+// The job as far as this server knows it, in workspaceID for jobs it didn't submit. Fails with 404 when the
+// workspace is unknown.
+func (s *apiServer) lookupJob(activityID string, workspaceID string) (apiJob, *submittedJob, *apiFailure) {
+	s.mu.Lock()
+	known := s.jobs[activityID]
+	job := apiJob{ActivityID: activityID}
+	if known != nil {
+		job.WorkspaceID, job.Action, job.SubmittedBy = known.workspaceID, known.action, known.caller
+	}
+	s.mu.Unlock()
+	if known == nil {
+		job.WorkspaceID = workspaceID
+	}
+	if job.WorkspaceID == "" {
+		return job, nil, &apiFailure{http.StatusNotFound, apiErrorBody{Error: "job " + activityID + " was not submitted through this server; pass its workspace_id"}}
+	}
+	return job, known, nil
+}
+
+// GET /jobs/{id}: the job's current status.
+func (s *apiServer) job(ctx context.Context, caller string, activityID string, workspaceID string) (apiJob, *apiFailure) {
+	job, known, failure := s.lookupJob(activityID, workspaceID)
+	if failure != nil {
+		return job, failure
+	}
+	activity, err := s.client.GetActivity(ctx, job.WorkspaceID, activityID)
+	if err != nil {
+		logger.Info("API job lookup failed", "caller", caller, "activity", activityID, "error", formatError(err))
+		return job, schematicsFailure(err, "")
+	}
+	job.Status, job.Message = activity.Status, activity.Message
+	if job.Action == "" {
+		job.Action = strings.ToLower(activity.Name)
+	}
+	logger.Info("API read job", "caller", caller, "activity", activityID, "status", activity.Status)
+	if known != nil && s.metrics != nil && schematics.IsTerminalStatus(activity.Status) {
+		s.mu.Lock()
+		first := !known.observed
+		known.observed = true
+		s.mu.Unlock()
+		if first {
+			// without the activity id, so the submission counted in submit isn't counted again
+			s.metrics.observe(runResult{Action: known.action, WorkspaceID: known.workspaceID, StatusCode: http.StatusAccepted,
+				JobStatus: activity.Status, Duration: time.Since(known.submitted)})
+		}
+	}
+	return job, nil
+}
+
+// GET /jobs/{id}/logs: polls the job like --follow-logs does and writes each new line of its Terraform output as
+// soon as it is seen to the writer start returns, ending once the job has finished. start is called when the job
+// has been found; problems after that can only be logged, since the caller has been answered by then.
+func (s *apiServer) logs(ctx context.Context, caller string, activityID string, workspaceID string, start func() io.Writer) *apiFailure {
+	job, _, failure := s.lookupJob(activityID, workspaceID)
+	if failure != nil {
+		return failure
+	}
+	activity, err := s.client.GetActivity(ctx, job.WorkspaceID, activityID)
+	if err != nil {
+		logger.Info("API job logs failed", "caller", caller, "activity", activityID, "error", formatError(err))
+		return schematicsFailure(err, "")
+	}
+	logger.Info("API streaming job logs", "caller", caller, "workspace", job.WorkspaceID, "activity", activityID, "status", activity.Status)
+	follower := &logFollower{client: s.client, workspaceID: job.WorkspaceID, activityID: activityID, out: redactingWriter{start()}}
+	if schematics.IsTerminalStatus(activity.Status) {
+		follower.poll(ctx, true)
+		return nil
+	}
+	_, err = s.client.WaitForActivity(ctx, job.WorkspaceID, activityID, schematics.WaitOptions{
+		Interval: s.pollInterval,
+		OnPoll: func(activity schematics.Activity) {
+			follower.poll(ctx, schematics.IsTerminalStatus(activity.Status))
+		},
+	})
+	if err != nil && ctx.Err() == nil {
+		logger.Warn("API job logs ended early", "caller", caller, "activity", activityID, "error", formatError(err))
+	}
+	return nil
+}
+
+// Flushes every write to the client, so streamed lines aren't held in the response buffer.
+type flushingWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushingWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+// Fails with the status Schematics gave, or 502 when it couldn't be reached.
+func schematicsFailure(err error, transactionID string) *apiFailure {
+	status := http.StatusBadGateway
+	var apiErr *schematics.APIError
+	if errors.As(err, &apiErr) {
+		status = apiErr.StatusCode
+		if transactionID == "" {
+			transactionID = apiErr.TransactionID
+		}
+	}
+	return &apiFailure{status, apiErrorBody{Error: redactString(formatError(err)), TransactionID: transactionID}}
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// serves api as the gRPC service of proto/schematics/v1/runner.proto on listener until ctx is done; nil unless the
+// binary was built with -tags schematicsgrpc
+var serveGRPC func(ctx context.Context, api *apiServer, listener net.Listener) error
+
+// flags of `serve`
+type serveOptions struct {
+	listen       string
+	grpcListen   string
+	tokensFile   string
+	metricsAddr  string
+	pollInterval time.Duration
+}
+
+// Builds the flag set for `serve`.
+func serveFlags() (*flag.FlagSet, *globalOptions, *serveOptions) {
+	fs := newFlagSet("serve", "serve --api-tokens-file <file> [flags]", "Authenticates once, then serves a REST API for submitting workspace actions and reading job status, "+
+		"so internal tooling can trigger Schematics through one audited service instead of holding IBM Cloud API keys. "+
+		"POST /workspaces/{id}/apply (or destroy, plan, refresh) submits a job; GET /jobs/{activity-id} reads its status. Requests need Authorization: Bearer <token>.")
+	global := &globalOptions{}
+	global.register(fs, false)
+	opts := &serveOptions{}
+	fs.StringVar(&opts.listen, "listen", "127.0.0.1:8080", "`address` to serve the API on")
+	fs.StringVar(&opts.grpcListen, "grpc-listen", "", "also serve the API as the gRPC service SchematicsRunner at this `address`, e.g. 127.0.0.1:9443; needs a binary built with -tags schematicsgrpc")
+	fs.StringVar(&opts.tokensFile, "api-tokens-file", "", "file of API tokens callers authenticate with, one `[name] token` per line; the name is logged with every request")
+	fs.StringVar(&opts.metricsAddr, "metrics-addr", "", "serve Prometheus metrics on /metrics at this `address`, e.g. :9090")
+	fs.DurationVar(&opts.pollInterval, "poll-interval", 10*time.Second, "how often streaming a job's logs checks for new output")
+	return fs, global, opts
+}
+
+// `serve`: runs the REST API until SIGINT or SIGTERM, reusing one token.
+func runServeCommand(_ string, args []string) {
+	fs, global, opts := serveFlags()
+	parseFlags(fs, args)
+	if opts.tokensFile == "" {
+		usageError(fs, errors.New("--api-tokens-file is required; the API is never served without authentication"))
+	}
+	if opts.grpcListen != "" && serveGRPC == nil {
+		usageError(fs, errors.New("--grpc-listen: this binary was built without gRPC support; rebuild it with -tags schematicsgrpc"))
+	}
+	if err := global.validate(false); err != nil {
+		usageError(fs, err)
+	}
+	tokens, err := loadAPITokens(opts.tokensFile)
+	if err != nil {
+		fatalCode(exitInvalidInput, err)
+	}
+	listener, err := net.Listen("tcp", opts.listen)
+	if err != nil {
+		fatalCode(exitInvalidInput, fmt.Errorf("--listen: %w", err))
+	}
+	var grpcListener net.Listener
+	if opts.grpcListen != "" {
+		if grpcListener, err = net.Listen("tcp", opts.grpcListen); err != nil {
+			fatalCode(exitInvalidInput, fmt.Errorf("--grpc-listen: %w", err))
+		}
+	}
+	ctx, client := global.connect()
+	api := &apiServer{client: client, tokens: tokens, jobs: map[string]*submittedJob{}, pollInterval: opts.pollInterval}
+	if opts.metricsAddr != "" {
+		api.metrics = newMetrics()
+		client.OnTokenRenewal = api.metrics.tokenRenewed
+		serveMetrics(opts.metricsAddr, api.metrics)
+	}
+	server := &http.Server{
+		Handler:           api,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	if grpcListener != nil {
+		go func() {
+			if err := serveGRPC(ctx, api, grpcListener); err != nil {
+				fatal(err)
+			}
+		}()
+		logger.Info("serving gRPC API", "address", grpcListener.Addr().String())
+	}
+	logger.Info("serving API", "url", "http://"+listener.Addr().String(), "tokens", len(tokens))
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal(err)
+	}
+	exit(exitOK)
+}
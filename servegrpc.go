@@ -0,0 +1,231 @@
+//go:build schematicsgrpc
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"schematics-apply-destroy/pkg/schematics"
+	schematicsv1 "schematics-apply-destroy/proto/schematics/v1"
+)
+
+func init() {
+	serveGRPC = func(ctx context.Context, api *apiServer, listener net.Listener) error {
+		server := newGRPCServer(api)
+		go func() {
+			<-ctx.Done()
+			// like the REST server, give running calls 10s; log streams can run until their job ends
+			stopped := make(chan struct{})
+			go func() {
+				server.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-time.After(10 * time.Second):
+				server.Stop()
+			}
+		}()
+		if err := server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			return err
+		}
+		return nil
+	}
+}
+
+// The gRPC server of `serve --grpc-listen`: every call is authenticated with the API tokens and runs as an
+// operation of its own, like a REST request.
+func newGRPCServer(api *apiServer) *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(api.unaryInterceptor), grpc.StreamInterceptor(api.streamInterceptor))
+	schematicsv1.RegisterSchematicsRunnerServer(server, &grpcRunner{api: api})
+	return server
+}
+
+// context key of the caller name a gRPC call authenticated as
+type grpcCallerKey struct{}
+
+// Authenticates a call from its "authorization: Bearer <token>" metadata and sets its correlation id, sent back in
+// the response headers. Returns the call's context carrying the caller name.
+func (s *apiServer) authenticateCall(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	ctx, correlationID := withRequestCorrelationID(ctx, first(schematics.CorrelationIDHeader))
+	grpc.SetHeader(ctx, metadata.Pairs(schematics.CorrelationIDHeader, correlationID))
+	caller := s.caller(first("authorization"))
+	if caller == "" {
+		remote := ""
+		if p, ok := peer.FromContext(ctx); ok {
+			remote = p.Addr.String()
+		}
+		logger.Warn("API request refused: missing or unknown token", "method", method, "remote", remote)
+		return nil, status.Error(codes.Unauthenticated, "missing or unknown API token")
+	}
+	return context.WithValue(ctx, grpcCallerKey{}, caller), nil
+}
+
+func (s *apiServer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticateCall(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *apiServer) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticateCall(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, callStream{stream, ctx})
+}
+
+// A server stream running under the context the interceptor made for its call.
+type callStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (c callStream) Context() context.Context {
+	return c.ctx
+}
+
+// SchematicsRunner over the REST API's operations.
+type grpcRunner struct {
+	schematicsv1.UnimplementedSchematicsRunnerServer
+	api *apiServer
+}
+
+func (r *grpcRunner) Apply(ctx context.Context, req *schematicsv1.SubmitRequest) (*schematicsv1.Job, error) {
+	return r.submit(ctx, req, "apply")
+}
+
+func (r *grpcRunner) Destroy(ctx context.Context, req *schematicsv1.SubmitRequest) (*schematicsv1.Job, error) {
+	return r.submit(ctx, req, "destroy")
+}
+
+func (r *grpcRunner) submit(ctx context.Context, req *schematicsv1.SubmitRequest, action string) (*schematicsv1.Job, error) {
+	if req.GetWorkspaceId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "workspace_id is required")
+	}
+	job, failure := r.api.submit(ctx, ctx.Value(grpcCallerKey{}).(string), req.GetWorkspaceId(), action)
+	if failure != nil {
+		return nil, grpcError(ctx, failure)
+	}
+	return grpcJob(job), nil
+}
+
+func (r *grpcRunner) GetJob(ctx context.Context, req *schematicsv1.GetJobRequest) (*schematicsv1.Job, error) {
+	if req.GetActivityId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "activity_id is required")
+	}
+	job, failure := r.api.job(ctx, ctx.Value(grpcCallerKey{}).(string), req.GetActivityId(), req.GetWorkspaceId())
+	if failure != nil {
+		return nil, grpcError(ctx, failure)
+	}
+	return grpcJob(job), nil
+}
+
+func (r *grpcRunner) StreamJobLogs(req *schematicsv1.GetJobRequest, stream schematicsv1.SchematicsRunner_StreamJobLogsServer) error {
+	if req.GetActivityId() == "" {
+		return status.Error(codes.InvalidArgument, "activity_id is required")
+	}
+	ctx := stream.Context()
+	lines := &logLineSender{stream: stream}
+	failure := r.api.logs(ctx, ctx.Value(grpcCallerKey{}).(string), req.GetActivityId(), req.GetWorkspaceId(), func() io.Writer { return lines })
+	if failure != nil {
+		return grpcError(ctx, failure)
+	}
+	return lines.flush()
+}
+
+// Sends what is written to it as LogLine messages, one per line without its newline.
+type logLineSender struct {
+	stream  schematicsv1.SchematicsRunner_StreamJobLogsServer
+	partial []byte
+}
+
+func (l *logLineSender) Write(p []byte) (int, error) {
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := l.stream.Send(&schematicsv1.LogLine{Text: strings.TrimSuffix(string(l.partial[:i]), "\r")}); err != nil {
+			return 0, err
+		}
+		l.partial = l.partial[i+1:]
+	}
+}
+
+// Sends a last line that had no newline.
+func (l *logLineSender) flush() error {
+	if len(l.partial) == 0 {
+		return nil
+	}
+	err := l.stream.Send(&schematicsv1.LogLine{Text: string(l.partial)})
+	l.partial = nil
+	return err
+}
+
+func grpcJob(job apiJob) *schematicsv1.Job {
+	return &schematicsv1.Job{
+		ActivityId:  job.ActivityID,
+		WorkspaceId: job.WorkspaceID,
+		Action:      job.Action,
+		Status:      job.Status,
+		Message:     job.Message,
+		SubmittedBy: job.SubmittedBy,
+	}
+}
+
+// The gRPC status for a failure, as runner.proto maps them. The Schematics transaction id, when there is one, is
+// sent as the transaction-id trailer.
+func grpcError(ctx context.Context, failure *apiFailure) error {
+	if failure.body.TransactionID != "" {
+		grpc.SetTrailer(ctx, metadata.Pairs("transaction-id", failure.body.TransactionID))
+	}
+	return status.Error(grpcCode(failure.status), failure.body.Error)
+}
+
+// The gRPC code for an HTTP status of the REST API.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	}
+	if httpStatus >= 500 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,167 @@
+//go:build schematicsgrpc
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"schematics-apply-destroy/pkg/schematics"
+	"schematics-apply-destroy/pkg/schematics/schematicstest"
+	schematicsv1 "schematics-apply-destroy/proto/schematics/v1"
+)
+
+const testAPIToken = "test-token-0123456789"
+
+// A gRPC client of an apiServer over the fake Schematics, and the id of the fake's one workspace.
+func grpcTestClient(t *testing.T, job schematicstest.JobOptions) (schematicsv1.SchematicsRunnerClient, string) {
+	discardLogs(t)
+	srv := schematicstest.NewServer()
+	t.Cleanup(srv.Close)
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+	srv.SetJobOptions(job)
+	client := srv.Client()
+	if err := client.Authenticate(context.Background(), schematicstest.APIKey); err != nil {
+		t.Fatal(err)
+	}
+	api := &apiServer{client: client, tokens: []apiToken{{name: "ci", token: testAPIToken}}, jobs: map[string]*submittedJob{}, pollInterval: time.Millisecond}
+
+	listener := bufconn.Listen(1 << 20)
+	server := newGRPCServer(api)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufconn", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return schematicsv1.NewSchematicsRunnerClient(conn), ws.ID
+}
+
+// A context authenticating calls with token.
+func withAPIToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestGRPCApplyAndGetJob(t *testing.T) {
+	runner, wsID := grpcTestClient(t, schematicstest.JobOptions{})
+	ctx := withAPIToken(testAPIToken)
+
+	var header metadata.MD
+	job, err := runner.Apply(ctx, &schematicsv1.SubmitRequest{WorkspaceId: wsID}, grpc.Header(&header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.GetActivityId() == "" || job.GetStatus() != "SUBMITTED" || job.GetAction() != "apply" || job.GetSubmittedBy() != "ci" {
+		t.Errorf("Apply = %+v, want a SUBMITTED apply by ci", job)
+	}
+	if len(header.Get(schematics.CorrelationIDHeader)) != 1 {
+		t.Errorf("headers = %v, want a correlation id", header)
+	}
+
+	// the server remembers the workspace of a job it submitted
+	got, err := runner.GetJob(ctx, &schematicsv1.GetJobRequest{ActivityId: job.GetActivityId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetWorkspaceId() != wsID || got.GetStatus() != "COMPLETED" {
+		t.Errorf("GetJob = %+v, want the COMPLETED job in %s", got, wsID)
+	}
+}
+
+func TestGRPCErrors(t *testing.T) {
+	runner, wsID := grpcTestClient(t, schematicstest.JobOptions{})
+	tests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"no token", func() error {
+			_, err := runner.Apply(context.Background(), &schematicsv1.SubmitRequest{WorkspaceId: wsID})
+			return err
+		}, codes.Unauthenticated},
+		{"unknown token", func() error {
+			_, err := runner.Apply(withAPIToken("not-a-known-token-at-all"), &schematicsv1.SubmitRequest{WorkspaceId: wsID})
+			return err
+		}, codes.Unauthenticated},
+		{"no workspace id", func() error {
+			_, err := runner.Destroy(withAPIToken(testAPIToken), &schematicsv1.SubmitRequest{})
+			return err
+		}, codes.InvalidArgument},
+		{"unknown workspace", func() error {
+			_, err := runner.Apply(withAPIToken(testAPIToken), &schematicsv1.SubmitRequest{WorkspaceId: "us-south.workspace.none.0000"})
+			return err
+		}, codes.NotFound},
+		{"job not submitted here", func() error {
+			_, err := runner.GetJob(withAPIToken(testAPIToken), &schematicsv1.GetJobRequest{ActivityId: "a1"})
+			return err
+		}, codes.NotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.call(); status.Code(err) != test.want {
+				t.Errorf("error = %v, want code %s", err, test.want)
+			}
+		})
+	}
+}
+
+func TestGRPCStreamJobLogs(t *testing.T) {
+	runner, wsID := grpcTestClient(t, schematicstest.JobOptions{Polls: 2, Logs: "Plan: 1 to add\r\nApply complete!\nno newline"})
+	ctx := withAPIToken(testAPIToken)
+	job, err := runner.Apply(ctx, &schematicsv1.SubmitRequest{WorkspaceId: wsID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := runner.StreamJobLogs(ctx, &schematicsv1.GetJobRequest{ActivityId: job.GetActivityId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for {
+		line, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line.GetText())
+	}
+	if want := []string{"Plan: 1 to add", "Apply complete!", "no newline"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+}
+
+func TestGRPCCode(t *testing.T) {
+	tests := map[int]codes.Code{
+		400: codes.InvalidArgument,
+		401: codes.Unauthenticated,
+		403: codes.PermissionDenied,
+		404: codes.NotFound,
+		409: codes.FailedPrecondition,
+		429: codes.ResourceExhausted,
+		502: codes.Unavailable,
+		503: codes.Unavailable,
+		500: codes.Internal,
+		418: codes.Unknown,
+	}
+	for httpStatus, want := range tests {
+		if got := grpcCode(httpStatus); got != want {
+			t.Errorf("grpcCode(%d) = %s, want %s", httpStatus, got, want)
+		}
+	}
+}
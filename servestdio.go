@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// A single command read from stdin in --serve-stdio mode, one JSON object per line:
+//
+//	{"id": "1", "action": "apply", "workspace_id": "<schematics-workspace-id>", "options": {"targets": ["module.cluster"]}}
+//
+// id is optional and echoed back unchanged so callers can match responses to requests. options is optional too.
+type stdioRequest struct {
+	ID          string       `json:"id,omitempty"`
+	Action      string       `json:"action"`
+	WorkspaceID string       `json:"workspace_id"`
+	Options     stdioOptions `json:"options"`
+}
+
+// The options of a stdio command, the same as the flags of the one-shot commands.
+type stdioOptions struct {
+	// Terraform resource addresses to limit the job to, like --target
+	Targets []string `json:"targets,omitempty"`
+}
+
+// The result written to stdout for every line read, one JSON object per line:
+//
+//	{"id": "1", "ok": true, "activity_id": "<activity id>", "status_code": 202, "status": "202 Accepted", "body": "<raw Schematics response>"}
+//
+// ok is true only for a 2xx Schematics response. Otherwise error says what went wrong, whether the input was
+// malformed, Schematics could not be reached or it refused the action.
+type stdioResponse struct {
+	ID         string `json:"id,omitempty"`
+	OK         bool   `json:"ok"`
+	ActivityID string `json:"activity_id,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Body       string `json:"body,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// the longest command line serve-stdio reads, enough for long target lists; longer lines are answered with an error
+const maxStdioLine = 1 << 20
+
+// Reads newline-delimited JSON commands from in until EOF and writes one JSON result per command to out.
+// The client's tokens are reused for every command. Logging stays on stderr so stdout only carries results.
+// Each command is recorded in m, if set.
+func serveStdioCommands(ctx context.Context, in io.Reader, out io.Writer, client *schematics.Client, m *metrics) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxStdioLine)
+	oversized := false
+	scanner.Split(skipLongLines(maxStdioLine, &oversized))
+	encoder := json.NewEncoder(out)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if oversized {
+			oversized = false
+			if err := encoder.Encode(stdioResponse{Error: fmt.Sprintf("request longer than %d bytes", maxStdioLine)}); err != nil {
+				return fmt.Errorf("writing result: %w", err)
+			}
+			continue
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if err := encoder.Encode(handleStdioRequest(ctx, line, client, m)); err != nil {
+			return fmt.Errorf("writing result: %w", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading commands: %w", err)
+	}
+	return nil
+}
+
+// A bufio.SplitFunc like bufio.ScanLines, except that a line of max bytes or more doesn't stop the scanner with
+// bufio.ErrTooLong: it is skipped up to its newline, and then an empty token is returned with *oversized set.
+func skipLongLines(max int, oversized *bool) bufio.SplitFunc {
+	skipping := false
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if !skipping {
+			advance, token, err := bufio.ScanLines(data, atEOF)
+			if advance > 0 || token != nil || err != nil || len(data) < max {
+				return advance, token, err
+			}
+			skipping = true
+		}
+		if i := bytes.IndexByte(data, '\n'); i >= 0 || atEOF {
+			skipping, *oversized = false, true
+			if i < 0 {
+				i = len(data) - 1
+			}
+			return i + 1, []byte{}, nil
+		}
+		return len(data), nil, nil
+	}
+}
+
+// Decodes and runs a single command. Never exits the process.
+func handleStdioRequest(ctx context.Context, line []byte, client *schematics.Client, m *metrics) stdioResponse {
+	var req stdioRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return stdioResponse{Error: "malformed request: " + err.Error()}
+	}
+	result := stdioResponse{ID: req.ID}
+	if !supportedActions[req.Action] {
+		result.Error = unsupportedActionError(req.Action).Error()
+		return result
+	}
+	if req.WorkspaceID == "" {
+		result.Error = "workspace_id is required"
+		return result
+	}
+
+	start := time.Now()
+	resp, err := client.RunActionWithOptions(ctx, req.Action, req.WorkspaceID, schematics.ActionOptions{Targets: req.Options.Targets})
+	if m != nil {
+		observed := runResult{Action: req.Action, WorkspaceID: req.WorkspaceID, ActivityID: resp.ActivityID, StatusCode: resp.StatusCode, Status: resp.Status, Duration: time.Since(start)}
+		if err != nil {
+			observed.Error = formatError(err)
+		}
+		m.observe(observed)
+	}
+	result.OK = err == nil
+	result.ActivityID = resp.ActivityID
+	result.StatusCode = resp.StatusCode
+	result.Status = resp.Status
+	result.Body = string(resp.Body)
+	if err != nil {
+		result.Error = formatError(err)
+		if resp.StatusCode == 0 {
+			logger.Error(result.Error)
+		}
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		result.Error = forbiddenMessage(req.Action, req.WorkspaceID, resp.TransactionID)
+	}
+	return result
+}
+
+// Builds the flag set for the serve-stdio command.
+func serveStdioFlags() (*flag.FlagSet, *globalOptions, *string) {
+	fs := newFlagSet("serve-stdio", "serve-stdio [flags]", "Authenticates once, then reads newline-delimited JSON commands on stdin and writes one JSON result per line on stdout.")
+	global := &globalOptions{}
+	global.register(fs, false)
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on /metrics at this `address`, e.g. :9090")
+	return fs, global, metricsAddr
+}
+
+// `serve-stdio`: runs commands from stdin until EOF, reusing one token.
+func runServeStdioCommand(_ string, args []string) {
+	fs, global, metricsAddr := serveStdioFlags()
+	parseFlags(fs, args)
+	if global.apiKeyStdin {
+		usageError(fs, errors.New("--api-key-stdin cannot be used with serve-stdio, which reads commands from stdin"))
+	}
+	if err := global.validate(false); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	var m *metrics
+	if *metricsAddr != "" {
+		m = newMetrics()
+		client.OnTokenRenewal = m.tokenRenewed
+		serveMetrics(*metricsAddr, m)
+	}
+	if err := serveStdioCommands(ctx, os.Stdin, redactingWriter{os.Stdout}, client, m); err != nil {
+		fatal(err)
+	}
+}
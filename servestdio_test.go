@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"schematics-apply-destroy/pkg/schematics"
+	"schematics-apply-destroy/pkg/schematics/schematicstest"
+)
+
+func TestHandleStdioRequest(t *testing.T) {
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+	srv.SetJobOptions(schematicstest.JobOptions{Polls: 10})
+	client := srv.Client()
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, schematicstest.APIKey); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		line      string
+		wantOK    bool
+		wantCode  int
+		wantError string
+	}{
+		{"apply", `{"id": "1", "action": "apply", "workspace_id": "` + ws.ID + `"}`, true, http.StatusAccepted, ""},
+		// the apply above is still running
+		{"conflict", `{"id": "2", "action": "destroy", "workspace_id": "` + ws.ID + `"}`, false, http.StatusConflict, "409"},
+		{"unknown workspace", `{"id": "3", "action": "plan", "workspace_id": "nope"}`, false, http.StatusNotFound, "404"},
+		{"malformed", `{"action": `, false, 0, "malformed request"},
+		{"unsupported action", `{"id": "4", "action": "teleport", "workspace_id": "` + ws.ID + `"}`, false, 0, "teleport"},
+		{"no workspace", `{"id": "5", "action": "plan"}`, false, 0, "workspace_id is required"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := handleStdioRequest(ctx, []byte(test.line), client, nil)
+			if got.OK != test.wantOK || got.StatusCode != test.wantCode {
+				t.Errorf("response = %+v, want ok %v and status code %d", got, test.wantOK, test.wantCode)
+			}
+			if test.wantError == "" && got.Error != "" {
+				t.Errorf("error = %q, want none", got.Error)
+			}
+			if test.wantError != "" && !strings.Contains(got.Error, test.wantError) {
+				t.Errorf("error = %q, want it to mention %q", got.Error, test.wantError)
+			}
+		})
+	}
+}
+
+func TestStdioRequestOptions(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"activityid": "act-1"}`)
+	}))
+	defer srv.Close()
+	client := schematics.NewClient(schematics.WithHTTPClient(srv.Client()), schematics.WithEndpoints(srv.URL, srv.URL))
+	client.SetTokens("access", "refresh")
+
+	got := handleStdioRequest(context.Background(), []byte(`{"action": "plan", "workspace_id": "ws-1", "options": {"targets": ["module.a", "module.b"]}}`), client, nil)
+	if !got.OK || got.ActivityID != "act-1" {
+		t.Fatalf("response = %+v, want ok with activity act-1", got)
+	}
+	var sent struct {
+		ActionOptions struct {
+			Target []string `json:"target"`
+		} `json:"action_options"`
+	}
+	if err := json.Unmarshal(body, &sent); err != nil {
+		t.Fatalf("request body %q: %v", body, err)
+	}
+	if want := []string{"module.a", "module.b"}; !reflect.DeepEqual(sent.ActionOptions.Target, want) {
+		t.Errorf("targets sent = %q, want %q", sent.ActionOptions.Target, want)
+	}
+}
+
+func TestServeStdioSkipsLongLines(t *testing.T) {
+	long := `{"id": "1", "action": "plan", "workspace_id": "` + strings.Repeat("x", maxStdioLine) + `"}`
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"then more commands", long + "\n" + `{"action": ` + "\n", []string{"request longer than", "malformed request"}},
+		{"at the end", `{"action": ` + "\n" + long, []string{"malformed request", "request longer than"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := serveStdioCommands(context.Background(), strings.NewReader(test.input), &out, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if len(lines) != len(test.want) {
+				t.Fatalf("results = %q, want %d", lines, len(test.want))
+			}
+			for i, line := range lines {
+				var got stdioResponse
+				if err := json.Unmarshal([]byte(line), &got); err != nil {
+					t.Fatal(err)
+				}
+				if got.OK || !strings.Contains(got.Error, test.want[i]) {
+					t.Errorf("result %d = %+v, want an error mentioning %q", i, got, test.want[i])
+				}
+			}
+		})
+	}
+}
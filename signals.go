@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// exit code after SIGINT or SIGTERM, following the shell's 128+SIGINT convention
+const exitInterrupted = 130
+
+// set once SIGINT or SIGTERM arrived; the run then exits with exitInterrupted
+var interrupted atomic.Bool
+
+// the cause of the run's context ending on a signal
+var errInterrupted = errors.New("interrupted")
+
+// Cancels the returned context on the first SIGINT or SIGTERM, so waits stop and report the activity they were
+// following while the exit handlers still flush reports. Jobs already submitted keep running in Schematics.
+// A second signal exits at once.
+func handleSignals(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancelCause(parent)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		interrupted.Store(true)
+		logger.Warn("received " + sig.String() + ", stopping; submitted jobs keep running in Schematics (signal again to exit at once)")
+		cancel(errInterrupted)
+		<-signals
+		os.Exit(exitInterrupted)
+	}()
+	return ctx
+}
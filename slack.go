@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// Posts a message to a Slack incoming webhook when an apply or destroy finishes.
+type slackNotifier struct {
+	client *http.Client
+	url    string
+}
+
+// the body of a Slack incoming webhook: text is the notification fallback, blocks what the channel shows
+type slackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type   string      `json:"type"`
+	Text   *slackText  `json:"text,omitempty"`
+	Fields []slackText `json:"fields,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Checks the --slack-webhook URL. It is treated as a secret, since anyone holding it can post to the channel.
+func newSlackNotifier(rawURL string) (*slackNotifier, error) {
+	if _, ok := webhookHost(rawURL, false); !ok {
+		return nil, errors.New("--slack-webhook: must be an https URL such as https://hooks.slack.com/services/...")
+	}
+	addSecret(rawURL)
+	return &slackNotifier{url: rawURL}, nil
+}
+
+// Posts the outcome of an apply or destroy step. Other actions and skipped steps are not posted, and failures to
+// post are only logged.
+func (s *slackNotifier) notify(ctx context.Context, client *schematics.Client, result runResult) {
+	if result.Skipped || (result.Action != "apply" && result.Action != "destroy") {
+		return
+	}
+	name := result.WorkspaceID
+	if ws, err := client.GetWorkspace(ctx, result.WorkspaceID); err == nil && ws.Name != "" {
+		name = ws.Name
+	}
+	if err := s.post(ctx, slackMessageFor(result, name)); err != nil {
+		logger.Warn("Slack notification failed", "error", formatError(err))
+	}
+}
+
+// Builds the message for result in workspace name.
+func slackMessageFor(result runResult, name string) slackMessage {
+	icon, outcome := ":white_check_mark:", "succeeded"
+	switch {
+	case result.failed():
+		icon, outcome = ":x:", "failed"
+	case result.JobStatus == "":
+		icon, outcome = ":hourglass_flowing_sand:", "was submitted"
+	}
+	headline := fmt.Sprintf("%s %s of *%s* %s", icon, result.Action, slackEscape(name), outcome)
+	fields := []slackText{
+		{Type: "mrkdwn", Text: "*Workspace*\n" + slackEscape(name)},
+		{Type: "mrkdwn", Text: "*Result*\n" + stepStatus(result)},
+		{Type: "mrkdwn", Text: "*Duration*\n" + result.Duration.Round(time.Second).String()},
+		{Type: "mrkdwn", Text: "*Activity*\n" + orDash(result.ActivityID)},
+	}
+	blocks := []slackBlock{
+		{Type: "section", Text: &slackText{Type: "mrkdwn", Text: headline}},
+		{Type: "section", Fields: fields},
+	}
+	if result.Error != "" {
+		blocks = append(blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "```" + slackEscape(redactString(result.Error)) + "```"}})
+	}
+	blocks = append(blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "<" + consoleURL(result.WorkspaceID) + "|Open in the IBM Cloud console>"}})
+	return slackMessage{Text: fmt.Sprintf("%s of %s %s", result.Action, name, outcome), Blocks: blocks}
+}
+
+func (s *slackNotifier) post(ctx context.Context, message slackMessage) error {
+	resp, text, err := postJSON(ctx, s.client, s.url, message, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Slack answered %s: %s", resp.Status, strings.TrimSpace(string(text)))
+	}
+	return nil
+}
+
+// Escapes the characters Slack's mrkdwn gives a meaning to.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// the commands under `state`
+func stateCommands() []command {
+	return []command{
+		{name: "pull", summary: "download the workspace's Terraform state to a file or stdout", run: runStatePullCommand, flags: func(name string) *flag.FlagSet {
+			fs, _, _ := statePullFlags(name)
+			return fs
+		}},
+	}
+}
+
+// Builds the flag set for `state pull`.
+func statePullFlags(name string) (*flag.FlagSet, *globalOptions, *string) {
+	fs := newFlagSet(name, name+" <workspace-id> [flags]", "Downloads the Terraform state of a Schematics workspace. The id may also be given with --workspace-id or --crn. The state is written as Schematics returns it and may hold secrets.")
+	global := &globalOptions{}
+	global.register(fs, true)
+	out := fs.String("out", "", "write the state to this file, created with mode 0600, instead of stdout")
+	return fs, global, out
+}
+
+// `state pull <id>`: writes the workspace's state to --out or stdout.
+func runStatePullCommand(name string, args []string) {
+	fs, global, out := statePullFlags(name)
+	switch rest := parseFlagsArgs(fs, args); len(rest) {
+	case 0:
+	case 1:
+		global.workspaceID = rest[0]
+	default:
+		usageError(fs, fmt.Errorf("unexpected argument %q", rest[1]))
+	}
+	if err := global.validate(true); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	state, err := client.GetState(ctx, global.workspaceID)
+	if err != nil {
+		fatal(err)
+	}
+	if *out == "" {
+		if _, err := os.Stdout.Write(state); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if err := os.WriteFile(*out, state, 0600); err != nil {
+		fatal(fmt.Errorf("writing state: %w", err))
+	}
+	logger.Info("wrote state", "workspace", global.workspaceID, "path", *out, "bytes", len(state))
+}
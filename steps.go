@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// workspace actions the tool can submit
+var supportedActions = map[string]bool{
+	"apply":   true,
+	"destroy": true,
+	"plan":    true,
+	"refresh": true,
+}
+
+// Error for an action name that isn't in supportedActions.
+func unsupportedActionError(action string) error {
+	var names []string
+	for name := range supportedActions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unsupported action %q: must be one of %s", action, strings.Join(names, ", "))
+}
+
+// Splits a comma-separated action list such as `apply,destroy` and checks every entry is supported.
+func parseActions(list string) ([]string, error) {
+	var actions []string
+	for _, action := range strings.Split(list, ",") {
+		action = strings.TrimSpace(action)
+		if !supportedActions[action] {
+			return nil, unsupportedActionError(action)
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// settings shared by every step of a run
+type stepOptions struct {
+	ContinueOnFailure   bool
+	WaitForReady        bool
+	WaitForReadyTimeout time.Duration
+	// allow destroying a workspace whose last run FAILED
+	FromFailed bool
+	// skip apply when the last successful apply is newer than this; 0 disables the check
+	OnlyIfOlderThan time.Duration
+	// wait for each submitted job to finish, checking every PollInterval
+	Wait         bool
+	PollInterval time.Duration
+	// when Schematics refuses an action because the same action is already running, wait for that job instead
+	Attach bool
+	// with Wait, stop waiting on a job after this long, leaving it running; 0 waits as long as the run may last
+	JobTimeout time.Duration
+	// measures PollInterval and JobTimeout; the wall clock when nil
+	Clock schematics.Clock
+	// with Wait, print the job's Terraform output to LogOutput as it runs
+	FollowLogs bool
+	LogOutput  io.Writer
+	// with Wait, redraw a status line with the job's phase on LogOutput, which the caller checked is a terminal
+	Progress bool
+	// fold each job's followed output into a GitHub Actions log group
+	LogGroups bool
+	// Terraform resource addresses every job is limited to; all resources when empty
+	Targets []string
+	// before apply, plan first and refuse when the estimated monthly cost rises by more than this; nil disables it
+	MaxCostIncrease *float64
+	// fail a plan, and refuse an apply after planning first, when the plan destroys more resources than
+	// MaxDestroy or doesn't add, change and destroy exactly ExpectChanges in total; nil disables each
+	MaxDestroy    *int
+	ExpectChanges *int
+	// before apply, plan first, show what the plan changes and the apply request, and ask Confirm whether to go on;
+	// a nil Confirm applies without asking, as --auto-approve does
+	Review  bool
+	Confirm func(question string) bool
+	// where Review shows the plan and the apply request, whatever the log level, so --quiet cannot hide what is
+	// being approved; os.Stderr when nil
+	ReviewOutput io.Writer
+	// called as soon as each step finishes, if set
+	OnResult func(runResult)
+	// called, if set, when a job is submitted and when --wait first sees it running
+	OnJobEvent func(event string, result runResult)
+	// called, if set, after every status check of a job --wait follows, with the status in result.JobStatus and
+	// how long the job has been waited on by Clock
+	OnPoll func(result runResult, elapsed time.Duration)
+}
+
+// Runs each action in order against the workspace with the client's tokens.
+// Stops after the first failed step unless opts.ContinueOnFailure is set, and logs a per-step summary for multi-step runs.
+func runSteps(ctx context.Context, client *schematics.Client, actions []string, schematicsWorkspaceID string, opts stepOptions) []runResult {
+	var results []runResult
+	for _, action := range actions {
+		if ctx.Err() != nil && interrupted.Load() {
+			break
+		}
+		stepCtx, span := startSpan(ctx, action, "schematics.workspace_id", schematicsWorkspaceID)
+		result := runStep(stepCtx, client, action, schematicsWorkspaceID, opts)
+		span.set("schematics.activity_id", result.ActivityID)
+		span.set("schematics.status", stepStatus(result))
+		if result.failed() {
+			span.finish(errors.New(orDash(result.Error)))
+		} else {
+			span.finish(nil)
+		}
+		results = append(results, result)
+		if opts.OnResult != nil {
+			opts.OnResult(result)
+		}
+		if result.StatusCode == http.StatusForbidden {
+			logger.Error(forbiddenMessage(action, schematicsWorkspaceID, result.TransactionID))
+		}
+		if result.failed() && !opts.ContinueOnFailure {
+			break
+		}
+	}
+
+	if len(actions) > 1 {
+		logger.Info("steps:")
+		for i, action := range actions {
+			if i >= len(results) {
+				logger.Info(fmt.Sprintf("  %d/%d %s: skipped", i+1, len(actions), action))
+				continue
+			}
+			outcome := results[i].Status
+			if results[i].Error != "" {
+				outcome = results[i].Error
+			}
+			logger.Info(fmt.Sprintf("  %d/%d %s: %s", i+1, len(actions), action, outcome))
+		}
+	}
+	return results
+}
+
+// Runs a single action after the pre-flight checks: a frozen or FAILED workspace, another activity still running
+// before a destroy, and a recent successful apply when --only-if-older-than is set.
+func runStep(ctx context.Context, client *schematics.Client, action string, schematicsWorkspaceID string, opts stepOptions) runResult {
+	ws, err := client.GetWorkspace(ctx, schematicsWorkspaceID)
+	if err != nil {
+		return preflightFailed(action, schematicsWorkspaceID, err)
+	}
+	if ws.ID == "" {
+		ws.ID = schematicsWorkspaceID
+	}
+	if err := checkFrozenWorkspace(ws, action); err != nil {
+		return preflightFailed(action, schematicsWorkspaceID, err)
+	}
+	if err := checkFailedWorkspace(ctx, client, action, ws, opts.FromFailed); err != nil {
+		return preflightFailed(action, schematicsWorkspaceID, err)
+	}
+
+	if action == "destroy" {
+		if err := ensureWorkspaceIdle(ctx, client, action, schematicsWorkspaceID, opts.WaitForReady, opts.WaitForReadyTimeout); err != nil {
+			return preflightFailed(action, schematicsWorkspaceID, err)
+		}
+	}
+
+	if action == "apply" && opts.OnlyIfOlderThan > 0 {
+		recent, err := recentlyApplied(ctx, client, schematicsWorkspaceID, opts.OnlyIfOlderThan)
+		if err != nil {
+			return preflightFailed(action, schematicsWorkspaceID, err)
+		}
+		if recent {
+			logger.Info("recently applied; skipping apply", "only_if_older_than", opts.OnlyIfOlderThan)
+			return runResult{Action: action, WorkspaceID: schematicsWorkspaceID, Status: "skipped: recently applied", Skipped: true}
+		}
+	}
+
+	var cost *schematics.CostEstimate
+	if action == "apply" && (opts.MaxCostIncrease != nil || opts.checksChanges() || opts.Review) {
+		plan, err := planForApply(ctx, client, schematicsWorkspaceID, opts)
+		if err != nil {
+			return preflightFailed(action, schematicsWorkspaceID, err)
+		}
+		if opts.MaxCostIncrease != nil {
+			if plan.Cost == nil {
+				return preflightFailed(action, schematicsWorkspaceID, fmt.Errorf("plan %s has no cost estimate, so --max-cost-increase cannot be checked", plan.ActivityID))
+			}
+			if estimate := *plan.Cost; estimate.Delta > *opts.MaxCostIncrease {
+				result := preflightFailed(action, schematicsWorkspaceID, fmt.Errorf("estimated monthly cost increase of %.2f %s exceeds --max-cost-increase %.2f; refusing to apply",
+					estimate.Delta, estimate.Currency, *opts.MaxCostIncrease))
+				result.Cost = &estimate
+				return result
+			}
+			cost = plan.Cost
+		}
+		if opts.checksChanges() {
+			if err := checkPlanChanges(plan, opts); err != nil {
+				result := preflightFailed(action, schematicsWorkspaceID, fmt.Errorf("%w; refusing to apply", err))
+				result.Plan = plan.Plan
+				result.ChangesRefused = plan.Plan != nil
+				return result
+			}
+		}
+		if opts.Review && !reviewApply(client, schematicsWorkspaceID, plan, opts) {
+			logger.Error("not confirmed; nothing was applied")
+			return runResult{Action: action, WorkspaceID: schematicsWorkspaceID, Plan: plan.Plan, Error: "apply not confirmed"}
+		}
+	}
+
+	start := time.Now()
+	result := clusterCreateOrDestroy(ctx, client, action, schematicsWorkspaceID, opts.Targets)
+	result.Cost = cost
+	attached := opts.Attach && attachToRunning(&result)
+	if result.RunningActivityID != "" && !attached {
+		if strings.EqualFold(result.RunningAction, action) {
+			logger.Error(fmt.Sprintf("rerun with --attach to wait for activity %s instead of failing", result.RunningActivityID))
+		} else {
+			logger.Error(fmt.Sprintf("%s activity %s must finish before %s can run", result.RunningAction, result.RunningActivityID, action))
+		}
+	}
+	if opts.OnJobEvent != nil && !result.failed() && !attached {
+		opts.OnJobEvent(eventSubmitted, result)
+	}
+	if (opts.Wait || attached) && !result.failed() {
+		waitForJob(ctx, client, &result, opts)
+	}
+	if action == "plan" && opts.checksChanges() && !result.failed() {
+		if err := checkPlanChanges(result, opts); err != nil {
+			logger.Error(formatError(err), "workspace", schematicsWorkspaceID, "activity", result.ActivityID)
+			result.Error = formatError(err)
+			result.ChangesRefused = result.Plan != nil
+		}
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// Reports whether --max-destroy or --expect-changes is set.
+func (opts stepOptions) checksChanges() bool {
+	return opts.MaxDestroy != nil || opts.ExpectChanges != nil
+}
+
+// Checks the change counts of the finished plan against --max-destroy and --expect-changes.
+func checkPlanChanges(plan runResult, opts stepOptions) error {
+	if plan.Plan == nil {
+		return fmt.Errorf("plan %s has no summary of its changes, so --max-destroy and --expect-changes cannot be checked", plan.ActivityID)
+	}
+	summary := *plan.Plan
+	if opts.MaxDestroy != nil && summary.Destroy > *opts.MaxDestroy {
+		return fmt.Errorf("plan %s destroys %d resources, more than --max-destroy %d", plan.ActivityID, summary.Destroy, *opts.MaxDestroy)
+	}
+	if total := summary.Add + summary.Change + summary.Destroy; opts.ExpectChanges != nil && total != *opts.ExpectChanges {
+		return fmt.Errorf("plan %s makes %d changes (%s), not the --expect-changes %d", plan.ActivityID, total, summary, *opts.ExpectChanges)
+	}
+	return nil
+}
+
+// the longest a single job status check of --wait may take before the wait fails
+const statusCheckTimeout = time.Minute
+
+// Polls the job behind result until it finishes and records its final status on result.
+// Status changes are logged as they are seen, and new Terraform output is printed with opts.FollowLogs.
+func waitForJob(ctx context.Context, client *schematics.Client, result *runResult, opts stepOptions) {
+	if result.ActivityID == "" {
+		result.Error = "Schematics did not return an activity id to wait on"
+		logger.Error(result.Error)
+		return
+	}
+	logger.Info("waiting for job", "action", result.Action, "activity", result.ActivityID)
+	ctx, span := startSpan(ctx, "wait for "+result.Action, "schematics.activity_id", result.ActivityID)
+	defer func() {
+		span.set("schematics.job_status", result.JobStatus)
+		switch {
+		case result.Error != "":
+			span.finish(errors.New(result.Error))
+		case result.JobStatus != "COMPLETED":
+			span.finish(fmt.Errorf("job finished with status %s", orDash(result.JobStatus)))
+		default:
+			span.finish(nil)
+		}
+	}()
+	if opts.FollowLogs && opts.LogGroups {
+		fmt.Fprintf(opts.LogOutput, "::group::%s %s (%s)\n", result.Action, result.WorkspaceID, result.ActivityID)
+		defer fmt.Fprintln(opts.LogOutput, "::endgroup::")
+	}
+	now := time.Now
+	if opts.Clock != nil {
+		now = opts.Clock.Now
+	}
+	started := now()
+	lastStatus := ""
+	follower := &logFollower{client: client, workspaceID: result.WorkspaceID, activityID: result.ActivityID, out: opts.LogOutput}
+	var progress *progressLine
+	if opts.Progress {
+		progress = startProgress(opts.LogOutput, result.Action, result.ActivityID, time.Now())
+		follower.out = progress
+	}
+	activity, err := client.WaitForActivity(ctx, result.WorkspaceID, result.ActivityID, schematics.WaitOptions{
+		Interval:    opts.PollInterval,
+		Timeout:     opts.JobTimeout,
+		PollTimeout: statusCheckTimeout,
+		Clock:       opts.Clock,
+		OnPoll: func(activity schematics.Activity) {
+			terminal := schematics.IsTerminalStatus(activity.Status)
+			if opts.FollowLogs {
+				follower.poll(ctx, terminal)
+			}
+			if progress != nil && terminal {
+				progress.finish()
+			} else if progress != nil {
+				progress.update(activity, progressLogs(ctx, client, result.Action, follower, activity, opts.FollowLogs))
+			}
+			if activity.Status != lastStatus {
+				if progress == nil || terminal {
+					logger.Info("job status", "activity", activity.ActionID, "status", activity.Status)
+				}
+				if activity.Status == "INPROGRESS" && opts.OnJobEvent != nil {
+					started := *result
+					started.JobStatus = activity.Status
+					opts.OnJobEvent(eventStarted, started)
+				}
+				lastStatus = activity.Status
+			}
+			if opts.OnPoll != nil {
+				polled := *result
+				polled.JobStatus = activity.Status
+				opts.OnPoll(polled, now().Sub(started))
+			}
+		},
+	})
+	if progress != nil {
+		progress.finish()
+	}
+	result.JobStatus = activity.Status
+	switch {
+	case err != nil && interrupted.Load():
+		result.Error = "interrupted while waiting"
+		logger.Warn(fmt.Sprintf("stopped waiting for %s; the job keeps running, follow it with `%s job status %s %s --watch`", result.Action, programName(), result.WorkspaceID, result.ActivityID),
+			"workspace", result.WorkspaceID, "activity", result.ActivityID)
+		return
+	case err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded):
+		result.Error = fmt.Sprintf("job still %s after --job-timeout %s", orDash(lastStatus), opts.JobTimeout)
+		logger.Error(result.Error+"; it keeps running in Schematics", "workspace", result.WorkspaceID, "activity", result.ActivityID)
+		return
+	}
+	if err != nil {
+		if isNetworkUnreachable(err) {
+			fatal(err)
+		}
+		result.Error = formatError(err)
+		logger.Error(result.Error)
+		return
+	}
+	if activity.Status != "COMPLETED" {
+		logger.Error(fmt.Sprintf("%s job finished with status %s", result.Action, activity.Status), "activity", result.ActivityID, "message", activity.Message)
+		return
+	}
+	if result.Action == "plan" {
+		printPlanSummary(ctx, client, result)
+		printCostEstimate(ctx, client, result)
+	}
+}
+
+// The Terraform output the status line reads the resource count from: what the follower last fetched, or else
+// a fresh copy while an apply or destroy runs.
+func progressLogs(ctx context.Context, client *schematics.Client, action string, follower *logFollower, activity schematics.Activity, following bool) string {
+	if following {
+		return follower.logs
+	}
+	if activity.Status != "INPROGRESS" || (action != "apply" && action != "destroy") {
+		return ""
+	}
+	logs, err := client.GetActivityLogs(ctx, follower.workspaceID, follower.activityID)
+	if err != nil {
+		logger.Debug(formatError(err))
+		return ""
+	}
+	return logs
+}
+
+// Fetches the finished plan's cost estimate and prints it, recording it on result. Not every workspace has one,
+// so a missing estimate is only logged at debug level.
+func printCostEstimate(ctx context.Context, client *schematics.Client, result *runResult) {
+	estimate, err := client.GetCostEstimate(ctx, result.ActivityID)
+	if err != nil {
+		logger.Debug("no cost estimate", "error", formatError(err))
+		return
+	}
+	result.Cost = &estimate
+	logger.Info("Estimated cost: " + estimate.String())
+}
+
+// Runs a plan against the workspace and waits for it, for --review and the checks --max-cost-increase,
+// --max-destroy and --expect-changes make before apply. The plan's result carries its summary and cost estimate.
+func planForApply(ctx context.Context, client *schematics.Client, schematicsWorkspaceID string, opts stepOptions) (runResult, error) {
+	logger.Info("planning before apply", "workspace", schematicsWorkspaceID)
+	plan := clusterCreateOrDestroy(ctx, client, "plan", schematicsWorkspaceID, opts.Targets)
+	if !plan.failed() {
+		// the plan is internal to the apply step, so it sends no job notifications of its own; heartbeats still
+		// go out while it runs
+		planOpts := opts
+		planOpts.OnJobEvent = nil
+		planOpts.OnResult = nil
+		waitForJob(ctx, client, &plan, planOpts)
+	}
+	if plan.failed() {
+		return plan, fmt.Errorf("plan %s before apply did not complete", plan.ActivityID)
+	}
+	return plan, nil
+}
+
+// Shows what plan changes and the apply request that follows it on opts.ReviewOutput, and reports whether
+// opts.Confirm agrees to send it.
+func reviewApply(client *schematics.Client, schematicsWorkspaceID string, plan runResult, opts stepOptions) bool {
+	req, err := client.ActionRequest("apply", schematicsWorkspaceID, schematics.ActionOptions{Targets: opts.Targets})
+	if err != nil {
+		logger.Error(formatError(err))
+		return false
+	}
+	out := opts.ReviewOutput
+	if out == nil {
+		out = os.Stderr
+	}
+	out = redactingWriter{out}
+	changes := "the unknown changes of plan " + plan.ActivityID
+	if plan.Plan != nil {
+		changes = plan.Plan.String()
+		fmt.Fprintf(out, "Plan: %s\n", changes)
+		for _, change := range plan.Plan.Resources {
+			fmt.Fprintf(out, "  %s %s\n", change.Symbol(), change.Address)
+		}
+	} else {
+		fmt.Fprintf(out, "Plan %s has no summary of its changes\n", plan.ActivityID)
+	}
+	fmt.Fprintf(out, "Apply request: %s %s\n", req.Method, req.URL)
+	if req.Body != nil {
+		fmt.Fprintf(out, "  %s\n", req.Body)
+	}
+	if opts.Confirm == nil {
+		return true
+	}
+	return opts.Confirm(fmt.Sprintf("Apply %s to workspace %s?", changes, schematicsWorkspaceID))
+}
+
+// Reads what the finished plan changes, preferring the JSON plan and falling back to the job logs, then prints
+// the change counts and resources and records them on result. A missing summary is only logged; the plan itself
+// still succeeded.
+func printPlanSummary(ctx context.Context, client *schematics.Client, result *runResult) {
+	summary, err := planSummaryFromJSON(ctx, client, result.ActivityID)
+	if err != nil {
+		logger.Debug("no JSON plan, reading the job logs instead", "error", formatError(err))
+		logs, err := client.GetActivityLogs(ctx, result.WorkspaceID, result.ActivityID)
+		if err != nil {
+			logger.Warn(formatError(err))
+			return
+		}
+		var ok bool
+		if summary, ok = schematics.ParsePlanSummary(logs); !ok {
+			logger.Warn("no plan summary found in the job logs", "activity", result.ActivityID)
+			return
+		}
+	}
+	result.Plan = &summary
+	logger.Info(fmt.Sprintf("Plan: %s", summary))
+	for _, change := range summary.Resources {
+		logger.Info(fmt.Sprintf("  %s %s", change.Symbol(), change.Address))
+	}
+}
+
+// Fetches the JSON plan of the finished plan job activityID and summarizes its resource changes.
+func planSummaryFromJSON(ctx context.Context, client *schematics.Client, activityID string) (schematics.PlanSummary, error) {
+	plan, err := client.GetPlanJSON(ctx, activityID)
+	if err != nil {
+		return schematics.PlanSummary{}, err
+	}
+	return schematics.ParsePlanJSON(plan)
+}
+
+// Records a failed pre-flight check as the step's result. Network-unreachable errors are still fatal, and a 403
+// names the role the identity lacks, as for a refused submit.
+func preflightFailed(action string, schematicsWorkspaceID string, err error) runResult {
+	if isNetworkUnreachable(err) {
+		fatal(err)
+	}
+	logger.Error(formatError(err))
+	result := runResult{Action: action, WorkspaceID: schematicsWorkspaceID, Error: formatError(err)}
+	// the checks only read the workspace, so a 403 here means the identity cannot even see it
+	var apiErr *schematics.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden {
+		result.TransactionID = apiErr.TransactionID
+		result.Error = forbiddenMessage("read", schematicsWorkspaceID, apiErr.TransactionID)
+		logger.Error(result.Error)
+	}
+	return result
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+	"schematics-apply-destroy/pkg/schematics/schematicstest"
+)
+
+// Sends the logger's output nowhere for the test.
+func discardLogs(t *testing.T) {
+	saved := logger
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	t.Cleanup(func() { logger = saved })
+}
+
+// Submits an apply to a fake server whose jobs run as job says, and returns the client and the step's result.
+func fakeApply(t *testing.T, job schematicstest.JobOptions) (*schematics.Client, runResult) {
+	discardLogs(t)
+	srv := schematicstest.NewServer()
+	t.Cleanup(srv.Close)
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+	srv.SetJobOptions(job)
+	client := srv.Client()
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, schematicstest.APIKey); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Apply(ctx, ws.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, runResult{Action: "apply", WorkspaceID: ws.ID, ActivityID: resp.ActivityID, StatusCode: resp.StatusCode}
+}
+
+func TestWaitForJobInterval(t *testing.T) {
+	client, result := fakeApply(t, schematicstest.JobOptions{Polls: 2})
+	clock := schematicstest.NewClock(time.Now())
+	var events []string
+	waitForJob(context.Background(), client, &result, stepOptions{
+		PollInterval: 30 * time.Second,
+		Clock:        clock,
+		OnJobEvent:   func(event string, r runResult) { events = append(events, event+" "+r.JobStatus) },
+	})
+	if result.JobStatus != "COMPLETED" || result.Error != "" {
+		t.Errorf("result = %+v, want a COMPLETED job", result)
+	}
+	if want := []time.Duration{30 * time.Second, 30 * time.Second}; !reflect.DeepEqual(clock.Sleeps(), want) {
+		t.Errorf("slept %v, want %v", clock.Sleeps(), want)
+	}
+	if want := []string{eventStarted + " INPROGRESS"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
+
+func TestWaitForJobTimeout(t *testing.T) {
+	client, result := fakeApply(t, schematicstest.JobOptions{Polls: 100})
+	clock := schematicstest.NewClock(time.Now())
+	waitForJob(context.Background(), client, &result, stepOptions{PollInterval: 10 * time.Second, JobTimeout: 25 * time.Second, Clock: clock})
+	if want := "job still INPROGRESS after --job-timeout 25s"; result.Error != want {
+		t.Errorf("error = %q, want %q", result.Error, want)
+	}
+	if result.JobStatus != "INPROGRESS" || !result.failed() {
+		t.Errorf("result = %+v, want a failed step with the job INPROGRESS", result)
+	}
+	if want := []time.Duration{10 * time.Second, 10 * time.Second, 5 * time.Second}; !reflect.DeepEqual(clock.Sleeps(), want) {
+		t.Errorf("slept %v, want %v", clock.Sleeps(), want)
+	}
+}
+
+func TestWaitForJobTerminalStates(t *testing.T) {
+	for _, status := range []string{"COMPLETED", "FAILED", "STOPPED"} {
+		t.Run(status, func(t *testing.T) {
+			client, result := fakeApply(t, schematicstest.JobOptions{Status: status, Polls: 1})
+			clock := schematicstest.NewClock(time.Now())
+			waitForJob(context.Background(), client, &result, stepOptions{PollInterval: time.Second, JobTimeout: time.Hour, Clock: clock})
+			if result.JobStatus != status || result.Error != "" {
+				t.Errorf("result = %+v, want job status %s and no error", result, status)
+			}
+			if result.failed() != (status != "COMPLETED") {
+				t.Errorf("failed() = %v for a %s job", result.failed(), status)
+			}
+			if len(clock.Sleeps()) != 1 {
+				t.Errorf("slept %v, want one interval", clock.Sleeps())
+			}
+		})
+	}
+}
+
+func TestCheckPlanChanges(t *testing.T) {
+	zero, one, three := 0, 1, 3
+	tests := []struct {
+		name    string
+		plan    *schematics.PlanSummary
+		opts    stepOptions
+		wantErr string
+	}{
+		{"within max destroy", &schematics.PlanSummary{Add: 2, Destroy: 1}, stepOptions{MaxDestroy: &one}, ""},
+		{"over max destroy", &schematics.PlanSummary{Add: 2, Destroy: 1}, stepOptions{MaxDestroy: &zero}, "plan act-1 destroys 1 resources, more than --max-destroy 0"},
+		{"expected changes", &schematics.PlanSummary{Add: 1, Change: 1, Destroy: 1}, stepOptions{ExpectChanges: &three}, ""},
+		{"unexpected changes", &schematics.PlanSummary{Add: 1}, stepOptions{ExpectChanges: &three},
+			"plan act-1 makes 1 changes (1 to add, 0 to change, 0 to destroy), not the --expect-changes 3"},
+		{"no changes expected", &schematics.PlanSummary{}, stepOptions{MaxDestroy: &zero, ExpectChanges: &zero}, ""},
+		{"both checked", &schematics.PlanSummary{Destroy: 1}, stepOptions{MaxDestroy: &one, ExpectChanges: &zero}, "not the --expect-changes 0"},
+		{"no summary", nil, stepOptions{MaxDestroy: &zero}, "plan act-1 has no summary of its changes"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkPlanChanges(runResult{ActivityID: "act-1", Plan: test.plan}, test.opts)
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Errorf("error = %v, want none", err)
+			case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+				t.Errorf("error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyRefusedByMaxDestroy(t *testing.T) {
+	discardLogs(t)
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+	srv.SetJobOptions(schematicstest.JobOptions{Logs: "Plan: 1 to add, 0 to change, 2 to destroy."})
+	client := srv.Client()
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, schematicstest.APIKey); err != nil {
+		t.Fatal(err)
+	}
+	zero := 0
+	results := runSteps(ctx, client, []string{"apply"}, ws.ID, stepOptions{MaxDestroy: &zero, PollInterval: time.Millisecond})
+	if len(results) != 1 || !results[0].ChangesRefused || !strings.Contains(results[0].Error, "more than --max-destroy 0; refusing to apply") {
+		t.Fatalf("results = %+v, want the apply refused", results)
+	}
+	if activities := srv.Activities(ws.ID); len(activities) != 1 || activities[0].Name != "PLAN" {
+		t.Errorf("submitted %+v, want only the plan", activities)
+	}
+	if code := exitCodeFor(results); code != exitChangesPending {
+		t.Errorf("exit code = %d, want %d", code, exitChangesPending)
+	}
+}
+
+func TestApplyMaxCostIncrease(t *testing.T) {
+	tests := []struct {
+		name        string
+		cost        string
+		wantRefused bool
+	}{
+		// 0 is a limit like any other, not a way to turn the check off
+		{"increase over 0", `{"totalMonthlyCost": "12.50", "pastTotalMonthlyCost": "10"}`, true},
+		{"no increase", `{"totalMonthlyCost": "10", "pastTotalMonthlyCost": "10"}`, false},
+		{"decrease", `{"totalMonthlyCost": "8", "pastTotalMonthlyCost": "10"}`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			discardLogs(t)
+			srv := schematicstest.NewServer()
+			defer srv.Close()
+			ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+			srv.SetJobOptions(schematicstest.JobOptions{CostEstimateJSON: test.cost})
+			client := srv.Client()
+			ctx := context.Background()
+			if err := client.Authenticate(ctx, schematicstest.APIKey); err != nil {
+				t.Fatal(err)
+			}
+			zero := 0.0
+			results := runSteps(ctx, client, []string{"apply"}, ws.ID, stepOptions{MaxCostIncrease: &zero, PollInterval: time.Millisecond})
+			if len(results) != 1 || results[0].failed() != test.wantRefused {
+				t.Fatalf("results = %+v, want refused %v", results, test.wantRefused)
+			}
+			if test.wantRefused && !strings.Contains(results[0].Error, "exceeds --max-cost-increase 0.00; refusing to apply") {
+				t.Errorf("error = %q, want the apply refused", results[0].Error)
+			}
+			want := 2
+			if test.wantRefused {
+				want = 1
+			}
+			if activities := srv.Activities(ws.ID); len(activities) != want {
+				t.Errorf("submitted %+v, want %d jobs", activities, want)
+			}
+		})
+	}
+}
+
+func TestOptionalAmount(t *testing.T) {
+	var amount *float64
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(optionalAmount{&amount}, "max", "")
+	if err := fs.Parse(nil); err != nil || amount != nil {
+		t.Fatalf("unset: amount = %v, err = %v, want nil", amount, err)
+	}
+	if err := fs.Parse([]string{"--max", "0"}); err != nil || amount == nil || *amount != 0 {
+		t.Fatalf("--max 0: amount = %v, err = %v, want 0", amount, err)
+	}
+	for _, value := range []string{"-1", "NaN", "Inf", "lots"} {
+		if err := fs.Parse([]string{"--max", value}); err == nil {
+			t.Errorf("--max %s accepted", value)
+		}
+	}
+}
+
+func TestExitCodeForRefusedChanges(t *testing.T) {
+	refused := runResult{Action: "plan", Error: "plan act-1 destroys 1 resources, more than --max-destroy 0", ChangesRefused: true}
+	failed := runResult{Action: "apply", Error: "job failed"}
+	ok := runResult{Action: "apply", StatusCode: 202}
+	tests := []struct {
+		results []runResult
+		want    int
+	}{
+		{[]runResult{ok, refused}, exitChangesPending},
+		{[]runResult{refused, failed}, exitFailed},
+		{[]runResult{failed, refused}, exitFailed},
+		{[]runResult{ok}, exitOK},
+	}
+	for _, test := range tests {
+		if got := exitCodeFor(test.results); got != test.want {
+			t.Errorf("exitCodeFor(%+v) = %d, want %d", test.results, got, test.want)
+		}
+	}
+}
+
+func TestApplyReview(t *testing.T) {
+	tests := []struct {
+		name        string
+		autoApprove bool
+		answer      bool
+		wantNames   []string // most recent first
+		wantFailed  bool
+	}{
+		{"confirmed", false, true, []string{"APPLY", "PLAN"}, false},
+		{"declined", false, false, []string{"PLAN"}, true},
+		{"auto-approved", true, false, []string{"APPLY", "PLAN"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			discardLogs(t)
+			srv := schematicstest.NewServer()
+			defer srv.Close()
+			ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+			srv.SetJobOptions(schematicstest.JobOptions{Logs: "Plan: 2 to add, 0 to change, 0 to destroy."})
+			client := srv.Client()
+			ctx := context.Background()
+			if err := client.Authenticate(ctx, schematicstest.APIKey); err != nil {
+				t.Fatal(err)
+			}
+			var questions []string
+			var review strings.Builder
+			opts := stepOptions{Review: true, PollInterval: time.Millisecond, ReviewOutput: &review}
+			if !test.autoApprove {
+				opts.Confirm = func(question string) bool {
+					questions = append(questions, question)
+					return test.answer
+				}
+			}
+
+			results := runSteps(ctx, client, []string{"apply"}, ws.ID, opts)
+			if len(results) != 1 || results[0].failed() != test.wantFailed {
+				t.Fatalf("results = %+v, want failed %v", results, test.wantFailed)
+			}
+			var names []string
+			for _, activity := range srv.Activities(ws.ID) {
+				names = append(names, activity.Name)
+			}
+			if !reflect.DeepEqual(names, test.wantNames) {
+				t.Errorf("submitted %q, want %q", names, test.wantNames)
+			}
+			if want := "Apply 2 to add, 0 to change, 0 to destroy to workspace " + ws.ID + "?"; !test.autoApprove && !reflect.DeepEqual(questions, []string{want}) {
+				t.Errorf("asked %q, want %q", questions, want)
+			}
+			// shown even though the logs are discarded, as with --quiet
+			want := "Plan: 2 to add, 0 to change, 0 to destroy\nApply request: PUT "
+			if !strings.HasPrefix(review.String(), want) || !strings.Contains(review.String(), "/v1/workspaces/"+ws.ID+"/apply") {
+				t.Errorf("review = %q, want the plan and the apply request", review.String())
+			}
+		})
+	}
+}
+
+func TestForbiddenMessageRoles(t *testing.T) {
+	for action, role := range map[string]string{"plan": "Writer", "refresh": "Writer", "apply": "Manager", "destroy": "Manager", "read": "Reader"} {
+		if msg := forbiddenMessage(action, "ws1", ""); !strings.Contains(msg, " "+role+" service access role to "+action+" ") {
+			t.Errorf("forbiddenMessage(%q) = %q, want the %s role", action, msg, role)
+		}
+	}
+}
+
+func TestRunStepForbiddenWorkspace(t *testing.T) {
+	discardLogs(t)
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+	client := srv.Client()
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, schematicstest.APIKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pre-flight read of the workspace is refused before anything is submitted
+	srv.FailNext(http.StatusForbidden)
+	result := runStep(ctx, client, "plan", ws.ID, stepOptions{})
+	if !strings.Contains(result.Error, "Reader service access role to read workspace "+ws.ID) {
+		t.Errorf("error = %q, want the Reader role named", result.Error)
+	}
+	if activities := srv.Activities(ws.ID); len(activities) != 0 {
+		t.Errorf("activities = %+v, want none submitted", activities)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// cached tokens this close to expiring are not reused
+const tokenExpiryMargin = 5 * time.Minute
+
+// Path of the on-disk token cache, under the user's cache directory.
+func tokenCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "schematics-apply-destroy", "tokens.json"), nil
+}
+
+// Cache entry name for the identity the options authenticate as. The API key itself is never written to disk.
+func (o *globalOptions) tokenCacheKey(iamEndpoint string) string {
+	sum := sha256.Sum256([]byte(iamEndpoint + "\n" + o.apiKey + "\n" + o.profile.ID + "\n" + o.profile.Name + "\n" + o.profile.Account))
+	return hex.EncodeToString(sum[:])
+}
+
+// Reads the token cache. A missing file yields an empty cache; a file other users can read is ignored.
+func loadTokenCache(path string) (map[string]schematics.Token, error) {
+	tokens := map[string]schematics.Token{}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	}
+	if err != nil {
+		return tokens, err
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		logger.Warn(fmt.Sprintf("ignoring token cache %s: it is readable by other users; chmod 600 it", path))
+		return tokens, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return tokens, err
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return map[string]schematics.Token{}, fmt.Errorf("parsing token cache %s: %w", path, err)
+	}
+	return tokens, nil
+}
+
+// Writes the token cache with mode 0600, dropping expired entries. The file is replaced atomically.
+func saveTokenCache(path string, tokens map[string]schematics.Token) error {
+	for key, token := range tokens {
+		if token.Expiration == 0 || token.ExpiresWithin(0) {
+			delete(tokens, key)
+		}
+	}
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tokens-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// With --token-cache and an API key, puts a cached token for this identity on the client if one is still valid.
+// Cache problems are only logged; the caller falls back to authenticating.
+func (o *globalOptions) useCachedToken(client *schematics.Client) bool {
+	if !o.tokenCache || o.apiKey == "" || o.apiKeySecretCRN != "" {
+		return false
+	}
+	path, err := tokenCachePath()
+	if err != nil {
+		logger.Warn("token cache: " + err.Error())
+		return false
+	}
+	tokens, err := loadTokenCache(path)
+	if err != nil {
+		logger.Warn("token cache: " + err.Error())
+		return false
+	}
+	token, ok := tokens[o.tokenCacheKey(client.IAMEndpoint)]
+	if !ok || token.Expiration == 0 || token.ExpiresWithin(tokenExpiryMargin) {
+		return false
+	}
+	logger.Debug("using cached IAM token", "expires", time.Unix(int64(token.Expiration), 0).Format(time.RFC3339))
+	client.SetToken(token)
+	client.SetRenewalCredentials(o.apiKey, o.profile)
+	return true
+}
+
+// With --token-cache and an API key, stores the client's token for later runs.
+func (o *globalOptions) storeCachedToken(client *schematics.Client) {
+	if !o.tokenCache || o.apiKey == "" || o.apiKeySecretCRN != "" {
+		return
+	}
+	path, err := tokenCachePath()
+	if err == nil {
+		var tokens map[string]schematics.Token
+		if tokens, err = loadTokenCache(path); err == nil {
+			tokens[o.tokenCacheKey(client.IAMEndpoint)] = client.Token()
+			err = saveTokenCache(path, tokens)
+		}
+	}
+	if err != nil {
+		logger.Warn("token cache: " + err.Error())
+	}
+}
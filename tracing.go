@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// the standard OpenTelemetry exporter settings honoured besides --otlp-endpoint
+const (
+	otlpTracesEndpointEnv = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT" // full URL of the traces endpoint
+	otlpEndpointEnv       = "OTEL_EXPORTER_OTLP_ENDPOINT"        // base URL; /v1/traces is appended
+	otlpHeadersEnv        = "OTEL_EXPORTER_OTLP_HEADERS"         // key=value,key=value, e.g. an API key
+	otlpProtocolEnv       = "OTEL_EXPORTER_OTLP_PROTOCOL"
+	otelServiceNameEnv    = "OTEL_SERVICE_NAME"
+	// W3C trace context of a parent span, e.g. from a CI system, that the run's spans join
+	traceparentEnv = "TRACEPARENT"
+)
+
+// the tracer spans are recorded with; nil when tracing is off, which makes every span a no-op
+var tracer *otlpTracer
+
+// Collects finished spans and sends them in batches to an OTLP/HTTP endpoint, JSON-encoded.
+type otlpTracer struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+
+	mu      sync.Mutex
+	pending []*span
+	// exporting is serialized so a flush at exit waits for a batch still in flight
+	exportMu sync.Mutex
+}
+
+// A span being recorded. The methods of a nil *span do nothing.
+type span struct {
+	traceID, spanID, parentID string
+	name                      string
+	kind                      int // 1 internal, 3 client
+	start, end                time.Time
+	attributes                map[string]string
+	err                       string
+}
+
+type spanContextKey struct{}
+
+// Resolves the OTLP traces URL from endpoint and the environment; "" disables tracing.
+func otlpTracesURL(endpoint string) string {
+	switch {
+	case endpoint != "":
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	case os.Getenv(otlpTracesEndpointEnv) != "":
+		return os.Getenv(otlpTracesEndpointEnv)
+	case os.Getenv(otlpEndpointEnv) != "":
+		return strings.TrimSuffix(os.Getenv(otlpEndpointEnv), "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// Creates the tracer exporting to url through client, flushing every few seconds and when the run exits.
+func newOTLPTracer(url string, client *http.Client) *otlpTracer {
+	if protocol := os.Getenv(otlpProtocolEnv); protocol != "" && protocol != "http/json" {
+		logger.Warn(otlpProtocolEnv+" "+protocol+" is not supported; exporting spans as http/json", "endpoint", url)
+	}
+	t := &otlpTracer{endpoint: url, headers: map[string]string{}, service: os.Getenv(otelServiceNameEnv), client: client}
+	if t.service == "" {
+		t.service = programName()
+	}
+	for _, pair := range strings.Split(os.Getenv(otlpHeadersEnv), ",") {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			t.headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			addSecret(strings.TrimSpace(value))
+		}
+	}
+	ticker := time.NewTicker(5 * time.Second)
+	go func() {
+		for range ticker.C {
+			t.flush()
+		}
+	}()
+	atExit(func() {
+		ticker.Stop()
+		t.flush()
+	})
+	return t
+}
+
+// Starts a span named name as a child of the span in ctx, or of TRACEPARENT, or as a new trace, and returns ctx
+// carrying it. attrs are key, value pairs.
+func startSpan(ctx context.Context, name string, attrs ...string) (context.Context, *span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	s := &span{name: name, kind: 1, start: time.Now(), spanID: randomHex(8), attributes: map[string]string{}}
+	if parent, ok := ctx.Value(spanContextKey{}).(*span); ok {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else if traceID, parentID, ok := parseTraceparent(os.Getenv(traceparentEnv)); ok {
+		s.traceID, s.parentID = traceID, parentID
+	} else {
+		s.traceID = randomHex(16)
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.attributes[attrs[i]] = attrs[i+1]
+	}
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+// Sets an attribute on the span.
+func (s *span) set(key string, value string) {
+	if s != nil {
+		s.attributes[key] = value
+	}
+}
+
+// Ends the span, marking it failed when err is set, and queues it for export.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	if err != nil {
+		s.err = redactString(formatError(err))
+	}
+	tracer.mu.Lock()
+	tracer.pending = append(tracer.pending, s)
+	tracer.mu.Unlock()
+}
+
+// The W3C traceparent header value for the span.
+func (s *span) traceparent() string {
+	return "00-" + s.traceID + "-" + s.spanID + "-01"
+}
+
+// Splits a traceparent value into its trace and parent span ids.
+func parseTraceparent(value string) (traceID string, spanID string, ok bool) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// Sends the queued spans. Export failures are logged at debug level; tracing never fails a run.
+func (t *otlpTracer) flush() {
+	t.exportMu.Lock()
+	defer t.exportMu.Unlock()
+	t.mu.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	if err := t.export(spans); err != nil {
+		logger.Debug("exporting spans failed", "endpoint", t.endpoint, "spans", len(spans), "error", formatError(err))
+	}
+}
+
+// OTLP JSON encoding of an attribute
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            struct {
+		// 1 ok, 2 error
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+func (t *otlpTracer) export(spans []*span) error {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		o := otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attributes),
+		}
+		o.Status.Code = 1
+		if s.err != "" {
+			o.Status.Code, o.Status.Message = 2, s.err
+		}
+		encoded = append(encoded, o)
+	}
+	type scopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	type resourceSpans struct {
+		Resource struct {
+			Attributes []otlpAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+	var rs resourceSpans
+	rs.Resource.Attributes = otlpAttributes(map[string]string{"service.name": t.service})
+	scope := scopeSpans{Spans: encoded}
+	scope.Scope.Name = "schematics-apply-destroy"
+	rs.ScopeSpans = []scopeSpans{scope}
+	body, err := json.Marshal(map[string][]resourceSpans{"resourceSpans": {rs}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+func otlpAttributes(attributes map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	encoded := make([]otlpAttribute, len(keys))
+	for i, key := range keys {
+		encoded[i].Key = key
+		encoded[i].Value.StringValue = attributes[key]
+	}
+	return encoded
+}
+
+// Wraps the transport of IAM and Schematics requests in a client span each, propagating the trace context to
+// the server in a traceparent header.
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, s := startSpan(req.Context(), "HTTP "+req.Method,
+		"http.request.method", req.Method,
+		"server.address", req.URL.Host,
+		"url.path", req.URL.Path)
+	s.kind = 3
+	req = req.Clone(ctx)
+	req.Header.Set("traceparent", s.traceparent())
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		s.finish(err)
+		return resp, err
+	}
+	s.set("http.response.status_code", strconv.Itoa(resp.StatusCode))
+	if id := schematics.TransactionID(resp.Header); id != "" {
+		s.set("ibm.transaction_id", id)
+	}
+	if resp.StatusCode >= 400 {
+		s.finish(fmt.Errorf("%s", resp.Status))
+	} else {
+		s.finish(nil)
+	}
+	return resp, nil
+}
+
+// n random bytes as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// flags of `ui`
+type uiOptions struct {
+	steps         stepOptions
+	resourceGroup string
+	jobs          int
+}
+
+// Builds the flag set for `ui`.
+func uiFlags() (*flag.FlagSet, *globalOptions, *uiOptions) {
+	fs := newFlagSet("ui", "ui [flags]", "Browses the region's workspaces interactively: pick one by number to see its recent jobs, "+
+		"then plan, apply or destroy it or tail a job's logs. Every screen reads one command per line; q quits.")
+	global := &globalOptions{}
+	global.register(fs, false)
+	opts := &uiOptions{}
+	fs.StringVar(&opts.resourceGroup, "resource-group", "", "only list the workspaces in the resource group with this `id`")
+	fs.IntVar(&opts.jobs, "jobs", 10, "how many recent jobs a workspace's screen shows")
+	fs.DurationVar(&opts.steps.PollInterval, "poll-interval", 5*time.Second, "how often a running job's status and logs are checked")
+	fs.BoolVar(&opts.steps.FromFailed, "from-failed", false, "allow destroying a workspace whose last run FAILED")
+	return fs, global, opts
+}
+
+// `ui`: the interactive browser, until q or the end of stdin.
+func runUICommand(_ string, args []string) {
+	fs, global, opts := uiFlags()
+	parseFlags(fs, args)
+	if opts.jobs < 1 {
+		usageError(fs, fmt.Errorf("--jobs %d: must be at least 1", opts.jobs))
+	}
+	if !isTerminal(os.Stdin) {
+		fatalCode(exitInvalidInput, errors.New("ui needs a terminal on stdin"))
+	}
+	if err := global.validate(false); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	opts.steps.Wait = true
+	opts.steps.FollowLogs = true
+	opts.steps.LogOutput = redactingWriter{os.Stdout}
+	opts.steps.Progress = isTerminal(os.Stdout)
+	ui := &uiSession{ctx: ctx, client: client, in: bufio.NewReader(os.Stdin), out: redactingWriter{os.Stdout}, opts: opts}
+	if err := ui.run(); err != nil && !errors.Is(err, io.EOF) {
+		fatal(err)
+	}
+	exit(exitOK)
+}
+
+// The state of an interactive `ui` session.
+type uiSession struct {
+	ctx    context.Context
+	client *schematics.Client
+	in     *bufio.Reader
+	out    io.Writer
+	opts   *uiOptions
+}
+
+// errors the screens return to move between them
+var (
+	errUIBack = errors.New("back")
+	errUIQuit = errors.New("quit")
+)
+
+// Shows the workspace list until the user quits.
+func (ui *uiSession) run() error {
+	for {
+		all, err := ui.client.ListWorkspaces(ui.ctx)
+		if err != nil {
+			return err
+		}
+		var workspaces []schematics.Workspace
+		for _, ws := range all {
+			if ws.InResourceGroup(ui.opts.resourceGroup) {
+				workspaces = append(workspaces, ws)
+			}
+		}
+		ui.clearScreen()
+		fmt.Fprintln(ui.out, "Workspaces")
+		w := tabwriter.NewWriter(ui.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "#\tNAME\tID\tSTATUS\tRESOURCE GROUP")
+		for i, ws := range workspaces {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i+1, ws.Name, ws.ID, orDash(ws.Status), orDash(ws.ResourceGroup))
+		}
+		w.Flush()
+		if len(workspaces) == 0 {
+			fmt.Fprintln(ui.out, "(none)")
+		}
+
+		answer, err := ui.prompt("number to open, r to refresh, q to quit")
+		if err != nil {
+			return err
+		}
+		switch answer {
+		case "", "r":
+			continue
+		case "q":
+			return nil
+		}
+		n, convErr := strconv.Atoi(answer)
+		if convErr != nil || n < 1 || n > len(workspaces) {
+			ui.pause(fmt.Sprintf("no workspace %q", answer))
+			continue
+		}
+		switch err := ui.workspace(workspaces[n-1].ID); {
+		case errors.Is(err, errUIQuit):
+			return nil
+		case err != nil && !errors.Is(err, errUIBack):
+			return err
+		}
+	}
+}
+
+// Shows one workspace and its recent jobs and runs the commands typed there, until b goes back.
+func (ui *uiSession) workspace(schematicsWorkspaceID string) error {
+	for {
+		ws, err := ui.client.GetWorkspace(ui.ctx, schematicsWorkspaceID)
+		if err != nil {
+			ui.pause(formatError(err))
+			return errUIBack
+		}
+		activities, err := ui.client.ListActivities(ui.ctx, schematicsWorkspaceID)
+		if err != nil {
+			ui.pause(formatError(err))
+			return errUIBack
+		}
+		if len(activities) > ui.opts.jobs {
+			activities = activities[:ui.opts.jobs]
+		}
+		ui.clearScreen()
+		frozen := ""
+		if ws.State.Frozen {
+			frozen = ", frozen"
+		}
+		fmt.Fprintf(ui.out, "%s (%s): %s%s\n\n", orDash(ws.Name), schematicsWorkspaceID, orDash(ws.Status), frozen)
+		w := tabwriter.NewWriter(ui.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "#\tID\tTYPE\tSTATUS\tSTARTED\tENDED\tTRIGGERED BY")
+		for i, activity := range activities {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", i+1, activity.ActionID, activity.Name, activity.Status,
+				orDash(activity.StartTime()), orDash(activity.EndTime()), orDash(activity.PerformedBy))
+		}
+		w.Flush()
+		if len(activities) == 0 {
+			fmt.Fprintln(ui.out, "(no jobs yet)")
+		}
+
+		answer, err := ui.prompt("p plan, a apply, d destroy, l [#] logs of a job (the latest by default), r refresh, b back, q quit")
+		if err != nil {
+			return err
+		}
+		command, arg, _ := strings.Cut(answer, " ")
+		switch command {
+		case "", "r":
+		case "b":
+			return errUIBack
+		case "q":
+			return errUIQuit
+		case "p":
+			ui.runAction("plan", ws)
+		case "a":
+			ui.runAction("apply", ws)
+		case "d":
+			ui.runAction("destroy", ws)
+		case "l":
+			n := 1
+			if arg = strings.TrimSpace(arg); arg != "" {
+				if n, err = strconv.Atoi(arg); err != nil {
+					n = 0
+				}
+			}
+			if n < 1 || n > len(activities) {
+				ui.pause(fmt.Sprintf("no job %q", arg))
+				continue
+			}
+			ui.showLogs(schematicsWorkspaceID, activities[n-1])
+		default:
+			ui.pause(fmt.Sprintf("unknown command %q", answer))
+		}
+	}
+}
+
+// Confirms the action, runs it against the workspace and waits for it with its logs, as `<action> --wait` would.
+func (ui *uiSession) runAction(action string, ws schematics.Workspace) {
+	var ok bool
+	var err error
+	if action == "destroy" {
+		name := ws.Name
+		if name == "" {
+			name = ws.ID
+		}
+		ok, err = readTypedConfirmation(ui.in, ui.out, fmt.Sprintf("Destroy every resource of workspace %s (%s)?", name, ws.ID), name)
+	} else {
+		ok, err = readConfirmation(ui.in, ui.out, fmt.Sprintf("Run %s on workspace %s?", action, orDash(ws.Name)))
+	}
+	if err != nil || !ok {
+		ui.pause("not confirmed")
+		return
+	}
+	results := runSteps(ui.ctx, ui.client, []string{action}, ws.ID, ui.opts.steps)
+	if len(results) == 1 && !results[0].failed() {
+		ui.pause(fmt.Sprintf("%s %s", action, stepStatus(results[0])))
+	} else {
+		ui.pause(action + " failed")
+	}
+}
+
+// Prints the job's logs; while it still runs, follows them until it finishes.
+func (ui *uiSession) showLogs(schematicsWorkspaceID string, activity schematics.Activity) {
+	ui.clearScreen()
+	fmt.Fprintf(ui.out, "%s %s (%s)\n\n", activity.Name, activity.ActionID, activity.Status)
+	follower := &logFollower{client: ui.client, workspaceID: schematicsWorkspaceID, activityID: activity.ActionID, out: ui.out}
+	if schematics.IsTerminalStatus(activity.Status) {
+		follower.poll(ui.ctx, true)
+	} else {
+		final, err := ui.client.WaitForActivity(ui.ctx, schematicsWorkspaceID, activity.ActionID, schematics.WaitOptions{
+			Interval: ui.opts.steps.PollInterval,
+			OnPoll: func(a schematics.Activity) {
+				follower.poll(ui.ctx, schematics.IsTerminalStatus(a.Status))
+			},
+		})
+		if err != nil {
+			ui.pause(formatError(err))
+			return
+		}
+		activity = final
+	}
+	if follower.logs == "" {
+		fmt.Fprintln(ui.out, "(no logs)")
+	}
+	ui.pause(fmt.Sprintf("%s %s", activity.ActionID, activity.Status))
+}
+
+// Prints prompt and reads the answer. io.EOF means stdin was closed.
+func (ui *uiSession) prompt(prompt string) (string, error) {
+	fmt.Fprintf(ui.out, "\n%s> ", prompt)
+	answer, err := ui.in.ReadString('\n')
+	if err != nil && (answer == "" || !errors.Is(err, io.EOF)) {
+		return "", err
+	}
+	return strings.ToLower(strings.TrimSpace(answer)), nil
+}
+
+// Shows message until Enter is pressed, so it isn't cleared away at once.
+func (ui *uiSession) pause(message string) {
+	fmt.Fprintf(ui.out, "\n%s; press Enter to go on ", message)
+	ui.in.ReadString('\n')
+}
+
+// Clears the terminal before the next screen.
+func (ui *uiSession) clearScreen() {
+	if isTerminal(os.Stdout) {
+		fmt.Fprint(ui.out, "\033[H\033[2J")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// Reads the variables in a --var-file. Files ending in .json hold either Terraform's JSON variable syntax
+// ({"name": value}) or Schematics variablestore entries ([{"name": ..., "value": ..., "type": ..., "secure": true}],
+// optionally wrapped in {"variablestore": [...]}); anything else is read as a .tfvars file.
+func readVarFile(path string) ([]schematics.Variable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading variable file: %w", err)
+	}
+	var vars []schematics.Variable
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		vars, err = parseJSONVars(data)
+	} else {
+		vars, err = parseTFVars(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("variable file %s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// a variablestore entry as written in a variable file; sensitive is accepted as Terraform's name for secure
+type varFileEntry struct {
+	Name        string          `json:"name"`
+	Value       json.RawMessage `json:"value"`
+	Type        string          `json:"type"`
+	Secure      bool            `json:"secure"`
+	Sensitive   bool            `json:"sensitive"`
+	Description string          `json:"description"`
+}
+
+func parseJSONVars(data []byte) ([]schematics.Variable, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		return parseVariablestore(data)
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	if store, ok := object["variablestore"]; ok && len(object) == 1 {
+		return parseVariablestore(store)
+	}
+	// encoding/json loses the key order, so take it from the document
+	names, err := jsonObjectKeys(data)
+	if err != nil {
+		return nil, err
+	}
+	vars := make([]schematics.Variable, 0, len(names))
+	for _, name := range names {
+		vars = append(vars, schematics.Variable{Name: name, Value: jsonVarValue(object[name])})
+	}
+	return vars, nil
+}
+
+func parseVariablestore(data []byte) ([]schematics.Variable, error) {
+	var entries []varFileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	vars := make([]schematics.Variable, 0, len(entries))
+	for i, entry := range entries {
+		if strings.TrimSpace(entry.Name) == "" {
+			return nil, fmt.Errorf("entry %d has no name", i+1)
+		}
+		vars = append(vars, schematics.Variable{
+			Name:        entry.Name,
+			Value:       jsonVarValue(entry.Value),
+			Type:        entry.Type,
+			Secure:      entry.Secure || entry.Sensitive,
+			Description: entry.Description,
+		})
+	}
+	return vars, nil
+}
+
+// The variablestore value for a JSON value: strings as they are, anything else as its compact JSON text,
+// which Schematics reads as the equivalent HCL.
+func jsonVarValue(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return string(raw)
+	}
+	return compact.String()
+}
+
+// Returns the keys of the JSON object in data in document order.
+func jsonObjectKeys(data []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, tok.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// Parses the assignments of a .tfvars file: `name = value`, where a value is a quoted string, a number, a bool,
+// or a list or map that may span lines. Quoted strings become their contents; other values are kept as HCL
+// source. Comments start with #, // or /*.
+func parseTFVars(data []byte) ([]schematics.Variable, error) {
+	var vars []schematics.Variable
+	src := string(data)
+	line := 1
+	for {
+		var skipped int
+		src, skipped = skipTFVarsSpace(src)
+		line += skipped
+		if src == "" {
+			return vars, nil
+		}
+		eq := strings.IndexAny(src, "=\n")
+		if eq < 0 || src[eq] != '=' {
+			return nil, fmt.Errorf("line %d: expected name = value", line)
+		}
+		name := strings.TrimSpace(src[:eq])
+		if name == "" || strings.ContainsAny(name, " \t\"{}[]") {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", line, name)
+		}
+		value, rest, lines, err := scanTFVarsValue(strings.TrimLeft(src[eq+1:], " \t"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", line, name, err)
+		}
+		if strings.HasPrefix(value, `"`) {
+			if err := json.Unmarshal([]byte(value), &value); err != nil {
+				return nil, fmt.Errorf("line %d: %s: invalid string", line, name)
+			}
+		}
+		vars = append(vars, schematics.Variable{Name: name, Value: value})
+		line += lines
+		src = rest
+	}
+}
+
+// Skips whitespace and comments, returning the rest of src and the number of newlines skipped.
+func skipTFVarsSpace(src string) (string, int) {
+	lines := 0
+	for src != "" {
+		switch {
+		case src[0] == '\n':
+			lines++
+			src = src[1:]
+		case src[0] == ' ' || src[0] == '\t' || src[0] == '\r':
+			src = src[1:]
+		case src[0] == '#' || strings.HasPrefix(src, "//"):
+			end := strings.IndexByte(src, '\n')
+			if end < 0 {
+				return "", lines
+			}
+			src = src[end:]
+		case strings.HasPrefix(src, "/*"):
+			end := strings.Index(src, "*/")
+			if end < 0 {
+				return "", lines
+			}
+			lines += strings.Count(src[:end], "\n")
+			src = src[end+2:]
+		default:
+			return src, lines
+		}
+	}
+	return src, lines
+}
+
+// Scans one value from the start of src up to the end of its line, following brackets and quoted strings
+// across lines. Returns the value's source, the remaining input and the number of newlines consumed.
+func scanTFVarsValue(src string) (string, string, int, error) {
+	depth, inString, lines := 0, false, 0
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case inString && c == '\\':
+			i++
+		case inString && c == '"':
+			inString = false
+		case inString && c == '\n':
+			return "", "", 0, fmt.Errorf("unterminated string")
+		case inString:
+		case c == '"':
+			inString = true
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+			if depth < 0 {
+				return "", "", 0, fmt.Errorf("unbalanced %q", c)
+			}
+		case c == '\n' && depth > 0:
+			lines++
+		case depth == 0 && (c == '\n' || c == '#' || strings.HasPrefix(src[i:], "//")):
+			return finishTFVarsValue(src[:i], src[i:], lines)
+		}
+	}
+	if inString {
+		return "", "", 0, fmt.Errorf("unterminated string")
+	}
+	if depth > 0 {
+		return "", "", 0, fmt.Errorf("unterminated list or map")
+	}
+	return finishTFVarsValue(src, "", lines)
+}
+
+func finishTFVarsValue(value string, rest string, lines int) (string, string, int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", "", 0, fmt.Errorf("missing value")
+	}
+	return value, rest, lines, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// the commands under `vars`
+func varsCommands() []command {
+	return []command{
+		{name: "set", summary: "update Terraform variables in the workspace's variable store", run: runVarsSetCommand, flags: func(name string) *flag.FlagSet {
+			fs, _, _ := varsSetFlags(name)
+			return fs
+		}},
+	}
+}
+
+// Parses a `key=value` assignment from --var or the `vars set` arguments.
+func parseVarAssignment(assignment string) (schematics.Variable, error) {
+	name, value, ok := strings.Cut(assignment, "=")
+	if !ok || strings.TrimSpace(name) == "" {
+		return schematics.Variable{}, fmt.Errorf("variable %q: expected key=value", assignment)
+	}
+	return schematics.Variable{Name: strings.TrimSpace(name), Value: value}, nil
+}
+
+// Parses every assignment, failing on the first malformed one.
+func parseVarAssignments(assignments []string) ([]schematics.Variable, error) {
+	var vars []schematics.Variable
+	for _, assignment := range assignments {
+		v, err := parseVarAssignment(assignment)
+		if err != nil {
+			return nil, err
+		}
+		vars = append(vars, v)
+	}
+	return vars, nil
+}
+
+// the --var, --sensitive-var and --var-file flags
+type varOptions struct {
+	vars          stringList
+	sensitiveVars stringList
+	varFiles      stringList
+}
+
+func (o *varOptions) register(fs *flag.FlagSet, varUsage string) {
+	fs.Var(&o.vars, "var", varUsage)
+	fs.Var(&o.sensitiveVars, "sensitive-var", "like --var, but the variable is stored as secure: Schematics never returns its value and it is masked in all output")
+	fs.Var(&o.varFiles, "var-file", "file of Terraform variables to set: .json (Terraform JSON syntax or Schematics variablestore entries with type and secure) or .tfvars; may be repeated")
+}
+
+// Reads the variable files in order, then the assignments and the sensitive assignments, so a --var overrides
+// the same variable in a file. The values of secure variables are registered as secrets so they are never echoed.
+func (o *varOptions) variables(assignments []string) ([]schematics.Variable, error) {
+	var vars []schematics.Variable
+	for _, path := range o.varFiles {
+		fileVars, err := readVarFile(path)
+		if err != nil {
+			return nil, err
+		}
+		vars = append(vars, fileVars...)
+	}
+	assigned, err := parseVarAssignments(assignments)
+	if err != nil {
+		return nil, err
+	}
+	vars = append(vars, assigned...)
+	sensitive, err := parseVarAssignments(o.sensitiveVars)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range sensitive {
+		v.Secure = true
+		vars = append(vars, v)
+	}
+	for _, v := range vars {
+		if v.Secure {
+			addSensitiveValue(v.Value)
+		}
+	}
+	return vars, nil
+}
+
+// Sends vars to the workspace's variable store, logging the names (never the values) that changed.
+func updateVariables(ctx context.Context, client *schematics.Client, schematicsWorkspaceID string, vars []schematics.Variable) error {
+	if len(vars) == 0 {
+		return nil
+	}
+	if err := client.SetVariables(ctx, schematicsWorkspaceID, vars); err != nil {
+		return err
+	}
+	var names []string
+	seen := map[string]bool{}
+	for _, v := range vars {
+		if !seen[v.Name] {
+			seen[v.Name] = true
+			names = append(names, v.Name)
+		}
+	}
+	logger.Info("updated workspace variables", "workspace", schematicsWorkspaceID, "variables", strings.Join(names, ","))
+	return nil
+}
+
+// Builds the flag set for `vars set`.
+func varsSetFlags(name string) (*flag.FlagSet, *globalOptions, *varOptions) {
+	fs := newFlagSet(name, name+" --workspace-id <id> [key=value...] [flags]", "Sets Terraform variables in the workspace's variable store in one update, keeping the other variables as they are.")
+	global := &globalOptions{}
+	global.register(fs, true)
+	opts := &varOptions{}
+	opts.register(fs, "variable to set as key=value; may be repeated, and assignments may also follow the flags")
+	return fs, global, opts
+}
+
+// `vars set key=value...`: updates the variables without running a job.
+func runVarsSetCommand(name string, args []string) {
+	fs, global, opts := varsSetFlags(name)
+	rest := parseFlagsArgs(fs, args)
+	vars, err := opts.variables(append(opts.vars, rest...))
+	if err != nil {
+		usageError(fs, err)
+	}
+	if len(vars) == 0 {
+		usageError(fs, errors.New("no variables given"))
+	}
+	if err := global.validate(true); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	if err := updateVariables(ctx, client, global.workspaceID, vars); err != nil {
+		fatal(err)
+	}
+}
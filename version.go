@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// build metadata, set at build time with e.g.
+// go build -ldflags "-X main.version=v1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// where `version --check` looks up the latest release; a var so test builds can point it elsewhere with -X
+var latestReleaseURL = "https://api.github.com/repos/bhpratt/schematics-apply-destroy/releases/latest"
+
+// how long `version --check` waits for GitHub
+const latestReleaseTimeout = 10 * time.Second
+
+// What `version` prints.
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+	// set by --check
+	Latest   string `json:"latest,omitempty"`
+	Outdated *bool  `json:"outdated,omitempty"`
+}
+
+// The build metadata. What the ldflags left unset is taken from the module and VCS information the Go toolchain
+// records, so `go install` builds still show their version and commit.
+func currentVersion() versionInfo {
+	info := versionInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "dev" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+		info.Version = build.Main.Version
+	}
+	for _, setting := range build.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = setting.Value
+		case setting.Key == "vcs.time" && info.BuildDate == "":
+			info.BuildDate = setting.Value
+		}
+	}
+	return info
+}
+
+// The User-Agent of the tool's requests, e.g. schematics-apply-destroy/v1.4.0.
+func userAgent() string {
+	return "schematics-apply-destroy/" + currentVersion().Version
+}
+
+// Builds the flag set for `version`.
+func versionFlags() (*flag.FlagSet, *bool, *string) {
+	fs := newFlagSet("version", "version [--check] [--output json]", "Prints the version, git commit, build date and Go version "+
+		"of the binary. With --check it also asks GitHub for the latest release and says whether this binary is older.")
+	check := fs.Bool("check", false, "compare the version with the latest GitHub release")
+	output := fs.String("output", outputText, "output format: text, or json")
+	return fs, check, output
+}
+
+// `version`: prints the build metadata and, with --check, whether a newer release is out. A failed check is only
+// a warning, so scripts printing the version don't break when GitHub can't be reached.
+func runVersionCommand(_ string, args []string) {
+	fs, check, output := versionFlags()
+	parseFlags(fs, args)
+	if *output != outputText && *output != outputJSON {
+		usageError(fs, fmt.Errorf("--output %q: must be %s or %s", *output, outputText, outputJSON))
+	}
+	info := currentVersion()
+	if *check {
+		ctx, cancel := context.WithTimeout(context.Background(), latestReleaseTimeout)
+		defer cancel()
+		latest, err := fetchLatestRelease(ctx, http.DefaultClient, latestReleaseURL)
+		if err != nil {
+			logger.Warn("could not check for a newer release", "error", formatError(err))
+		} else {
+			info.Latest = latest
+			if outdated, ok := olderVersion(info.Version, latest); ok {
+				info.Outdated = &outdated
+			}
+		}
+	}
+	if *output == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(info); err != nil {
+			fatal(err)
+		}
+		exit(exitOK)
+	}
+	writeVersionText(os.Stdout, info)
+	exit(exitOK)
+}
+
+// Prints info as lines of name and value.
+func writeVersionText(out io.Writer, info versionInfo) {
+	fmt.Fprintf(out, "%s %s\n", programName(), info.Version)
+	fmt.Fprintf(out, "commit:     %s\n", orDash(info.Commit))
+	fmt.Fprintf(out, "built:      %s\n", orDash(info.BuildDate))
+	fmt.Fprintf(out, "go version: %s %s\n", info.GoVersion, info.Platform)
+	switch {
+	case info.Latest == "":
+	case info.Outdated == nil:
+		fmt.Fprintf(out, "latest:     %s (%s can't be compared with it)\n", info.Latest, info.Version)
+	case *info.Outdated:
+		fmt.Fprintf(out, "latest:     %s; this binary is out of date, see https://github.com/bhpratt/schematics-apply-destroy/releases\n", info.Latest)
+	default:
+		fmt.Fprintf(out, "latest:     %s; this binary is up to date\n", info.Latest)
+	}
+}
+
+// Asks the GitHub API at releaseURL for the tag of the latest release.
+func fetchLatestRelease(ctx context.Context, client *http.Client, releaseURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, releaseURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", userAgent())
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return "", urlErr.Err
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// GitHub's errors, such as a rate limit, carry a message
+		var body struct {
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&body) == nil && body.Message != "" {
+			return "", fmt.Errorf("GitHub answered %s: %s", resp.Status, body.Message)
+		}
+		return "", fmt.Errorf("GitHub answered %s", resp.Status)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", fmt.Errorf("reading the latest release: %w", err)
+	}
+	if release.TagName == "" {
+		return "", errors.New("the latest release has no tag")
+	}
+	return release.TagName, nil
+}
+
+// Reports whether version is older than latest, both semantic versions such as v1.4.0 or 1.5.0-rc.1. ok is false
+// when either isn't one, as for a "dev" build.
+func olderVersion(version string, latest string) (older bool, ok bool) {
+	current, ok := parseSemver(version)
+	if !ok {
+		return false, false
+	}
+	newest, ok := parseSemver(latest)
+	if !ok {
+		return false, false
+	}
+	for i := 0; i < 3; i++ {
+		if current.numbers[i] != newest.numbers[i] {
+			return current.numbers[i] < newest.numbers[i], true
+		}
+	}
+	// a pre-release comes before its release; pre-releases of the same version are compared as text
+	switch {
+	case current.prerelease == newest.prerelease:
+		return false, true
+	case current.prerelease == "":
+		return false, true
+	case newest.prerelease == "":
+		return true, true
+	}
+	return current.prerelease < newest.prerelease, true
+}
+
+// The parts of a semantic version that order it. Build metadata after + is ignored.
+type semver struct {
+	numbers    [3]int
+	prerelease string
+}
+
+// Parses s, with or without its leading v.
+func parseSemver(s string) (semver, bool) {
+	s, _, _ = strings.Cut(strings.TrimPrefix(s, "v"), "+")
+	core, prerelease, _ := strings.Cut(s, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+	v := semver{prerelease: prerelease}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return semver{}, false
+		}
+		v.numbers[i] = n
+	}
+	return v, true
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// The host of a webhook URL given on the command line, which is logged instead of the URL since its path may hold
+// a token. Reports false unless the URL is absolute and https, or http too when allowHTTP is set.
+func webhookHost(rawURL string, allowHTTP bool) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && (!allowHTTP || u.Scheme != "http")) {
+		return "", false
+	}
+	return u.Host, true
+}
+
+// POSTs payload as JSON to a webhook and returns the response, already closed, with up to 512 bytes of its body.
+// sign, when set, returns extra headers for the encoded body, such as a signature. Errors leave out the URL,
+// which *url.Error repeats.
+func postJSON(ctx context.Context, client *http.Client, rawURL string, payload interface{}, sign func(body []byte) http.Header) (*http.Response, []byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sign != nil {
+		for name, values := range sign(body) {
+			req.Header[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, nil, urlErr.Err
+		}
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	io.Copy(io.Discard, resp.Body)
+	return resp, text, nil
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"schematics-apply-destroy/pkg/schematics"
+)
+
+// the commands under `workspace`
+func workspaceCommands() []command {
+	return []command{
+		{name: "list", summary: "list the workspaces in the region with their status and last activity", run: runWorkspaceListCommand, flags: func(name string) *flag.FlagSet {
+			fs, _, _, _ := workspaceListFlags(name)
+			return fs
+		}},
+		{name: "create", summary: "create a workspace from a Terraform template in a git repository and print its id", run: runWorkspaceCreateCommand, flags: func(name string) *flag.FlagSet {
+			fs, _, _ := workspaceCreateFlags(name)
+			return fs
+		}},
+		{name: "clone", summary: "create a copy of a workspace with the same template, variables and settings, and print its id", run: runWorkspaceCloneCommand, flags: func(name string) *flag.FlagSet {
+			fs, _, _ := workspaceCloneFlags(name)
+			return fs
+		}},
+		{name: "delete", summary: "delete a workspace, optionally destroying its resources first", run: runWorkspaceDeleteCommand, flags: func(name string) *flag.FlagSet {
+			fs, _, _ := workspaceDeleteFlags(name)
+			return fs
+		}},
+		{name: "freeze", summary: "freeze a workspace so no job can run on it", run: runWorkspaceFreezeCommand, flags: func(name string) *flag.FlagSet {
+			fs, _ := workspaceFreezeFlags(name)
+			return fs
+		}},
+		{name: "unfreeze", summary: "unfreeze a workspace so jobs can run on it again", run: runWorkspaceFreezeCommand, flags: func(name string) *flag.FlagSet {
+			fs, _ := workspaceFreezeFlags(name)
+			return fs
+		}},
+		{name: "set-terraform-version", summary: "switch a workspace's templates to another Terraform version", run: runWorkspaceSetTerraformVersionCommand, flags: func(name string) *flag.FlagSet {
+			fs, _ := workspaceSetTerraformVersionFlags(name)
+			return fs
+		}},
+	}
+}
+
+// Builds the flag set for `workspace list`.
+func workspaceListFlags(name string) (*flag.FlagSet, *globalOptions, *string, *string) {
+	fs := newFlagSet(name, name+" [flags]", "Lists every Schematics workspace in the region with its id, name, status, resource group and last activity.")
+	global := &globalOptions{}
+	global.register(fs, false)
+	output := fs.String("output", outputText, "output format: text for a table, or json")
+	resourceGroup := fs.String("resource-group", "", "list only the workspaces in the resource group with this `id`")
+	return fs, global, output, resourceGroup
+}
+
+// `workspace list`: prints the region's workspaces as a table or JSON.
+func runWorkspaceListCommand(name string, args []string) {
+	fs, global, output, resourceGroup := workspaceListFlags(name)
+	parseFlags(fs, args)
+	if *output != outputText && *output != outputJSON {
+		usageError(fs, fmt.Errorf("--output %q: must be %s or %s", *output, outputText, outputJSON))
+	}
+	if err := global.validate(false); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	all, err := client.ListWorkspaces(ctx)
+	if err != nil {
+		fatal(err)
+	}
+	cacheWorkspaces(client.SchematicsEndpoint, all)
+	var workspaces []schematics.Workspace
+	for _, ws := range all {
+		if ws.InResourceGroup(*resourceGroup) {
+			workspaces = append(workspaces, ws)
+		}
+	}
+	out := redactingWriter{os.Stdout}
+	if *output == outputJSON {
+		err = writeWorkspacesJSON(out, workspaces)
+	} else {
+		err = writeWorkspacesTable(out, workspaces)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// flags of `workspace create`
+type workspaceCreateOptions struct {
+	schematics.CreateWorkspaceOptions
+	tags   stringList
+	output string
+}
+
+// Builds the flag set for `workspace create`.
+func workspaceCreateFlags(name string) (*flag.FlagSet, *globalOptions, *workspaceCreateOptions) {
+	fs := newFlagSet(name, name+" --name <name> --template-repo <git url> [flags]", "Creates a Schematics workspace from a Terraform template in a git repository and prints the new workspace id. The workspace runs in --region when given.")
+	global := &globalOptions{}
+	global.register(fs, false)
+	opts := &workspaceCreateOptions{}
+	fs.StringVar(&opts.Name, "name", "", "workspace name")
+	fs.StringVar(&opts.Description, "description", "", "workspace description")
+	fs.StringVar(&opts.TemplateRepo, "template-repo", "", "git URL of the Terraform template, e.g. https://github.com/org/repo")
+	fs.StringVar(&opts.Branch, "branch", "", "branch of --template-repo to use")
+	fs.StringVar(&opts.Folder, "folder", ".", "folder of the repository holding the template")
+	fs.StringVar(&opts.TerraformVersion, "terraform-version", "", "Terraform version, e.g. 1.5")
+	fs.StringVar(&opts.ResourceGroup, "resource-group", "", "resource group id; the account's default group when unset")
+	fs.Var(&opts.tags, "tag", "tag for the workspace; may be repeated")
+	fs.StringVar(&opts.output, "output", outputText, "output format: text prints the workspace id, json the created workspace")
+	return fs, global, opts
+}
+
+// `workspace create`: creates the workspace and prints its id.
+func runWorkspaceCreateCommand(name string, args []string) {
+	fs, global, opts := workspaceCreateFlags(name)
+	parseFlags(fs, args)
+	if opts.Name == "" || opts.TemplateRepo == "" {
+		usageError(fs, errors.New("--name and --template-repo are required"))
+	}
+	if opts.output != outputText && opts.output != outputJSON {
+		usageError(fs, fmt.Errorf("--output %q: must be %s or %s", opts.output, outputText, outputJSON))
+	}
+	if err := global.validate(false); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	opts.Location = global.region
+	opts.Tags = opts.tags
+	ws, err := client.CreateWorkspace(ctx, opts.CreateWorkspaceOptions)
+	if err != nil {
+		fatal(err)
+	}
+	logger.Info("created workspace", "name", ws.Name, "id", ws.ID)
+	out := redactingWriter{os.Stdout}
+	if opts.output == outputJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(ws)
+	} else {
+		_, err = fmt.Fprintln(out, ws.ID)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// flags of `workspace clone`
+type workspaceCloneOptions struct {
+	vars             varOptions
+	name             string
+	description      string
+	resourceGroup    string
+	branch           string
+	terraformVersion string
+	tags             stringList
+	output           string
+}
+
+// Builds the flag set for `workspace clone`.
+func workspaceCloneFlags(name string) (*flag.FlagSet, *globalOptions, *workspaceCloneOptions) {
+	fs := newFlagSet(name, name+" <source-workspace-id> --name <name> [flags]", "Creates a Schematics workspace from the same template repository, branch, folder and Terraform version as the source, "+
+		"in its resource group and location and with its tags and variables, then prints the new workspace id. Flags override any of them. "+
+		"Schematics never returns secure values, so each secure variable of the source must be given again with --sensitive-var. "+
+		"The source id may also be given with --workspace-id or --crn.")
+	global := &globalOptions{}
+	global.register(fs, true)
+	opts := &workspaceCloneOptions{}
+	fs.StringVar(&opts.name, "name", "", "name of the new workspace")
+	fs.StringVar(&opts.description, "description", "", "description of the new workspace; the source's when unset")
+	fs.StringVar(&opts.resourceGroup, "new-resource-group", "", "resource group `id` of the new workspace; the source's when unset")
+	fs.StringVar(&opts.branch, "branch", "", "branch of the template repository to use; the source's when unset")
+	fs.StringVar(&opts.terraformVersion, "terraform-version", "", "Terraform version, e.g. 1.6; the source's when unset")
+	fs.Var(&opts.tags, "tag", "tag to add to the source's tags; may be repeated")
+	fs.StringVar(&opts.output, "output", outputText, "output format: text prints the workspace id, json the created workspace")
+	opts.vars.register(fs, "variable to override as key=value; may be repeated")
+	return fs, global, opts
+}
+
+// `workspace clone <source-id>`: creates the copy and prints its id.
+func runWorkspaceCloneCommand(name string, args []string) {
+	fs, global, opts := workspaceCloneFlags(name)
+	switch rest := parseFlagsArgs(fs, args); len(rest) {
+	case 0:
+	case 1:
+		global.workspaceID = rest[0]
+	default:
+		usageError(fs, fmt.Errorf("unexpected argument %q", rest[1]))
+	}
+	if opts.name == "" {
+		usageError(fs, errors.New("--name is required"))
+	}
+	if opts.terraformVersion != "" {
+		if err := validateTerraformVersion(opts.terraformVersion); err != nil {
+			usageError(fs, err)
+		}
+	}
+	if opts.output != outputText && opts.output != outputJSON {
+		usageError(fs, fmt.Errorf("--output %q: must be %s or %s", opts.output, outputText, outputJSON))
+	}
+	overrides, err := opts.vars.variables(opts.vars.vars)
+	if err != nil {
+		usageError(fs, err)
+	}
+	if err := global.validate(true); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	source, err := client.GetWorkspace(ctx, global.workspaceID)
+	if err != nil {
+		fatal(err)
+	}
+	sourceVars, err := client.GetVariables(ctx, global.workspaceID)
+	if err != nil {
+		fatal(err)
+	}
+	create, err := cloneOptions(source, sourceVars, overrides, opts)
+	if err != nil {
+		fatalCode(exitInvalidInput, err)
+	}
+	ws, err := client.CreateWorkspace(ctx, create)
+	if err != nil {
+		fatal(err)
+	}
+	logger.Info("cloned workspace", "source", source.ID, "name", ws.Name, "id", ws.ID)
+	out := redactingWriter{os.Stdout}
+	if opts.output == outputJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(ws)
+	} else {
+		_, err = fmt.Fprintln(out, ws.ID)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// Describes the copy of source: its settings and variables, overridden by the flags and the variable overrides.
+// The copy gets no expires-at tag; an apply --ttl on it records its own.
+func cloneOptions(source schematics.Workspace, sourceVars []schematics.Variable, overrides []schematics.Variable, opts *workspaceCloneOptions) (schematics.CreateWorkspaceOptions, error) {
+	create := schematics.CreateWorkspaceOptions{
+		Name:             opts.name,
+		Description:      source.Description,
+		ResourceGroup:    source.ResourceGroup,
+		Location:         source.Location,
+		Tags:             withoutExpiryTags(source.Tags),
+		TerraformVersion: source.TerraformVersion(),
+	}
+	if source.Repo == nil || source.Repo.URL == "" {
+		return create, fmt.Errorf("workspace %s has no template repository to clone", source.ID)
+	}
+	create.TemplateRepo, create.Branch = source.Repo.URL, source.Repo.Branch
+	if len(source.Templates) > 0 {
+		create.Folder = source.Templates[0].Folder
+	}
+	if opts.description != "" {
+		create.Description = opts.description
+	}
+	if opts.resourceGroup != "" {
+		create.ResourceGroup = opts.resourceGroup
+	}
+	if opts.branch != "" {
+		create.Branch = opts.branch
+	}
+	if opts.terraformVersion != "" {
+		create.TerraformVersion = opts.terraformVersion
+	}
+	for _, tag := range opts.tags {
+		if !source.HasTag(tag) {
+			create.Tags = append(create.Tags, tag)
+		}
+	}
+
+	overridden := map[string]schematics.Variable{}
+	for _, v := range overrides {
+		overridden[v.Name] = v
+	}
+	var missing []string
+	for _, v := range sourceVars {
+		override, ok := overridden[v.Name]
+		if !ok {
+			if v.Secure {
+				missing = append(missing, v.Name)
+			}
+			create.Variables = append(create.Variables, v)
+			continue
+		}
+		delete(overridden, v.Name)
+		if override.Type == "" {
+			override.Type = v.Type
+		}
+		if override.Description == "" {
+			override.Description = v.Description
+		}
+		override.Secure = override.Secure || v.Secure
+		create.Variables = append(create.Variables, override)
+	}
+	if len(missing) > 0 {
+		return create, fmt.Errorf("secure variables %s of workspace %s cannot be copied because Schematics does not return their values; give them with --sensitive-var",
+			strings.Join(missing, ", "), source.ID)
+	}
+	for _, v := range overrides {
+		if last, ok := overridden[v.Name]; ok {
+			create.Variables = append(create.Variables, last)
+			delete(overridden, v.Name)
+		}
+	}
+	return create, nil
+}
+
+// flags of `workspace delete`
+type workspaceDeleteOptions struct {
+	destroyResources bool
+	yes              bool
+}
+
+// Builds the flag set for `workspace delete`.
+func workspaceDeleteFlags(name string) (*flag.FlagSet, *globalOptions, *workspaceDeleteOptions) {
+	fs := newFlagSet(name, name+" <workspace-id> [flags]", "Deletes a Schematics workspace. The id may also be given with --workspace-id or --crn. Asks for confirmation unless --yes is given.")
+	global := &globalOptions{}
+	global.register(fs, true)
+	opts := &workspaceDeleteOptions{}
+	fs.BoolVar(&opts.destroyResources, "destroy-resources", false, "destroy every resource the workspace manages before deleting it")
+	fs.BoolVar(&opts.yes, "yes", false, "delete without asking for confirmation")
+	return fs, global, opts
+}
+
+// `workspace delete <id>`: confirms, then deletes the workspace.
+func runWorkspaceDeleteCommand(name string, args []string) {
+	fs, global, opts := workspaceDeleteFlags(name)
+	switch rest := parseFlagsArgs(fs, args); len(rest) {
+	case 0:
+	case 1:
+		global.workspaceID = rest[0]
+	default:
+		usageError(fs, fmt.Errorf("unexpected argument %q", rest[1]))
+	}
+	if err := global.validate(true); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	wsID := global.workspaceID
+
+	if !opts.yes {
+		question := "Delete workspace " + wsID
+		if ws, err := client.GetWorkspace(ctx, wsID); err == nil && ws.Name != "" {
+			question += " (" + ws.Name + ")"
+		}
+		if opts.destroyResources {
+			question += " and destroy all of its resources"
+		}
+		ok, err := confirm(question+"?", "--yes")
+		if err != nil {
+			fatalCode(exitInvalidInput, err)
+		}
+		if !ok {
+			logger.Error("not confirmed; workspace left in place")
+			exit(exitFailed)
+		}
+	}
+	if err := client.DeleteWorkspace(ctx, wsID, opts.destroyResources); err != nil {
+		fatal(err)
+	}
+	logger.Info("deleted workspace", "id", wsID, "destroy_resources", opts.destroyResources)
+}
+
+// Builds the flag set for `workspace freeze` and `workspace unfreeze`.
+func workspaceFreezeFlags(name string) (*flag.FlagSet, *globalOptions) {
+	fs := newFlagSet(name, name+" <workspace-id> [flags]", "Freezes or unfreezes a Schematics workspace; while frozen, Schematics refuses every job on it. The id may also be given with --workspace-id or --crn.")
+	global := &globalOptions{}
+	global.register(fs, true)
+	return fs, global
+}
+
+// `workspace freeze <id>` and `workspace unfreeze <id>`.
+func runWorkspaceFreezeCommand(name string, args []string) {
+	fs, global := workspaceFreezeFlags(name)
+	switch rest := parseFlagsArgs(fs, args); len(rest) {
+	case 0:
+	case 1:
+		global.workspaceID = rest[0]
+	default:
+		usageError(fs, fmt.Errorf("unexpected argument %q", rest[1]))
+	}
+	if err := global.validate(true); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	frozen := !strings.HasSuffix(name, "unfreeze")
+	if err := client.SetFrozen(ctx, global.workspaceID, frozen); err != nil {
+		fatal(err)
+	}
+	if frozen {
+		logger.Info("froze workspace", "id", global.workspaceID)
+	} else {
+		logger.Info("unfroze workspace", "id", global.workspaceID)
+	}
+}
+
+// Terraform versions as Schematics names them, major and minor only, e.g. 1.6
+var terraformVersionPattern = regexp.MustCompile(`^v?[0-9]+\.[0-9]+$`)
+
+// Checks a Terraform version given on the command line or in a manifest.
+func validateTerraformVersion(version string) error {
+	if !terraformVersionPattern.MatchString(version) {
+		return fmt.Errorf("Terraform version %q: expected major and minor version such as 1.6", version)
+	}
+	return nil
+}
+
+// Builds the flag set for `workspace set-terraform-version`.
+func workspaceSetTerraformVersionFlags(name string) (*flag.FlagSet, *globalOptions) {
+	fs := newFlagSet(name, name+" <workspace-id> <version> [flags]", "Switches every template of a Schematics workspace to a Terraform version such as 1.6; "+
+		"the next job runs with it. Schematics only allows moving to a newer version. The id may also be given with --workspace-id or --crn.")
+	global := &globalOptions{}
+	global.register(fs, true)
+	return fs, global
+}
+
+// `workspace set-terraform-version <id> <version>`.
+func runWorkspaceSetTerraformVersionCommand(name string, args []string) {
+	fs, global := workspaceSetTerraformVersionFlags(name)
+	version := ""
+	switch rest := parseFlagsArgs(fs, args); len(rest) {
+	case 1:
+		version = rest[0]
+	case 2:
+		global.workspaceID, version = rest[0], rest[1]
+	case 0:
+		usageError(fs, errors.New("expected a Terraform version such as 1.6"))
+	default:
+		usageError(fs, fmt.Errorf("unexpected argument %q", rest[2]))
+	}
+	if err := validateTerraformVersion(version); err != nil {
+		usageError(fs, err)
+	}
+	if err := global.validate(true); err != nil {
+		usageError(fs, err)
+	}
+	ctx, client := global.connect()
+	if err := client.SetTerraformVersion(ctx, global.workspaceID, version); err != nil {
+		fatal(err)
+	}
+	logger.Info("set Terraform version", "id", global.workspaceID, "version", strings.TrimPrefix(version, "v"))
+}
+
+// Writes workspaces as a JSON array.
+func writeWorkspacesJSON(out io.Writer, workspaces []schematics.Workspace) error {
+	if workspaces == nil {
+		workspaces = []schematics.Workspace{}
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(workspaces)
+}
+
+// Writes workspaces as an aligned table.
+func writeWorkspacesTable(out io.Writer, workspaces []schematics.Workspace) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSTATUS\tRESOURCE GROUP\tLAST ACTIVITY")
+	for _, ws := range workspaces {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", ws.ID, ws.Name, ws.Status, ws.ResourceGroup, orDash(ws.UpdatedAt))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"schematics-apply-destroy/pkg/schematics"
+	"schematics-apply-destroy/pkg/schematics/schematicstest"
+)
+
+// the arguments, separated by U+001F, that runMain's child process runs main with
+const runMainEnv = "SCHEMATICS_APPLY_DESTROY_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv(runMainEnv); ok {
+		os.Args = append([]string{"schematics-apply-destroy"}, strings.Split(args, "\x1f")...)
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+// Runs the command line args against srv in a child process, since commands end the process, and returns its exit
+// status and stderr.
+func runMain(t *testing.T, srv *schematicstest.Server, args ...string) (int, string) {
+	t.Helper()
+	args = append(args, "--iam-endpoint", srv.URL, "--schematics-endpoint", srv.URL, "--ibmcloud-config=false")
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), runMainEnv+"="+strings.Join(args, "\x1f"), apiKeyEnv+"="+schematicstest.APIKey, "HOME="+t.TempDir())
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), stderr.String()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exitOK, stderr.String()
+}
+
+func TestWorkspaceDeletePositionalID(t *testing.T) {
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo"})
+
+	if code, stderr := runMain(t, srv, "workspace", "delete", ws.ID, "--yes"); code != exitOK {
+		t.Fatalf("workspace delete %s exited %d: %s", ws.ID, code, stderr)
+	}
+	if _, ok := srv.Workspace(ws.ID); ok {
+		t.Errorf("workspace %s still exists", ws.ID)
+	}
+}
+
+func TestWorkspaceSetTerraformVersionPositionalID(t *testing.T) {
+	srv := schematicstest.NewServer()
+	defer srv.Close()
+	ws := srv.AddWorkspace(schematics.Workspace{Name: "demo", Templates: []schematics.WorkspaceTemplate{{ID: "t1", Type: "terraform_v1.5"}}})
+
+	if code, stderr := runMain(t, srv, "workspace", "set-terraform-version", ws.ID, "1.6"); code != exitOK {
+		t.Fatalf("workspace set-terraform-version %s 1.6 exited %d: %s", ws.ID, code, stderr)
+	}
+	if got, _ := srv.Workspace(ws.ID); len(got.Templates) != 1 || got.Templates[0].Type != "terraform_v1.6" {
+		t.Errorf("templates = %+v, want terraform_v1.6", got.Templates)
+	}
+}
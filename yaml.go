@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A value from the small YAML subset the config files use: a scalar, a mapping or a list.
+type yamlNode struct {
+	Line   int
+	Scalar string
+	Map    map[string]*yamlNode
+	Keys   []string // mapping keys in file order
+	List   []*yamlNode
+}
+
+// one meaningful line of a YAML document
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// Parses a YAML document made of nested `key: value` mappings and `- item` lists with plain or quoted scalars,
+// [a, b] lists of scalars and # comments. Anything else, such as anchors, multi-line strings or flow mappings,
+// is rejected with the offending line number.
+func parseYAML(data []byte) (*yamlNode, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(raw, " \r")
+		trimmed := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		lines = append(lines, yamlLine{number: i + 1, indent: len(raw) - len(trimmed), text: trimmed})
+	}
+	root := &yamlNode{Line: 1, Map: map[string]*yamlNode{}}
+	if len(lines) == 0 {
+		return root, nil
+	}
+	rest, err := parseYAMLMapping(root, lines, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("line %d: unexpected indentation", rest[0].number)
+	}
+	return root, nil
+}
+
+// Fills node with the mapping entries at indent and returns the lines after it.
+func parseYAMLMapping(node *yamlNode, lines []yamlLine, indent int) ([]yamlLine, error) {
+	for len(lines) > 0 {
+		line := lines[0]
+		if line.indent < indent {
+			return lines, nil
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.number)
+		}
+		if isYAMLListItem(line.text) {
+			return nil, fmt.Errorf("line %d: expected `key: value`, not a list item", line.number)
+		}
+		key, value, ok := strings.Cut(line.text, ":")
+		if !ok || (value != "" && value[0] != ' ') {
+			return nil, fmt.Errorf("line %d: expected `key: value`", line.number)
+		}
+		key = strings.TrimSpace(key)
+		if _, dup := node.Map[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.number, key)
+		}
+		child := &yamlNode{Line: line.number}
+		lines = lines[1:]
+		if value = strings.TrimSpace(value); strings.HasPrefix(value, "#") {
+			// `key: # comment` introduces a nested value like `key:`
+			value = ""
+		}
+		if strings.HasPrefix(value, "[") {
+			list, err := parseYAMLFlowList(line.number, value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line.number, err)
+			}
+			child.List = list
+		} else if value != "" {
+			scalar, err := parseYAMLScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line.number, err)
+			}
+			child.Scalar = scalar
+		} else if len(lines) > 0 && lines[0].indent >= indent && isYAMLListItem(lines[0].text) {
+			// a list may sit at the same indentation as its key
+			var err error
+			if lines, err = parseYAMLList(child, lines, lines[0].indent); err != nil {
+				return nil, err
+			}
+		} else if len(lines) > 0 && lines[0].indent > indent {
+			child.Map = map[string]*yamlNode{}
+			var err error
+			if lines, err = parseYAMLMapping(child, lines, lines[0].indent); err != nil {
+				return nil, err
+			}
+		}
+		node.Map[key] = child
+		node.Keys = append(node.Keys, key)
+	}
+	return lines, nil
+}
+
+// Fills node with the `- item` entries at indent and returns the lines after them. An item is a scalar, a mapping
+// starting on the dash line and continuing at the indentation of its first key, or a nested list.
+func parseYAMLList(node *yamlNode, lines []yamlLine, indent int) ([]yamlLine, error) {
+	node.List = []*yamlNode{}
+	for len(lines) > 0 && lines[0].indent == indent && isYAMLListItem(lines[0].text) {
+		line := lines[0]
+		item := &yamlNode{Line: line.number}
+		text := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if strings.HasPrefix(text, "#") {
+			text = ""
+		}
+		// the item's content, as if it were on a line of its own
+		inner := yamlLine{number: line.number, indent: indent + len(line.text) - len(text), text: text}
+		var err error
+		switch {
+		case text == "":
+			lines = lines[1:]
+			if len(lines) > 0 && lines[0].indent > indent {
+				if isYAMLListItem(lines[0].text) {
+					lines, err = parseYAMLList(item, lines, lines[0].indent)
+				} else {
+					item.Map = map[string]*yamlNode{}
+					lines, err = parseYAMLMapping(item, lines, lines[0].indent)
+				}
+			}
+		case isYAMLListItem(text):
+			lines, err = parseYAMLList(item, append([]yamlLine{inner}, lines[1:]...), inner.indent)
+		case isYAMLMappingLine(text):
+			item.Map = map[string]*yamlNode{}
+			lines, err = parseYAMLMapping(item, append([]yamlLine{inner}, lines[1:]...), inner.indent)
+		case strings.HasPrefix(text, "["):
+			item.List, err = parseYAMLFlowList(line.number, text)
+			lines = lines[1:]
+		default:
+			item.Scalar, err = parseYAMLScalar(text)
+			if err != nil {
+				err = fmt.Errorf("line %d: %w", line.number, err)
+			}
+			lines = lines[1:]
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.List = append(node.List, item)
+	}
+	if len(lines) > 0 && lines[0].indent > indent {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[0].number)
+	}
+	return lines, nil
+}
+
+// Parses a one-line list of scalars such as [network, "cluster"].
+func parseYAMLFlowList(lineNumber int, value string) ([]*yamlNode, error) {
+	// the items, split at the commas outside quotes, up to the closing bracket
+	var items []string
+	end := -1
+	start := 1
+	for i := 1; i < len(value) && end < 0; i++ {
+		switch value[i] {
+		case '"', '\'':
+			closing := closingQuote(value[i:])
+			if closing < 0 {
+				return nil, fmt.Errorf("unterminated string in %s", value)
+			}
+			i += closing
+		case '[', '{':
+			return nil, fmt.Errorf("nested collections are not supported in %s", value)
+		case ',':
+			items = append(items, value[start:i])
+			start = i + 1
+		case ']':
+			items = append(items, value[start:i])
+			end = i
+		}
+	}
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated list %s", value)
+	}
+	if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+		return nil, fmt.Errorf("unexpected text after list: %s", rest)
+	}
+	list := []*yamlNode{}
+	if len(items) == 1 && strings.TrimSpace(items[0]) == "" {
+		return list, nil
+	}
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return nil, fmt.Errorf("empty list item in %s", value)
+		}
+		scalar, err := parseYAMLScalar(item)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, &yamlNode{Line: lineNumber, Scalar: scalar})
+	}
+	return list, nil
+}
+
+// Reports whether text starts a list item.
+func isYAMLListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// Reports whether text is a `key: value` or `key:` line rather than a scalar.
+func isYAMLMappingLine(text string) bool {
+	if text[0] == '"' || text[0] == '\'' {
+		return false
+	}
+	key, value, ok := strings.Cut(text, ":")
+	return ok && key != "" && (value == "" || value[0] == ' ') && !strings.Contains(key, " #")
+}
+
+// Unquotes a scalar and strips a trailing comment from a plain one.
+func parseYAMLScalar(value string) (string, error) {
+	switch value[0] {
+	case '"', '\'':
+		end := closingQuote(value)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected text after string: %s", rest)
+		}
+		if value[0] == '\'' {
+			return strings.ReplaceAll(value[1:end], "''", "'"), nil
+		}
+		return strconv.Unquote(value[:end+1])
+	case '[', '{', '&', '*', '|', '>':
+		return "", fmt.Errorf("unsupported YAML syntax %s", value)
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
+
+// Returns the index of the quote closing the string value starts with, or -1 when it isn't closed. A double-quoted
+// string escapes with a backslash, a single-quoted one by doubling the quote.
+func closingQuote(value string) int {
+	quote := value[0]
+	for i := 1; i < len(value); i++ {
+		switch {
+		case quote == '"' && value[i] == '\\':
+			i++
+		case value[i] == quote && quote == '\'' && i+1 < len(value) && value[i+1] == '\'':
+			i++
+		case value[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
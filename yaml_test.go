@@ -0,0 +1,159 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Renders node compactly, e.g. {a: "1", b: ["x", "y"]}, for comparing parse results.
+func renderYAML(node *yamlNode) string {
+	switch {
+	case node.Map != nil:
+		parts := make([]string, len(node.Keys))
+		for i, key := range node.Keys {
+			parts[i] = key + ": " + renderYAML(node.Map[key])
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case node.List != nil:
+		parts := make([]string, len(node.List))
+		for i, item := range node.List {
+			parts[i] = renderYAML(item)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return strconv.Quote(node.Scalar)
+}
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"empty", "", "{}"},
+		{"comments only", "# a\n---\n  # b\n", "{}"},
+		{"scalars", "a: 1\nb: two words\nc:\n", `{a: "1", b: "two words", c: ""}`},
+		{"plain comment", "a: x # a comment\nb: x#not a comment", `{a: "x", b: "x#not a comment"}`},
+		{"double quoted", `a: "x: y # z"`, `{a: "x: y # z"}`},
+		{"double quoted escapes", `a: "tab\t \"q\" back\\"`, `{a: "tab\t \"q\" back\\"}`},
+		{"quote in comment", `a: "x" # say "hi"`, `{a: "x"}`},
+		{"single quoted", `a: 'it''s # here' # it's a comment`, `{a: "it's # here"}`},
+		{"quote in comment after single", `a: 'x' # say 'hi'`, `{a: "x"}`},
+		{"empty strings", `a: ""` + "\nb: ''", `{a: "", b: ""}`},
+		{"nested mapping", "a:\n  b:\n    c: 1\n  d: 2\ne: 3", `{a: {b: {c: "1"}, d: "2"}, e: "3"}`},
+		{"comment after key", "a: # the children\n  b: 1", `{a: {b: "1"}}`},
+		{"key order", "z: 1\na: 2\nm: 3", `{z: "1", a: "2", m: "3"}`},
+		{"flow list", `a: [x, "y, z", 'w]']`, `{a: ["x", "y, z", "w]"]}`},
+		{"empty flow list", "a: []\nb: [ ]", `{a: [], b: []}`},
+		{"flow list with comment", `a: [x, y] # see [docs], "more"`, `{a: ["x", "y"]}`},
+		{"block list", "a:\n  - x\n  - 'y'\n", `{a: ["x", "y"]}`},
+		{"list at key indentation", "a:\n- x\n- y\nb: 1", `{a: ["x", "y"], b: "1"}`},
+		{"list item comment", "a:\n  - x # first\n  - # empty\n", `{a: ["x", ""]}`},
+		{"list of mappings", "steps:\n  - name: net\n    after: [a, b]\n  - name: app\n    vars:\n      size: 2\n",
+			`{steps: [{name: "net", after: ["a", "b"]}, {name: "app", vars: {size: "2"}}]}`},
+		{"mapping item on next line", "a:\n  -\n    b: 1\n    c: 2", `{a: [{b: "1", c: "2"}]}`},
+		{"nested lists", "a:\n  - - x\n    - y\n  -\n    - z", `{a: [["x", "y"], ["z"]]}`},
+		{"list in list mapping", "a:\n  - b:\n      - x\n    c: 1", `{a: [{b: ["x"], c: "1"}]}`},
+		{"quoted list item with colon", `a:` + "\n" + `  - "b: c"`, `{a: ["b: c"]}`},
+		{"indented document", "  a: 1\n  b:\n    c: 2", `{a: "1", b: {c: "2"}}`},
+		{"windows line endings", "a: 1\r\nb: 2\r\n", `{a: "1", b: "2"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, err := parseYAML([]byte(test.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := renderYAML(root); got != test.want {
+				t.Errorf("got  %s\nwant %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLLines(t *testing.T) {
+	root, err := parseYAML([]byte("# header\n\na: 1\nb:\n  - x\n\n  - c: 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Map["a"].Line != 3 || root.Map["b"].Line != 4 || root.Map["b"].List[0].Line != 5 || root.Map["b"].List[1].Map["c"].Line != 7 {
+		t.Errorf("line numbers: a %d, b %d, b[0] %d, b[1].c %d; want 3, 4, 5, 7", root.Map["a"].Line, root.Map["b"].Line,
+			root.Map["b"].List[0].Line, root.Map["b"].List[1].Map["c"].Line)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"tab indentation", "a:\n\tb: 1", "line 2: tabs are not allowed"},
+		{"over-indented key", "a: 1\n  b: 2", "line 2: unexpected indentation"},
+		{"under-indented key", "  a: 1\nb: 2", "line 2: unexpected indentation"},
+		{"under-indented nested key", "a:\n    b: 1\n  c: 2", "line 3: unexpected indentation"},
+		{"under-indented list mapping", "a:\n  - b: 1\n   c: 2", "line 3: unexpected indentation"},
+		{"over-indented list item", "a:\n  - x\n    - y", "line 3: unexpected indentation"},
+		{"not a mapping", "just text", "line 1: expected `key: value`"},
+		{"no space after colon", "a:b", "line 1: expected `key: value`"},
+		{"list at the top", "- a", "line 1: expected `key: value`, not a list item"},
+		{"duplicate key", "a: 1\na: 2", `line 2: duplicate key "a"`},
+		{"unterminated double", `a: "x`, "line 1: unterminated string"},
+		{"escaped quote only", `a: "x\"`, "line 1: unterminated string"},
+		{"unterminated single", `a: 'it''s`, "line 1: unterminated string"},
+		{"text after string", `a: "x" y`, "line 1: unexpected text after string: y"},
+		{"invalid escape", `a: "\q"`, "line 1: invalid syntax"},
+		{"unterminated list", "a: [x, y", "line 1: unterminated list"},
+		{"text after list", "a: [x] y", "line 1: unexpected text after list: y"},
+		{"empty list item", "a: [x, , y]", "line 1: empty list item"},
+		{"nested flow list", "a: [[x]]", "line 1: nested collections are not supported"},
+		{"flow mapping", "a: {b: 1}", "line 1: unsupported YAML syntax"},
+		{"anchor", "a: &x 1", "line 1: unsupported YAML syntax"},
+		{"block scalar", "a: |\n  text", "line 1: unsupported YAML syntax"},
+		{"bad list item", "a:\n  - \"x", "line 2: unterminated string"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseYAML([]byte(test.yaml))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("error = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func FuzzParseYAML(f *testing.F) {
+	for _, seed := range []string{
+		"a: 1\nb: [x, 'y']\n",
+		"steps:\n  - name: net\n    after: [a]\n  - - x\n",
+		`a: "x" # say "hi"`,
+		"a: 'it''s'\nb:\n  c: # comment\n    d: 2\n",
+		"a:\n- x\n-\n  b: 1\n",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data string) {
+		root, err := parseYAML([]byte(data))
+		if err != nil {
+			return
+		}
+		// every node of a parsed document is exactly one of a scalar, a mapping or a list
+		var check func(node *yamlNode)
+		check = func(node *yamlNode) {
+			if node.Map != nil && node.List != nil {
+				t.Fatalf("node on line %d is both a mapping and a list", node.Line)
+			}
+			if len(node.Keys) != len(node.Map) {
+				t.Fatalf("node on line %d has %d keys for %d entries", node.Line, len(node.Keys), len(node.Map))
+			}
+			for _, key := range node.Keys {
+				check(node.Map[key])
+			}
+			for _, item := range node.List {
+				check(item)
+			}
+		}
+		check(root)
+	})
+}